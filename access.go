@@ -0,0 +1,59 @@
+package stb
+
+// AccessList lists users and chats, see Settings.Allow and Settings.Deny.
+type AccessList struct {
+	Users []int
+	Chats []int64
+}
+
+// has reports whether the user or the chat is on the list.
+func (l *AccessList) has(user *User, chat *Chat) bool {
+	if user != nil {
+		for _, id := range l.Users {
+			if id == user.ID {
+				return true
+			}
+		}
+	}
+	if chat != nil {
+		for _, id := range l.Chats {
+			if id == chat.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// admitted reports whether the update passes the allow and
+// deny lists, calling the OnRejected hook if it does not.
+// Updates from neither a user nor a chat are admitted.
+func (b *Bot) admitted(upd Update) bool {
+	if b.allow == nil && b.deny == nil {
+		return true
+	}
+
+	user, _ := b.recognizer(upd)
+	chat := updateChat(upd)
+	if user == nil && chat == nil {
+		return true
+	}
+
+	if (b.allow == nil || b.allow.has(user, chat)) &&
+		(b.deny == nil || !b.deny.has(user, chat)) {
+		return true
+	}
+
+	if b.onRejected != nil {
+		if b.synchronous {
+			b.onRejected(upd)
+		} else {
+			b.inflight.Add(1)
+			go func() {
+				defer b.inflight.Done()
+				b.onRejected(upd)
+			}()
+		}
+	}
+	return false
+}
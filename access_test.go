@@ -0,0 +1,37 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotAccessLists(t *testing.T) {
+	var rejected []int
+	b, err := NewBot(Settings{
+		Synchronous: true,
+		Offline:     true,
+		Allow:       &AccessList{Users: []int{1, 2}, Chats: []int64{-100}},
+		Deny:        &AccessList{Users: []int{2}},
+		OnRejected:  func(upd Update) { rejected = append(rejected, upd.Message.Sender.ID) },
+	})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	var got []int
+	b.Handle(OnText, func(msg *Message, _ *Machine) { got = append(got, msg.Sender.ID) })
+
+	send := func(user int, chat int64) {
+		b.ProcessUpdate(Update{Message: &Message{Text: "hi", Sender: &User{ID: user}, Chat: &Chat{ID: chat}}})
+	}
+	send(1, 1)
+	send(2, 2)
+	send(3, 3)
+	send(3, -100)
+	send(2, -100)
+
+	assert.Equal(t, []int{1, 3}, got)
+	assert.Equal(t, []int{2, 3, 2}, rejected)
+	assert.Equal(t, 2, b.Machines().Len())
+}
@@ -273,3 +273,52 @@ func (b *Bot) SetAdminTitle(chat *Chat, user *User, title string) error {
 	_, err := b.Raw("setChatAdministratorCustomTitle", params)
 	return err
 }
+
+// ChatJoinRequest represents a join request sent to a chat.
+type ChatJoinRequest struct {
+	// Chat to which the request was sent.
+	Chat Chat `json:"chat"`
+
+	// User that sent the join request.
+	From User `json:"from"`
+
+	// Identifier of a private chat with the user, the bot
+	// can write to it until the request is processed.
+	UserChatID int64 `json:"user_chat_id"`
+
+	// Unixtime, use ChatJoinRequest.Time() to get time.Time
+	Unixtime int64 `json:"date"`
+
+	// (Optional) Bio of the user.
+	Bio string `json:"bio,omitempty"`
+
+	// (Optional) InviteLink which was used by the user to send the join request.
+	InviteLink *ChatInviteLink `json:"invite_link,omitempty"`
+}
+
+// Time returns the moment of the request in local time.
+func (r *ChatJoinRequest) Time() time.Time {
+	return time.Unix(r.Unixtime, 0)
+}
+
+// ApproveJoinRequest approves a chat join request.
+func (b *Bot) ApproveJoinRequest(chat Recipient, user *User) error {
+	params := map[string]string{
+		"chat_id": chat.Recipient(),
+		"user_id": user.Recipient(),
+	}
+
+	_, err := b.Raw("approveChatJoinRequest", params)
+	return err
+}
+
+// DeclineJoinRequest declines a chat join request.
+func (b *Bot) DeclineJoinRequest(chat Recipient, user *User) error {
+	params := map[string]string{
+		"chat_id": chat.Recipient(),
+		"user_id": user.Recipient(),
+	}
+
+	_, err := b.Raw("declineChatJoinRequest", params)
+	return err
+}
@@ -0,0 +1,33 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatJoinRequest(t *testing.T) {
+	api := newFakeAPI(t, `{"message_id":1}`)
+	b, err := NewBot(api.Settings())
+	require.NoError(t, err)
+
+	b.Default(Default).Handle(OnChatJoinRequest, func(r *ChatJoinRequest, m *Machine) error {
+		if _, err := m.Send("welcome"); err != nil {
+			return err
+		}
+		return m.Approve(r)
+	})
+
+	b.ProcessUpdate(Update{ChatJoinRequest: &ChatJoinRequest{
+		Chat:       Chat{ID: -100},
+		From:       User{ID: 1},
+		UserChatID: 1,
+	}})
+
+	var calls []string
+	for _, call := range api.Calls() {
+		calls = append(calls, call.Method+" "+call.Param("chat_id"))
+	}
+	assert.Equal(t, []string{"sendMessage 1", "approveChatJoinRequest -100"}, calls)
+}
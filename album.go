@@ -0,0 +1,64 @@
+package stb
+
+import (
+	"sync"
+	"time"
+)
+
+// albums collects the messages of media groups, which
+// Telegram delivers as separate updates, until no new
+// part arrived for the wait.
+type albums struct {
+	mu      sync.Mutex
+	wait    time.Duration
+	pending map[string]*album
+	enabled bool
+}
+
+type album struct {
+	upd   Update
+	msgs  []*Message
+	timer *time.Timer
+}
+
+// collect buffers the update if it is a part of an album and
+// reports whether it did. flush is called with the whole album,
+// inflight counts the albums waiting for it.
+func (a *albums) collect(upd Update, inflight *sync.WaitGroup, flush func(Update)) bool {
+	if upd.Message == nil || upd.Message.AlbumID == "" {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.enabled {
+		return false
+	}
+
+	id := upd.Message.AlbumID
+	// once the timer fired, the album is on its way and
+	// a late part starts a new one
+	if p, ok := a.pending[id]; ok && p.timer.Stop() {
+		p.msgs = append(p.msgs, upd.Message)
+		p.timer.Reset(a.wait)
+		return true
+	}
+
+	p := &album{upd: upd, msgs: []*Message{upd.Message}}
+	inflight.Add(1)
+	p.timer = time.AfterFunc(a.wait, func() {
+		defer inflight.Done()
+
+		a.mu.Lock()
+		if a.pending[id] == p {
+			delete(a.pending, id)
+		}
+		a.mu.Unlock()
+
+		p.upd.album = p.msgs
+		flush(p.upd)
+	})
+	a.pending[id] = p
+	return true
+}
@@ -0,0 +1,93 @@
+package stb
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlbum(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, AlbumWait: 20 * time.Millisecond})
+	require.NoError(t, err)
+
+	var (
+		mu     sync.Mutex
+		albums = make(map[string]int)
+		photos []*Message
+	)
+	b.Default(Default).Handle(OnPhoto, func(msg *Message, _ *Machine) {
+		photos = append(photos, msg)
+	})
+
+	user := &User{ID: 1}
+	part := func(id int, album string) Update {
+		return Update{ID: id, Message: &Message{ID: id, AlbumID: album, Sender: user, Photo: &Photo{}}}
+	}
+
+	// without OnAlbum the parts are handled right away
+	b.ProcessUpdate(part(1, "a"))
+	assert.Len(t, photos, 1)
+
+	b.State("Albums").Handle(OnAlbum, func(msgs []*Message, _ *Machine) {
+		mu.Lock()
+		albums[msgs[0].AlbumID] = len(msgs)
+		mu.Unlock()
+	})
+	b.Event("albums", "Albums")
+	require.NoError(t, b.machine(user).SendEvent("albums"))
+
+	b.ProcessUpdate(part(2, "b"))
+	b.ProcessUpdate(part(3, "b"))
+	b.ProcessUpdate(part(4, "c"))
+	b.ProcessUpdate(Update{ID: 5, Message: &Message{Text: "hi", Sender: user}})
+	b.inflight.Wait()
+
+	assert.Equal(t, map[string]int{"b": 2, "c": 1}, albums)
+	assert.Len(t, photos, 1)
+
+}
+
+func TestAlbumSynchronous(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, AlbumWait: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	var (
+		mu      sync.Mutex
+		running bool
+		overlap bool
+	)
+	enter := func() {
+		mu.Lock()
+		overlap = overlap || running
+		running = true
+		mu.Unlock()
+	}
+	leave := func() {
+		mu.Lock()
+		running = false
+		mu.Unlock()
+	}
+
+	s := b.Default(Default)
+	s.Handle(OnAlbum, func([]*Message, *Machine) {
+		enter()
+		defer leave()
+	})
+	s.Handle(OnText, func(*Message, *Machine) {
+		enter()
+		defer leave()
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	// the album is complete while the text is handled,
+	// and waits for it
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{ID: 1, Message: &Message{ID: 1, AlbumID: "a", Sender: user, Photo: &Photo{}}})
+	b.ProcessUpdate(Update{ID: 2, Message: &Message{ID: 2, Text: "hi", Sender: user}})
+	b.inflight.Wait()
+
+	assert.False(t, overlap)
+}
@@ -0,0 +1,112 @@
+package stb
+
+import (
+	"sort"
+	"strings"
+)
+
+// updateTypes maps the endpoints to the update types feeding them.
+// Any other endpoint is fed by messages.
+var updateTypes = map[string][]string{
+	OnEdited:                  {"edited_message"},
+	OnChannelPost:             {"channel_post"},
+	OnEditedChannelPost:       {"edited_channel_post"},
+	OnPinned:                  {"message", "channel_post"},
+	OnLiveLocation:            {"message", "edited_message"},
+	OnCallback:                {"callback_query"},
+	OnQuery:                   {"inline_query"},
+	OnChosenInlineResult:      {"chosen_inline_result"},
+	OnShipping:                {"shipping_query"},
+	OnCheckout:                {"pre_checkout_query"},
+	OnPaidMediaPurchased:      {"purchased_paid_media"},
+	OnBusinessConnection:      {"business_connection"},
+	OnBusinessMessage:         {"business_message"},
+	OnEditedBusinessMessage:   {"edited_business_message"},
+	OnDeletedBusinessMessages: {"deleted_business_messages"},
+	OnChatBoost:               {"chat_boost"},
+	OnChatBoostRemoved:        {"removed_chat_boost"},
+	OnPoll:                    {"poll"},
+	OnPollAnswer:              {"poll_answer"},
+	OnMyChatMember:            {"my_chat_member"},
+	OnChatMember:              {"chat_member"},
+	OnChatJoinRequest:         {"chat_join_request"},
+	OnReaction:                {"message_reaction"},
+	OnReactionCount:           {"message_reaction_count"},
+	OnBotBlocked:              {"my_chat_member"},
+	OnBotUnblocked:            {"my_chat_member"},
+	OnExpire:                  nil,
+}
+
+// optInUpdates are the update types Telegram sends
+// only when they are asked for explicitly.
+var optInUpdates = map[string]bool{
+	"chat_member":            true,
+	"message_reaction":       true,
+	"message_reaction_count": true,
+}
+
+// AllowedUpdates returns the update types the handlers registered
+// in all the states need, sorted. Messages, my_chat_member updates
+// and the answers to polls sent by the bot are always included,
+// as the machines rely on them, and so are chat_member updates
+// with Settings.Members.
+//
+// Middleware and OnAnyUpdate or OnEveryUpdate handlers may look at
+// any update, so with them every update type is included, except the
+// chat_member and reaction updates Telegram only sends on request:
+// those need a handler of their own.
+//
+// With Settings.NarrowUpdates, LongPoller and Webhook ask Telegram
+// for these update types only, unless their AllowedUpdates are set.
+// The webhook is set again by Reload, for the new handlers.
+func (b *Bot) AllowedUpdates() []string {
+	allowed := map[string]bool{
+		"message":        true,
+		"my_chat_member": true,
+		"poll_answer":    true,
+	}
+
+	states, _ := b.config()
+	everything := len(b.middleware) > 0
+	for _, state := range states {
+		if len(state.middleware) > 0 {
+			everything = true
+		}
+		for end := range state.handlers {
+			switch types, ok := updateTypes[end]; {
+			case end == OnAnyUpdate || end == OnEveryUpdate:
+				everything = true
+			case ok:
+				for _, t := range types {
+					allowed[t] = true
+				}
+			case strings.HasPrefix(end, "\f"):
+				allowed["callback_query"] = true
+			}
+		}
+	}
+
+	if everything {
+		for _, types := range updateTypes {
+			for _, t := range types {
+				if !optInUpdates[t] {
+					allowed[t] = true
+				}
+			}
+		}
+		allowed["callback_query"] = true
+	}
+	if b.routeEdits {
+		allowed["edited_message"] = true
+	}
+	if b.members != nil {
+		allowed["chat_member"] = true
+	}
+
+	types := make([]string, 0, len(allowed))
+	for t := range allowed {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
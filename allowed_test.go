@@ -0,0 +1,65 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotAllowedUpdates(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	b.Handle("/start", func(*Message, *Machine) {})
+	assert.Equal(t, []string{"message", "my_chat_member", "poll_answer"}, b.AllowedUpdates())
+
+	b.State("Menu").Handle(&InlineButton{Unique: "buy"}, func(*Callback, *Machine) {})
+	b.Handle(OnChatMember, func(*ChatMemberUpdated, *Machine) {})
+	assert.Equal(t, []string{
+		"callback_query", "chat_member", "message", "my_chat_member", "poll_answer",
+	}, b.AllowedUpdates())
+
+	b.Handle(OnAnyUpdate, func(*Update, *Machine) {})
+	allowed := b.AllowedUpdates()
+	assert.Contains(t, allowed, "inline_query")
+	assert.Contains(t, allowed, "chat_member")
+	assert.NotContains(t, allowed, "message_reaction")
+}
+
+func TestBotNarrowUpdates(t *testing.T) {
+	var allowed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		json.NewDecoder(r.Body).Decode(&params)
+		allowed = append(allowed, params["allowed_updates"])
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+	require.NoError(t, b.SetWebhook(&Webhook{}))
+	assert.Equal(t, []string{""}, allowed)
+
+	allowed = nil
+	b, err = NewBot(Settings{Offline: true, URL: srv.URL, NarrowUpdates: true})
+	require.NoError(t, err)
+	b.Default(Default)
+	b.webhook = &Webhook{}
+	require.NoError(t, b.SetWebhook(b.webhook))
+
+	// reloading sets the webhook again for the new handlers
+	require.NoError(t, b.Reload(func(b *Bot) error {
+		b.Default(Default)
+		b.Handle(OnChatMember, func(*ChatMemberUpdated, *Machine) {})
+		return nil
+	}, nil))
+	assert.Equal(t, []string{
+		`["message","my_chat_member","poll_answer"]`,
+		`["chat_member","message","my_chat_member","poll_answer"]`,
+	}, allowed)
+}
@@ -0,0 +1,130 @@
+package stb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Flood is the event AntiFlood conventionally sends
+// to the machines of flooding users.
+const Flood EventType = "flood"
+
+// AntiFlood returns middleware that lets each user send at most
+// limit updates within any window of the given length. Updates over
+// the limit are dropped. If event is not empty, it is sent to the
+// machine of the user when they go over the limit, once until they
+// calm down again, so the flow can react, e.g. move to a Muted state.
+// Rejected events are not an error, the flow may ignore floods
+// in some states. Updates without a user are let through.
+//
+// Example:
+//
+//     b.Use(b.AntiFlood(20, time.Minute, stb.Flood))
+//
+//     b.Event(stb.Flood, Muted)
+//
+func (b *Bot) AntiFlood(limit int, window time.Duration, event EventType) MiddlewareFunc {
+	f := &floodGuard{
+		limit:  limit,
+		window: window,
+		users:  make(map[int]*floodCount),
+	}
+
+	return func(next UpdateHandler) UpdateHandler {
+		return func(upd Update) {
+			user, _ := b.recognizer(upd)
+			if user == nil {
+				next(upd)
+				return
+			}
+
+			allowed, flooding := f.hit(user.ID, time.Now())
+			if allowed {
+				next(upd)
+				return
+			}
+			if !flooding || event == "" {
+				return
+			}
+			if id := b.scope(upd); id != "" {
+				err := b.machines.obtain(id, user).SendEvent(event)
+				if err != nil && err != ErrEventRejected {
+					b.debug(errors.Wrap(err, "stb: sending flood event"))
+				}
+			}
+		}
+	}
+}
+
+// floodGuard counts the updates of each user in a sliding window.
+type floodGuard struct {
+	limit  int
+	window time.Duration
+
+	mu    sync.Mutex
+	users map[int]*floodCount
+	swept time.Time
+}
+
+type floodCount struct {
+	hits     []time.Time
+	flooding bool
+}
+
+// hit counts an update of the user. It reports whether the update
+// is within the limit and, if not, whether the user just went over it.
+func (f *floodGuard) hit(user int, now time.Time) (allowed, flooding bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sweep(now)
+
+	c := f.users[user]
+	if c == nil {
+		c = &floodCount{}
+		f.users[user] = c
+	}
+	c.expire(now, f.window)
+
+	if len(c.hits) < f.limit {
+		c.hits = append(c.hits, now)
+		c.flooding = false
+		return true, false
+	}
+
+	// Dropped updates keep the window full,
+	// so users have to stop to get through again.
+	if len(c.hits) > 0 {
+		c.hits = c.hits[1:]
+	}
+	c.hits = append(c.hits, now)
+	if c.flooding {
+		return false, false
+	}
+	c.flooding = true
+	return false, true
+}
+
+// expire forgets the hits older than the window.
+func (c *floodCount) expire(now time.Time, window time.Duration) {
+	i := 0
+	for i < len(c.hits) && now.Sub(c.hits[i]) >= window {
+		i++
+	}
+	c.hits = c.hits[i:]
+}
+
+// sweep forgets the users that were quiet for a whole window.
+func (f *floodGuard) sweep(now time.Time) {
+	if now.Sub(f.swept) < f.window {
+		return
+	}
+	f.swept = now
+	for user, c := range f.users {
+		if c.expire(now, f.window); len(c.hits) == 0 {
+			delete(f.users, user)
+		}
+	}
+}
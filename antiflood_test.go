@@ -0,0 +1,56 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotAntiFlood(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+	b.Default(Default)
+	b.State("Muted")
+	b.Event(Flood, "Muted")
+	b.Use(b.AntiFlood(2, time.Hour, Flood))
+
+	var got []string
+	b.Handle(OnText, func(msg *Message, m *Machine) {
+		got = append(got, msg.Text)
+	})
+
+	user := &User{ID: 1}
+	for _, text := range []string{"a", "b", "c", "d"} {
+		b.ProcessUpdate(Update{Message: &Message{Text: text, Sender: user, Chat: &Chat{ID: 1}}})
+	}
+	b.ProcessUpdate(Update{Message: &Message{Text: "e", Sender: &User{ID: 2}, Chat: &Chat{ID: 2}}})
+
+	assert.Equal(t, []string{"a", "b", "e"}, got)
+	assert.Equal(t, StateType("Muted"), b.machine(user).Current())
+	assert.Equal(t, Default, b.machine(&User{ID: 2}).Current())
+}
+
+func TestFloodGuard(t *testing.T) {
+	f := &floodGuard{limit: 2, window: time.Minute, users: make(map[int]*floodCount)}
+	now := time.Now()
+	at := func(s int) time.Time { return now.Add(time.Duration(s) * time.Second) }
+
+	hit := func(s int) [2]bool {
+		allowed, flooding := f.hit(1, at(s))
+		return [2]bool{allowed, flooding}
+	}
+	assert.Equal(t, [2]bool{true, false}, hit(0))
+	assert.Equal(t, [2]bool{true, false}, hit(10))
+	assert.Equal(t, [2]bool{false, true}, hit(20))
+	assert.Equal(t, [2]bool{false, false}, hit(30))
+
+	// the dropped updates at 20 and 30 keep the window full
+	assert.Equal(t, [2]bool{false, false}, hit(70))
+	assert.Equal(t, [2]bool{true, false}, hit(100))
+	assert.Equal(t, [2]bool{false, true}, hit(101))
+
+	f.sweep(at(300))
+	assert.Empty(t, f.users)
+}
@@ -10,16 +10,67 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Raw lets you call any method of Bot API manually.
 // It also handles API errors, so you only need to unwrap
 // result field from json data.
 func (b *Bot) Raw(method string, payload interface{}) ([]byte, error) {
-	url := b.URL + "/bot" + b.Token + "/" + method
+	chatID := payloadChat(payload)
+
+	var floods, failures int
+	for {
+		if b.limiter != nil {
+			b.limiter.wait(method, chatID)
+		}
+
+		start := time.Now()
+		data, err := b.callAPI(method, payload, func(payload interface{}) ([]byte, error) {
+			return b.raw(method, payload)
+		})
+		b.observeAPI(method, time.Since(start), err)
+		if err == nil {
+			return data, nil
+		}
+
+		if flood, ok := err.(FloodError); ok && b.limiter != nil && floods < b.limiter.Retries {
+			floods++
+			b.limiter.pause(time.Duration(flood.RetryAfter) * time.Second)
+			continue
+		}
+
+		if b.retry != nil && retryable(err) {
+			if failures < b.retry.Retries {
+				b.retry.wait(failures)
+				failures++
+				continue
+			}
+			if failures > 0 {
+				return data, errors.Wrapf(err, "stb: %s failed after %d attempts", method, failures+1)
+			}
+		}
+		return data, err
+	}
+}
+
+// apiURL returns the URL of a method or, with the "/file" prefix,
+// of a file, in the test environment with Settings.TestEnv.
+func (b *Bot) apiURL(prefix, path string) string {
+	url := b.URL + prefix + "/bot" + b.Token + "/"
+	if b.testEnv {
+		url += "test/"
+	}
+	return url + path
+}
+
+func (b *Bot) raw(method string, payload interface{}) ([]byte, error) {
+	url := b.apiURL("", method)
 
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
@@ -38,6 +89,10 @@ func (b *Bot) Raw(method string, payload interface{}) ([]byte, error) {
 		return nil, wrapError(err)
 	}
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return data, &serverError{code: resp.StatusCode, err: extractOk(data)}
+	}
+
 	if b.verbose {
 		body, _ := json.Marshal(payload)
 		body = bytes.ReplaceAll(body, []byte(`\"`), []byte(`"`))
@@ -67,7 +122,16 @@ func (b *Bot) sendFiles(method string, files map[string]File, params map[string]
 			params[name] = f.FileID
 		case f.FileURL != "":
 			params[name] = f.FileURL
+		case f.OnDisk() && b.local:
+			path, err := filepath.Abs(f.FileLocal)
+			if err != nil {
+				return nil, err
+			}
+			params[name] = "file://" + path
 		case f.OnDisk():
+			if err := b.checkUpload(f.FileLocal); err != nil {
+				return nil, err
+			}
 			rawFiles[name] = f.FileLocal
 		case f.FileReader != nil:
 			rawFiles[name] = f.FileReader
@@ -80,6 +144,32 @@ func (b *Bot) sendFiles(method string, files map[string]File, params map[string]
 		return b.Raw(method, params)
 	}
 
+	start := time.Now()
+	data, err := b.callAPI(method, params, func(payload interface{}) ([]byte, error) {
+		params, err := uploadParams(payload)
+		if err != nil {
+			return nil, err
+		}
+		return b.upload(method, files, rawFiles, params)
+	})
+	b.observeAPI(method, time.Since(start), err)
+	return data, err
+}
+
+// checkUpload fails early for the files over the upload limit.
+func (b *Bot) checkUpload(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return wrapError(err)
+	}
+	if limit := b.UploadLimit(); info.Size() > limit {
+		return errors.Wrapf(ErrTooLarge, "stb: %s is over %d bytes", filename, limit)
+	}
+	return nil
+}
+
+// upload sends the files in a multipart request.
+func (b *Bot) upload(method string, files map[string]File, rawFiles map[string]interface{}, params map[string]string) ([]byte, error) {
 	pipeReader, pipeWriter := io.Pipe()
 	writer := multipart.NewWriter(pipeWriter)
 
@@ -104,7 +194,11 @@ func (b *Bot) sendFiles(method string, files map[string]File, params map[string]
 		}
 	}()
 
-	url := b.URL + "/bot" + b.Token + "/" + method
+	if b.limiter != nil {
+		b.limiter.wait(method, payloadChat(params))
+	}
+
+	url := b.apiURL("", method)
 
 	resp, err := b.client.Post(url, writer.FormDataContentType(), pipeReader)
 	if err != nil {
@@ -124,7 +218,12 @@ func (b *Bot) sendFiles(method string, files map[string]File, params map[string]
 		return nil, wrapError(err)
 	}
 
-	return data, extractOk(data)
+	err = extractOk(data)
+	if flood, ok := err.(FloodError); ok && b.limiter != nil {
+		// the upload can't be replayed, but the next requests can wait
+		b.limiter.pause(time.Duration(flood.RetryAfter) * time.Second)
+	}
+	return data, err
 }
 
 func addFileToWriter(writer *multipart.Writer, filename, field string, file interface{}) error {
@@ -152,13 +251,7 @@ func addFileToWriter(writer *multipart.Writer, filename, field string, file inte
 }
 
 func (b *Bot) sendText(to Recipient, text string, opt *SendOptions) (*Message, error) {
-	params := map[string]string{
-		"chat_id": to.Recipient(),
-		"text":    text,
-	}
-	b.embedSendOptions(params, opt)
-
-	data, err := b.Raw("sendMessage", params)
+	data, err := b.Raw("sendMessage", b.textParams(to, text, opt))
 	if err != nil {
 		return nil, err
 	}
@@ -166,6 +259,16 @@ func (b *Bot) sendText(to Recipient, text string, opt *SendOptions) (*Message, e
 	return extractMessage(data)
 }
 
+// textParams returns the parameters of sendMessage.
+func (b *Bot) textParams(to Recipient, text string, opt *SendOptions) map[string]string {
+	params := map[string]string{
+		"chat_id": to.Recipient(),
+		"text":    text,
+	}
+	b.embedSendOptions(params, opt)
+	return params
+}
+
 func (b *Bot) sendObject(f *File, what string, params map[string]string, files map[string]File) (*Message, error) {
 	sendWhat := "send" + strings.Title(what)
 
@@ -173,6 +276,12 @@ func (b *Bot) sendObject(f *File, what string, params map[string]string, files m
 		what = "video_note"
 	}
 
+	// entities of media are the ones of its caption
+	if entities, ok := params["entities"]; ok {
+		params["caption_entities"] = entities
+		delete(params, "entities")
+	}
+
 	sendFiles := map[string]File{what: *f}
 	for k, v := range files {
 		sendFiles[k] = v
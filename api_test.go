@@ -72,3 +72,28 @@ func TestRaw(t *testing.T) {
 	_, err = b.Raw("testUnknownError", nil)
 	assert.EqualError(t, err, "telegram unknown: unknown error (400)")
 }
+
+func TestTestEnv(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getMe"):
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`))
+		default:
+			w.Write([]byte(`{"ok":true,"result":{"file_id":"f","file_path":"photos/1.jpg"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{URL: srv.URL, Token: "TOKEN", TestEnv: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "test_bot", b.Me.Username)
+
+	url, err := b.FileURLByID("f")
+	assert.NoError(t, err)
+	assert.Equal(t, srv.URL+"/file/botTOKEN/test/photos/1.jpg", url)
+	assert.Equal(t, []string{"/botTOKEN/test/getMe", "/botTOKEN/test/getFile"}, paths)
+}
@@ -0,0 +1,142 @@
+package stb
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// APICall is an outgoing request to the Bot API, see Bot.UseAPI.
+type APICall struct {
+	// Method is the name of the API method, e.g. "sendMessage".
+	Method string
+
+	// Payload holds the parameters of the request, usually
+	// a map[string]string. Use Param and SetParam to read
+	// and change them whatever their form.
+	Payload interface{}
+}
+
+// Param returns the parameter of the request, if set.
+func (c *APICall) Param(key string) (interface{}, bool) {
+	switch p := c.Payload.(type) {
+	case map[string]string:
+		v, ok := p[key]
+		return v, ok
+	case map[string]interface{}:
+		v, ok := p[key]
+		return v, ok
+	}
+	params, err := c.params()
+	if err != nil {
+		return nil, false
+	}
+	v, ok := params[key]
+	return v, ok
+}
+
+// SetParam sets the parameter of the request. Values of a
+// map[string]string payload are stored in their JSON form,
+// unless they are strings.
+func (c *APICall) SetParam(key string, value interface{}) error {
+	switch p := c.Payload.(type) {
+	case map[string]string:
+		if s, ok := value.(string); ok {
+			p[key] = s
+			return nil
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return wrapError(err)
+		}
+		p[key] = string(data)
+		return nil
+	case map[string]interface{}:
+		p[key] = value
+		return nil
+	}
+	params, err := c.params()
+	if err != nil {
+		return err
+	}
+	params[key] = value
+	c.Payload = params
+	return nil
+}
+
+// params returns the payload in the form of a map.
+func (c *APICall) params() (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if c.Payload == nil {
+		return params, nil
+	}
+	data, err := json.Marshal(c.Payload)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, wrapError(err)
+	}
+	return params, nil
+}
+
+// APIHandler performs an API call and returns the raw response.
+type APIHandler func(call *APICall) ([]byte, error)
+
+// APIMiddleware wraps every outgoing API call, the way
+// MiddlewareFunc wraps incoming updates. It may inspect or
+// change the call, time it, look at the response and the error,
+// or not call next to answer the call itself.
+type APIMiddleware func(next APIHandler) APIHandler
+
+// UseAPI adds middleware around the API calls of the bot, in the
+// order it was added. Every attempt of a retried call goes through
+// it. Files uploaded with the call are not part of its payload.
+//
+// Example:
+//
+//     b.UseAPI(func(next stb.APIHandler) stb.APIHandler {
+//         return func(call *stb.APICall) ([]byte, error) {
+//             if call.Method == "sendMessage" {
+//                 call.SetParam("message_thread_id", "42")
+//             }
+//             start := time.Now()
+//             data, err := next(call)
+//             log.Println(call.Method, time.Since(start), err)
+//             return data, err
+//         }
+//     })
+//
+func (b *Bot) UseAPI(middleware ...APIMiddleware) {
+	b.apiHooks = append(b.apiHooks, middleware...)
+}
+
+// callAPI runs the call through the API middleware, then send,
+// unless the call is captured by a dry run.
+func (b *Bot) callAPI(method string, payload interface{}, send func(payload interface{}) ([]byte, error)) ([]byte, error) {
+	dry := b.dryRun != nil && !reading(method)
+	if len(b.apiHooks) == 0 && !dry {
+		return send(payload)
+	}
+
+	handler := APIHandler(func(call *APICall) ([]byte, error) {
+		return send(call.Payload)
+	})
+	if dry {
+		handler = b.dryRun.send
+	}
+	for i := len(b.apiHooks) - 1; i >= 0; i-- {
+		handler = b.apiHooks[i](handler)
+	}
+	return handler(&APICall{Method: method, Payload: payload})
+}
+
+// uploadParams returns the parameters of an upload,
+// which API middleware must leave a map[string]string.
+func uploadParams(payload interface{}) (map[string]string, error) {
+	params, ok := payload.(map[string]string)
+	if !ok {
+		return nil, errors.Errorf("stb: upload parameters turned into %T", payload)
+	}
+	return params, nil
+}
@@ -0,0 +1,72 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseAPI(t *testing.T) {
+	var received map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+
+	var calls []string
+	b.UseAPI(func(next APIHandler) APIHandler {
+		return func(call *APICall) ([]byte, error) {
+			calls = append(calls, call.Method)
+			data, err := next(call)
+			calls = append(calls, "done")
+			return data, err
+		}
+	}, func(next APIHandler) APIHandler {
+		return func(call *APICall) ([]byte, error) {
+			if call.Method == "getMe" {
+				return []byte(`{"ok":true,"result":{"id":2,"username":"cached_bot"}}`), nil
+			}
+			require.NoError(t, call.SetParam("message_thread_id", 42))
+			return next(call)
+		}
+	})
+
+	_, err = b.Send(&Chat{ID: 1}, "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "42", received["message_thread_id"])
+	assert.Equal(t, "hello", received["text"])
+
+	me, err := b.getMe()
+	require.NoError(t, err)
+	assert.Equal(t, "cached_bot", me.Username)
+	assert.Equal(t, []string{"sendMessage", "done", "getMe", "done"}, calls)
+}
+
+func TestAPICallParams(t *testing.T) {
+	call := &APICall{Payload: map[string]string{"chat_id": "1"}}
+	v, ok := call.Param("chat_id")
+	assert.True(t, ok)
+	assert.Equal(t, "1", v)
+	require.NoError(t, call.SetParam("limit", 5))
+	assert.Equal(t, map[string]string{"chat_id": "1", "limit": "5"}, call.Payload)
+
+	call = &APICall{Payload: struct {
+		ChatID int64 `json:"chat_id"`
+	}{1}}
+	v, ok = call.Param("chat_id")
+	assert.True(t, ok)
+	assert.Equal(t, float64(1), v)
+	require.NoError(t, call.SetParam("limit", 5))
+	assert.Equal(t, map[string]interface{}{"chat_id": float64(1), "limit": 5}, call.Payload)
+
+	_, ok = (&APICall{}).Param("chat_id")
+	assert.False(t, ok)
+}
@@ -0,0 +1,80 @@
+package stb
+
+import "time"
+
+// BoostSource is the way a chat boost was obtained.
+type BoostSource string
+
+const (
+	BoostPremium  BoostSource = "premium"
+	BoostGiftCode BoostSource = "gift_code"
+	BoostGiveaway BoostSource = "giveaway"
+)
+
+// ChatBoostSource describes the source of a chat boost.
+type ChatBoostSource struct {
+	Source BoostSource `json:"source"`
+
+	// The user that boosted the chat, bought the gift code or won
+	// the giveaway. Nil for unclaimed giveaway prizes.
+	User *User `json:"user"`
+
+	// (Optional) For giveaways, the message with the giveaway.
+	GiveawayMessageID int `json:"giveaway_message_id"`
+
+	// (Optional) For giveaways, the number of Telegram Stars
+	// to be split between the winners.
+	PrizeStars int `json:"prize_star_count"`
+
+	// (Optional) For giveaways, true if the giveaway was
+	// completed, but there was no user to win the prize.
+	Unclaimed bool `json:"is_unclaimed"`
+}
+
+// ChatBoost contains information about a chat boost.
+type ChatBoost struct {
+	// Unique identifier of the boost.
+	ID string `json:"boost_id"`
+
+	// Unixtime, use ChatBoost.AddDate() to get time.Time.
+	AddUnixtime int64 `json:"add_date"`
+
+	// Unixtime, use ChatBoost.ExpireDate() to get time.Time.
+	ExpireUnixtime int64 `json:"expiration_date"`
+
+	Source ChatBoostSource `json:"source"`
+}
+
+// AddDate returns the moment the chat was boosted in local time.
+func (c *ChatBoost) AddDate() time.Time {
+	return time.Unix(c.AddUnixtime, 0)
+}
+
+// ExpireDate returns the moment the boost expires in local time.
+func (c *ChatBoost) ExpireDate() time.Time {
+	return time.Unix(c.ExpireUnixtime, 0)
+}
+
+// ChatBoostUpdated represents a boost added to a chat or changed.
+type ChatBoostUpdated struct {
+	Chat  Chat      `json:"chat"`
+	Boost ChatBoost `json:"boost"`
+}
+
+// ChatBoostRemoved represents a boost removed from a chat.
+type ChatBoostRemoved struct {
+	Chat Chat `json:"chat"`
+
+	// Unique identifier of the boost.
+	BoostID string `json:"boost_id"`
+
+	// Unixtime, use ChatBoostRemoved.RemoveDate() to get time.Time.
+	RemoveUnixtime int64 `json:"remove_date"`
+
+	Source ChatBoostSource `json:"source"`
+}
+
+// RemoveDate returns the moment the boost was removed in local time.
+func (c *ChatBoostRemoved) RemoveDate() time.Time {
+	return time.Unix(c.RemoveUnixtime, 0)
+}
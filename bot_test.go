@@ -101,7 +101,8 @@ func TestBotHandle(t *testing.T) {
 	assert.Contains(t, b.handlers, reply.CallbackUnique())
 	assert.Contains(t, b.handlers, inline.CallbackUnique())
 
-	assert.Panics(t, func() { b.Handle(1, func() {}) })
+	assert.Equal(t, ErrUnsupportedEndpoint, b.Handle(1, func() {}))
+	assert.Panics(t, func() { b.MustHandle(1, func() {}) })
 }
 
 func TestBotStart(t *testing.T) {
@@ -136,7 +137,7 @@ func TestBotStart(t *testing.T) {
 	b.Poller = tp
 
 	var ok bool
-	b.Handle("/start", func(m *Message) {
+	b.Handle("/start", func(m *Message, _ *Machine) {
 		assert.Equal(t, m.Text, "/start")
 		tp.done <- struct{}{}
 		ok = true
@@ -155,103 +156,103 @@ func TestBotProcessUpdate(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	b.Handle("/start", func(m *Message) {
+	b.Handle("/start", func(m *Message, _ *Machine) {
 		assert.Equal(t, "/start", m.Text)
 	})
-	b.Handle("hello", func(m *Message) {
+	b.Handle("hello", func(m *Message, _ *Machine) {
 		assert.Equal(t, "hello", m.Text)
 	})
-	b.Handle(OnText, func(m *Message) {
+	b.Handle(OnText, func(m *Message, _ *Machine) {
 		assert.Equal(t, "text", m.Text)
 	})
-	b.Handle(OnPinned, func(m *Message) {
+	b.Handle(OnPinned, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.PinnedMessage)
 	})
-	b.Handle(OnPhoto, func(m *Message) {
+	b.Handle(OnPhoto, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Photo)
 	})
-	b.Handle(OnVoice, func(m *Message) {
+	b.Handle(OnVoice, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Voice)
 	})
-	b.Handle(OnAudio, func(m *Message) {
+	b.Handle(OnAudio, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Audio)
 	})
-	b.Handle(OnAnimation, func(m *Message) {
+	b.Handle(OnAnimation, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Animation)
 	})
-	b.Handle(OnDocument, func(m *Message) {
+	b.Handle(OnDocument, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Document)
 	})
-	b.Handle(OnSticker, func(m *Message) {
+	b.Handle(OnSticker, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Sticker)
 	})
-	b.Handle(OnVideo, func(m *Message) {
+	b.Handle(OnVideo, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Video)
 	})
-	b.Handle(OnVideoNote, func(m *Message) {
+	b.Handle(OnVideoNote, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.VideoNote)
 	})
-	b.Handle(OnContact, func(m *Message) {
+	b.Handle(OnContact, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Contact)
 	})
-	b.Handle(OnLocation, func(m *Message) {
+	b.Handle(OnLocation, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Location)
 	})
-	b.Handle(OnVenue, func(m *Message) {
+	b.Handle(OnVenue, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.Venue)
 	})
-	b.Handle(OnAddedToGroup, func(m *Message) {
+	b.Handle(OnAddedToGroup, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.GroupCreated)
 	})
-	b.Handle(OnUserJoined, func(m *Message) {
+	b.Handle(OnUserJoined, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.UserJoined)
 	})
-	b.Handle(OnUserLeft, func(m *Message) {
+	b.Handle(OnUserLeft, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.UserLeft)
 	})
-	b.Handle(OnNewGroupTitle, func(m *Message) {
+	b.Handle(OnNewGroupTitle, func(m *Message, _ *Machine) {
 		assert.Equal(t, "title", m.NewGroupTitle)
 	})
-	b.Handle(OnNewGroupPhoto, func(m *Message) {
+	b.Handle(OnNewGroupPhoto, func(m *Message, _ *Machine) {
 		assert.NotNil(t, m.NewGroupPhoto)
 	})
-	b.Handle(OnGroupPhotoDeleted, func(m *Message) {
+	b.Handle(OnGroupPhotoDeleted, func(m *Message, _ *Machine) {
 		assert.True(t, m.GroupPhotoDeleted)
 	})
 	b.Handle(OnMigration, func(from, to int64) {
 		assert.Equal(t, int64(1), from)
 		assert.Equal(t, int64(2), to)
 	})
-	b.Handle(OnEdited, func(m *Message) {
+	b.Handle(OnEdited, func(m *Message, _ *Machine) {
 		assert.Equal(t, "edited", m.Text)
 	})
-	b.Handle(OnChannelPost, func(m *Message) {
+	b.Handle(OnChannelPost, func(m *Message, _ *Machine) {
 		assert.Equal(t, "post", m.Text)
 	})
-	b.Handle(OnEditedChannelPost, func(m *Message) {
+	b.Handle(OnEditedChannelPost, func(m *Message, _ *Machine) {
 		assert.Equal(t, "edited post", m.Text)
 	})
-	b.Handle(OnCallback, func(c *Callback) {
+	b.Handle(OnCallback, func(c *Callback, _ *Machine) {
 		if c.Data[0] != '\f' {
 			assert.Equal(t, "callback", c.Data)
 		}
 	})
-	b.Handle("\funique", func(c *Callback) {
+	b.Handle("\funique", func(c *Callback, _ *Machine) {
 		assert.Equal(t, "callback", c.Data)
 	})
-	b.Handle(OnQuery, func(q *Query) {
+	b.Handle(OnQuery, func(q *Query, _ *Machine) {
 		assert.Equal(t, "query", q.Text)
 	})
-	b.Handle(OnChosenInlineResult, func(r *ChosenInlineResult) {
+	b.Handle(OnChosenInlineResult, func(r *ChosenInlineResult, _ *Machine) {
 		assert.Equal(t, "result", r.ResultID)
 	})
-	b.Handle(OnCheckout, func(pre *PreCheckoutQuery) {
+	b.Handle(OnCheckout, func(pre *PreCheckoutQuery, _ *Machine) {
 		assert.Equal(t, "checkout", pre.ID)
 	})
 	b.Handle(OnPoll, func(p *Poll) {
 		assert.Equal(t, "poll", p.ID)
 	})
-	b.Handle(OnPollAnswer, func(pa *PollAnswer) {
+	b.Handle(OnPollAnswer, func(pa *PollAnswer, _ *Machine) {
 		assert.Equal(t, "poll", pa.PollID)
 	})
 
@@ -507,3 +508,39 @@ func TestBot(t *testing.T) {
 		assert.True(t, len(response.InviteLink) > 0)
 	})
 }
+
+func TestBotGlobalHandlers(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var got []string
+	b.Event("cancel", Default)
+	b.MustHandle("/cancel", func(_ *Message, m *Machine) error {
+		got = append(got, "global cancel in "+string(m.Current()))
+		return m.SendEvent("cancel")
+	})
+	b.MustHandle(OnMyChatMember, func(u *ChatMemberUpdated, m *Machine) {
+		got = append(got, "member")
+	})
+
+	b.Default(Default).Event("pay", "Pay")
+	pay := b.State("Pay")
+	pay.MustHandle("/cancel", func(*Message, *Machine) {
+		got = append(got, "pay cancel")
+	})
+	b.State("Card").Parent("Pay")
+	b.State("Name")
+
+	user := &User{ID: 1}
+	m := b.machine(user)
+	cancel := Update{Message: &Message{Text: "/cancel", Sender: user, Chat: &Chat{ID: 1}}}
+
+	for _, state := range []StateType{"Pay", "Card", "Name"} {
+		m.current = state
+		b.ProcessUpdate(cancel)
+	}
+	b.ProcessUpdate(Update{MyChatMember: &ChatMemberUpdated{From: *user, Chat: Chat{ID: 1}}})
+
+	assert.Equal(t, []string{"pay cancel", "pay cancel", "global cancel in Name", "member"}, got)
+	assert.Equal(t, Default, m.Current())
+}
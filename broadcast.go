@@ -0,0 +1,206 @@
+package stb
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BroadcastOptions configures Bot.Broadcast. It is passed
+// along with the send options.
+type BroadcastOptions struct {
+	// Rate is the number of messages sent per second.
+	Rate float64 // Default: 25
+
+	// Progress is called after every machine with the report so far.
+	Progress func(BroadcastReport)
+}
+
+// BroadcastReport sums up a broadcast.
+type BroadcastReport struct {
+	// Total is the number of machines the filter selected.
+	Total int
+
+	// Sent is the number of messages sent so far.
+	Sent int
+
+	// Unreachable are the ids of the machines whose users blocked
+	// the bot, deleted their account or removed the bot from the chat.
+	Unreachable []string
+
+	// Failed holds the other errors by machine id.
+	Failed map[string]error
+}
+
+// Broadcast sends the message to the chats of all the machines the
+// filter selects, a nil filter selects all of them. Besides the loaded
+// machines, it reaches the ones in the store, which has to implement
+// Lister. The stored machines are read one at a time, without being
+// loaded: they are neither saved nor kept in memory, and their timers
+// don't run. The messages are paced to stay below the flood limits of
+// Telegram, flood errors are waited out. Chats that can't be reached
+// anymore are skipped, as are the machines of users who blocked the
+// bot (see Machine.Blocked).
+//
+// Broadcast returns once all the messages are sent, so it usually
+// runs in its own goroutine. It only fails if the store can't list
+// its machines.
+//
+// Example:
+//
+//     report, err := b.Broadcast(func(m *stb.Machine) bool {
+//         return m.Current() == Subscribed
+//     }, "We are back!", &stb.BroadcastOptions{
+//         Progress: func(r stb.BroadcastReport) { log.Printf("%d/%d", r.Sent, r.Total) },
+//     })
+//
+func (b *Bot) Broadcast(filter func(*Machine) bool, what interface{}, options ...interface{}) (BroadcastReport, error) {
+	opts := BroadcastOptions{Rate: 25}
+	var sendOpts []interface{}
+	for _, opt := range options {
+		if o, ok := opt.(*BroadcastOptions); ok {
+			opts = *o
+			if opts.Rate <= 0 {
+				opts.Rate = 25
+			}
+			continue
+		}
+		sendOpts = append(sendOpts, opt)
+	}
+
+	report := BroadcastReport{Failed: make(map[string]error)}
+
+	ids, err := b.machineIDs()
+	if err != nil {
+		return report, err
+	}
+	var selected []string
+	for _, id := range ids {
+		if m := b.peek(id); m != nil && (filter == nil || filter(m)) {
+			selected = append(selected, id)
+		}
+	}
+	report.Total = len(selected)
+
+	tick := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+	defer tick.Stop()
+
+	for _, id := range selected {
+		m := b.peek(id)
+		if m == nil {
+			continue
+		}
+
+		var err error
+		if m.Blocked() {
+			err = ErrBlockedByUser
+		} else {
+			<-tick.C
+			err = b.broadcastTo(m, what, sendOpts)
+		}
+
+		switch {
+		case err == nil:
+			report.Sent++
+		case unreachable(err):
+			report.Unreachable = append(report.Unreachable, m.id)
+		default:
+			report.Failed[m.id] = err
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(report)
+		}
+	}
+	return report, nil
+}
+
+// broadcastTo sends the message to the machine, waiting out floods.
+func (b *Bot) broadcastTo(m *Machine, what interface{}, options []interface{}) error {
+	for floods := 0; ; floods++ {
+		_, err := m.Send(what, options...)
+		flood, ok := errors.Cause(err).(FloodError)
+		if !ok || floods == 3 {
+			return err
+		}
+		time.Sleep(time.Duration(flood.RetryAfter) * time.Second)
+	}
+}
+
+// peek returns the loaded machine with the id or else the one in the
+// store, restored without being loaded, saved or having its timers
+// armed, nil if there is none.
+func (b *Bot) peek(id string) *Machine {
+	if m, ok := b.machines.Get(id); ok {
+		return m
+	}
+	if b.store == nil {
+		return nil
+	}
+
+	snap, err := b.store.Load(id)
+	if err != nil {
+		if err != ErrNotStored {
+			b.debug(err)
+		}
+		return nil
+	}
+
+	b.configMu.RLock()
+	defer b.configMu.RUnlock()
+
+	m := b.blankMachine(id, nil)
+	m.store = nil
+	m.peeked = true
+	cfg := b.current()
+	snap.State = renameState(snap.State, cfg.states, b.rename, cfg.defaultState)
+	snap.History = renameHistory(snap.History, cfg.states, b.rename)
+	if _, err := m.restoreState(snap, b.newCtx); err != nil {
+		b.debug(err)
+		return nil
+	}
+	return m
+}
+
+// machineIDs returns the ids of the loaded and the stored machines.
+func (b *Bot) machineIDs() ([]string, error) {
+	seen := make(map[string]bool)
+	b.machines.Range(func(m *Machine) bool {
+		seen[m.id] = true
+		return true
+	})
+
+	if b.store != nil {
+		lister, ok := b.store.(Lister)
+		if !ok {
+			return nil, errors.New("stb: the store can't list its machines")
+		}
+		stored, err := lister.IDs()
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range stored {
+			seen[id] = true
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// unreachable reports whether the error means the chat can't be
+// messaged anymore: the user blocked the bot or deleted their
+// account, or the bot was removed from the chat.
+func unreachable(err error) bool {
+	switch errors.Cause(err) {
+	case ErrBlockedByUser, ErrUserIsDeactivated, ErrNotStartedByUser,
+		ErrChatNotFound, ErrBotKickedFromGroup, ErrBotKickedFromSuperGroup:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotBroadcast(t *testing.T) {
+	var chats []string
+	floods := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		json.NewDecoder(r.Body).Decode(&params)
+		switch chat := params["chat_id"]; {
+		case chat == "3":
+			w.Write([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`))
+		case chat == "4":
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: message text is empty"}`))
+		case chat == "5" && floods == 0:
+			floods++
+			w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":0}}`))
+		default:
+			chats = append(chats, chat)
+			w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+		}
+	}))
+	defer srv.Close()
+
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL, Store: store})
+	require.NoError(t, err)
+	b.Default(Default)
+	b.State("Muted")
+
+	b.machine(&User{ID: 1})
+	b.machine(&User{ID: 2}).force("Muted")
+	for _, id := range []int64{3, 4, 5} {
+		require.NoError(t, store.Save(strconv.FormatInt(id, 10), &Snapshot{State: Default, Chat: id}))
+	}
+
+	var progress []int
+	report, err := b.Broadcast(func(m *Machine) bool {
+		return m.Current() == Default
+	}, "news", &BroadcastOptions{Rate: 1000, Progress: func(r BroadcastReport) {
+		progress = append(progress, r.Sent)
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"1", "5"}, chats)
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, 2, report.Sent)
+	assert.Equal(t, []string{"3"}, report.Unreachable)
+	assert.Contains(t, report.Failed, "4")
+	assert.Equal(t, []int{1, 1, 1, 2}, progress)
+
+	// the stored machines were not loaded
+	assert.Equal(t, 2, b.Machines().Len())
+}
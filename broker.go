@@ -0,0 +1,108 @@
+package stb
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Broker carries the raw updates from a thin webhook receiver to
+// the instances processing them, so both can be scaled and restarted
+// independently. See Relay and BrokerPoller, and package broker/nats
+// for a Broker on top of NATS.
+type Broker interface {
+	// Publish publishes an update as received from Telegram.
+	Publish(update []byte) error
+
+	// Consume passes the published updates to handle, one at a
+	// time, until stop is closed or consuming fails.
+	Consume(handle func(update []byte), stop chan struct{}) error
+}
+
+// BrokerPoller is a Poller consuming updates from a Broker instead
+// of Telegram. It keeps consuming after failures, RetryAfter apart.
+//
+// Example:
+//
+//     b, err := stb.NewBot(stb.Settings{
+//         Token:  "TOKEN_HERE",
+//         Poller: &stb.BrokerPoller{Broker: nats.New(nats.Options{})},
+//     })
+//
+type BrokerPoller struct {
+	Broker     Broker
+	RetryAfter time.Duration // Default: 1s
+}
+
+// Poll consumes the updates of the broker until stop is closed.
+func (p *BrokerPoller) Poll(b *Bot, dest chan Update, stop chan struct{}) {
+	if p.RetryAfter == 0 {
+		p.RetryAfter = time.Second
+	}
+
+	handle := func(data []byte) {
+		var upd Update
+		if err := json.Unmarshal(data, &upd); err != nil {
+			b.debug(errors.Wrap(err, "stb: bad update from broker"))
+			return
+		}
+		select {
+		case dest <- upd:
+		case <-stop:
+		}
+	}
+
+	for {
+		err := p.Broker.Consume(handle, stop)
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err != nil {
+			b.debug(errors.WithMessage(err, "stb: consuming updates"))
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(p.RetryAfter):
+		}
+	}
+}
+
+// Relay returns a handler receiving updates from Telegram like a
+// Webhook, which publishes them to the broker instead of handling
+// them. Updates that can't be published are answered with an error,
+// so Telegram delivers them again later. Requests without the secret
+// token, if there is one, are rejected.
+//
+// Example:
+//
+//     broker := nats.New(nats.Options{})
+//     http.ListenAndServe(":8080", stb.Relay(broker, secret))
+//
+func Relay(broker Broker, secretToken string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if secretToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secretToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil || !json.Valid(data) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := broker.Publish(data); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	})
+}
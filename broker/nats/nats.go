@@ -0,0 +1,470 @@
+// Package nats implements a stb.Broker on top of NATS JetStream.
+//
+// A thin receiver publishes the updates from Telegram with
+// stb.Relay, the instances processing them consume them with
+// a stb.BrokerPoller. The updates are kept in a stream until an
+// instance acknowledges them, so the processing tier can be down
+// or restart while the receiver keeps accepting updates. The
+// instances share a durable consumer, so every update is delivered
+// to only one of them, and again if it is not acknowledged in time:
+// set stb.Settings.Dedup to drop the updates handled twice.
+//
+// Example:
+//
+//		broker := nats.New(nats.Options{Addr: "nats:4222"})
+//		defer broker.Close()
+//
+//		// the receiver
+//		http.ListenAndServe(":8080", stb.Relay(broker, secret))
+//
+//		// the processing tier
+//		b, err := stb.NewBot(stb.Settings{
+//			Token:  "TOKEN_HERE",
+//			Poller: &stb.BrokerPoller{Broker: broker},
+//			Dedup:  1000,
+//		})
+//
+package nats
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Options configures the connections and the subject of a Broker.
+type Options struct {
+	// Addr is the host:port of the server.
+	Addr string // Default: localhost:4222
+
+	// Subject is the subject updates are published on.
+	Subject string // Default: stb.updates
+
+	// Stream is the JetStream stream keeping the updates, created
+	// for the subject on first use. An existing stream of that
+	// name is used as it is.
+	Stream string // Default: STB
+
+	// Queue names the durable consumer the instances share.
+	Queue string // Default: stb
+
+	// AckWait is how long an instance has to acknowledge an
+	// update before it is delivered again.
+	AckWait time.Duration // Default: 30s
+
+	// User and Password or Token authenticate the connections, if set.
+	User     string
+	Password string
+	Token    string
+
+	// DialTimeout limits the time spent on connecting, and
+	// waiting for the server to acknowledge a request.
+	DialTimeout time.Duration // Default: 5s
+}
+
+// Broker is a stb.Broker publishing updates to a JetStream stream.
+// It publishes over a single connection, made lazily and made
+// again after network errors, and consumes over one per Consume.
+type Broker struct {
+	opts Options
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// New creates a Broker, no connection is made until the first call.
+func New(opts Options) *Broker {
+	if opts.Addr == "" {
+		opts.Addr = "localhost:4222"
+	}
+	if opts.Subject == "" {
+		opts.Subject = "stb.updates"
+	}
+	if opts.Stream == "" {
+		opts.Stream = "STB"
+	}
+	if opts.Queue == "" {
+		opts.Queue = "stb"
+	}
+	if opts.AckWait == 0 {
+		opts.AckWait = 30 * time.Second
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	return &Broker{opts: opts}
+}
+
+// Publish implements stb.Broker. It returns once
+// the update is stored in the stream.
+func (b *Broker) Publish(update []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		c, err := dial(b.opts)
+		if err == nil {
+			err = c.createStream(b.opts)
+		}
+		if err != nil {
+			if c != nil {
+				c.Close()
+			}
+			return err
+		}
+		b.conn = c
+	}
+
+	err := b.conn.publish(b.opts.Subject, update, b.opts.DialTimeout)
+	if err != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+	return err
+}
+
+// Consume implements stb.Broker. An update is acknowledged once
+// handled, unless stop was closed meanwhile: it is delivered
+// again then, as handling it could have been cut short.
+func (b *Broker) Consume(handle func(update []byte), stop chan struct{}) error {
+	c, err := dial(b.opts)
+	if err != nil {
+		return err
+	}
+	deliver, err := c.createConsumer(b.opts)
+	if err != nil {
+		c.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		c.Close()
+	}()
+
+	err = c.consume(deliver, b.opts.Queue, func(update []byte) bool {
+		handle(update)
+		select {
+		case <-stop:
+			return false
+		default:
+			return true
+		}
+	})
+	select {
+	case <-stop:
+		return nil
+	default:
+		return err
+	}
+}
+
+// Close closes the connection used for publishing.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	return err
+}
+
+// conn is a connection speaking the NATS client protocol.
+type conn struct {
+	net.Conn
+	rd *bufio.Reader
+	wr *bufio.Writer
+
+	// inbox is the prefix of the reply subjects of requests.
+	inbox    string
+	requests int
+}
+
+// dial connects to the server and introduces the client.
+func dial(opts Options) (*conn, error) {
+	nc, err := net.DialTimeout("tcp", opts.Addr, opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{Conn: nc, rd: bufio.NewReader(nc), wr: bufio.NewWriter(nc)}
+
+	// the server greets with INFO
+	line, err := c.readLine()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		c.Close()
+		return nil, errors.Errorf("nats: unexpected greeting %q", line)
+	}
+
+	info := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "stb",
+		"lang":     "go",
+	}
+	if opts.User != "" {
+		info["user"], info["pass"] = opts.User, opts.Password
+	}
+	if opts.Token != "" {
+		info["auth_token"] = opts.Token
+	}
+	connect, _ := json.Marshal(info)
+	c.wr.WriteString("CONNECT " + string(connect) + "\r\n")
+	if err := c.ping(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// apiError is the error of a JetStream API response.
+type apiError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+// streamNameInUse is the err_code of a stream created
+// again with another configuration.
+const streamNameInUse = 10058
+
+// jsRequest makes a JetStream API request, or a publish
+// expecting an acknowledgement, and decodes the response.
+func (c *conn) jsRequest(subject string, req interface{}, timeout time.Duration) (*apiError, error) {
+	data, ok := req.([]byte)
+	if !ok {
+		data, _ = json.Marshal(req)
+	}
+	reply, err := c.request(subject, data, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Error *apiError `json:"error"`
+	}
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		return nil, errors.Wrap(err, "nats: bad response")
+	}
+	return resp.Error, nil
+}
+
+// createStream creates the stream of the subject, unless there is one.
+func (c *conn) createStream(opts Options) error {
+	apiErr, err := c.jsRequest("$JS.API.STREAM.CREATE."+opts.Stream, map[string]interface{}{
+		"name":     opts.Stream,
+		"subjects": []string{opts.Subject},
+		"storage":  "file",
+	}, opts.DialTimeout)
+	if err != nil {
+		return err
+	}
+	if apiErr != nil && apiErr.ErrCode != streamNameInUse {
+		return errors.Errorf("nats: creating stream: %s", apiErr.Description)
+	}
+	return nil
+}
+
+// createConsumer creates the stream and its durable consumer
+// delivering to a queue group, and returns the subject it
+// delivers on.
+func (c *conn) createConsumer(opts Options) (string, error) {
+	if err := c.createStream(opts); err != nil {
+		return "", err
+	}
+
+	deliver := "_STB." + opts.Stream + "." + opts.Queue
+	apiErr, err := c.jsRequest("$JS.API.CONSUMER.DURABLE.CREATE."+opts.Stream+"."+opts.Queue, map[string]interface{}{
+		"stream_name": opts.Stream,
+		"config": map[string]interface{}{
+			"durable_name":    opts.Queue,
+			"deliver_subject": deliver,
+			"deliver_group":   opts.Queue,
+			"filter_subject":  opts.Subject,
+			"ack_policy":      "explicit",
+			"ack_wait":        opts.AckWait.Nanoseconds(),
+		},
+	}, opts.DialTimeout)
+	if err != nil {
+		return "", err
+	}
+	if apiErr != nil {
+		return "", errors.Errorf("nats: creating consumer: %s", apiErr.Description)
+	}
+	return deliver, nil
+}
+
+// publish publishes the data and waits for the stream to store it.
+func (c *conn) publish(subject string, data []byte, timeout time.Duration) error {
+	apiErr, err := c.jsRequest(subject, data, timeout)
+	if err != nil {
+		return err
+	}
+	if apiErr != nil {
+		return errors.Errorf("nats: publishing: %s", apiErr.Description)
+	}
+	return nil
+}
+
+// request publishes the data with a reply subject
+// and waits for the reply until the timeout.
+func (c *conn) request(subject string, data []byte, timeout time.Duration) ([]byte, error) {
+	if c.inbox == "" {
+		id := make([]byte, 12)
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+		c.inbox = "_INBOX." + hex.EncodeToString(id)
+		c.wr.WriteString("SUB " + c.inbox + ".* 2\r\n")
+	}
+	c.requests++
+	reply := c.inbox + "." + strconv.Itoa(c.requests)
+
+	c.wr.WriteString("PUB " + subject + " " + reply + " " + strconv.Itoa(len(data)) + "\r\n")
+	c.wr.Write(data)
+	c.wr.WriteString("\r\n")
+	if err := c.wr.Flush(); err != nil {
+		return nil, err
+	}
+
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, errors.Wrapf(err, "nats: no reply to %s", subject)
+		}
+
+		switch {
+		case line == "PING":
+			c.wr.WriteString("PONG\r\n")
+			if err := c.wr.Flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return nil, serverError(line)
+		case strings.HasPrefix(line, "MSG "):
+			fields, payload, err := c.readMsg(line)
+			if err != nil {
+				return nil, err
+			}
+			// replies to requests that timed out are dropped
+			if fields[1] == reply {
+				return payload, nil
+			}
+		}
+	}
+}
+
+// ping flushes what was written and waits for the PONG,
+// failing on the errors the server reports until then.
+func (c *conn) ping() error {
+	c.wr.WriteString("PING\r\n")
+	if err := c.wr.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.readLine()
+		switch {
+		case err != nil:
+			return err
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return serverError(line)
+		}
+	}
+}
+
+// consume subscribes to the subject in the queue group and passes
+// the messages to handle until reading fails. The messages handle
+// reports as done are acknowledged.
+func (c *conn) consume(subject, queue string, handle func([]byte) bool) error {
+	// messages may arrive right away, errors are read with them
+	c.wr.WriteString("SUB " + subject + " " + queue + " 1\r\n")
+	if err := c.wr.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "PING":
+			c.wr.WriteString("PONG\r\n")
+			if err := c.wr.Flush(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return serverError(line)
+		case strings.HasPrefix(line, "MSG "):
+			fields, data, err := c.readMsg(line)
+			if err != nil {
+				return err
+			}
+			// late replies to the requests are not updates
+			if fields[2] != "1" || !handle(data) || len(fields) < 5 {
+				continue
+			}
+			// an empty message to the reply subject acknowledges it
+			c.wr.WriteString("PUB " + fields[3] + " 0\r\n\r\n")
+			if err := c.wr.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readMsg reads the payload of the message of the line,
+// and returns it with the fields of the line:
+// MSG <subject> <sid> [reply-to] <size>
+func (c *conn) readMsg(line string) ([]string, []byte, error) {
+	fields := strings.Fields(line)
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || len(fields) < 4 {
+		return nil, nil, errors.Errorf("nats: bad message %q", line)
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.rd, data); err != nil {
+		return nil, nil, err
+	}
+	return fields, data[:size], nil
+}
+
+func (c *conn) readLine() (string, error) {
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func serverError(line string) error {
+	msg := strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'")
+	return errors.New("nats: " + msg)
+}
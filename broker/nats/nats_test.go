@@ -0,0 +1,290 @@
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exp625/stb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer speaks just enough of the NATS protocol and the
+// JetStream API to keep the published messages in a stream and
+// deliver them to a durable consumer until they are acknowledged.
+type fakeServer struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	connects []string
+	subs     map[string][]fakeSub
+	subbed   chan struct{}
+	subjects []string
+	deliver  string
+	msgs     []*fakeMsg
+}
+
+type fakeSub struct {
+	sid string
+	wr  *bufio.Writer
+}
+
+type fakeMsg struct {
+	data  []byte
+	sent  bool
+	acked bool
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &fakeServer{ln: ln, subs: make(map[string][]fakeSub), subbed: make(chan struct{}, 1)}
+	go srv.serve()
+	return srv
+}
+
+func (srv *fakeServer) serve() {
+	for {
+		conn, err := srv.ln.Accept()
+		if err != nil {
+			return
+		}
+		go srv.handle(conn)
+	}
+}
+
+func (srv *fakeServer) handle(conn net.Conn) {
+	rd, wr := bufio.NewReader(conn), bufio.NewWriter(conn)
+	defer srv.disconnect(conn, wr)
+
+	srv.mu.Lock()
+	wr.WriteString("INFO {\"server_id\":\"fake\"}\r\n")
+	wr.Flush()
+	srv.mu.Unlock()
+
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+
+		srv.mu.Lock()
+		switch args[0] {
+		case "CONNECT":
+			srv.connects = append(srv.connects, strings.TrimSpace(line[len("CONNECT "):]))
+		case "PING":
+			wr.WriteString("PONG\r\n")
+		case "SUB":
+			srv.subs[args[1]] = append(srv.subs[args[1]], fakeSub{sid: args[len(args)-1], wr: wr})
+			if args[1] == srv.deliver {
+				srv.deliverPending()
+				srv.subbed <- struct{}{}
+			}
+		case "PUB":
+			size, _ := strconv.Atoi(args[len(args)-1])
+			data := make([]byte, size+2)
+			io.ReadFull(rd, data)
+			reply := ""
+			if len(args) == 4 {
+				reply = args[2]
+			}
+			srv.publish(wr, args[1], reply, data[:size])
+		}
+		wr.Flush()
+		srv.mu.Unlock()
+	}
+}
+
+// publish handles a message published by a client.
+// The caller must hold the mutex.
+func (srv *fakeServer) publish(wr *bufio.Writer, subject, reply string, data []byte) {
+	switch {
+	case subject == "forbidden":
+		wr.WriteString("-ERR 'Permissions Violation for Publish'\r\n")
+	case strings.HasPrefix(subject, "$JS.API.STREAM.CREATE."):
+		var config struct{ Subjects []string }
+		json.Unmarshal(data, &config)
+		srv.subjects = config.Subjects
+		srv.send(reply, "", []byte(`{"type":"io.nats.jetstream.api.v1.stream_create_response"}`))
+	case strings.HasPrefix(subject, "$JS.API.CONSUMER.DURABLE.CREATE."):
+		var req struct {
+			Config struct {
+				DeliverSubject string `json:"deliver_subject"`
+			}
+		}
+		json.Unmarshal(data, &req)
+		srv.deliver = req.Config.DeliverSubject
+		srv.send(reply, "", []byte(`{"type":"io.nats.jetstream.api.v1.consumer_create_response"}`))
+	case strings.HasPrefix(subject, "$JS.ACK."):
+		seq, _ := strconv.Atoi(subject[strings.LastIndex(subject, ".")+1:])
+		srv.msgs[seq-1].acked = true
+	case len(srv.subjects) > 0 && srv.subjects[0] == subject:
+		srv.msgs = append(srv.msgs, &fakeMsg{data: data})
+		srv.send(reply, "", []byte(fmt.Sprintf(`{"stream":"STB","seq":%d}`, len(srv.msgs))))
+		srv.deliverPending()
+	}
+}
+
+// deliverPending delivers the messages not delivered yet to
+// one of the consumers. The caller must hold the mutex.
+func (srv *fakeServer) deliverPending() {
+	if len(srv.subs[srv.deliver]) == 0 {
+		return
+	}
+	for i, msg := range srv.msgs {
+		if !msg.sent && !msg.acked {
+			msg.sent = true
+			srv.send(srv.deliver, fmt.Sprintf("$JS.ACK.STB.stb.1.%d", i+1), msg.data)
+		}
+	}
+}
+
+// send writes the message to the first subscription matching the
+// subject, by name or with a trailing wildcard. The caller must hold
+// the mutex.
+func (srv *fakeServer) send(subject, reply string, data []byte) {
+	for name, subs := range srv.subs {
+		match := name == subject ||
+			strings.HasSuffix(name, ".*") && strings.HasPrefix(subject, strings.TrimSuffix(name, "*"))
+		if !match || len(subs) == 0 {
+			continue
+		}
+		if reply != "" {
+			reply += " "
+		}
+		fmt.Fprintf(subs[0].wr, "MSG %s %s %s%d\r\n%s\r\n", subject, subs[0].sid, reply, len(data), data)
+		subs[0].wr.Flush()
+		return
+	}
+}
+
+// disconnect drops the subscriptions of the connection,
+// the messages it did not acknowledge are delivered again.
+func (srv *fakeServer) disconnect(conn net.Conn, wr *bufio.Writer) {
+	conn.Close()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for name, subs := range srv.subs {
+		kept := subs[:0]
+		for _, sub := range subs {
+			if sub.wr != wr {
+				kept = append(kept, sub)
+			}
+		}
+		srv.subs[name] = kept
+	}
+	for _, msg := range srv.msgs {
+		msg.sent = false
+	}
+	srv.deliverPending()
+}
+
+func TestBroker(t *testing.T) {
+	srv := newFakeServer(t)
+	defer srv.ln.Close()
+
+	broker := New(Options{Addr: srv.ln.Addr().String(), Token: "secret"})
+	defer broker.Close()
+
+	// updates published while no one consumes are kept
+	require.NoError(t, broker.Publish([]byte(`{"update_id":1}`)))
+
+	got := make(chan string, 2)
+	stop := make(chan struct{})
+	consumed := make(chan error)
+	go func() {
+		consumed <- broker.Consume(func(update []byte) { got <- string(update) }, stop)
+	}()
+	<-srv.subbed
+
+	require.NoError(t, broker.Publish([]byte(`{"update_id":2}`)))
+	assert.Equal(t, `{"update_id":1}`, <-got)
+	assert.Equal(t, `{"update_id":2}`, <-got)
+
+	close(stop)
+	assert.NoError(t, <-consumed)
+
+	// an update cut short by stopping is delivered again
+	require.NoError(t, broker.Publish([]byte(`{"update_id":3}`)))
+	stop = make(chan struct{})
+	go func() {
+		consumed <- broker.Consume(func(update []byte) {
+			got <- string(update)
+			close(stop)
+		}, stop)
+	}()
+	<-srv.subbed
+	assert.Equal(t, `{"update_id":3}`, <-got)
+	assert.NoError(t, <-consumed)
+
+	stop = make(chan struct{})
+	go func() {
+		consumed <- broker.Consume(func(update []byte) { got <- string(update) }, stop)
+	}()
+	<-srv.subbed
+	assert.Equal(t, `{"update_id":3}`, <-got)
+	close(stop)
+	assert.NoError(t, <-consumed)
+
+	srv.mu.Lock()
+	assert.Contains(t, srv.connects[0], `"auth_token":"secret"`)
+	assert.NotContains(t, srv.connects[0], `"user"`)
+	srv.mu.Unlock()
+
+	forbidden := New(Options{Addr: srv.ln.Addr().String(), Subject: "forbidden", DialTimeout: 100 * time.Millisecond})
+	assert.EqualError(t, forbidden.Publish([]byte(`{}`)), "nats: Permissions Violation for Publish")
+}
+
+func TestRelay(t *testing.T) {
+	srv := newFakeServer(t)
+	defer srv.ln.Close()
+
+	broker := New(Options{Addr: srv.ln.Addr().String()})
+	defer broker.Close()
+
+	b, err := stb.NewBot(stb.Settings{Offline: true, Poller: &stb.BrokerPoller{Broker: broker}})
+	require.NoError(t, err)
+
+	texts := make(chan string, 1)
+	b.Default(stb.Default).MustHandle(stb.OnText, func(msg *stb.Message, m *stb.Machine) {
+		texts <- msg.Text
+	})
+	go b.Start()
+	defer b.Stop()
+	<-srv.subbed
+
+	relay := httptest.NewServer(stb.Relay(broker, "secret"))
+	defer relay.Close()
+
+	post := func(token string) int {
+		req, _ := http.NewRequest(http.MethodPost, relay.URL, strings.NewReader(
+			`{"update_id":1,"message":{"from":{"id":1},"chat":{"id":1},"text":"hi"}}`))
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("wrong"))
+	assert.Equal(t, http.StatusOK, post("secret"))
+
+	select {
+	case text := <-texts:
+		assert.Equal(t, "hi", text)
+	case <-time.After(3 * time.Second):
+		t.Fatal("update was not consumed")
+	}
+}
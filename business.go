@@ -0,0 +1,84 @@
+package stb
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// BusinessConnection describes the connection of the bot
+// with a Telegram Business account.
+type BusinessConnection struct {
+	// Unique identifier of the business connection.
+	ID string `json:"id"`
+
+	// Business account user that created the business connection.
+	User User `json:"user"`
+
+	// Identifier of a private chat with the user who
+	// created the business connection.
+	UserChatID int64 `json:"user_chat_id"`
+
+	// Unixtime, use BusinessConnection.Time() to get time.Time.
+	Unixtime int64 `json:"date"`
+
+	// True, if the bot can act on behalf of the business account
+	// in chats that were active in the last 24 hours.
+	CanReply bool `json:"can_reply"`
+
+	// True, if the connection is active.
+	Enabled bool `json:"is_enabled"`
+}
+
+// Time returns the moment the connection was established in local time.
+func (c *BusinessConnection) Time() time.Time {
+	return time.Unix(c.Unixtime, 0)
+}
+
+// BusinessMessagesDeleted is received when messages
+// are deleted from a connected business account.
+type BusinessMessagesDeleted struct {
+	// Unique identifier of the business connection.
+	BusinessConnectionID string `json:"business_connection_id"`
+
+	// Information about a chat in the business account.
+	// The bot may not have access to the chat or the corresponding user.
+	Chat Chat `json:"chat"`
+
+	// The list of identifiers of deleted messages in the chat.
+	MessageIDs []int `json:"message_ids"`
+}
+
+// BusinessConnection returns information about the connection
+// of the bot with a business account.
+func (b *Bot) BusinessConnection(id string) (*BusinessConnection, error) {
+	params := map[string]string{
+		"business_connection_id": id,
+	}
+
+	data, err := b.Raw("getBusinessConnection", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Result *BusinessConnection
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, wrapError(err)
+	}
+	return resp.Result, nil
+}
+
+// updateBusiness returns the business connection
+// an update comes from or an empty string.
+func updateBusiness(upd Update) string {
+	switch {
+	case upd.BusinessMessage != nil:
+		return upd.BusinessMessage.BusinessConnectionID
+	case upd.EditedBusinessMessage != nil:
+		return upd.EditedBusinessMessage.BusinessConnectionID
+	case upd.DeletedBusinessMessages != nil:
+		return upd.DeletedBusinessMessages.BusinessConnectionID
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusinessMessage(t *testing.T) {
+	var sent []map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		json.NewDecoder(r.Body).Decode(&params)
+		sent = append(sent, params)
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+
+	var deleted []int
+	s := b.Default(Default)
+	s.Handle(OnBusinessMessage, func(msg *Message, m *Machine) error {
+		_, err := m.Send("We are closed, " + msg.Text)
+		return err
+	})
+	s.Handle(OnDeletedBusinessMessages, func(d *BusinessMessagesDeleted, m *Machine) {
+		deleted = d.MessageIDs
+	})
+
+	chat := &Chat{ID: 7, Type: ChatPrivate}
+	b.ProcessUpdate(Update{BusinessMessage: &Message{
+		Sender:               &User{ID: 7},
+		Chat:                 chat,
+		Text:                 "hi",
+		BusinessConnectionID: "conn",
+	}})
+	b.ProcessUpdate(Update{DeletedBusinessMessages: &BusinessMessagesDeleted{
+		BusinessConnectionID: "conn",
+		Chat:                 *chat,
+		MessageIDs:           []int{1, 2},
+	}})
+
+	require.Len(t, sent, 1)
+	assert.Equal(t, "7", sent[0]["chat_id"])
+	assert.Equal(t, "conn", sent[0]["business_connection_id"])
+	assert.Equal(t, []int{1, 2}, deleted)
+
+	// both updates reached the machine of the customer
+	assert.Equal(t, 1, b.Machines().Len())
+}
+
+func TestBusinessConnection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"result":{"id":"conn","user":{"id":3},"user_chat_id":3,"can_reply":true,"is_enabled":true}}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+
+	var chat *Chat
+	b.Default(Default).Handle(OnBusinessConnection, func(c *BusinessConnection, m *Machine) {
+		chat = m.Chat()
+	})
+	b.ProcessUpdate(Update{BusinessConnection: &BusinessConnection{ID: "conn", User: User{ID: 3}, UserChatID: 3}})
+
+	require.NotNil(t, chat)
+	assert.Equal(t, int64(3), chat.ID)
+
+	conn, err := b.BusinessConnection("conn")
+	require.NoError(t, err)
+	assert.True(t, conn.CanReply)
+	assert.Equal(t, 3, conn.User.ID)
+}
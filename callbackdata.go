@@ -0,0 +1,215 @@
+package stb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// MaxCallbackData is the most bytes of callback data Telegram accepts.
+const MaxCallbackData = 64
+
+// ErrCallbackExpired is returned when the overflow store no
+// longer knows the callback data a button refers to.
+var ErrCallbackExpired = errors.New("stb: callback data expired")
+
+// CallbackStore keeps the callback data that doesn't fit
+// into a button, see CallbackCodec.
+type CallbackStore interface {
+	// Put saves the data and returns a short id for it.
+	Put(data []byte) (id string, err error)
+
+	// Get returns the data saved under id or ErrCallbackExpired.
+	Get(id string) ([]byte, error)
+}
+
+// CallbackCodec packs small values into callback data and
+// unpacks them in the handler, instead of formatting and parsing
+// "unique|payload" strings by hand:
+//
+//     type pick struct {
+//         Item int
+//         Page int
+//     }
+//
+//     btn, err := codec.Data("Pick", "pick", pick{Item: 12, Page: 3})
+//     ...
+//     state.Handle(&btn, func(c *stb.Callback, m *stb.Machine) error {
+//         var p pick
+//         if err := codec.Decode(c.Data, &p); err != nil {
+//             return err
+//         }
+//         ...
+//     })
+//
+// Structs are encoded as JSON arrays of their field values to save
+// space. Values that still don't fit are kept in the overflow store,
+// the button only carries their id.
+type CallbackCodec struct {
+	overflow CallbackStore
+}
+
+// NewCallbackCodec creates a codec. Without an overflow store,
+// encoding values that don't fit fails.
+func NewCallbackCodec(overflow CallbackStore) *CallbackCodec {
+	return &CallbackCodec{overflow: overflow}
+}
+
+// Encode returns the callback data carrying v for a button with
+// the unique. The data fits the Telegram limit along with the unique.
+func (c *CallbackCodec) Encode(unique string, v interface{}) (string, error) {
+	data, err := marshalCompact(v)
+	if err != nil {
+		return "", err
+	}
+
+	// "\f" + unique + "|" + kind + data
+	room := MaxCallbackData - len(unique) - 3
+	if len(data) <= room {
+		return "j" + string(data), nil
+	}
+
+	if c.overflow == nil {
+		return "", errors.Errorf("stb: callback data for %q is %d bytes, %d fit", unique, len(data), room)
+	}
+	id, err := c.overflow.Put(data)
+	if err != nil {
+		return "", err
+	}
+	if len(id) > room {
+		return "", errors.Errorf("stb: callback id for %q does not fit", unique)
+	}
+	return "o" + id, nil
+}
+
+// Decode unpacks the callback data into v, which must be a pointer.
+func (c *CallbackCodec) Decode(data string, v interface{}) error {
+	if data == "" {
+		return errors.New("stb: empty callback data")
+	}
+
+	var raw []byte
+	switch data[0] {
+	case 'j':
+		raw = []byte(data[1:])
+	case 'o':
+		if c.overflow == nil {
+			return ErrCallbackExpired
+		}
+		var err error
+		if raw, err = c.overflow.Get(data[1:]); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("stb: bad callback data %q", data)
+	}
+
+	return unmarshalCompact(raw, v)
+}
+
+// Data creates an inline button carrying v, like ReplyMarkup.Data.
+func (c *CallbackCodec) Data(text, unique string, v interface{}) (Btn, error) {
+	data, err := c.Encode(unique, v)
+	if err != nil {
+		return Btn{}, err
+	}
+	return Btn{Text: text, Unique: unique, Data: data}, nil
+}
+
+// marshalCompact encodes structs as arrays of their exported
+// field values and anything else as plain JSON.
+func marshalCompact(v interface{}) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return json.Marshal(v)
+	}
+
+	var fields []interface{}
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Type().Field(i).PkgPath == "" {
+			fields = append(fields, rv.Field(i).Interface())
+		}
+	}
+	return json.Marshal(fields)
+}
+
+func unmarshalCompact(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("stb: callback data must be decoded into a pointer")
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return json.Unmarshal(data, v)
+	}
+
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	n := 0
+	for i := 0; i < rv.NumField() && n < len(fields); i++ {
+		if rv.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		if err := json.Unmarshal(fields[n], rv.Field(i).Addr().Interface()); err != nil {
+			return err
+		}
+		n++
+	}
+	return nil
+}
+
+// MemoryCallbackStore is a CallbackStore keeping the data in memory.
+// Buttons sent before a restart stop working with it, as do the
+// buttons whose data was dropped to make room for newer data.
+type MemoryCallbackStore struct {
+	// Limit is how much data is kept, the oldest data
+	// is dropped beyond it. Zero keeps everything.
+	Limit int
+
+	mu    sync.RWMutex
+	data  map[string][]byte
+	order []string
+}
+
+// NewMemoryCallbackStore creates an empty MemoryCallbackStore
+// keeping the data of the latest 10000 buttons.
+func NewMemoryCallbackStore() *MemoryCallbackStore {
+	return &MemoryCallbackStore{Limit: 10000, data: make(map[string][]byte)}
+}
+
+// Put implements CallbackStore.
+func (s *MemoryCallbackStore) Put(data []byte) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[id] = data
+	s.order = append(s.order, id)
+	for s.Limit > 0 && len(s.order) > s.Limit {
+		delete(s.data, s.order[0])
+		s.order = s.order[1:]
+	}
+	return id, nil
+}
+// Get implements CallbackStore.
+func (s *MemoryCallbackStore) Get(id string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.data[id]
+	if !ok {
+		return nil, ErrCallbackExpired
+	}
+	return data, nil
+}
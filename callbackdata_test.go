@@ -0,0 +1,65 @@
+package stb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbackCodec(t *testing.T) {
+	type pick struct {
+		Item int
+		Page int
+		Name string
+		note string
+	}
+
+	codec := NewCallbackCodec(nil)
+	data, err := codec.Encode("pick", pick{Item: 12, Page: 3, Name: "a|b", note: "x"})
+	require.NoError(t, err)
+	assert.Equal(t, `j[12,3,"a|b"]`, data)
+
+	var got pick
+	require.NoError(t, codec.Decode(data, &got))
+	assert.Equal(t, pick{Item: 12, Page: 3, Name: "a|b"}, got)
+
+	var n int
+	data, err = codec.Encode("n", 42)
+	require.NoError(t, err)
+	require.NoError(t, codec.Decode(data, &n))
+	assert.Equal(t, 42, n)
+
+	long := pick{Name: strings.Repeat("x", 100)}
+	_, err = codec.Encode("pick", long)
+	assert.Error(t, err)
+
+	codec = NewCallbackCodec(NewMemoryCallbackStore())
+	btn, err := codec.Data("Pick", "pick", long)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(btn.CallbackUnique()+"|"+btn.Data), MaxCallbackData)
+
+	got = pick{}
+	require.NoError(t, codec.Decode(btn.Data, &got))
+	assert.Equal(t, long, got)
+	assert.Equal(t, ErrCallbackExpired, codec.Decode("o0000", &got))
+}
+
+func TestMemoryCallbackStoreLimit(t *testing.T) {
+	s := NewMemoryCallbackStore()
+	s.Limit = 2
+
+	first, err := s.Put([]byte("1"))
+	require.NoError(t, err)
+	s.Put([]byte("2"))
+	last, err := s.Put([]byte("3"))
+	require.NoError(t, err)
+
+	_, err = s.Get(first)
+	assert.Equal(t, ErrCallbackExpired, err)
+	data, err := s.Get(last)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("3"), data)
+	assert.Len(t, s.data, 2)
+}
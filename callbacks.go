@@ -69,12 +69,13 @@ type InlineButton struct {
 	// It will be used as a callback endpoint.
 	Unique string `json:"unique,omitempty"`
 
-	Text            string `json:"text"`
-	URL             string `json:"url,omitempty"`
-	Data            string `json:"callback_data,omitempty"`
-	InlineQuery     string `json:"switch_inline_query,omitempty"`
-	InlineQueryChat string `json:"switch_inline_query_current_chat"`
-	Login           *Login `json:"login_url,omitempty"`
+	Text            string      `json:"text"`
+	URL             string      `json:"url,omitempty"`
+	Data            string      `json:"callback_data,omitempty"`
+	InlineQuery     string      `json:"switch_inline_query,omitempty"`
+	InlineQueryChat string      `json:"switch_inline_query_current_chat"`
+	Login           *Login      `json:"login_url,omitempty"`
+	WebApp          *WebAppInfo `json:"web_app,omitempty"`
 }
 
 // With returns a copy of the button with data.
@@ -86,6 +87,7 @@ func (t *InlineButton) With(data string) *InlineButton {
 		InlineQuery:     t.InlineQuery,
 		InlineQueryChat: t.InlineQueryChat,
 		Login:           t.Login,
+		WebApp:          t.WebApp,
 		Data:            data,
 	}
 }
@@ -120,11 +122,11 @@ type Login struct {
 
 // MarshalJSON implements json.Marshaler interface.
 // It needed to avoid InlineQueryChat and Login fields conflict.
-// If you have Login field in your button, InlineQueryChat must be skipped.
+// If you have Login or WebApp field in your button, InlineQueryChat must be skipped.
 func (t *InlineButton) MarshalJSON() ([]byte, error) {
 	type InlineButtonJSON InlineButton
 
-	if t.Login != nil {
+	if t.Login != nil || t.WebApp != nil {
 		return json.Marshal(struct {
 			InlineButtonJSON
 			InlineQueryChat string `json:"switch_inline_query_current_chat,omitempty"`
@@ -0,0 +1,208 @@
+package stb
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Captcha verifies the users joining a group. It restricts a newcomer,
+// asks them to press the button with a given emoji and lifts the
+// restrictions once they do. Newcomers who press another button or
+// don't answer in time are kicked, they may join again. Each newcomer
+// solves the captcha in their own machine, which needs a scope keying
+// machines by user (ScopeUser or ScopeChatUser).
+//
+// Example:
+//
+//     captcha := stb.NewCaptcha("captcha")
+//     captcha.Timeout = time.Minute
+//     captcha.Passed = "Welcome, %s!"
+//
+//     if err := captcha.Register(b, stb.Default); err != nil {
+//         log.Fatal(err)
+//     }
+//     b.Handle(stb.OnUserJoined, captcha.Join)
+//
+type Captcha struct {
+	// Timeout is how long newcomers have to answer.
+	Timeout time.Duration // Default: 2 minutes
+
+	// Prompt is the challenge, formatted with the first
+	// name of the newcomer and the emoji to press.
+	Prompt string // Default: "%s, please press %s to show you are human."
+
+	// Passed and Failed are sent to the group, formatted with
+	// the first name of the newcomer, once they pass or fail.
+	// Nothing is sent if they are empty.
+	Passed, Failed string
+
+	// Choices are the emojis of the buttons, one of them is the answer.
+	Choices []string // Default: 🍎 🍌 🍇 🍒 🍋 🥝
+
+	// Rights are given to the newcomers who pass.
+	Rights Rights // Default: NoRestrictions()
+
+	// Done is called with the outcome, before the machine leaves the captcha.
+	Done func(m *Machine, passed bool)
+
+	name  string
+	exit  StateType
+	leave EventType
+	bot   *Bot
+}
+
+// challenge is what the machine remembers about its captcha.
+type challenge struct {
+	Answer string        `json:"answer"`
+	Prompt StoredMessage `json:"prompt"`
+}
+
+// NewCaptcha creates a captcha with the default settings. The name
+// prefixes the states, events and session key the captcha uses.
+func NewCaptcha(name string) *Captcha {
+	return &Captcha{
+		Timeout: 2 * time.Minute,
+		Prompt:  "%s, please press %s to show you are human.",
+		Choices: []string{"🍎", "🍌", "🍇", "🍒", "🍋", "🥝"},
+		Rights:  NoRestrictions(),
+		name:    name,
+		leave:   EventType(name + ":leave"),
+	}
+}
+
+// Event returns the global event starting the captcha.
+func (c *Captcha) Event() EventType {
+	return EventType(c.name)
+}
+
+// State returns the state newcomers are in while they solve the captcha.
+func (c *Captcha) State() StateType {
+	return StateType(c.name)
+}
+
+// Register creates the states of the captcha in the bot.
+// Passing and failing the captcha both lead to exit.
+func (c *Captcha) Register(b *Bot, exit StateType) error {
+	if len(c.Choices) < 2 {
+		return errors.Errorf("stb: captcha %q needs two choices at least", c.name)
+	}
+	c.bot, c.exit = b, exit
+
+	b.Event(c.Event(), c.State())
+
+	s := b.State(c.State())
+	s.Event(c.leave, exit)
+	s.Timeout(c.Timeout, StateType(c.name+"/expired"))
+	s.Action(c.ask)
+	s.MustHandle(&Btn{Unique: c.name + "-pick"}, c.pick)
+
+	expired := b.State(StateType(c.name + "/expired"))
+	expired.Event(c.leave, exit)
+	expired.Action(func(m *Machine) {
+		c.finish(m, false)
+		m.report(m.raise(c.leave, nil))
+	})
+
+	return nil
+}
+
+// Join is the OnUserJoined handler starting the captcha
+// for the newcomer. Bots are let in right away.
+func (c *Captcha) Join(msg *Message, _ *Machine) error {
+	user := msg.UserJoined
+	if user == nil || user.IsBot || msg.Chat == nil {
+		return nil
+	}
+
+	joined := Update{Message: &Message{
+		Sender:       user,
+		Chat:         msg.Chat,
+		ThreadID:     msg.ThreadID,
+		TopicMessage: msg.TopicMessage,
+	}}
+	id := c.bot.scope(joined)
+	if id == "" {
+		return nil
+	}
+	m := c.bot.machines.obtain(id, user)
+	m.touch(msg.Chat, updateThread(joined), "")
+	return m.SendEvent(c.Event())
+}
+
+// ask restricts the newcomer and sends the challenge.
+func (c *Captcha) ask(m *Machine) {
+	if err := m.Restrict(nil, NoRights(), 0); err != nil {
+		m.report(err)
+		return
+	}
+
+	choices := rand.Perm(len(c.Choices))
+	answer := c.Choices[choices[0]]
+	rand.Shuffle(len(choices), func(i, j int) {
+		choices[i], choices[j] = choices[j], choices[i]
+	})
+
+	var row Row
+	for _, i := range choices {
+		row = append(row, Btn{Unique: c.name + "-pick", Text: c.Choices[i], Data: strconv.Itoa(i)})
+	}
+	markup := &ReplyMarkup{}
+	markup.Inline(row)
+
+	msg, err := m.Send(fmt.Sprintf(c.Prompt, m.User().FirstName, answer), markup)
+	if err != nil {
+		m.report(err)
+		return
+	}
+
+	id, chat := msg.MessageSig()
+	m.report(m.Session().Set(c.name, challenge{
+		Answer: answer,
+		Prompt: StoredMessage{MessageID: id, ChatID: chat},
+	}))
+}
+
+// pick checks the button pressed.
+func (c *Captcha) pick(cb *Callback, m *Machine) error {
+	if err := c.bot.Respond(cb); err != nil {
+		return err
+	}
+
+	var ch challenge
+	m.Session().Get(c.name, &ch)
+	i, err := strconv.Atoi(cb.Data)
+	passed := err == nil && i >= 0 && i < len(c.Choices) && c.Choices[i] == ch.Answer
+
+	c.finish(m, passed)
+	return m.SendEvent(c.leave)
+}
+
+// finish lets the newcomer in or kicks them, and cleans up.
+func (c *Captcha) finish(m *Machine, passed bool) {
+	var ch challenge
+	if m.Session().Get(c.name, &ch) && ch.Prompt.MessageID != "" {
+		m.report(m.Delete(ch.Prompt))
+	}
+	m.Session().Delete(c.name)
+
+	text := c.Failed
+	if passed {
+		text = c.Passed
+		m.report(m.Restrict(nil, c.Rights, 0))
+	} else {
+		m.report(m.Ban(nil, 0))
+		m.report(m.Unban(nil))
+	}
+	if text != "" {
+		_, err := m.Send(fmt.Sprintf(text, m.User().FirstName))
+		m.report(err)
+	}
+
+	if c.Done != nil {
+		c.Done(m, passed)
+	}
+}
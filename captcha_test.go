@@ -0,0 +1,81 @@
+package stb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptcha(t *testing.T) {
+	api := newFakeAPI(t, `{"message_id":7,"chat":{"id":-100}}`)
+	b, err := NewBot(api.Settings())
+	require.NoError(t, err)
+	b.Default(Default)
+
+	var outcomes []bool
+	captcha := NewCaptcha("captcha")
+	captcha.Passed = "Welcome, %s!"
+	captcha.Done = func(_ *Machine, passed bool) { outcomes = append(outcomes, passed) }
+	require.NoError(t, captcha.Register(b, Default))
+	b.Handle(OnUserJoined, captcha.Join)
+
+	group := &Chat{ID: -100, Type: ChatSuperGroup}
+	join := func(user *User) {
+		b.ProcessUpdate(Update{Message: &Message{Chat: group, Sender: user, UserJoined: user}})
+	}
+	press := func(user *User, answer bool) {
+		var ch challenge
+		require.True(t, b.machine(user).Session().Get("captcha", &ch))
+		for i, choice := range captcha.Choices {
+			if (choice == ch.Answer) == answer {
+				data := "\fcaptcha-pick|" + strconv.Itoa(i)
+				b.ProcessUpdate(Update{Callback: &Callback{Sender: user, Message: &Message{ID: 7, Chat: group}, Data: data}})
+				return
+			}
+		}
+	}
+
+	alice := &User{ID: 1, FirstName: "Alice"}
+	join(alice)
+	assert.Equal(t, captcha.State(), b.machine(alice).Current())
+	assert.Equal(t, []string{"restrictChatMember", "sendMessage"}, api.Methods())
+
+	press(alice, true)
+	assert.Equal(t, Default, b.machine(alice).Current())
+	assert.False(t, b.machine(alice).Session().Has("captcha"))
+	assert.Equal(t, []string{"answerCallbackQuery", "deleteMessage", "restrictChatMember", "sendMessage"}, api.Methods())
+
+	bob := &User{ID: 2, FirstName: "Bob"}
+	join(bob)
+	api.Methods()
+	press(bob, false)
+	assert.Equal(t, Default, b.machine(bob).Current())
+	assert.Equal(t, []string{"answerCallbackQuery", "deleteMessage", "kickChatMember", "unbanChatMember"}, api.Methods())
+
+	join(&User{ID: 3, IsBot: true})
+	assert.Empty(t, api.Methods())
+
+	captcha.Timeout = 10 * time.Millisecond
+	require.NoError(t, captcha.Register(b, Default))
+	carol := &User{ID: 3, FirstName: "Carol"}
+	join(carol)
+	assert.Eventually(t, func() bool {
+		return b.machine(carol).Current() == Default
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []bool{true, false, false}, outcomes)
+	history := b.machine(carol).History()
+	assert.Equal(t, StateType("captcha/expired"), history[len(history)-1])
+
+	// the challenge goes to the topic the newcomer joined in
+	dave := &User{ID: 4, FirstName: "Dave"}
+	api.Calls()
+	b.ProcessUpdate(Update{Message: &Message{Chat: group, Sender: dave, UserJoined: dave, ThreadID: 5, TopicMessage: true}})
+	calls := api.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "5", calls[1].Param("message_thread_id"))
+
+	assert.Error(t, (&Captcha{name: "none"}).Register(b, Default))
+}
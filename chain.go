@@ -0,0 +1,88 @@
+package stb
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Stop is returned by a handler of a Chain to skip the handlers
+// after it. The chain itself then returns no error.
+var Stop = errors.New("stb: stop the chain")
+
+// Chain returns a handler running the handlers one after the other,
+// e.g. to log, validate and then act on an update, until one of
+// them returns an error. Stop ends the chain without an error,
+// other errors end it and are returned. The handlers must take
+// the same arguments, with or without an error result, Chain
+// panics otherwise.
+//
+// Example:
+//
+//     b.Handle("/pay", stb.Chain(audit, requireAmount, pay))
+//
+//     func requireAmount(msg *stb.Message, m *stb.Machine) error {
+//         if msg.Payload == "" {
+//             m.Send("Usage: /pay <amount>")
+//             return stb.Stop
+//         }
+//         return nil
+//     }
+//
+func Chain(handlers ...interface{}) interface{} {
+	if len(handlers) == 0 {
+		panic("stb: Chain needs handlers")
+	}
+
+	funcs := make([]reflect.Value, len(handlers))
+	var in []reflect.Type
+	for i, handler := range handlers {
+		h := reflect.ValueOf(handler)
+		if h.Kind() != reflect.Func || !returnsError(h.Type()) {
+			panic(fmt.Sprintf("stb: Chain handler %d must be a function returning nothing or an error", i))
+		}
+		args, _ := handlerArgs(h.Type())
+		if i == 0 {
+			in = args
+		} else if !sameTypes(in, args) {
+			panic(fmt.Sprintf("stb: Chain handler %d takes other arguments than the first", i))
+		}
+		funcs[i] = h
+	}
+
+	chained := reflect.FuncOf(in, []reflect.Type{errorType}, false)
+	return reflect.MakeFunc(chained, func(args []reflect.Value) []reflect.Value {
+		var err error
+		for _, h := range funcs {
+			out := h.Call(args)
+			if len(out) == 0 || out[0].IsNil() {
+				continue
+			}
+			if err = out[0].Interface().(error); errors.Cause(err) == Stop {
+				err = nil
+			}
+			break
+		}
+		return []reflect.Value{reflect.ValueOf(&err).Elem()}
+	}).Interface()
+}
+
+// returnsError reports whether the function
+// returns nothing or only an error.
+func returnsError(t reflect.Type) bool {
+	return t.NumOut() == 0 || t.NumOut() == 1 && t.Out(0) == errorType
+}
+
+// sameTypes reports whether both lists hold the same types.
+func sameTypes(a, b []reflect.Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
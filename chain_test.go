@@ -0,0 +1,65 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	audit := func(msg *Message, m *Machine) {
+		calls = append(calls, "audit")
+	}
+	validate := func(msg *Message, m *Machine) error {
+		calls = append(calls, "validate")
+		if msg.Payload == "" {
+			return Stop
+		}
+		if msg.Payload == "fail" {
+			return errors.New("invalid")
+		}
+		return nil
+	}
+	pay := func(msg *Message, m *Machine) error {
+		calls = append(calls, "pay")
+		return nil
+	}
+
+	chained, ok := Chain(audit, validate, pay).(func(*Message, *Machine) error)
+	require.True(t, ok)
+
+	assert.NoError(t, chained(&Message{}, nil))
+	assert.Equal(t, []string{"audit", "validate"}, calls)
+
+	calls = nil
+	assert.EqualError(t, chained(&Message{Payload: "fail"}, nil), "invalid")
+	assert.Equal(t, []string{"audit", "validate"}, calls)
+
+	calls = nil
+	assert.NoError(t, chained(&Message{Payload: "10"}, nil))
+	assert.Equal(t, []string{"audit", "validate", "pay"}, calls)
+
+	// a wrapped Stop ends the chain as well
+	calls = nil
+	stop := func(*Message, *Machine) error { return errors.Wrap(Stop, "paid already") }
+	chained = Chain(stop, pay).(func(*Message, *Machine) error)
+	assert.NoError(t, chained(&Message{}, nil))
+	assert.Empty(t, calls)
+
+	assert.Panics(t, func() { Chain() })
+	assert.Panics(t, func() { Chain(audit, func(*Callback, *Machine) {}) })
+	assert.Panics(t, func() { Chain(audit, 1) })
+	assert.Panics(t, func() { Chain(func(*Message, *Machine) bool { return true }) })
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+	b.Default(Default)
+	require.NoError(t, b.Handle("/pay", Chain(audit, validate, pay)))
+
+	calls = nil
+	b.ProcessUpdate(Update{Message: &Message{Text: "/pay 10", Sender: &User{ID: 1}, Chat: &Chat{ID: 1}}})
+	assert.Equal(t, []string{"audit", "validate", "pay"}, calls)
+}
@@ -1,6 +1,9 @@
 package stb
 
-import "strconv"
+import (
+	"strconv"
+	"time"
+)
 
 // User object represents a Telegram user, bot.
 type User struct {
@@ -85,6 +88,9 @@ type ChatMember struct {
 	Title     string       `json:"custom_title"`
 	Anonymous bool         `json:"is_anonymous"`
 
+	// (Restricted only) True, if the user is a member of the chat.
+	IsMember bool `json:"is_member,omitempty"`
+
 	// Date when restrictions will be lifted for the user, unix time.
 	//
 	// If user is restricted for more than 366 days or less than
@@ -96,6 +102,33 @@ type ChatMember struct {
 	RestrictedUntil int64 `json:"until_date,omitempty"`
 }
 
+// Admin tells whether the member is the creator or an administrator.
+func (m *ChatMember) Admin() bool {
+	return m.Role == Creator || m.Role == Administrator
+}
+
+// InChat tells whether the user is currently a member of the chat,
+// restricted members included.
+func (m *ChatMember) InChat() bool {
+	switch m.Role {
+	case Creator, Administrator, Member:
+		return true
+	case Restricted:
+		return m.IsMember
+	default:
+		return false
+	}
+}
+
+// Until returns the moment the restrictions or the ban of the
+// member end, the zero time if they last forever.
+func (m *ChatMember) Until() time.Time {
+	if m.RestrictedUntil == 0 {
+		return time.Time{}
+	}
+	return time.Unix(m.RestrictedUntil, 0)
+}
+
 // ChatID represents a chat or an user integer ID, which can be used
 // as recipient in bot methods. It is very useful in cases where
 // you have special group IDs, for example in your config, and don't
@@ -0,0 +1,97 @@
+package stb
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// chatActionEvery is how often chat actions are sent again,
+// they fade out after 5 seconds.
+var chatActionEvery = 4 * time.Second
+
+// Typing shows the bot typing in the chat of the machine until stop
+// is called, see ChatAction.
+//
+// Example:
+//
+//     defer m.Typing()()
+//     report := buildReport()
+//
+func (m *Machine) Typing() (stop func()) {
+	return m.ChatAction(Typing)
+}
+
+// ChatAction shows the action in the chat of the machine until
+// stop is called. The action is sent right away and again every
+// few seconds, since Telegram stops showing it after 5 seconds.
+// A message sent by the bot hides it only until it is sent again,
+// so call stop before sending the result. Errors go to the
+// reporter of the machine.
+func (m *Machine) ChatAction(action ChatAction) (stop func()) {
+	done, finished := make(chan struct{}), make(chan struct{})
+	notify := func() {
+		to := m.recipient()
+		if to == nil {
+			return
+		}
+		if err := m.bot.Notify(to, action); err != nil && m.reporter != nil {
+			m.reporter(err)
+		}
+	}
+
+	notify()
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(chatActionEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				notify()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-finished
+	}
+}
+
+// WithChatAction shows the action in the chat of the machine for as
+// long as the handler runs. The handler must take a *Machine,
+// WithChatAction panics otherwise.
+//
+// Example:
+//
+//     b.Handle("/report", stb.WithChatAction(stb.UploadingDocument, sendReport))
+//
+func WithChatAction(action ChatAction, handler interface{}) interface{} {
+	h := reflect.ValueOf(handler)
+	if h.Kind() != reflect.Func {
+		panic("stb: WithChatAction needs a handler function")
+	}
+
+	in, machineArg := handlerArgs(h.Type())
+	if machineArg < 0 {
+		panic("stb: WithChatAction needs a handler taking a *Machine")
+	}
+
+	wrapped := reflect.FuncOf(in, []reflect.Type{errorType}, false)
+	return reflect.MakeFunc(wrapped, func(args []reflect.Value) []reflect.Value {
+		if m := args[machineArg].Interface().(*Machine); m != nil && m.bot != nil {
+			defer m.ChatAction(action)()
+		}
+
+		out := h.Call(args)
+		if len(out) == 0 {
+			var err error
+			return []reflect.Value{reflect.ValueOf(&err).Elem()}
+		}
+		return out
+	}).Interface()
+}
@@ -0,0 +1,57 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithChatAction(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		actions []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sendChatAction") {
+			var params map[string]string
+			json.NewDecoder(r.Body).Decode(&params)
+			mu.Lock()
+			actions = append(actions, params["action"])
+			mu.Unlock()
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	every := chatActionEvery
+	chatActionEvery = 20 * time.Millisecond
+	defer func() { chatActionEvery = every }()
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+	b.Default(Default)
+	b.Handle("/report", WithChatAction(UploadingDocument, func(msg *Message, m *Machine) {
+		time.Sleep(70 * time.Millisecond)
+	}))
+	assert.Panics(t, func() { WithChatAction(Typing, func(*Poll) {}) })
+
+	b.ProcessUpdate(Update{Message: &Message{Text: "/report", Sender: &User{ID: 1}, Chat: &Chat{ID: 1}}})
+
+	mu.Lock()
+	count := len(actions)
+	assert.GreaterOrEqual(t, count, 3)
+	assert.Equal(t, "upload_document", actions[0])
+	mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, count, len(actions))
+	mu.Unlock()
+}
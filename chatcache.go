@@ -0,0 +1,197 @@
+package stb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ChatCache keeps the responses of the read-mostly API calls about
+// chats, so that group management bots don't ask Telegram about the
+// same chat for every update. The updates telling about a change of
+// the chat, like a new title or a member joining, and the calls of
+// the bot changing it, like setChatTitle or promoteChatMember, drop
+// the responses they make stale.
+//
+// It is set with Settings.ChatCache and sits in front of the API
+// middleware, which cached responses skip.
+//
+// Example:
+//
+//     cache := stb.NewChatCache()
+//     cache.TTL["getChat"] = time.Hour
+//     b, _ := stb.NewBot(stb.Settings{ChatCache: cache})
+//
+type ChatCache struct {
+	// TTL is how long the responses of each method are kept.
+	// Methods it does not list are not cached. It must not
+	// change once the bot is created.
+	TTL map[string]time.Duration
+
+	// entries are keyed by chat, then by method.
+	mu      sync.Mutex
+	entries map[string]map[string]cachedResponse
+
+	// swept is when the expired responses were last dropped.
+	swept time.Time
+}
+
+// chatCacheSweep is how often the expired responses are dropped.
+const chatCacheSweep = time.Minute
+
+type cachedResponse struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewChatCache creates a ChatCache keeping getChat for 10 minutes,
+// getChatAdministrators for 5 minutes and getChatMemberCount
+// for a minute.
+func NewChatCache() *ChatCache {
+	return &ChatCache{
+		TTL: map[string]time.Duration{
+			"getChat":               10 * time.Minute,
+			"getChatAdministrators": 5 * time.Minute,
+			"getChatMemberCount":    time.Minute,
+			"getChatMembersCount":   time.Minute,
+		},
+		entries: make(map[string]map[string]cachedResponse),
+	}
+}
+
+// chatWrites are the methods changing what the cached methods tell.
+var chatWrites = map[string]bool{
+	"setChatTitle":                    true,
+	"setChatDescription":              true,
+	"setChatPhoto":                    true,
+	"deleteChatPhoto":                 true,
+	"setChatPermissions":              true,
+	"setChatStickerSet":               true,
+	"deleteChatStickerSet":            true,
+	"pinChatMessage":                  true,
+	"unpinChatMessage":                true,
+	"unpinAllChatMessages":            true,
+	"promoteChatMember":               true,
+	"restrictChatMember":              true,
+	"banChatMember":                   true,
+	"kickChatMember":                  true,
+	"unbanChatMember":                 true,
+	"setChatAdministratorCustomTitle": true,
+	"leaveChat":                       true,
+}
+
+// middleware answers the cached calls from the cache.
+func (c *ChatCache) middleware(next APIHandler) APIHandler {
+	return func(call *APICall) ([]byte, error) {
+		id, ok := call.Param("chat_id")
+		if !ok {
+			return next(call)
+		}
+		chat := fmt.Sprint(id)
+
+		ttl, cached := c.TTL[call.Method]
+		if !cached {
+			data, err := next(call)
+			if chatWrites[call.Method] && err == nil {
+				c.forget(chat)
+			}
+			return data, err
+		}
+
+		c.mu.Lock()
+		entry, ok := c.entries[chat][call.Method]
+		c.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.data, nil
+		}
+
+		data, err := next(call)
+		if err != nil {
+			return nil, err
+		}
+		c.store(chat, call.Method, data, ttl)
+		return data, nil
+	}
+}
+
+func (c *ChatCache) store(chat, method string, data []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.swept) >= chatCacheSweep {
+		c.sweep(now)
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[string]map[string]cachedResponse)
+	}
+	methods, ok := c.entries[chat]
+	if !ok {
+		methods = make(map[string]cachedResponse)
+		c.entries[chat] = methods
+	}
+	methods[method] = cachedResponse{data: data, expires: now.Add(ttl)}
+}
+
+// sweep drops the expired responses, so that the cache
+// doesn't grow with every chat ever asked about. The
+// caller must hold mu.
+func (c *ChatCache) sweep(now time.Time) {
+	for chat, methods := range c.entries {
+		for method, entry := range methods {
+			if !now.Before(entry.expires) {
+				delete(methods, method)
+			}
+		}
+		if len(methods) == 0 {
+			delete(c.entries, chat)
+		}
+	}
+	c.swept = now
+}
+
+// Forget drops the cached responses about the chat.
+func (c *ChatCache) Forget(chat *Chat) {
+	c.forget(chat.Recipient())
+}
+
+func (c *ChatCache) forget(chat string, methods ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(methods) == 0 {
+		delete(c.entries, chat)
+		return
+	}
+	for _, method := range methods {
+		delete(c.entries[chat], method)
+	}
+	if len(c.entries[chat]) == 0 {
+		delete(c.entries, chat)
+	}
+}
+
+// observe drops the responses the update makes stale.
+func (c *ChatCache) observe(upd Update) {
+	counts := []string{"getChatMemberCount", "getChatMembersCount"}
+
+	switch {
+	case upd.MyChatMember != nil:
+		c.Forget(&upd.MyChatMember.Chat)
+	case upd.ChatMember != nil:
+		c.forget(upd.ChatMember.Chat.Recipient(), append(counts, "getChatAdministrators")...)
+	case upd.Message != nil && upd.Message.Chat != nil:
+		msg := upd.Message
+		chat := msg.Chat.Recipient()
+		switch {
+		case msg.NewGroupTitle != "" || msg.NewGroupPhoto != nil || msg.GroupPhotoDeleted ||
+			msg.PinnedMessage != nil:
+			c.forget(chat, "getChat")
+		case msg.MigrateTo != 0:
+			c.forget(chat)
+		case msg.UserJoined != nil || len(msg.UsersJoined) > 0 || msg.UserLeft != nil:
+			c.forget(chat, counts...)
+		}
+	}
+}
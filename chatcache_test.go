@@ -0,0 +1,71 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatCache(t *testing.T) {
+	api := newFakeAPI(t, "true")
+	api.Result = func(call apiCall) string {
+		switch call.Method {
+		case "getChat":
+			return `{"id":-100,"type":"supergroup","title":"Old"}`
+		case "getChatMembersCount":
+			return "42"
+		}
+		return "true"
+	}
+
+	settings := api.Settings()
+	settings.ChatCache = NewChatCache()
+	b, err := NewBot(settings)
+	require.NoError(t, err)
+	b.Default(Default)
+
+	chat := &Chat{ID: -100, Type: ChatSuperGroup}
+	for i := 0; i < 2; i++ {
+		_, err = b.ChatByID("-100")
+		require.NoError(t, err)
+		n, err := b.Len(chat)
+		require.NoError(t, err)
+		assert.Equal(t, 42, n)
+	}
+	assert.Equal(t, 1, api.Count("getChat"))
+	assert.Equal(t, 1, api.Count("getChatMembersCount"))
+
+	// a member joining only drops the count
+	b.ProcessUpdate(Update{Message: &Message{Chat: chat, Sender: &User{ID: 1}, UserJoined: &User{ID: 2}}})
+	b.ChatByID("-100")
+	b.Len(chat)
+	assert.Equal(t, 1, api.Count("getChat"))
+	assert.Equal(t, 2, api.Count("getChatMembersCount"))
+
+	// changes made by the bot drop the whole chat
+	require.NoError(t, b.SetGroupTitle(chat, "New"))
+	b.ChatByID("-100")
+	b.Len(chat)
+	assert.Equal(t, 2, api.Count("getChat"))
+	assert.Equal(t, 3, api.Count("getChatMembersCount"))
+}
+
+func TestChatCacheSweep(t *testing.T) {
+	cache := NewChatCache()
+	cache.store("-1", "getChat", []byte("{}"), -time.Second)
+	cache.store("-2", "getChat", []byte("{}"), time.Minute)
+	assert.Len(t, cache.entries, 2)
+
+	// the next store after a while drops the expired responses
+	cache.swept = time.Now().Add(-chatCacheSweep)
+	cache.store("-2", "getChatAdministrators", []byte("[]"), time.Minute)
+	assert.Len(t, cache.entries, 1)
+	assert.Len(t, cache.entries["-2"], 2)
+
+	cache.forget("-2", "getChat")
+	assert.Len(t, cache.entries["-2"], 1)
+	cache.forget("-2", "getChatAdministrators")
+	assert.Empty(t, cache.entries)
+}
@@ -0,0 +1,229 @@
+package stb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PaymentSucceeded and PaymentFailed are the events a Checkout
+// sends to the machine once the payment is done or failed.
+// The payload is the *Payment or the error.
+const (
+	PaymentSucceeded EventType = "payment_succeeded"
+	PaymentFailed    EventType = "payment_failed"
+)
+
+// ErrCheckoutExpired is the payload of PaymentFailed
+// when the user did not pay before Checkout.Timeout.
+var ErrCheckoutExpired = errors.New("stb: checkout expired")
+
+// Checkout takes a machine through a payment: it sends the invoice,
+// answers the shipping and pre-checkout queries and waits for the
+// payment. Queries are answered within Telegram's 10 seconds, even if
+// Shipping or Validate take longer, and queries about another invoice
+// than the one sent are turned down.
+//
+// The checkout is a child state of the state it is registered
+// under, which must handle PaymentSucceeded and PaymentFailed.
+//
+// Example:
+//
+//     checkout := stb.NewCheckout("checkout")
+//     checkout.Invoice = func(m *stb.Machine) (*stb.Invoice, error) {
+//         return cart(m).Invoice(), nil
+//     }
+//     checkout.Validate = func(q *stb.PreCheckoutQuery, m *stb.Machine) error {
+//         return stock.Reserve(m.Context(), q.Payload)
+//     }
+//
+//     if err := checkout.Register(b, Cart); err != nil {
+//         log.Fatal(err)
+//     }
+//     cart.Event(stb.PaymentSucceeded, Thanks)
+//     cart.Event(stb.PaymentFailed, Cart)
+//
+//     cart.Handle("/pay", func(_ *stb.Message, m *stb.Machine) error {
+//         return m.SendEvent(checkout.Event())
+//     })
+//
+type Checkout struct {
+	// Invoice returns the invoice to send. Its payload is
+	// generated if empty. Required.
+	Invoice func(m *Machine) (*Invoice, error)
+
+	// Shipping returns the shipping options for the address of
+	// flexible invoices. The error is shown to the user.
+	Shipping func(q *ShippingQuery, m *Machine) ([]ShippingOption, error)
+
+	// Validate approves the order right before the payment.
+	// The error is shown to the user. Optional.
+	Validate func(q *PreCheckoutQuery, m *Machine) error
+
+	// AnswerWithin is how long Shipping and Validate may take
+	// before the query is turned down with Busy. The context
+	// of their machine is cancelled then.
+	AnswerWithin time.Duration // Default: 8s
+
+	// Busy is shown to the user when a query is answered too late,
+	// Mismatch when it is about another invoice.
+	Busy     string // Default: "Please try again in a moment."
+	Mismatch string // Default: "This invoice has expired."
+
+	// Timeout is how long the user has to pay.
+	Timeout time.Duration // Default: 30 minutes
+
+	name string
+}
+
+// NewCheckout creates a checkout with the default settings. The name
+// prefixes the states, events and session key the checkout uses.
+func NewCheckout(name string) *Checkout {
+	return &Checkout{
+		AnswerWithin: 8 * time.Second,
+		Busy:         "Please try again in a moment.",
+		Mismatch:     "This invoice has expired.",
+		Timeout:      30 * time.Minute,
+		name:         name,
+	}
+}
+
+// Event returns the global event starting the checkout.
+func (c *Checkout) Event() EventType {
+	return EventType(c.name)
+}
+
+// State returns the state machines are in while they pay.
+func (c *Checkout) State() StateType {
+	return StateType(c.name)
+}
+
+// Register creates the states of the checkout in the bot,
+// as children of the parent state.
+func (c *Checkout) Register(b *Bot, parent StateType) error {
+	if c.Invoice == nil {
+		return errors.Errorf("stb: checkout %q has no invoice", c.name)
+	}
+
+	b.Event(c.Event(), c.State())
+
+	s := b.State(c.State())
+	s.Parent(parent)
+	s.Timeout(c.Timeout, StateType(c.name+"/expired"))
+	s.Action(c.send)
+	s.MustHandle(OnShipping, c.ship)
+	s.MustHandle(OnCheckout, c.checkout)
+	s.MustHandle(OnPayment, c.pay)
+
+	expired := b.State(StateType(c.name + "/expired"))
+	expired.Parent(parent)
+	expired.Action(func(m *Machine) {
+		c.fail(m, ErrCheckoutExpired)
+	})
+
+	return nil
+}
+
+// send sends the invoice and remembers its payload.
+func (c *Checkout) send(m *Machine) {
+	invoice, err := c.Invoice(m)
+	if err != nil {
+		c.fail(m, err)
+		return
+	}
+
+	if invoice.Payload == "" {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			c.fail(m, err)
+			return
+		}
+		invoice.Payload = c.name + ":" + hex.EncodeToString(id)
+	}
+	if err := m.Session().Set(c.name, invoice.Payload); err != nil {
+		c.fail(m, err)
+		return
+	}
+
+	if _, err := m.Send(invoice); err != nil {
+		c.fail(m, err)
+	}
+}
+
+// fail sends PaymentFailed from the actions of the checkout.
+func (c *Checkout) fail(m *Machine, cause error) {
+	m.Session().Delete(c.name)
+	if err := m.raise(PaymentFailed, cause); err != nil {
+		m.report(errors.Wrapf(err, "stb: checkout failed with %v", cause))
+	}
+}
+
+// expected reports whether the payload is the one of the invoice sent.
+func (c *Checkout) expected(m *Machine, payload string) bool {
+	var sent string
+	return m.Session().Get(c.name, &sent) && sent == payload
+}
+
+// within runs f, giving up after AnswerWithin and
+// cancelling the context of the machine it gets.
+func (c *Checkout) within(m *Machine, f func(m *Machine) error) error {
+	ctx, cancel := context.WithTimeout(m.Context(), c.AnswerWithin)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- f(m.withContext(ctx)) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.New(c.Busy)
+	}
+}
+
+func (c *Checkout) ship(q *ShippingQuery, m *Machine) error {
+	if !c.expected(m, q.Payload) {
+		return m.bot.Ship(q, c.Mismatch)
+	}
+	if c.Shipping == nil {
+		return m.bot.Ship(q, "Shipping is not available.")
+	}
+
+	var options []ShippingOption
+	err := c.within(m, func(m *Machine) (err error) {
+		options, err = c.Shipping(q, m)
+		return err
+	})
+	if err != nil {
+		return m.bot.Ship(q, err.Error())
+	}
+
+	what := make([]interface{}, len(options))
+	for i, option := range options {
+		what[i] = option
+	}
+	return m.bot.Ship(q, what...)
+}
+
+func (c *Checkout) checkout(q *PreCheckoutQuery, m *Machine) error {
+	if !c.expected(m, q.Payload) {
+		return m.bot.Accept(q, c.Mismatch)
+	}
+	if c.Validate != nil {
+		if err := c.within(m, func(m *Machine) error { return c.Validate(q, m) }); err != nil {
+			return m.bot.Accept(q, err.Error())
+		}
+	}
+	return m.bot.Accept(q)
+}
+
+func (c *Checkout) pay(msg *Message, m *Machine) error {
+	if !c.expected(m, msg.Payment.Payload) {
+		return errors.Errorf("stb: checkout %q got a payment for another invoice", c.name)
+	}
+	m.Session().Delete(c.name)
+	return m.SendEvent(PaymentSucceeded, msg.Payment)
+}
@@ -0,0 +1,90 @@
+package stb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckout(t *testing.T) {
+	api := newFakeAPI(t, `{"message_id":1}`)
+	answered := func() []string {
+		var answers []string
+		for _, call := range api.Calls() {
+			if strings.HasPrefix(call.Method, "answer") {
+				answers = append(answers, strings.TrimSpace(call.Method+" "+call.Param("ok")+" "+call.Param("error_message")))
+			}
+		}
+		return answers
+	}
+
+	b, err := NewBot(api.Settings())
+	require.NoError(t, err)
+	cart := b.Default(Default)
+	cart.Event(PaymentSucceeded, "Thanks")
+	cart.Event(PaymentFailed, "Failed")
+	b.State("Thanks")
+	b.State("Failed")
+
+	checkout := NewCheckout("checkout")
+	checkout.AnswerWithin = 20 * time.Millisecond
+	checkout.Invoice = func(m *Machine) (*Invoice, error) {
+		return &Invoice{Title: "Pizza", Currency: CurrencyStars, Prices: []Price{{"Pizza", 10}}, Flexible: true}, nil
+	}
+	checkout.Shipping = func(q *ShippingQuery, m *Machine) ([]ShippingOption, error) {
+		return []ShippingOption{{ID: "courier", Title: "Courier"}}, nil
+	}
+	slow := false
+	cancelled := make(chan error, 1)
+	checkout.Validate = func(q *PreCheckoutQuery, m *Machine) error {
+		if slow {
+			<-m.Context().Done()
+			cancelled <- m.Context().Err()
+		}
+		return nil
+	}
+	require.NoError(t, checkout.Register(b, Default))
+
+	user := &User{ID: 1}
+	m := b.machine(user)
+	require.NoError(t, m.SendEvent(checkout.Event()))
+	assert.Equal(t, checkout.State(), m.Current())
+
+	var payload string
+	require.True(t, m.Session().Get("checkout", &payload))
+
+	b.ProcessUpdate(Update{ShippingQuery: &ShippingQuery{ID: "s", Sender: user, Payload: payload}})
+	b.ProcessUpdate(Update{PreCheckoutQuery: &PreCheckoutQuery{ID: "p", Sender: user, Payload: "other"}})
+	b.ProcessUpdate(Update{PreCheckoutQuery: &PreCheckoutQuery{ID: "p", Sender: user, Payload: payload}})
+	slow = true
+	b.ProcessUpdate(Update{PreCheckoutQuery: &PreCheckoutQuery{ID: "p", Sender: user, Payload: payload}})
+	assert.Equal(t, []string{
+		"answerShippingQuery True",
+		"answerPreCheckoutQuery False This invoice has expired.",
+		"answerPreCheckoutQuery True",
+		"answerPreCheckoutQuery False Please try again in a moment.",
+	}, answered())
+	assert.Equal(t, context.DeadlineExceeded, <-cancelled)
+
+	// payments for another invoice are not taken
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: &Chat{ID: 1}, Payment: &Payment{Payload: "other"}}})
+	assert.Equal(t, checkout.State(), m.Current())
+
+	payment := &Payment{Payload: payload, Total: 10}
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: &Chat{ID: 1}, Payment: payment}})
+	assert.Equal(t, StateType("Thanks"), m.Current())
+	assert.Equal(t, payment, m.Payload())
+	assert.False(t, m.Session().Has("checkout"))
+
+	checkout.Timeout = 10 * time.Millisecond
+	require.NoError(t, checkout.Register(b, Default))
+	require.NoError(t, m.SendEvent(checkout.Event()))
+	assert.Eventually(t, func() bool {
+		return m.Current() == "Failed"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, ErrCheckoutExpired, m.Payload())
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/exp625/stb"
+)
+
+// diff lists the changes from the old to the new definition:
+// "+" for what was added, "-" for what was removed
+// and "~" for what changed.
+func diff(old, new *stb.Definition) []string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	if old.Default != new.Default {
+		add("~ default: %s -> %s", old.Default, new.Default)
+	}
+	for _, line := range diffMaps(eventMap(old.Events), eventMap(new.Events), "event") {
+		add("~ global: %s", line)
+	}
+	for _, line := range diffMaps(old.Handlers, new.Handlers, "handler") {
+		add("~ global: %s", line)
+	}
+
+	for _, t := range stateNames(old, new) {
+		o, inOld := old.States[t]
+		n, inNew := new.States[t]
+		switch {
+		case !inNew:
+			add("- state %s", t)
+			continue
+		case !inOld:
+			add("+ state %s", t)
+			continue
+		}
+
+		var changes []string
+		change := func(what, from, to string) {
+			if from != to {
+				changes = append(changes, fmt.Sprintf("%s %s -> %s", what, orNone(from), orNone(to)))
+			}
+		}
+		change("parent", string(o.Parent), string(n.Parent))
+		change("action", o.Action, n.Action)
+		change("timeout", timeoutString(o.Timeout), timeoutString(n.Timeout))
+		change("stay", strconv.FormatBool(o.Stay), strconv.FormatBool(n.Stay))
+		changes = append(changes, diffMaps(eventMap(o.Events), eventMap(n.Events), "event")...)
+		changes = append(changes, diffMaps(o.Handlers, n.Handlers, "handler")...)
+
+		for _, c := range changes {
+			add("~ state %s: %s", t, c)
+		}
+	}
+	return lines
+}
+
+// diffMaps lists the keys added, removed and changed.
+func diffMaps(old, new map[string]string, what string) []string {
+	keys := make(map[string]bool)
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var lines []string
+	for _, k := range sorted {
+		o, inOld := old[k]
+		n, inNew := new[k]
+		switch {
+		case !inNew:
+			lines = append(lines, fmt.Sprintf("- %s %s", what, k))
+		case !inOld:
+			lines = append(lines, fmt.Sprintf("+ %s %s -> %s", what, k, n))
+		case o != n:
+			lines = append(lines, fmt.Sprintf("%s %s: %s -> %s", what, k, o, n))
+		}
+	}
+	return lines
+}
+
+func eventMap(events map[stb.EventType]stb.StateType) map[string]string {
+	m := make(map[string]string, len(events))
+	for e, t := range events {
+		m[string(e)] = string(t)
+	}
+	return m
+}
+
+func stateNames(defs ...*stb.Definition) []stb.StateType {
+	seen := make(map[stb.StateType]bool)
+	var names []stb.StateType
+	for _, def := range defs {
+		for t := range def.States {
+			if !seen[t] {
+				seen[t] = true
+				names = append(names, t)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+func timeoutString(t *stb.TimeoutDefinition) string {
+	if t == nil {
+		return ""
+	}
+	return t.After + " to " + string(t.Target)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
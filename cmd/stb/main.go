@@ -0,0 +1,172 @@
+// Command stb works with the state graphs of declarative bots
+// (see stb.Definition) and the update logs of stb.Recorder.
+//
+// Usage:
+//
+//     stb validate flow.yaml
+//     stb svg flow.yaml > flow.svg
+//     stb diff old.yaml new.yaml
+//     stb replay -url http://localhost:8080/hook [-secret TOKEN] updates.jsonl
+//
+// Validate reports the problems of the state graph and exits with 1
+// if there are any. Svg renders the graph. Diff lists the states,
+// events, handlers, actions and timeouts that changed between two
+// versions of a flow. Replay posts a recorded update log to the
+// webhook of a bot, e.g. one running locally, to reproduce
+// a conversation.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/exp625/stb"
+	"github.com/pkg/errors"
+)
+
+const usage = `usage:
+	stb validate flow.yaml
+	stb svg flow.yaml > flow.svg
+	stb diff old.yaml new.yaml
+	stb replay -url URL [-secret TOKEN] updates.jsonl
+`
+
+func main() {
+	code, err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "stb:", err)
+	}
+	os.Exit(code)
+}
+
+// run runs the command and returns the exit code.
+func run(args []string, out io.Writer) (int, error) {
+	if len(args) == 0 {
+		return 2, errors.New(usage)
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "validate":
+		if len(args) != 1 {
+			return 2, errors.New(usage)
+		}
+		def, err := load(args[0])
+		if err != nil {
+			return 1, err
+		}
+		problems := def.Validate()
+		for _, p := range problems {
+			fmt.Fprintln(out, p)
+		}
+		if len(problems) > 0 {
+			return 1, nil
+		}
+		return 0, nil
+
+	case "svg":
+		if len(args) != 1 {
+			return 2, errors.New(usage)
+		}
+		def, err := load(args[0])
+		if err != nil {
+			return 1, err
+		}
+		_, err = io.WriteString(out, renderSVG(def))
+		return exit(err)
+
+	case "diff":
+		if len(args) != 2 {
+			return 2, errors.New(usage)
+		}
+		old, err := load(args[0])
+		if err != nil {
+			return 1, err
+		}
+		new, err := load(args[1])
+		if err != nil {
+			return 1, err
+		}
+		for _, line := range diff(old, new) {
+			fmt.Fprintln(out, line)
+		}
+		return 0, nil
+
+	case "replay":
+		flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		url := flags.String("url", "", "webhook of the bot")
+		secret := flags.String("secret", "", "secret token of the webhook")
+		if err := flags.Parse(args); err != nil || *url == "" || flags.NArg() != 1 {
+			return 2, errors.New(usage)
+		}
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return 1, err
+		}
+		defer f.Close()
+		n, err := replay(f, *url, *secret)
+		fmt.Fprintf(out, "replayed %d updates\n", n)
+		return exit(err)
+	}
+
+	return 2, errors.New(usage)
+}
+
+func exit(err error) (int, error) {
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+func load(path string) (*stb.Definition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return stb.ParseDefinition(data)
+}
+
+// replay posts the updates of the log to the webhook one by one.
+func replay(r io.Reader, url, secret string) (int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16<<20)
+
+	n := 0
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return n, errors.Errorf("update #%d is not valid JSON", n+1)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(line))
+		if err != nil {
+			return n, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if secret != "" {
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return n, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return n, errors.Errorf("update #%d: webhook answered %s", n+1, resp.Status)
+		}
+		n++
+	}
+	return n, sc.Err()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/exp625/stb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const flow = `
+default: Default
+events:
+  cancel: Default
+states:
+  Default:
+    events:
+      order: Order
+    handlers:
+      /order: order
+  Order:
+    action: askSize
+    timeout: {after: 10m, target: Default}
+    events:
+      done: Done
+    handlers:
+      text: pickSize
+  Done:
+    events:
+      again: Default
+`
+
+func write(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	good := write(t, dir, "good.yaml", flow)
+	bad := write(t, dir, "bad.yaml", strings.Replace(flow, "done: Done", "done: Gone", 1))
+
+	var out bytes.Buffer
+	code, err := run([]string{"validate", good}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Empty(t, out.String())
+
+	code, err = run([]string{"validate", bad}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out.String(), `"Gone"`)
+	assert.Contains(t, out.String(), "unreachable")
+
+	code, _ = run([]string{"validate"}, &out)
+	assert.Equal(t, 2, code)
+	code, _ = run([]string{"validate", filepath.Join(dir, "missing.yaml")}, &out)
+	assert.Equal(t, 1, code)
+}
+
+func TestSVG(t *testing.T) {
+	path := write(t, t.TempDir(), "flow.yaml", flow)
+
+	var out bytes.Buffer
+	code, err := run([]string{"svg", path}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, 0, code)
+
+	svg := out.String()
+	require.NoError(t, xml.Unmarshal(out.Bytes(), new(interface{})))
+	for _, s := range []string{">Default<", ">Order<", ">Done<", ">order<", ">10m<", ">again<", "cancel → Default"} {
+		assert.Contains(t, svg, s)
+	}
+	assert.Equal(t, 1, strings.Count(svg, "stroke-dasharray"))
+
+	columns := layers(mustLoad(t, path))
+	assert.Equal(t, 3, len(columns))
+	assert.Equal(t, "Done", string(columns[2][0]))
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	old := write(t, dir, "old.yaml", flow)
+	new := write(t, dir, "new.yaml", strings.NewReplacer(
+		"after: 10m", "after: 5m",
+		"action: askSize", "action: askColor",
+		"      again: Default\n", "      again: Default\n  Help: {}\n",
+		"      /order: order\n", "      /order: order\n      /help: help\n",
+	).Replace(flow))
+
+	var out bytes.Buffer
+	code, err := run([]string{"diff", old, new}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, strings.Join([]string{
+		"~ state Default: + handler /help -> help",
+		"+ state Help",
+		"~ state Order: action askSize -> askColor",
+		"~ state Order: timeout 10m to Default -> 5m to Default",
+		"",
+	}, "\n"), out.String())
+
+	out.Reset()
+	run([]string{"diff", new, old}, &out)
+	assert.Contains(t, out.String(), "- state Help\n")
+	assert.Contains(t, out.String(), "~ state Default: - handler /help\n")
+}
+
+func TestReplay(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Telegram-Bot-Api-Secret-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, string(body))
+	}))
+	defer srv.Close()
+
+	path := write(t, t.TempDir(), "updates.jsonl", "{\"update_id\":1}\n\n{\"update_id\":2}\n")
+
+	var out bytes.Buffer
+	code, err := run([]string{"replay", "-url", srv.URL, "-secret", "secret", path}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, []string{`{"update_id":1}`, `{"update_id":2}`}, got)
+	assert.Equal(t, "replayed 2 updates\n", out.String())
+
+	code, err = run([]string{"replay", "-url", srv.URL, path}, &out)
+	assert.Equal(t, 1, code)
+	assert.EqualError(t, err, "update #1: webhook answered 401 Unauthorized")
+
+	code, _ = run([]string{"replay", path}, &out)
+	assert.Equal(t, 2, code)
+}
+
+func mustLoad(t *testing.T, path string) *stb.Definition {
+	def, err := load(path)
+	require.NoError(t, err)
+	return def
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/exp625/stb"
+)
+
+const (
+	nodeWidth  = 140
+	nodeHeight = 40
+	colGap     = 80
+	rowGap     = 30
+	margin     = 20
+	lineHeight = 16
+)
+
+type edge struct {
+	from, to stb.StateType
+	label    string
+	timeout  bool
+}
+
+// renderSVG lays the states out in columns by their distance from
+// the default state, states that can't be reached come last.
+// Events are drawn as labelled arrows, timeouts as dashed ones,
+// global events are listed below the graph.
+func renderSVG(def *stb.Definition) string {
+	columns := layers(def)
+
+	pos := make(map[stb.StateType][2]int)
+	rows := 0
+	for i, col := range columns {
+		for j, t := range col {
+			pos[t] = [2]int{
+				margin + i*(nodeWidth+colGap),
+				margin + j*(nodeHeight+rowGap),
+			}
+		}
+		if len(col) > rows {
+			rows = len(col)
+		}
+	}
+
+	globals := sortedEvents(def.Events)
+	width := 2*margin + len(columns)*(nodeWidth+colGap) - colGap
+	height := 2*margin + rows*(nodeHeight+rowGap) - rowGap
+	legend := height
+	if len(globals) > 0 {
+		height += (len(globals) + 1) * lineHeight
+	}
+	if width < 2*margin+nodeWidth {
+		width = 2*margin + nodeWidth
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", width, height)
+	sb.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M0,0 L10,5 L0,10 z"/></marker></defs>` + "\n")
+
+	for _, e := range edges(def) {
+		from, ok1 := pos[e.from]
+		to, ok2 := pos[e.to]
+		if !ok1 || !ok2 {
+			continue
+		}
+		x1, y1 := from[0]+nodeWidth, from[1]+nodeHeight/2
+		x2, y2 := to[0], to[1]+nodeHeight/2
+		var path string
+		switch {
+		case e.from == e.to:
+			// a loop over the top of the node
+			path = fmt.Sprintf("M%d,%d C%d,%d %d,%d %d,%d",
+				from[0]+nodeWidth/3, from[1], from[0]+nodeWidth/3, from[1]-rowGap, from[0]+2*nodeWidth/3, from[1]-rowGap, from[0]+2*nodeWidth/3, from[1])
+		case x2 <= x1:
+			// backwards, around the bottom of the nodes
+			x1, x2 = from[0]+nodeWidth/2, to[0]+nodeWidth/2
+			y1, y2 = from[1]+nodeHeight, to[1]+nodeHeight
+			low := max(y1, y2) + rowGap/2
+			path = fmt.Sprintf("M%d,%d C%d,%d %d,%d %d,%d", x1, y1, x1, low, x2, low, x2, y2)
+		default:
+			mid := (x1 + x2) / 2
+			path = fmt.Sprintf("M%d,%d C%d,%d %d,%d %d,%d", x1, y1, mid, y1, mid, y2, x2, y2)
+		}
+		dash := ""
+		if e.timeout {
+			dash = ` stroke-dasharray="4,3"`
+		}
+		fmt.Fprintf(&sb, `<path d="%s" fill="none" stroke="black"%s marker-end="url(#arrow)"/>`+"\n", path, dash)
+
+		lx, ly := (from[0]+nodeWidth+to[0])/2, (from[1]+to[1]+nodeHeight)/2-4
+		if e.from == e.to {
+			lx, ly = from[0]+nodeWidth/2, from[1]-rowGap+8
+		} else if to[0] <= from[0] {
+			lx, ly = (from[0]+to[0]+nodeWidth)/2, max(from[1], to[1])+nodeHeight+rowGap/2+4
+		}
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle" fill="#555">%s</text>`+"\n", lx, ly, html.EscapeString(e.label))
+	}
+
+	for _, col := range columns {
+		for _, t := range col {
+			p := pos[t]
+			stroke := "1"
+			if t == def.Default {
+				stroke = "3"
+			}
+			fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" rx="8" fill="white" stroke="black" stroke-width="%s"/>`+"\n",
+				p[0], p[1], nodeWidth, nodeHeight, stroke)
+			fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n",
+				p[0]+nodeWidth/2, p[1]+nodeHeight/2+4, html.EscapeString(string(t)))
+		}
+	}
+
+	if len(globals) > 0 {
+		y := legend + lineHeight
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" font-weight="bold">global events</text>`+"\n", margin, y)
+		for _, e := range globals {
+			y += lineHeight
+			fmt.Fprintf(&sb, `<text x="%d" y="%d">%s</text>`+"\n",
+				margin, y, html.EscapeString(fmt.Sprintf("%s → %s", e, def.Events[e])))
+		}
+	}
+
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// layers groups the states by their distance from the default state.
+func layers(def *stb.Definition) [][]stb.StateType {
+	next := make(map[stb.StateType][]stb.StateType)
+	for _, e := range edges(def) {
+		next[e.from] = append(next[e.from], e.to)
+	}
+
+	var columns [][]stb.StateType
+	seen := make(map[stb.StateType]bool)
+	if _, ok := def.States[def.Default]; ok {
+		seen[def.Default] = true
+		for layer := []stb.StateType{def.Default}; len(layer) > 0; {
+			columns = append(columns, layer)
+			var following []stb.StateType
+			for _, t := range layer {
+				for _, n := range next[t] {
+					if _, ok := def.States[n]; ok && !seen[n] {
+						seen[n] = true
+						following = append(following, n)
+					}
+				}
+			}
+			layer = following
+		}
+	}
+
+	var rest []stb.StateType
+	for _, t := range stateNames(def) {
+		if !seen[t] {
+			rest = append(rest, t)
+		}
+	}
+	if len(rest) > 0 {
+		columns = append(columns, rest)
+	}
+	return columns
+}
+
+// edges lists the transitions of the states in a stable order.
+// Events of a parent are drawn from the parent only.
+func edges(def *stb.Definition) []edge {
+	var all []edge
+	for _, t := range stateNames(def) {
+		s := def.States[t]
+		for _, e := range sortedEvents(s.Events) {
+			all = append(all, edge{from: t, to: s.Events[e], label: string(e)})
+		}
+		if s.Timeout != nil {
+			all = append(all, edge{from: t, to: s.Timeout.Target, label: s.Timeout.After, timeout: true})
+		}
+	}
+	return all
+}
+
+func sortedEvents(events map[stb.EventType]stb.StateType) []stb.EventType {
+	sorted := make([]stb.EventType, 0, len(events))
+	for e := range events {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
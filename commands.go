@@ -0,0 +1,407 @@
+package stb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBadUsage is returned by State.Command when the usage
+// of a command can't be parsed.
+var ErrBadUsage = errors.New("stb: bad command usage")
+
+// ArgType is the type of a command argument.
+type ArgType string
+
+const (
+	ArgString   ArgType = "string"
+	ArgInt      ArgType = "int"
+	ArgFloat    ArgType = "float"
+	ArgBool     ArgType = "bool"
+	ArgDuration ArgType = "duration"
+)
+
+// Arg describes an argument of a command.
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+}
+
+// Args are the parsed arguments of a command, by name.
+// Missing optional arguments are not set.
+type Args map[string]interface{}
+
+// Has says whether the argument was given.
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+// String returns a string argument or "".
+func (a Args) String(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+// Int returns an int argument or 0.
+func (a Args) Int(name string) int {
+	v, _ := a[name].(int)
+	return v
+}
+
+// Float returns a float argument or 0.
+func (a Args) Float(name string) float64 {
+	v, _ := a[name].(float64)
+	return v
+}
+
+// Bool returns a bool argument or false.
+func (a Args) Bool(name string) bool {
+	v, _ := a[name].(bool)
+	return v
+}
+
+// Duration returns a duration argument or 0.
+func (a Args) Duration(name string) time.Duration {
+	v, _ := a[name].(time.Duration)
+	return v
+}
+
+// CommandSpec describes a command registered with State.Command.
+type CommandSpec struct {
+	// Name is the command without the slash.
+	Name        string
+	Description string
+	Args        []Arg
+
+	handler func(*Message, Args, *Machine) error
+}
+
+// Usage returns the usage line of the command,
+// like "/remind <when> <text>".
+func (c *CommandSpec) Usage() string {
+	usage := "/" + c.Name
+	for _, arg := range c.Args {
+		if arg.Optional {
+			usage += " [" + arg.Name + "]"
+		} else {
+			usage += " <" + arg.Name + ">"
+		}
+	}
+	return usage
+}
+
+var (
+	commandRx = regexp.MustCompile(`^/?([a-z0-9_]{1,32})$`)
+	argRx     = regexp.MustCompile(`^([<\[])(\w+)(?::(\w+))?([>\]])$`)
+)
+
+// Command registers a command with typed arguments in the state.
+// The arguments are parsed before the handler runs, on bad input
+// the user gets the usage of the command instead.
+//
+// Arguments are written as <name:type>, optional ones as [name:type].
+// Types are string, int, float, bool and duration, the type can be
+// left out if the name is a type or for strings. The last string
+// argument takes the rest of the line.
+//
+// The handler must be func(*Message, Args, *Machine), with or without
+// an error result. Commands show up in the /help reply, unless the
+// state handles /help itself, see Bot.Help.
+//
+// Example:
+//
+//     b.Command("/remind <duration> <text>", "Remind me later", func(msg *stb.Message, args stb.Args, m *stb.Machine) {
+//         time.AfterFunc(args.Duration("duration"), func() { m.Send(args.String("text")) })
+//     })
+//
+func (s *State) Command(usage, description string, handler interface{}) error {
+	spec, err := parseUsage(usage)
+	if err != nil {
+		return err
+	}
+	spec.Description = description
+
+	switch h := handler.(type) {
+	case func(*Message, Args, *Machine) error:
+		spec.handler = h
+	case func(*Message, Args, *Machine):
+		spec.handler = func(msg *Message, args Args, m *Machine) error { h(msg, args, m); return nil }
+	default:
+		return errors.Wrapf(ErrBadHandler, "command %q expects func(*Message, Args, *Machine), got %T",
+			spec.Name, handler)
+	}
+
+	if err := s.Handle("/"+spec.Name, spec.run); err != nil {
+		return err
+	}
+	s.commands = append(s.commands, spec)
+	return nil
+}
+
+// MustCommand is like Command but panics if the command can't be registered.
+func (s *State) MustCommand(usage, description string, handler interface{}) {
+	if err := s.Command(usage, description, handler); err != nil {
+		panic(err)
+	}
+}
+
+// Command registers a command in the global state, see State.Command.
+func (b *Bot) Command(usage, description string, handler interface{}) error {
+	return b.global.Command(usage, description, handler)
+}
+
+// MustCommand is like Command but panics if the command can't be registered.
+func (b *Bot) MustCommand(usage, description string, handler interface{}) {
+	b.global.MustCommand(usage, description, handler)
+}
+
+// Commands returns the commands available in the state:
+// its own, the ones of its parents and the global ones.
+func (b *Bot) Commands(state StateType) []*CommandSpec {
+	var cmds []*CommandSpec
+	seen := make(map[string]bool)
+	states, global := b.config()
+	for _, s := range append(lineage(states, state), global) {
+		for _, cmd := range s.commands {
+			if !seen[cmd.Name] {
+				seen[cmd.Name] = true
+				cmds = append(cmds, cmd)
+			}
+		}
+	}
+	return cmds
+}
+
+// Help returns the help text listing the commands of the state.
+func (b *Bot) Help(state StateType) string {
+	var lines []string
+	for _, cmd := range b.Commands(state) {
+		lines = append(lines, cmd.Usage()+" - "+cmd.Description)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SyncCommands sets the commands of the default
+// state as the commands of the bot, see SetCommands.
+func (b *Bot) SyncCommands() error {
+	return b.SetCommands(commandList(b.Commands(b.defaultState)))
+}
+
+// help answers /help with the commands of the state of
+// the machine, if no handler took care of it.
+func (b *Bot) help(upd Update, m *Machine) bool {
+	msg := upd.Message
+	if msg == nil || !isHelp(msg.Text) {
+		return false
+	}
+
+	text := b.Help(m.Current())
+	if text == "" {
+		return false
+	}
+	if _, err := m.Send(text); err != nil {
+		b.handleError(err, upd)
+	}
+	return true
+}
+
+func isHelp(text string) bool {
+	match := cmdRx.FindStringSubmatch(text)
+	return match != nil && match[1] == "/help"
+}
+
+// syncMenuLater runs syncMenu in the background, as the
+// caller holds the mutex.
+func (m *Machine) syncMenuLater() {
+	m.bot.inflight.Add(1)
+	go func() {
+		defer m.bot.inflight.Done()
+		m.syncMenu()
+	}()
+}
+
+// syncMenu sets the command menu of the chat of the machine to the
+// commands of its current state. In groups, the menu is only changed
+// for the user of the machine. Menus that did not change are not
+// sent again.
+func (m *Machine) syncMenu() {
+	m.menuMu.Lock()
+	defer m.menuMu.Unlock()
+
+	cmds := commandList(m.bot.Commands(m.Current()))
+
+	var key []string
+	for _, cmd := range cmds {
+		key = append(key, cmd.Text+" "+cmd.Description)
+	}
+	menu := strings.Join(key, "\n")
+
+	scope, ok := m.commandScope()
+	if !ok || menu == m.menu {
+		return
+	}
+
+	var err error
+	if len(cmds) == 0 {
+		err = m.bot.DeleteCommands(scope)
+	} else {
+		err = m.bot.SetCommands(cmds, scope)
+	}
+	if err != nil {
+		m.bot.handleError(err, Update{})
+		return
+	}
+	m.menu = menu
+}
+
+// commandScope returns the command scope of the chat of the machine.
+func (m *Machine) commandScope() (CommandScope, bool) {
+	chat := m.Chat()
+	switch {
+	case chat != nil && chat.Type != ChatPrivate && m.who != nil:
+		return CommandScope{Type: CommandScopeChatMember, ChatID: chat.ID, UserID: m.who.ID}, true
+	case chat != nil:
+		return CommandScope{Type: CommandScopeChat, ChatID: chat.ID}, true
+	case m.who != nil:
+		return CommandScope{Type: CommandScopeChat, ChatID: int64(m.who.ID)}, true
+	}
+	return CommandScope{}, false
+}
+
+func commandList(specs []*CommandSpec) []Command {
+	cmds := make([]Command, 0, len(specs))
+	for _, spec := range specs {
+		cmds = append(cmds, Command{Text: spec.Name, Description: spec.Description})
+	}
+	return cmds
+}
+
+// run parses the arguments of the command and runs its handler.
+func (c *CommandSpec) run(msg *Message, m *Machine) error {
+	args, err := c.parse(msg.Payload)
+	if err != nil {
+		if m == nil {
+			return err
+		}
+		_, err := m.Send(m.tr("stb.usage", "Usage: %s", c.Usage()) + "\n" + err.Error())
+		return err
+	}
+	return c.handler(msg, args, m)
+}
+
+func (c *CommandSpec) parse(payload string) (Args, error) {
+	args := make(Args)
+	rest := strings.TrimSpace(payload)
+
+	for i, arg := range c.Args {
+		if rest == "" {
+			if !arg.Optional {
+				return nil, fmt.Errorf("%s is missing", arg.Name)
+			}
+			break
+		}
+
+		var word string
+		if arg.Type == ArgString && i == c.lastString() {
+			word, rest = rest, ""
+		} else if n := strings.IndexFunc(rest, isSpace); n >= 0 {
+			word, rest = rest[:n], strings.TrimSpace(rest[n:])
+		} else {
+			word, rest = rest, ""
+		}
+
+		v, err := parseArg(arg.Type, word)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid %s", arg.Name, arg.Type)
+		}
+		args[arg.Name] = v
+	}
+
+	if rest != "" {
+		return nil, fmt.Errorf("too many arguments")
+	}
+	return args, nil
+}
+
+// lastString returns the index of the last argument,
+// if it is a string, -1 otherwise.
+func (c *CommandSpec) lastString() int {
+	if n := len(c.Args) - 1; n >= 0 && c.Args[n].Type == ArgString {
+		return n
+	}
+	return -1
+}
+
+func parseArg(t ArgType, word string) (interface{}, error) {
+	switch t {
+	case ArgInt:
+		return strconv.Atoi(word)
+	case ArgFloat:
+		return strconv.ParseFloat(word, 64)
+	case ArgBool:
+		return strconv.ParseBool(word)
+	case ArgDuration:
+		return time.ParseDuration(word)
+	default:
+		return word, nil
+	}
+}
+
+func parseUsage(usage string) (*CommandSpec, error) {
+	fields := strings.Fields(usage)
+	if len(fields) == 0 {
+		return nil, errors.Wrapf(ErrBadUsage, "%q", usage)
+	}
+
+	match := commandRx.FindStringSubmatch(fields[0])
+	if match == nil {
+		return nil, errors.Wrapf(ErrBadUsage, "%q: bad command name", usage)
+	}
+	spec := &CommandSpec{Name: match[1]}
+
+	seen := make(map[string]bool)
+	for _, field := range fields[1:] {
+		m := argRx.FindStringSubmatch(field)
+		if m == nil || (m[1] == "<") != (m[4] == ">") {
+			return nil, errors.Wrapf(ErrBadUsage, "%q: bad argument %s", usage, field)
+		}
+
+		arg := Arg{Name: m[2], Type: ArgType(m[3]), Optional: m[1] == "["}
+		if arg.Type == "" {
+			arg.Type = ArgString
+			if isArgType(ArgType(arg.Name)) {
+				arg.Type = ArgType(arg.Name)
+			}
+		}
+		if !isArgType(arg.Type) {
+			return nil, errors.Wrapf(ErrBadUsage, "%q: unknown type %s", usage, arg.Type)
+		}
+		if seen[arg.Name] {
+			return nil, errors.Wrapf(ErrBadUsage, "%q: duplicate argument %s", usage, arg.Name)
+		}
+		if n := len(spec.Args); n > 0 && spec.Args[n-1].Optional && !arg.Optional {
+			return nil, errors.Wrapf(ErrBadUsage, "%q: %s follows an optional argument", usage, arg.Name)
+		}
+		seen[arg.Name] = true
+		spec.Args = append(spec.Args, arg)
+	}
+	return spec, nil
+}
+
+func isArgType(t ArgType) bool {
+	switch t {
+	case ArgString, ArgInt, ArgFloat, ArgBool, ArgDuration:
+		return true
+	}
+	return false
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n'
+}
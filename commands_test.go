@@ -0,0 +1,128 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUsage(t *testing.T) {
+	spec, err := parseUsage("/remind <duration> <text>")
+	require.NoError(t, err)
+	assert.Equal(t, "remind", spec.Name)
+	assert.Equal(t, []Arg{{Name: "duration", Type: ArgDuration}, {Name: "text", Type: ArgString}}, spec.Args)
+
+	spec, err = parseUsage("roll [sides:int]")
+	require.NoError(t, err)
+	assert.Equal(t, "/roll [sides]", spec.Usage())
+
+	for _, usage := range []string{"", "/Remind", "/x <a:date>", "/x <a> <a>", "/x [a] <b>", "/x <a]"} {
+		_, err := parseUsage(usage)
+		assert.Error(t, err, usage)
+	}
+}
+
+func TestCommandParse(t *testing.T) {
+	spec, err := parseUsage("/remind <when:duration> [times:int] [text]")
+	require.NoError(t, err)
+
+	args, err := spec.parse(" 10m  3 buy  milk ")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, args.Duration("when"))
+	assert.Equal(t, 3, args.Int("times"))
+	assert.Equal(t, "buy  milk", args.String("text"))
+
+	args, err = spec.parse("1h")
+	require.NoError(t, err)
+	assert.False(t, args.Has("times"))
+
+	_, err = spec.parse("")
+	assert.EqualError(t, err, "when is missing")
+	_, err = spec.parse("soon")
+	assert.EqualError(t, err, "when is not a valid duration")
+
+	spec, _ = parseUsage("/roll <sides:int>")
+	_, err = spec.parse("6 7")
+	assert.EqualError(t, err, "too many arguments")
+}
+
+func TestStateCommand(t *testing.T) {
+	api := newFakeAPI(t, `{"message_id":1}`)
+	b, err := NewBot(api.Settings())
+	require.NoError(t, err)
+
+	var sides int
+	b.Default(Default).MustCommand("/roll <sides:int>", "Roll a die", func(_ *Message, args Args, _ *Machine) {
+		sides = args.Int("sides")
+	})
+	b.MustCommand("/ping", "Check the bot", func(*Message, Args, *Machine) {})
+	assert.Error(t, b.Command("/pong", "", func(*Message, *Machine) {}))
+
+	user := &User{ID: 1}
+	for _, text := range []string{"/roll 20", "/roll x", "/help"} {
+		b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: &Chat{ID: 1}, Text: text}})
+	}
+	require.NoError(t, b.SyncCommands())
+
+	var sent []string
+	for _, call := range api.Calls() {
+		sent = append(sent, call.Param("text")+call.Param("commands"))
+	}
+	assert.Equal(t, 20, sides)
+	assert.Equal(t, []string{
+		"Usage: /roll <sides>\nsides is not a valid int",
+		"/roll <sides> - Roll a die\n/ping - Check the bot",
+		`[{"command":"roll","description":"Roll a die"},{"command":"ping","description":"Check the bot"}]`,
+	}, sent)
+}
+
+func TestSyncMenus(t *testing.T) {
+	api := newFakeAPI(t, "true")
+	settings := api.Settings()
+	settings.SyncMenus = true
+	b, err := NewBot(settings)
+	require.NoError(t, err)
+
+	noop := func(*Message, Args, *Machine) {}
+	b.Default(Default).Event("order", "Order")
+	order := b.State("Order")
+	order.MustCommand("/cancel", "Cancel the order", noop)
+	order.Event("pay", "Pay")
+	pay := b.State("Pay")
+	pay.MustCommand("/cancel", "Cancel the order", noop)
+	pay.Event("done", Default)
+
+	// the menus are synced in the background
+	m := b.machine(&User{ID: 3})
+	for _, event := range []EventType{"order", "pay", "done"} {
+		require.NoError(t, m.SendEvent(event))
+		b.inflight.Wait()
+	}
+
+	var calls []string
+	for _, call := range api.Calls() {
+		calls = append(calls, call.Method+" "+string(call.Params["scope"])+" "+string(call.Params["commands"]))
+	}
+	assert.Equal(t, []string{
+		`setMyCommands "{\"type\":\"chat\",\"chat_id\":3}" "[{\"command\":\"cancel\",\"description\":\"Cancel the order\"}]"`,
+		`deleteMyCommands {"type":"chat","chat_id":3} `,
+	}, calls)
+}
+
+func TestCommandUsageTranslated(t *testing.T) {
+	api := newFakeAPI(t, `{"message_id":1}`)
+	settings := api.Settings()
+	settings.Locales = NewLocales("de")
+	settings.Locales.Add("de", map[string]string{"stb.usage": "Aufruf: %s"})
+	b, err := NewBot(settings)
+	require.NoError(t, err)
+
+	b.Default(Default).MustCommand("/roll <sides:int>", "Roll a die", func(*Message, Args, *Machine) {})
+	b.ProcessUpdate(Update{Message: &Message{Sender: &User{ID: 1}, Chat: &Chat{ID: 1}, Text: "/roll x"}})
+
+	calls := api.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "Aufruf: /roll <sides>\nsides is not a valid int", calls[0].Param("text"))
+}
@@ -0,0 +1,274 @@
+package stb
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule is a parsed cron expression, see ParseSchedule.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domAny and dowAny tell whether the day fields are "*",
+	// a day matches either of them if both are restricted.
+	domAny, dowAny bool
+
+	every time.Duration
+}
+
+// ParseSchedule parses a cron expression of five fields: minute,
+// hour, day of month, month and day of week (0 or 7 is Sunday).
+// Fields are "*", numbers, ranges ("1-5") and lists of them ("1,15"),
+// optionally with steps ("*/15", "0-30/10"). The descriptors
+// @yearly, @monthly, @weekly, @daily and @hourly are understood,
+// as well as "@every 1h30m".
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil || d <= 0 {
+			return nil, errors.Errorf("stb: bad schedule %q", spec)
+		}
+		return &Schedule{every: d}, nil
+	}
+
+	switch spec {
+	case "@yearly", "@annually":
+		spec = "0 0 1 1 *"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@hourly":
+		spec = "0 * * * *"
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("stb: bad schedule %q: want 5 fields", spec)
+	}
+
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var masks [5]uint64
+	for i, field := range fields {
+		mask, err := parseField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "stb: bad schedule %q", spec)
+		}
+		masks[i] = mask
+	}
+	// 7 is Sunday as well
+	if masks[4]&(1<<7) != 0 {
+		masks[4] |= 1
+	}
+
+	return &Schedule{
+		minute: masks[0],
+		hour:   masks[1],
+		dom:    masks[2],
+		month:  masks[3],
+		dow:    masks[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseField turns a field into a bit mask of the values it matches.
+func parseField(field string, min, max int) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.Errorf("bad step in %q", part)
+			}
+			step, part = n, part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.Errorf("bad value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, errors.Errorf("bad value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, errors.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+// Next returns the first time after t the schedule matches,
+// or the zero time if there is none within five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Job is a job run by a Scheduler.
+type Job func(s *Scheduler) error
+
+type cronJob struct {
+	schedule *Schedule
+	job      Job
+}
+
+// Scheduler runs jobs on cron schedules while the bot is running,
+// e.g. to send a daily digest. Jobs get the scheduler to look up or
+// range over the machines, and send their messages through the bot,
+// with its rate limiter and retries.
+//
+// Example:
+//
+//     b.Scheduler().Add("0 9 * * *", func(s *stb.Scheduler) error {
+//         return s.Range(func(m *stb.Machine) bool {
+//             if m.Current() == Subscribed {
+//                 m.Send(digest())
+//             }
+//             return true
+//         })
+//     })
+//
+type Scheduler struct {
+	bot  *Bot
+	jobs []cronJob
+}
+
+// Scheduler returns the scheduler of the bot.
+func (b *Bot) Scheduler() *Scheduler {
+	return b.scheduler
+}
+
+// Add runs the job on the schedule, see ParseSchedule. Errors are
+// passed to the Reporter. A job never runs twice at the same time,
+// runs that are due while the job is still running are skipped.
+// Jobs must be added before Start.
+func (s *Scheduler) Add(spec string, job Job) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	s.jobs = append(s.jobs, cronJob{schedule: schedule, job: job})
+	return nil
+}
+
+// Bot returns the bot the jobs run for.
+func (s *Scheduler) Bot() *Bot {
+	return s.bot
+}
+
+// Machine returns the machine with the id, loading it if needed.
+func (s *Scheduler) Machine(id string) *Machine {
+	return s.bot.machines.obtain(id, nil)
+}
+
+// Range calls f for every machine, the loaded ones and the ones in
+// the store, which has to implement Lister, until f returns false.
+// The stored machines are read one at a time, without being loaded:
+// they can send messages, but their changes are not saved, so get the
+// machines to change with Machine. Range only fails if the store
+// can't list its machines.
+func (s *Scheduler) Range(f func(m *Machine) bool) error {
+	ids, err := s.bot.machineIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if m := s.bot.peek(id); m != nil && !f(m) {
+			break
+		}
+	}
+	return nil
+}
+
+// run runs the jobs until stop is closed.
+func (s *Scheduler) run(stop chan struct{}) {
+	b := s.bot
+	for _, j := range s.jobs {
+		b.inflight.Add(1)
+		go func(j cronJob) {
+			defer b.inflight.Done()
+			s.runJob(j, stop)
+		}(j)
+	}
+}
+
+func (s *Scheduler) runJob(j cronJob, stop chan struct{}) {
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					s.bot.debug(errors.Errorf("stb: cron job panicked: %v", r))
+				}
+			}()
+			if err := j.job(s); err != nil {
+				s.bot.debug(err)
+			}
+		}()
+	}
+}
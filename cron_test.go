@@ -0,0 +1,113 @@
+package stb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		require.NoError(t, err)
+		return tm
+	}
+	from := at("2024-03-15 10:07") // a Friday
+
+	tests := []struct {
+		spec, next string
+	}{
+		{"* * * * *", "2024-03-15 10:08"},
+		{"*/15 * * * *", "2024-03-15 10:15"},
+		{"0 9 * * *", "2024-03-16 09:00"},
+		{"30 8-18/2 * * *", "2024-03-15 10:30"},
+		{"0 0 1 * *", "2024-04-01 00:00"},
+		{"0 9 * * 1-5", "2024-03-18 09:00"},
+		{"0 9 * * 7", "2024-03-17 09:00"},
+		{"0 9 20 * 0", "2024-03-17 09:00"},
+		{"5,10 10 15 3 *", "2024-03-15 10:10"},
+		{"0 0 29 2 *", "2024-02-29 00:00"},
+		{"@weekly", "2024-03-17 00:00"},
+		{"@hourly", "2024-03-15 11:00"},
+	}
+	for _, test := range tests {
+		s, err := ParseSchedule(test.spec)
+		require.NoError(t, err, test.spec)
+		next := s.Next(from)
+		if test.spec == "0 0 29 2 *" {
+			next = s.Next(at("2023-06-01 00:00"))
+		}
+		assert.Equal(t, at(test.next), next, test.spec)
+	}
+
+	s, err := ParseSchedule("@every 90m")
+	require.NoError(t, err)
+	assert.Equal(t, from.Add(90*time.Minute), s.Next(from))
+
+	s, err = ParseSchedule("0 0 31 2 *")
+	require.NoError(t, err)
+	assert.True(t, s.Next(from).IsZero())
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "@every", "@every -1s", "a * * * *"} {
+		_, err := ParseSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	var reported []error
+	b, err := NewBot(Settings{Offline: true, Reporter: func(err error) { reported = append(reported, err) }})
+	require.NoError(t, err)
+	b.Poller = newTestPoller()
+	b.Default(Default)
+
+	runs := make(chan *Bot, 10)
+	require.NoError(t, b.Scheduler().Add("@every 10ms", func(s *Scheduler) error {
+		runs <- s.Bot()
+		return errors.New("failed")
+	}))
+	assert.Error(t, b.Scheduler().Add("* *", nil))
+
+	go b.Start()
+	for i := 0; i < 2; i++ {
+		select {
+		case got := <-runs:
+			assert.Equal(t, b, got)
+		case <-time.After(time.Second):
+			t.Fatal("job did not run")
+		}
+	}
+	b.Stop()
+
+	require.NotEmpty(t, reported)
+	assert.Contains(t, reported[0].Error(), "failed")
+}
+
+func TestSchedulerRange(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+	b.Default(Default)
+	b.State("Subscribed")
+
+	b.machine(&User{ID: 1}).force("Subscribed")
+	require.NoError(t, store.Save("2", &Snapshot{State: "Subscribed"}))
+	require.NoError(t, store.Save("3", &Snapshot{State: Default}))
+
+	var subscribed []string
+	s := b.Scheduler()
+	require.NoError(t, s.Range(func(m *Machine) bool {
+		if m.Current() == "Subscribed" {
+			subscribed = append(subscribed, m.id)
+		}
+		return true
+	}))
+	assert.Equal(t, []string{"1", "2"}, subscribed)
+	assert.Equal(t, 1, b.Machines().Len())
+
+	assert.Equal(t, StateType("Subscribed"), s.Machine("2").Current())
+	assert.Equal(t, 2, b.Machines().Len())
+}
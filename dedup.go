@@ -0,0 +1,49 @@
+package stb
+
+// seen reports whether the machine already processed the update,
+// remembering it otherwise. The machine keeps the ids of the last
+// size updates it processed, updates older than all of them count
+// as processed. Updates without an id, such as the ones the bot
+// makes up itself, are never seen. The ids are saved along with
+// the rest of the machine.
+func (m *Machine) seen(upd Update, size int) bool {
+	if upd.ID == 0 {
+		return false
+	}
+
+	m.seenMu.Lock()
+	defer m.seenMu.Unlock()
+
+	m.currentMu.RLock()
+	ids := m.seenIDs
+	m.currentMu.RUnlock()
+	for _, id := range ids {
+		if id == upd.ID {
+			return true
+		}
+	}
+	if len(ids) >= size && upd.ID < ids[0] {
+		return true
+	}
+
+	ids = insertID(append([]int(nil), ids...), upd.ID)
+	if len(ids) > size {
+		ids = ids[len(ids)-size:]
+	}
+	m.currentMu.Lock()
+	m.seenIDs = ids
+	m.currentMu.Unlock()
+	return false
+}
+
+// insertID inserts the id into the sorted ids.
+func insertID(ids []int, id int) []int {
+	i := len(ids)
+	for i > 0 && ids[i-1] > id {
+		i--
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids
+}
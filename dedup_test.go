@@ -0,0 +1,53 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedup(t *testing.T) {
+	store := NewMemoryStore()
+	var handled []int
+
+	start := func() *Bot {
+		b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store, Dedup: 2})
+		require.NoError(t, err)
+		b.Default(Default)
+		b.Handle(OnText, func(msg *Message, m *Machine) {
+			handled = append(handled, msg.ID)
+		})
+		return b
+	}
+	update := func(id int) Update {
+		return Update{ID: id, Message: &Message{ID: id, Text: "hi", Sender: &User{ID: 1}, Chat: &Chat{ID: 1}}}
+	}
+
+	b := start()
+	b.ProcessUpdate(update(5))
+	m := b.machine(&User{ID: 1})
+	assert.Empty(t, m.Session().Keys())
+	m.Session().Clear()
+	b.ProcessUpdate(update(5))
+	b.ProcessUpdate(update(0))
+	b.ProcessUpdate(update(0))
+	assert.Equal(t, []int{5, 0, 0}, handled)
+
+	// after a restart, the ids come from the store
+	handled = nil
+	b = start()
+	b.ProcessUpdate(update(5))
+	b.ProcessUpdate(update(7))
+	b.ProcessUpdate(update(6))
+	b.ProcessUpdate(update(7))
+	b.ProcessUpdate(update(4))
+	assert.Equal(t, []int{7, 6}, handled)
+}
+
+func TestInsertID(t *testing.T) {
+	assert.Equal(t, []int{1}, insertID(nil, 1))
+	assert.Equal(t, []int{1, 2, 3}, insertID([]int{1, 3}, 2))
+	assert.Equal(t, []int{0, 1, 3}, insertID([]int{1, 3}, 0))
+	assert.Equal(t, []int{1, 3, 4}, insertID([]int{1, 3}, 4))
+}
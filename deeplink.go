@@ -0,0 +1,108 @@
+package stb
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// MaxStartPayload is the maximum length of the payload of a deep link.
+const MaxStartPayload = 64
+
+// startEncoded marks the payloads encoded by StartLink, it is
+// made of characters allowed in deep links that plain payloads
+// rarely begin with.
+const startEncoded = "__"
+
+// ErrStartTooLong is returned by StartLink when the encoded
+// payload does not fit into MaxStartPayload.
+var ErrStartTooLong = errors.New("stb: start payload is too long")
+
+// startHandler is a handler of /start deep links,
+// registered with State.HandleStart.
+type startHandler struct {
+	prefix  string
+	handler func(*Message, *Machine) error
+}
+
+// HandleStart registers the handler for deep links (/start <payload>)
+// whose payload begins with prefix. Payloads matching several prefixes
+// go to the handler of the longest one, deep links with no match
+// fall back to the /start handler.
+//
+// The handler gets the rest of the payload in Message.Payload,
+// decoded if it was encoded by StartLink.
+//
+// Example:
+//
+//     b.Default(stb.Default).HandleStart("item-", func(msg *stb.Message, m *stb.Machine) error {
+//         return m.SendEvent(ShowItem, msg.Payload)
+//     })
+//
+func (s *State) HandleStart(prefix string, handler interface{}) error {
+	if err := checkHandler("/start", handler); err != nil {
+		return err
+	}
+
+	for _, h := range s.starts {
+		if h.prefix == prefix {
+			s.duplicate("/start " + prefix)
+		}
+	}
+	s.starts = append(s.starts, startHandler{
+		prefix:  prefix,
+		handler: withError(handler).(func(*Message, *Machine) error),
+	})
+	return nil
+}
+
+// MustHandleStart is like HandleStart but panics if the handler can't be registered.
+func (s *State) MustHandleStart(prefix string, handler interface{}) {
+	if err := s.HandleStart(prefix, handler); err != nil {
+		panic(err)
+	}
+}
+
+// handleStart runs the start handler with the longest
+// prefix of the message payload, if there is one.
+func (s *State) handleStart(msg *Message, m *Machine) bool {
+	var match *startHandler
+	for i, h := range s.starts {
+		if strings.HasPrefix(msg.Payload, h.prefix) &&
+			(match == nil || len(h.prefix) > len(match.prefix)) {
+			match = &s.starts[i]
+		}
+	}
+	if match == nil {
+		return false
+	}
+
+	msg.Payload = decodeStart(msg.Payload[len(match.prefix):])
+	s.runHandler("/start", func(m *Machine) error { return match.handler(msg, m) })
+	return true
+}
+
+// StartLink returns a deep link to the bot, which sends /start with
+// the prefix and the base64url encoded payload once the user taps it.
+// The encoded payload is marked, so that the payloads of other links
+// are never decoded by mistake.
+func (b *Bot) StartLink(prefix, payload string) (string, error) {
+	start := prefix + startEncoded + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	if len(start) > MaxStartPayload {
+		return "", ErrStartTooLong
+	}
+	return "https://t.me/" + b.Me.Username + "?start=" + start, nil
+}
+
+// decodeStart decodes a payload encoded by StartLink,
+// other payloads are returned as they are.
+func decodeStart(payload string) string {
+	if !strings.HasPrefix(payload, startEncoded) {
+		return payload
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload[len(startEncoded):])
+	if err != nil {
+		return payload
+	}
+	return string(data)
+}
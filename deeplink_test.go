@@ -0,0 +1,42 @@
+package stb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateHandleStart(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+	b.Me.Username = "shopbot"
+
+	var got []string
+	s := b.Default(Default)
+	s.MustHandleStart("", func(msg *Message, _ *Machine) {
+		got = append(got, "any "+msg.Payload)
+	})
+	s.MustHandleStart("item-", func(msg *Message, _ *Machine) {
+		got = append(got, "item "+msg.Payload)
+	})
+	s.MustHandle("/start", func(msg *Message, _ *Machine) {
+		got = append(got, "start")
+	})
+	assert.Error(t, s.HandleStart("ref", func(*Callback, *Machine) {}))
+
+	link, err := b.StartLink("item-", "Blue Shirt")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(link, "https://t.me/shopbot?start=item-"))
+
+	start := "/start " + link[strings.Index(link, "=")+1:]
+	for _, text := range []string{start, "/start item-42", "/start item-Zm9v", "/start ref42", "/start"} {
+		b.ProcessUpdate(Update{Message: &Message{Sender: &User{ID: 1}, Text: text}})
+	}
+
+	assert.Equal(t, []string{"item Blue Shirt", "item 42", "item Zm9v", "any ref42", "start"}, got)
+
+	_, err = b.StartLink("item-", strings.Repeat("x", 64))
+	assert.Equal(t, ErrStartTooLong, err)
+}
@@ -0,0 +1,204 @@
+package stb
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Definition is the declarative form of the states of a bot,
+// see Bot.Define. It is usually loaded from a YAML or JSON
+// document with ParseDefinition:
+//
+//     default: Default
+//     events:
+//       cancel: Default
+//     handlers:
+//       /cancel: cancel
+//     states:
+//       Default:
+//         events:
+//           order: Order
+//         handlers:
+//           /order: order
+//       Order:
+//         action: askSize
+//         timeout: {after: 10m, target: Default}
+//         handlers:
+//           text: pickSize
+//
+// Handlers and actions are referred to by name, the functions
+// themselves come from a Registry.
+//
+// Endpoints are either commands ("/start"), callback buttons
+// prefixed with "btn:" ("btn:confirm") or the names of the
+// predefined endpoints without the leading \a ("text", "photo").
+type Definition struct {
+	// Default is the state new machines start in.
+	Default StateType `yaml:"default" json:"default"`
+
+	// Events and Handlers are the global ones (see Bot.Event and Bot.Handle).
+	Events   map[EventType]StateType `yaml:"events" json:"events"`
+	Handlers map[string]string       `yaml:"handlers" json:"handlers"`
+
+	States map[StateType]StateDefinition `yaml:"states" json:"states"`
+}
+
+// StateDefinition is the declarative form of a State.
+type StateDefinition struct {
+	Parent   StateType               `yaml:"parent" json:"parent"`
+	Action   string                  `yaml:"action" json:"action"`
+	Events   map[EventType]StateType `yaml:"events" json:"events"`
+	Handlers map[string]string       `yaml:"handlers" json:"handlers"`
+	Timeout  *TimeoutDefinition      `yaml:"timeout" json:"timeout"`
+
+	// Stay keeps the machine in the state on self-transitions,
+	// see State.Reenter.
+	Stay bool `yaml:"stay" json:"stay"`
+}
+
+// TimeoutDefinition is the declarative form of State.Timeout.
+type TimeoutDefinition struct {
+	// After is a duration as understood by time.ParseDuration.
+	After  string    `yaml:"after" json:"after"`
+	Target StateType `yaml:"target" json:"target"`
+}
+
+// Registry binds the handler and action names used in a
+// Definition to functions. Actions must be func(*Machine),
+// handlers must fit their endpoints like with State.Handle.
+type Registry map[string]interface{}
+
+// ParseDefinition parses a Definition from YAML or JSON.
+func ParseDefinition(data []byte) (*Definition, error) {
+	var def Definition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, errors.Wrap(err, "stb: bad definition")
+	}
+	return &def, nil
+}
+
+// Define creates the states, events and handlers of the definition,
+// binding the names it refers to with the registry.
+func (b *Bot) Define(def *Definition, reg Registry) error {
+	if def.Default == "" {
+		return errors.New("stb: definition has no default state")
+	}
+	if _, ok := def.States[def.Default]; !ok {
+		return errors.Errorf("stb: default state %q is not defined", def.Default)
+	}
+
+	for e, t := range def.Events {
+		b.Event(e, t)
+	}
+	if err := defineHandlers(b.global, def.Handlers, reg); err != nil {
+		return err
+	}
+
+	types := make([]string, 0, len(def.States))
+	for t := range def.States {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+
+	for _, t := range types {
+		sd := def.States[StateType(t)]
+
+		var s *State
+		if StateType(t) == def.Default {
+			s = b.Default(def.Default)
+		} else {
+			s = b.State(StateType(t))
+		}
+
+		if sd.Parent != "" {
+			s.Parent(sd.Parent)
+		}
+		for e, next := range sd.Events {
+			s.Event(e, next)
+		}
+		s.Reenter(!sd.Stay)
+
+		if sd.Action != "" {
+			action, ok := reg[sd.Action].(func(*Machine))
+			if !ok {
+				return errors.Errorf("stb: state %q: action %q is not a func(*Machine)", t, sd.Action)
+			}
+			s.Action(action)
+		}
+
+		if sd.Timeout != nil {
+			d, err := time.ParseDuration(sd.Timeout.After)
+			if err != nil {
+				return errors.Wrapf(err, "stb: state %q: bad timeout", t)
+			}
+			s.Timeout(d, sd.Timeout.Target)
+		}
+
+		if err := defineHandlers(s, sd.Handlers, reg); err != nil {
+			return errors.WithMessagef(err, "state %q", t)
+		}
+	}
+	return nil
+}
+
+// Validate runs ValidateStates on the states of the definition
+// without binding its handlers, e.g. to check a definition
+// before deploying it. Handlers registered twice can't be
+// told apart in a definition and are not reported.
+func (def *Definition) Validate() []error {
+	if _, ok := def.States[def.Default]; !ok {
+		return []error{errors.Wrapf(ErrUndefinedState, "default state is %q", def.Default)}
+	}
+
+	states := make(map[StateType]*State, len(def.States))
+	for t, sd := range def.States {
+		s := &State{Type: t, parent: sd.Parent, Events: sd.Events}
+		if sd.Timeout != nil {
+			d, err := time.ParseDuration(sd.Timeout.After)
+			if err != nil {
+				return []error{errors.Wrapf(err, "stb: state %q: bad timeout", t)}
+			}
+			s.timeout, s.timeoutTarget = d, sd.Timeout.Target
+		}
+		states[t] = s
+	}
+	return validateStates(states, def.Default, def.Events)
+}
+
+// LoadDefinition parses the YAML or JSON definition and defines it.
+func (b *Bot) LoadDefinition(data []byte, reg Registry) error {
+	def, err := ParseDefinition(data)
+	if err != nil {
+		return err
+	}
+	return b.Define(def, reg)
+}
+
+func defineHandlers(s *State, handlers map[string]string, reg Registry) error {
+	for end, name := range handlers {
+		handler, ok := reg[name]
+		if !ok {
+			return errors.Errorf("stb: handler %q is not registered", name)
+		}
+		if err := s.Handle(definedEndpoint(end), handler); err != nil {
+			return errors.WithMessagef(err, "handler %q", name)
+		}
+	}
+	return nil
+}
+
+// definedEndpoint turns an endpoint of a definition into a real one.
+func definedEndpoint(end string) string {
+	switch {
+	case strings.HasPrefix(end, "/"):
+		return end
+	case strings.HasPrefix(end, "btn:"):
+		return "\f" + strings.TrimPrefix(end, "btn:")
+	default:
+		return "\a" + end
+	}
+}
@@ -0,0 +1,80 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDefinition = `
+default: Default
+events:
+  cancel: Default
+handlers:
+  /cancel: cancel
+states:
+  Default:
+    events:
+      order: Order
+    handlers:
+      /order: order
+  Order:
+    action: askSize
+    timeout: {after: 10m, target: Default}
+    handlers:
+      text: pickSize
+      btn:confirm: confirm
+`
+
+func TestBotDefine(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var got []string
+	reg := Registry{
+		"cancel":   func(_ *Message, m *Machine) error { return m.SendEvent("cancel") },
+		"order":    func(_ *Message, m *Machine) error { return m.SendEvent("order") },
+		"askSize":  func(*Machine) { got = append(got, "ask") },
+		"pickSize": func(msg *Message, _ *Machine) { got = append(got, msg.Text) },
+		"confirm":  func(*Callback, *Machine) {},
+	}
+	require.NoError(t, b.LoadDefinition([]byte(testDefinition), reg))
+
+	assert.Equal(t, Default, b.defaultState)
+	assert.Equal(t, 10*time.Minute, b.states["Order"].timeout)
+	assert.Contains(t, b.states["Order"].handlers, "\fconfirm")
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{Message: &Message{Text: "/order", Sender: user}})
+	b.ProcessUpdate(Update{Message: &Message{Text: "large", Sender: user}})
+	b.ProcessUpdate(Update{Message: &Message{Text: "/cancel", Sender: user}})
+
+	assert.Equal(t, []string{"ask", "large"}, got)
+	assert.Equal(t, Default, b.machine(user).Current())
+
+	delete(reg, "confirm")
+	assert.Error(t, b.LoadDefinition([]byte(testDefinition), reg))
+
+	reg["confirm"] = func(*Message, *Machine) {}
+	err = b.LoadDefinition([]byte(testDefinition), reg)
+	assert.ErrorIs(t, err, ErrBadHandler)
+}
+
+func TestDefinitionValidate(t *testing.T) {
+	def, err := ParseDefinition([]byte(testDefinition))
+	require.NoError(t, err)
+	assert.Empty(t, def.Validate())
+
+	def.States["Lost"] = StateDefinition{Events: map[EventType]StateType{"back": "Nowhere"}}
+	problems := def.Validate()
+	require.Len(t, problems, 2)
+	assert.ErrorIs(t, problems[0], ErrUndefinedState)
+	assert.ErrorIs(t, problems[1], ErrUnreachableState)
+
+	def.Default = "Start"
+	problems = def.Validate()
+	require.Len(t, problems, 1)
+	assert.ErrorIs(t, problems[0], ErrUndefinedState)
+}
@@ -0,0 +1,140 @@
+package stb
+
+import "time"
+
+// ScheduledEvent is an event scheduled with Machine.SendEventAfter.
+type ScheduledEvent struct {
+	Event EventType `json:"event"`
+	At    time.Time `json:"at"`
+}
+
+type scheduledEvent struct {
+	ScheduledEvent
+	timer *time.Timer
+}
+
+// SendEventAfter sends the event to the machine once the delay
+// passed, e.g. to expire an order that was not confirmed in time.
+// Scheduled events are persisted with the machine: restored machines
+// send the ones that became due while the bot was down right away.
+// Machines with scheduled events are not evicted, and once the bot
+// is started, it loads the stored ones (see Bot.Start).
+//
+// Like with SendEvent, the event is rejected unless the state the
+// machine is in by then accepts it, which is reported to the Reporter
+// only if it is not ErrEventRejected.
+//
+// Example:
+//
+//     m.SendEventAfter(Expire, 24*time.Hour)
+//
+func (m *Machine) SendEventAfter(event EventType, delay time.Duration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.scheduleEvent(ScheduledEvent{Event: event, At: time.Now().Add(delay)})
+	return m.persist()
+}
+
+// CancelEvent cancels the scheduled events of the type.
+func (m *Machine) CancelEvent(event EventType) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	kept := m.scheduled[:0]
+	for _, se := range m.scheduled {
+		if se.Event == event {
+			se.timer.Stop()
+		} else {
+			kept = append(kept, se)
+		}
+	}
+	if len(kept) == len(m.scheduled) {
+		return nil
+	}
+	m.currentMu.Lock()
+	m.scheduled = kept
+	m.currentMu.Unlock()
+	return m.persist()
+}
+
+// Scheduled returns the events scheduled with SendEventAfter.
+func (m *Machine) Scheduled() []ScheduledEvent {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.scheduledEvents()
+}
+
+// scheduledEvents lists the scheduled events.
+// The caller must hold the mutex or currentMu.
+func (m *Machine) scheduledEvents() []ScheduledEvent {
+	var events []ScheduledEvent
+	for _, se := range m.scheduled {
+		events = append(events, se.ScheduledEvent)
+	}
+	return events
+}
+
+// scheduleEvent arms a timer for the event. The caller must hold the mutex.
+func (m *Machine) scheduleEvent(e ScheduledEvent) {
+	se := &scheduledEvent{ScheduledEvent: e}
+	se.timer = time.AfterFunc(time.Until(e.At), func() { m.fire(se) })
+	m.currentMu.Lock()
+	m.scheduled = append(m.scheduled, se)
+	m.currentMu.Unlock()
+}
+
+// fire sends the scheduled event, unless it was cancelled.
+func (m *Machine) fire(se *scheduledEvent) {
+	m.mutex.Lock()
+	found := false
+	for i, other := range m.scheduled {
+		if other == se {
+			m.currentMu.Lock()
+			m.scheduled = append(m.scheduled[:i:i], m.scheduled[i+1:]...)
+			m.currentMu.Unlock()
+			found = true
+			break
+		}
+	}
+	if !found {
+		m.mutex.Unlock()
+		return
+	}
+	err := m.persist()
+	m.mutex.Unlock()
+
+	if err == nil {
+		err = m.SendEvent(se.Event)
+	}
+	if err != nil && err != ErrEventRejected && m.reporter != nil {
+		m.reporter(err)
+	}
+}
+
+// loadStored loads the stored machines waiting for a scheduled
+// event or a state timeout, so that they fire even if their users
+// stay silent after a restart, and with Settings.Outbox the ones
+// with messages left in their outbox, which flush it once loaded.
+// It needs a store implementing Lister.
+func (b *Bot) loadStored() {
+	lister, ok := b.store.(Lister)
+	if !ok {
+		return
+	}
+	ids, err := lister.IDs()
+	if err != nil {
+		b.debug(err)
+		return
+	}
+	for _, id := range ids {
+		snap, err := b.store.Load(id)
+		if err != nil {
+			b.debug(err)
+			continue
+		}
+		if len(snap.Scheduled) > 0 || snap.Deadline != nil || b.outbox && len(snap.Outbox) > 0 {
+			b.machines.obtain(id, nil)
+		}
+	}
+}
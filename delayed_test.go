@@ -0,0 +1,116 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineSendEventAfter(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+
+	expired := make(chan string, 2)
+	b.Default("Confirm").Event("expire", "Expired")
+	b.State("Expired").Action(func(m *Machine) { expired <- m.ID() })
+
+	m := b.machine(&User{ID: 1})
+	require.NoError(t, m.SendEventAfter("expire", 30*time.Millisecond))
+	require.NoError(t, m.SendEventAfter("remind", time.Hour))
+	assert.Len(t, m.Scheduled(), 2)
+
+	snap, err := store.Load("1")
+	require.NoError(t, err)
+	require.Len(t, snap.Scheduled, 2)
+	assert.Equal(t, EventType("expire"), snap.Scheduled[0].Event)
+	assert.False(t, m.idle(time.Now().Add(time.Hour), time.Minute))
+
+	select {
+	case id := <-expired:
+		assert.Equal(t, "1", id)
+	case <-time.After(time.Second):
+		t.Fatal("event was not sent")
+	}
+	assert.Equal(t, StateType("Expired"), m.Current())
+
+	require.NoError(t, m.CancelEvent("remind"))
+	assert.Empty(t, m.Scheduled())
+	snap, err = store.Load("1")
+	require.NoError(t, err)
+	assert.Empty(t, snap.Scheduled)
+
+	// restored machines send the events that became due
+	past := ScheduledEvent{Event: "expire", At: time.Now().Add(-time.Minute)}
+	require.NoError(t, store.Save("2", &Snapshot{State: "Confirm", Scheduled: []ScheduledEvent{past}}))
+	b.machine(&User{ID: 2})
+
+	select {
+	case id := <-expired:
+		assert.Equal(t, "2", id)
+	case <-time.After(time.Second):
+		t.Fatal("restored event was not sent")
+	}
+}
+
+func TestBotLoadStored(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+
+	expired := make(chan string, 2)
+	b.Default("Confirm").Event("expire", "Expired")
+	b.State("Expired").Action(func(m *Machine) { expired <- m.ID() })
+	b.State("Waiting").Timeout(time.Hour, "Expired")
+
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, store.Save("1", &Snapshot{
+		State:     "Confirm",
+		Scheduled: []ScheduledEvent{{Event: "expire", At: past}},
+	}))
+	require.NoError(t, store.Save("2", &Snapshot{State: "Waiting", Deadline: &past}))
+	require.NoError(t, store.Save("3", &Snapshot{State: "Confirm"}))
+
+	// the users stay silent, the bot loads their machines itself
+	b.loadStored()
+
+	got := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case id := <-expired:
+			got[id] = true
+		case <-time.After(time.Second):
+			t.Fatal("stored machines did not fire")
+		}
+	}
+	assert.Equal(t, map[string]bool{"1": true, "2": true}, got)
+	_, loaded := b.machines.Get("3")
+	assert.False(t, loaded)
+}
+
+// savingStore is a MemoryStore counting its saves.
+type savingStore struct {
+	*MemoryStore
+	saves int
+}
+
+func (s *savingStore) Save(id string, snap *Snapshot) error {
+	s.saves++
+	return s.MemoryStore.Save(id, snap)
+}
+
+func TestMachineFireCancelled(t *testing.T) {
+	store := &savingStore{MemoryStore: NewMemoryStore()}
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+	b.Default(Default).Event("remind", "Reminded")
+	b.State("Reminded")
+
+	// a timer firing after its event was cancelled
+	m := b.machine(&User{ID: 1})
+	m.fire(&scheduledEvent{ScheduledEvent: ScheduledEvent{Event: "remind"}})
+	assert.Equal(t, 0, store.saves)
+	assert.Equal(t, Default, m.Current())
+}
@@ -0,0 +1,50 @@
+package stb
+
+import "sync"
+
+// workerQueue is the number of updates a worker buffers
+// before ProcessUpdate starts to block.
+const workerQueue = 64
+
+// dispatcher processes updates on a fixed set of workers.
+// Updates with the same key always land on the same worker,
+// so they are handled in the order they arrived, while updates
+// with different keys are handled in parallel.
+type dispatcher struct {
+	once    sync.Once
+	workers []chan func()
+}
+
+func newDispatcher(n int) *dispatcher {
+	return &dispatcher{workers: make([]chan func(), n)}
+}
+
+// submit queues the job on the worker that owns the key.
+func (d *dispatcher) submit(key int64, job func()) {
+	d.once.Do(func() {
+		for i := range d.workers {
+			jobs := make(chan func(), workerQueue)
+			d.workers[i] = jobs
+			go func() {
+				for job := range jobs {
+					job()
+				}
+			}()
+		}
+	})
+
+	n := uint64(key) % uint64(len(d.workers))
+	d.workers[n] <- job
+}
+
+// dispatchKey returns the key updates are ordered by: the chat
+// they come from or, if there is none, the user who sent them.
+func dispatchKey(upd Update) int64 {
+	if chat := updateChat(upd); chat != nil {
+		return chat.ID
+	}
+	if user, err := DefaultRecognizer(upd); err == nil && user != nil {
+		return int64(user.ID)
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package stb
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchOrder(t *testing.T) {
+	b, err := NewBot(Settings{Offline: true, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu  sync.Mutex
+		got []int
+	)
+	release := make(chan struct{})
+	b.Default(Default).Handle(OnText, func(msg *Message, m *Machine) {
+		if msg.Chat.ID == 1 {
+			// chat 1 waits for chat 2, which must not be stuck behind it
+			<-release
+			n, _ := strconv.Atoi(msg.Text)
+			time.Sleep(time.Duration(10-n) * time.Millisecond)
+			mu.Lock()
+			got = append(got, n)
+			mu.Unlock()
+		} else {
+			close(release)
+		}
+	})
+
+	user := &User{ID: 1}
+	for i := 0; i < 10; i++ {
+		b.ProcessUpdate(Update{Message: &Message{
+			Text:   strconv.Itoa(i),
+			Sender: user,
+			Chat:   &Chat{ID: 1},
+		}})
+	}
+	b.ProcessUpdate(Update{Message: &Message{Text: "go", Sender: &User{ID: 2}, Chat: &Chat{ID: 2}}})
+
+	b.inflight.Wait()
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, got)
+}
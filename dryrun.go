@@ -0,0 +1,59 @@
+package stb
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// dryRun stands in for the API calls that would change
+// anything while the bot runs with Settings.DryRun.
+type dryRun struct {
+	capture func(*APICall)
+	lastID  int64
+}
+
+// reading reports whether the method only reads data,
+// so that a dry run still sends it.
+func reading(method string) bool {
+	return strings.HasPrefix(method, "get")
+}
+
+// send captures the call and answers it the way Telegram would,
+// with a made up message for the methods returning one.
+func (d *dryRun) send(call *APICall) ([]byte, error) {
+	if d.capture != nil {
+		d.capture(call)
+	} else {
+		data, _ := json.Marshal(call.Payload)
+		log.Printf("[dry-run] stb: %s %s", call.Method, data)
+	}
+
+	var result interface{} = true
+	switch {
+	case call.Method == "sendMediaGroup":
+		result = []interface{}{d.message(call)}
+	case strings.HasPrefix(call.Method, "send"),
+		strings.HasPrefix(call.Method, "edit"),
+		call.Method == "copyMessage",
+		call.Method == "forwardMessage",
+		call.Method == "stopMessageLiveLocation":
+		result = d.message(call)
+	}
+	return json.Marshal(map[string]interface{}{"ok": true, "result": result})
+}
+
+// message makes up the message the call would have sent.
+func (d *dryRun) message(call *APICall) map[string]interface{} {
+	msg := map[string]interface{}{
+		"message_id": atomic.AddInt64(&d.lastID, 1),
+		"chat":       map[string]interface{}{"id": payloadChat(call.Payload)},
+		"date":       time.Now().Unix(),
+	}
+	if text, ok := call.Param("text"); ok {
+		msg["text"] = text
+	}
+	return msg
+}
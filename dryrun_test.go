@@ -0,0 +1,37 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	api := newFakeAPI(t, `{"file_id":"f","file_path":"photos/1.jpg"}`)
+
+	var captured []string
+	b, err := NewBot(Settings{
+		Offline:  true,
+		URL:      api.URL,
+		DryRun:   true,
+		OnDryRun: func(call *APICall) { captured = append(captured, call.Method) },
+	})
+	require.NoError(t, err)
+
+	msg, err := b.Send(&Chat{ID: 5}, "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", msg.Text)
+	assert.Equal(t, int64(5), msg.Chat.ID)
+
+	edited, err := b.Edit(msg, "bye")
+	require.NoError(t, err)
+	assert.NotEqual(t, msg.ID, edited.ID)
+	require.NoError(t, b.Delete(edited))
+
+	_, err = b.FileByID("f")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"sendMessage", "editMessageText", "deleteMessage"}, captured)
+	assert.Equal(t, []string{"getFile"}, api.Methods())
+}
@@ -0,0 +1,225 @@
+package stb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// encryptedPrefix marks the values encrypted by EncryptStore.
+const encryptedPrefix = "stb:enc:"
+
+// Cipher encrypts and decrypts the values EncryptStore persists.
+// The additional data is authenticated along with the value: a
+// value only decrypts with the data it was encrypted with.
+type Cipher interface {
+	Encrypt(plain, additional []byte) ([]byte, error)
+	Decrypt(sealed, additional []byte) ([]byte, error)
+}
+
+// AESCipher is a Cipher using AES-GCM with named keys. Values are
+// encrypted with the current key and carry its name, so that keys
+// can be rotated: values encrypted with an older key are still
+// decrypted as long as the key is kept, and encrypted with the new
+// key the next time the machine is saved.
+type AESCipher struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewAESCipher creates a cipher encrypting with the current key
+// and decrypting with any of the keys, which are 16, 24 or 32
+// bytes long for AES-128, AES-192 or AES-256.
+//
+// Example:
+//
+//     c, err := stb.NewAESCipher("2024-06", map[string][]byte{
+//         "2024-01": oldKey,
+//         "2024-06": newKey,
+//     })
+//
+func NewAESCipher(current string, keys map[string][]byte) (*AESCipher, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, errors.Errorf("stb: no key named %q", current)
+	}
+
+	c := &AESCipher{current: current, keys: make(map[string]cipher.AEAD)}
+	for name, key := range keys {
+		if len(name) > 255 {
+			return nil, errors.Errorf("stb: key name %q is too long", name)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "stb: key %q", name)
+		}
+		if c.keys[name], err = cipher.NewGCM(block); err != nil {
+			return nil, errors.Wrapf(err, "stb: key %q", name)
+		}
+	}
+	return c, nil
+}
+
+// Encrypt implements Cipher. The result holds the name
+// of the key, the nonce and the sealed value.
+func (c *AESCipher) Encrypt(plain, additional []byte) ([]byte, error) {
+	aead := c.keys[c.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, wrapError(err)
+	}
+
+	out := append([]byte{byte(len(c.current))}, c.current...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plain, additional), nil
+}
+
+// Decrypt implements Cipher.
+func (c *AESCipher) Decrypt(sealed, additional []byte) ([]byte, error) {
+	if len(sealed) == 0 || len(sealed) < 1+int(sealed[0]) {
+		return nil, errors.New("stb: malformed encrypted value")
+	}
+	name := string(sealed[1 : 1+sealed[0]])
+	sealed = sealed[1+sealed[0]:]
+
+	aead, ok := c.keys[name]
+	if !ok {
+		return nil, errors.Errorf("stb: no key named %q", name)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("stb: malformed encrypted value")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+	return plain, wrapError(err)
+}
+
+// EncryptStore returns a store encrypting the contexts and the
+// session values of the machines before they reach the store,
+// since they often hold personal data. A value is bound to the id
+// of its machine and to its session key, so it can't be copied
+// over to another machine or key. The rest of the snapshots stays
+// readable: the states and timers, but also the messages waiting
+// in the outbox (see Settings.Outbox) and the events deferred or
+// scheduled. Values which are not encrypted fail to load.
+//
+// Example:
+//
+//     store := stb.EncryptStore(redis.New(client), cipher)
+//
+func EncryptStore(store Store, c Cipher) Store {
+	return &encryptedStore{Store: store, cipher: c}
+}
+
+// EncryptStoreMigrating is EncryptStore also loading the values saved
+// before the encryption was turned on, which are encrypted the next
+// time their machine is saved. As anyone able to write to the store
+// could then slip in values of their own, switch over to EncryptStore
+// once the machines are migrated.
+func EncryptStoreMigrating(store Store, c Cipher) Store {
+	return &encryptedStore{Store: store, cipher: c, plaintext: true}
+}
+
+type encryptedStore struct {
+	Store
+	cipher    Cipher
+	plaintext bool
+}
+
+// contextData and sessionData are the additional data
+// binding the values to their machine and session key.
+func contextData(id string) []byte {
+	return []byte(id + "\x00context")
+}
+
+func sessionData(id, key string) []byte {
+	return []byte(id + "\x00session\x00" + key)
+}
+
+func (s *encryptedStore) Save(id string, snap *Snapshot) error {
+	sealed := *snap
+	var err error
+	if sealed.Context, err = s.seal(snap.Context, contextData(id)); err != nil {
+		return err
+	}
+	if snap.Session != nil {
+		sealed.Session = make(map[string]SessionEntry, len(snap.Session))
+		for key, entry := range snap.Session {
+			if entry.Value, err = s.seal(entry.Value, sessionData(id, key)); err != nil {
+				return err
+			}
+			sealed.Session[key] = entry
+		}
+	}
+	return s.Store.Save(id, &sealed)
+}
+
+func (s *encryptedStore) Load(id string) (*Snapshot, error) {
+	snap, err := s.Store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	opened := *snap
+	if opened.Context, err = s.open(snap.Context, contextData(id)); err != nil {
+		return nil, errors.Wrapf(err, "stb: can't decrypt machine %s", id)
+	}
+	if snap.Session != nil {
+		opened.Session = make(map[string]SessionEntry, len(snap.Session))
+		for key, entry := range snap.Session {
+			if entry.Value, err = s.open(entry.Value, sessionData(id, key)); err != nil {
+				return nil, errors.Wrapf(err, "stb: can't decrypt machine %s", id)
+			}
+			opened.Session[key] = entry
+		}
+	}
+	return &opened, nil
+}
+
+// IDs lists the machines of the store, if it is a Lister.
+func (s *encryptedStore) IDs() ([]string, error) {
+	lister, ok := s.Store.(Lister)
+	if !ok {
+		return nil, errors.New("stb: the store can't list its machines")
+	}
+	return lister.IDs()
+}
+
+// seal encrypts the JSON value into a JSON string.
+func (s *encryptedStore) seal(value json.RawMessage, additional []byte) (json.RawMessage, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	sealed, err := s.cipher.Encrypt(value, additional)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(encryptedPrefix + base64.StdEncoding.EncodeToString(sealed))
+	return data, wrapError(err)
+}
+
+// open decrypts the values sealed by seal. The others are
+// returned as they are while migrating, rejected otherwise.
+func (s *encryptedStore) open(value json.RawMessage, additional []byte) (json.RawMessage, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	var str string
+	if value[0] != '"' || json.Unmarshal(value, &str) != nil || !strings.HasPrefix(str, encryptedPrefix) {
+		if s.plaintext {
+			return value, nil
+		}
+		return nil, errors.New("stb: value is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(str[len(encryptedPrefix):])
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	plain, err := s.cipher.Decrypt(sealed, additional)
+	return json.RawMessage(plain), err
+}
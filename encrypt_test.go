@@ -0,0 +1,95 @@
+package stb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAESCipher(t *testing.T) {
+	old := bytes.Repeat([]byte{1}, 32)
+	c, err := NewAESCipher("old", map[string][]byte{"old": old})
+	require.NoError(t, err)
+
+	sealed, err := c.Encrypt([]byte("secret"), []byte("1"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+
+	rotated, err := NewAESCipher("new", map[string][]byte{"old": old, "new": bytes.Repeat([]byte{2}, 16)})
+	require.NoError(t, err)
+	plain, err := rotated.Decrypt(sealed, []byte("1"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plain))
+
+	resealed, err := rotated.Encrypt(plain, []byte("1"))
+	require.NoError(t, err)
+	_, err = c.Decrypt(resealed, []byte("1"))
+	assert.Error(t, err)
+	_, err = c.Decrypt(sealed[:5], []byte("1"))
+	assert.Error(t, err)
+	_, err = c.Decrypt(sealed, []byte("2"))
+	assert.Error(t, err)
+
+	_, err = NewAESCipher("missing", map[string][]byte{"old": old})
+	assert.Error(t, err)
+	_, err = NewAESCipher("short", map[string][]byte{"short": []byte("short")})
+	assert.Error(t, err)
+}
+
+func TestEncryptStore(t *testing.T) {
+	c, err := NewAESCipher("k", map[string][]byte{"k": bytes.Repeat([]byte{7}, 32)})
+	require.NoError(t, err)
+
+	plain := NewMemoryStore()
+	require.NoError(t, plain.Save("legacy", &Snapshot{State: Default, Context: json.RawMessage(`{"name":"Ann"}`)}))
+	store := EncryptStoreMigrating(plain, c)
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store, NewContext: func() interface{} { return new(map[string]string) }})
+	require.NoError(t, err)
+	b.Default(Default)
+	b.Handle(OnText, func(msg *Message, m *Machine) {
+		m.Session().Set("phone", "+49 123")
+		m.Set(map[string]string{"name": "Bob"})
+	})
+	b.ProcessUpdate(Update{Message: &Message{Text: "hi", Sender: &User{ID: 1}, Chat: &Chat{ID: 1}}})
+
+	raw, err := plain.Load("1")
+	require.NoError(t, err)
+	data, _ := json.Marshal(raw)
+	assert.NotContains(t, string(data), "+49 123")
+	assert.NotContains(t, string(data), "Bob")
+	assert.Equal(t, Default, raw.State)
+
+	snap, err := store.Load("1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"Bob"}`, string(snap.Context))
+	assert.JSONEq(t, `"+49 123"`, string(snap.Session["phone"].Value))
+
+	snap, err = store.Load("legacy")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"Ann"}`, string(snap.Context))
+
+	ids, err := store.(Lister).IDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "legacy"}, ids)
+
+	// plaintext is rejected once migrated
+	strict := EncryptStore(plain, c)
+	_, err = strict.Load("legacy")
+	assert.Error(t, err)
+	_, err = strict.Load("1")
+	assert.NoError(t, err)
+
+	// values don't decrypt on another machine or key
+	raw.Session["email"] = raw.Session["phone"]
+	require.NoError(t, plain.Save("2", raw))
+	_, err = strict.Load("2")
+	assert.Error(t, err)
+	delete(raw.Session, "email")
+	require.NoError(t, plain.Save("2", raw))
+	_, err = strict.Load("2")
+	assert.Error(t, err)
+}
@@ -0,0 +1,157 @@
+package stb
+
+import "unicode/utf16"
+
+// The offsets and lengths of entities count UTF-16 code units,
+// the helpers below convert them, so that emojis and other
+// characters outside of the BMP don't shift the entities.
+
+// utf16Slice returns the part of the text between the offsets
+// in UTF-16 code units, clamped to the text.
+func utf16Slice(text []uint16, start, end int) string {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	if start >= end {
+		return ""
+	}
+	return string(utf16.Decode(text[start:end]))
+}
+
+// entityText returns the text of the entities: the text of
+// the message, or its caption if it has no text.
+func (m *Message) entityText() (string, []MessageEntity) {
+	if m.Text != "" {
+		return m.Text, m.Entities
+	}
+	return m.Caption, m.CaptionEntities
+}
+
+// EntityText returns the part of the text, or the caption,
+// of the message the entity stands for.
+func (m *Message) EntityText(e MessageEntity) string {
+	text, _ := m.entityText()
+	encoded := utf16.Encode([]rune(text))
+	return utf16Slice(encoded, e.Offset, e.Offset+e.Length)
+}
+
+// EntitiesOf returns the entities of the text, or the
+// caption, of the message of any of the types.
+func (m *Message) EntitiesOf(types ...EntityType) []MessageEntity {
+	_, entities := m.entityText()
+
+	var found []MessageEntity
+	for _, e := range entities {
+		for _, t := range types {
+			if e.Type == t {
+				found = append(found, e)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// textsOf returns the texts of the entities of the types.
+func (m *Message) textsOf(types ...EntityType) []string {
+	var texts []string
+	for _, e := range m.EntitiesOf(types...) {
+		texts = append(texts, m.EntityText(e))
+	}
+	return texts
+}
+
+// Mentions returns the @usernames mentioned in the message.
+// Users without a username are mentioned with text mentions,
+// see EntitiesOf(EntityTMention).
+func (m *Message) Mentions() []string {
+	return m.textsOf(EntityMention)
+}
+
+// Hashtags returns the #hashtags of the message.
+func (m *Message) Hashtags() []string {
+	return m.textsOf(EntityHashtag)
+}
+
+// Commands returns the /commands of the message,
+// with their @botname if any.
+func (m *Message) Commands() []string {
+	return m.textsOf(EntityCommand)
+}
+
+// URLs returns the links of the message, both
+// spelled out in the text and behind text links.
+func (m *Message) URLs() []string {
+	var urls []string
+	for _, e := range m.EntitiesOf(EntityURL, EntityTextLink) {
+		if e.Type == EntityTextLink {
+			urls = append(urls, e.URL)
+		} else {
+			urls = append(urls, m.EntityText(e))
+		}
+	}
+	return urls
+}
+
+// CustomEmojis returns the ids of the custom emojis of the message.
+func (m *Message) CustomEmojis() []string {
+	var ids []string
+	for _, e := range m.EntitiesOf(EntityCustomEmoji) {
+		ids = append(ids, e.CustomEmojiID)
+	}
+	return ids
+}
+
+// Splice replaces the part of the text between the offsets, in UTF-16
+// code units, with insert and moves the entities accordingly. Entities
+// overlapping the part replaced are cut, the ones within it dropped.
+// It returns the new text and entities, leaving the ones passed as is.
+//
+// Example:
+//
+//     // censor the first URL, keeping the formatting around it
+//     url := msg.EntitiesOf(stb.EntityURL)[0]
+//     text, entities := stb.Splice(msg.Text, msg.Entities,
+//         url.Offset, url.Offset+url.Length, "[link removed]")
+//
+func Splice(text string, entities []MessageEntity, start, end int, insert string) (string, []MessageEntity) {
+	encoded := utf16.Encode([]rune(text))
+	if start < 0 {
+		start = 0
+	}
+	if end > len(encoded) {
+		end = len(encoded)
+	}
+	if start > end {
+		start = end
+	}
+
+	inserted := len(utf16.Encode([]rune(insert)))
+	shift := inserted - (end - start)
+	spliced := utf16Slice(encoded, 0, start) + insert + utf16Slice(encoded, end, len(encoded))
+
+	var moved []MessageEntity
+	for _, e := range entities {
+		from, to := e.Offset, e.Offset+e.Length
+		switch {
+		case to <= start:
+			// before the part replaced
+		case from >= end:
+			from, to = from+shift, to+shift
+		case from >= start && to <= end:
+			continue
+		case from < start && to > end:
+			to += shift
+		case from < start:
+			to = start
+		default:
+			from, to = start+inserted, to+shift
+		}
+		e.Offset, e.Length = from, to-from
+		moved = append(moved, e)
+	}
+	return spliced, moved
+}
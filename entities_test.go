@@ -0,0 +1,60 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageEntities(t *testing.T) {
+	// "🎉" takes two UTF-16 code units
+	msg := &Message{
+		Text: "🎉 @ann #go /start@bot https://a.io docs 😀",
+		Entities: []MessageEntity{
+			{Type: EntityMention, Offset: 3, Length: 4},
+			{Type: EntityHashtag, Offset: 8, Length: 3},
+			{Type: EntityCommand, Offset: 12, Length: 10},
+			{Type: EntityURL, Offset: 23, Length: 12},
+			{Type: EntityTextLink, Offset: 36, Length: 4, URL: "https://b.io"},
+			{Type: EntityCustomEmoji, Offset: 41, Length: 2, CustomEmojiID: "42"},
+		},
+	}
+
+	assert.Equal(t, []string{"@ann"}, msg.Mentions())
+	assert.Equal(t, []string{"#go"}, msg.Hashtags())
+	assert.Equal(t, []string{"/start@bot"}, msg.Commands())
+	assert.Equal(t, []string{"https://a.io", "https://b.io"}, msg.URLs())
+	assert.Equal(t, []string{"42"}, msg.CustomEmojis())
+	assert.Equal(t, "😀", msg.EntityText(msg.Entities[5]))
+
+	caption := &Message{Caption: "#tag", CaptionEntities: []MessageEntity{{Type: EntityHashtag, Length: 4}}}
+	assert.Equal(t, []string{"#tag"}, caption.Hashtags())
+}
+
+func TestSplice(t *testing.T) {
+	text := "🎉 bold link end"
+	entities := []MessageEntity{
+		{Type: EntityBold, Offset: 3, Length: 4},
+		{Type: EntityTextLink, Offset: 8, Length: 4, URL: "u"},
+		{Type: EntityItalic, Offset: 3, Length: 13},
+		{Type: EntityCode, Offset: 13, Length: 3},
+	}
+
+	spliced, moved := Splice(text, entities, 8, 12, "🔗")
+	assert.Equal(t, "🎉 bold 🔗 end", spliced)
+	assert.Equal(t, []MessageEntity{
+		{Type: EntityBold, Offset: 3, Length: 4},
+		{Type: EntityItalic, Offset: 3, Length: 11},
+		{Type: EntityCode, Offset: 11, Length: 3},
+	}, moved)
+
+	spliced, moved = Splice(text, entities, 5, 10, "")
+	assert.Equal(t, "🎉 bonk end", spliced)
+	assert.Equal(t, []MessageEntity{
+		{Type: EntityBold, Offset: 3, Length: 2},
+		{Type: EntityTextLink, Offset: 5, Length: 2, URL: "u"},
+		{Type: EntityItalic, Offset: 3, Length: 8},
+		{Type: EntityCode, Offset: 8, Length: 3},
+	}, moved)
+	assert.Equal(t, 4, entities[1].Length)
+}
@@ -1,3 +1,51 @@
 package stb
 
 type EventType string
+
+// Defer makes the events deferrable: when the current state of a
+// machine rejects one of them, SendEvent queues the event instead of
+// returning ErrEventRejected. After every transition, the first of
+// the queued events the new state accepts is delivered again. The
+// payloads of queued events are not persisted.
+//
+// Example:
+//
+//     // a payment can be confirmed before the order is complete
+//     b.Defer(PaymentConfirmed)
+//
+func (b *Bot) Defer(events ...EventType) {
+	for _, e := range events {
+		b.deferrable[e] = true
+	}
+}
+
+func (b *Bot) deferred(e EventType) bool {
+	b.configMu.RLock()
+	defer b.configMu.RUnlock()
+	return b.current().deferrable[e]
+}
+
+// deferredEvent is an event queued by SendEvent, see Bot.Defer.
+type deferredEvent struct {
+	event   EventType
+	payload interface{}
+}
+
+// redeliver sends the first deferred event the current
+// state accepts again. The caller must hold the mutex.
+func (m *Machine) redeliver() error {
+	m.currentMu.Lock()
+	for i, d := range m.deferred {
+		next, err := m.getNextState(d.event)
+		if err != nil || m.known(next) != nil {
+			continue
+		}
+		m.deferred = append(m.deferred[:i:i], m.deferred[i+1:]...)
+		m.currentMu.Unlock()
+
+		m.setPayload(d.payload)
+		return m.transition(next, d.event)
+	}
+	m.currentMu.Unlock()
+	return nil
+}
@@ -0,0 +1,149 @@
+package stb
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// dumpVersion is the version of the format of Machines.Export.
+const dumpVersion = 1
+
+// dump is the portable form of the machines of a bot.
+type dump struct {
+	Version  int                  `json:"version"`
+	Machines map[string]*Snapshot `json:"machines"`
+}
+
+// Export writes the snapshots of all the machines, the loaded ones
+// and the ones in the store, as a single JSON document, e.g. to move
+// them to another store or another instance with Import. The store
+// must be a Lister.
+//
+// Example:
+//
+//     f, _ := os.Create("machines.json")
+//     defer f.Close()
+//     if err := b.Machines().Export(f); err != nil {
+//         log.Fatal(err)
+//     }
+//
+func (ms *Machines) Export(w io.Writer) error {
+	d := dump{Version: dumpVersion, Machines: make(map[string]*Snapshot)}
+
+	var err error
+	ms.Range(func(m *Machine) bool {
+		var snap *Snapshot
+		if snap, err = m.Snapshot(); err != nil {
+			err = errors.Wrapf(err, "stb: can't export machine %s", m.id)
+			return false
+		}
+		d.Machines[m.id] = snap
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if ms.store != nil {
+		lister, ok := ms.store.(Lister)
+		if !ok {
+			return errors.New("stb: the store can't list its machines")
+		}
+		ids, err := lister.IDs()
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if _, ok := d.Machines[id]; ok {
+				continue
+			}
+			snap, err := ms.store.Load(id)
+			if err == ErrNotStored {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "stb: can't export machine %s", id)
+			}
+			d.Machines[id] = snap
+		}
+	}
+
+	return wrapError(json.NewEncoder(w).Encode(d))
+}
+
+// Import reads machines written by Export. They are saved to the
+// store, if there is one, and replace the loaded machines with the
+// same ids, which start over from the imported snapshots. Their
+// timeouts and scheduled events carry on.
+func (ms *Machines) Import(r io.Reader) error {
+	var d dump
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return wrapError(err)
+	}
+	if d.Version != dumpVersion {
+		return errors.Errorf("stb: unsupported export version %d", d.Version)
+	}
+
+	ids := make([]string, 0, len(d.Machines))
+	for id := range d.Machines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if err := ms.importMachine(id, d.Machines[id]); err != nil {
+			return errors.Wrapf(err, "stb: can't import machine %s", id)
+		}
+	}
+	return nil
+}
+
+// importMachine saves the snapshot and replaces the loaded machine.
+// Without a store, the new machine is restored from the snapshot.
+func (ms *Machines) importMachine(id string, snap *Snapshot) error {
+	shard := ms.shard(id)
+	shard.mu.Lock()
+	old, loaded := shard.machines[id]
+	shard.mu.Unlock()
+
+	if loaded {
+		// the replaced machine must not save over the snapshot
+		old.erase()
+	}
+
+	if ms.store != nil {
+		if err := ms.store.Save(id, snap); err != nil {
+			return err
+		}
+	}
+
+	if !loaded && ms.store != nil {
+		// restored from the store when needed
+		return nil
+	}
+
+	// the machine is built outside of the lock, as restoring it
+	// loads the store and arms its timers
+	m := ms.create(id, nil)
+	if ms.store == nil && m.bot != nil {
+		if err := m.restore(snap, m.bot.newCtx); err != nil {
+			return err
+		}
+	}
+
+	shard.mu.Lock()
+	current, ok := shard.machines[id]
+	if ok {
+		m.who = current.who
+	}
+	shard.machines[id] = m
+	shard.mu.Unlock()
+
+	if ok && current != old {
+		current.erase()
+	}
+	return nil
+}
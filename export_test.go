@@ -0,0 +1,75 @@
+package stb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachinesExport(t *testing.T) {
+	const Asked StateType = "Asked"
+
+	setup := func(store Store) *Bot {
+		b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+		require.NoError(t, err)
+		b.Default(Default)
+		b.State(Asked)
+		b.Event("ask", Asked)
+		b.Handle("/ask", func(msg *Message, m *Machine) error {
+			m.Session().Set("topic", msg.Payload)
+			return m.SendEvent("ask")
+		})
+		return b
+	}
+
+	store := NewMemoryStore()
+	require.NoError(t, store.Save("2", &Snapshot{State: Asked, Language: "de"}))
+	b := setup(store)
+	b.ProcessUpdate(Update{Message: &Message{Text: "/ask pizza", Sender: &User{ID: 1}, Chat: &Chat{ID: 1}}})
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Machines().Export(&buf))
+
+	var d dump
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &d))
+	assert.Equal(t, dumpVersion, d.Version)
+	assert.Len(t, d.Machines, 2)
+	assert.Equal(t, Asked, d.Machines["1"].State)
+
+	// into a bot without a store, the machines are loaded
+	memory := setup(nil)
+	require.NoError(t, memory.Machines().Import(bytes.NewReader(buf.Bytes())))
+	m, ok := memory.Machines().Get("1")
+	require.True(t, ok)
+	assert.Equal(t, Asked, m.Current())
+	var topic string
+	assert.True(t, m.Session().Get("topic", &topic))
+	assert.Equal(t, "pizza", topic)
+	m, ok = memory.Machines().Get("2")
+	require.True(t, ok)
+	assert.Equal(t, "de", m.Language())
+
+	// into a bot with a store, the machines are stored
+	other := NewMemoryStore()
+	stored := setup(other)
+	replaced := stored.Machines().obtain("2", nil)
+	require.NoError(t, stored.Machines().Import(bytes.NewReader(buf.Bytes())))
+	// a late save of the replaced machine is dropped
+	require.NoError(t, replaced.persist())
+	snap, err := other.Load("2")
+	require.NoError(t, err)
+	assert.Equal(t, Asked, snap.State)
+	ids, err := other.IDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids)
+	m, ok = stored.Machines().Get("2")
+	require.True(t, ok)
+	assert.Equal(t, Asked, m.Current())
+
+	err = stored.Machines().Import(strings.NewReader(`{"version":2}`))
+	assert.Error(t, err)
+}
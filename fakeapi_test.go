@@ -0,0 +1,95 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAPI is a Bot API server for the tests, recording the calls
+// it gets and answering them with Result.
+type fakeAPI struct {
+	*httptest.Server
+
+	// Result returns the JSON result of the call,
+	// it may be replaced before the bot is used.
+	Result func(call apiCall) string
+
+	mu     sync.Mutex
+	calls  []apiCall
+	counts map[string]int
+}
+
+// apiCall is a call received by fakeAPI.
+type apiCall struct {
+	Method string
+	Params map[string]json.RawMessage
+}
+
+// Param returns the parameter as a string, or "" if it's missing.
+// Strings are unquoted, other values are returned as JSON.
+func (c apiCall) Param(key string) string {
+	var s string
+	if err := json.Unmarshal(c.Params[key], &s); err != nil {
+		return string(c.Params[key])
+	}
+	return s
+}
+
+// newFakeAPI starts a fakeAPI answering every call with the result,
+// the server is closed when the test ends.
+func newFakeAPI(t *testing.T, result string) *fakeAPI {
+	api := &fakeAPI{
+		Result: func(apiCall) string { return result },
+		counts: make(map[string]int),
+	}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func (api *fakeAPI) serve(w http.ResponseWriter, r *http.Request) {
+	call := apiCall{Method: r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]}
+	json.NewDecoder(r.Body).Decode(&call.Params)
+
+	api.mu.Lock()
+	api.calls = append(api.calls, call)
+	api.counts[call.Method]++
+	result := api.Result
+	api.mu.Unlock()
+
+	w.Write([]byte(`{"ok":true,"result":` + result(call) + `}`))
+}
+
+// Settings returns the settings of a synchronous bot using the server.
+func (api *fakeAPI) Settings() Settings {
+	return Settings{Synchronous: true, Offline: true, URL: api.URL}
+}
+
+// Calls returns the calls received since the last time it was called.
+func (api *fakeAPI) Calls() []apiCall {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	calls := api.calls
+	api.calls = nil
+	return calls
+}
+
+// Methods is Calls returning just the methods.
+func (api *fakeAPI) Methods() []string {
+	var methods []string
+	for _, call := range api.Calls() {
+		methods = append(methods, call.Method)
+	}
+	return methods
+}
+
+// Count returns the number of calls of the method received so far.
+func (api *fakeAPI) Count(method string) int {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return api.counts[method]
+}
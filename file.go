@@ -5,6 +5,15 @@ import (
 	"os"
 )
 
+// The size limits of the files a bot uploads and downloads. A local
+// Bot API server (see Settings.LocalServer) raises the upload limit
+// to MaxLocalUploadSize and lifts the download limit.
+const (
+	MaxUploadSize      = 50 << 20
+	MaxLocalUploadSize = 2000 << 20
+	MaxDownloadSize    = 20 << 20
+)
+
 // File object represents any sort of file.
 type File struct {
 	FileID   string `json:"file_id"`
@@ -1,10 +1,20 @@
 package stb
 
 import (
+	"bytes"
+	"encoding/json"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFile(t *testing.T) {
@@ -22,3 +32,84 @@ func TestFile(t *testing.T) {
 	assert.Equal(t, g.FileLocal, f.FileLocal)
 	assert.Equal(t, f.FileURL, g.FileURL)
 }
+
+func TestBotDownloadTo(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "local.txt")
+	require.NoError(t, ioutil.WriteFile(local, []byte("from disk"), 0600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getFile"):
+			var params map[string]string
+			json.NewDecoder(r.Body).Decode(&params)
+			path := "documents/remote.txt"
+			if params["file_id"] == "local" {
+				path = local
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"ok":     true,
+				"result": map[string]string{"file_id": params["file_id"], "file_path": path},
+			})
+		case strings.HasSuffix(r.URL.Path, "/file/botTOKEN/documents/remote.txt"):
+			w.Write([]byte("from server"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Offline: true, URL: srv.URL, Token: "TOKEN"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, b.DownloadTo(&File{FileID: "remote"}, &buf))
+	assert.Equal(t, "from server", buf.String())
+
+	// only the paths of a local server are read from the disk
+	buf.Reset()
+	assert.Error(t, b.DownloadTo(&File{FileID: "local"}, &buf))
+	assert.Empty(t, buf.String())
+
+	b, err = NewBot(Settings{Offline: true, URL: srv.URL, Token: "TOKEN", LocalServer: true})
+	require.NoError(t, err)
+	require.NoError(t, b.DownloadTo(&File{FileID: "local"}, &buf))
+	assert.Equal(t, "from disk", buf.String())
+}
+
+func TestBotFileLimits(t *testing.T) {
+	large := filepath.Join(t.TempDir(), "large.bin")
+	require.NoError(t, ioutil.WriteFile(large, nil, 0600))
+	require.NoError(t, os.Truncate(large, MaxUploadSize+1))
+
+	message := `{"message_id":1,"chat":{"id":1},"document":{"file_id":"d"}}`
+	api := newFakeAPI(t, message)
+	api.Result = func(call apiCall) string {
+		if call.Method == "getFile" {
+			data, _ := json.Marshal(map[string]interface{}{"file_id": "big", "file_size": MaxDownloadSize + 1, "file_path": large})
+			return string(data)
+		}
+		return message
+	}
+
+	b, err := NewBot(Settings{Offline: true, URL: api.URL})
+	require.NoError(t, err)
+	assert.Equal(t, int64(MaxUploadSize), b.UploadLimit())
+	assert.Equal(t, int64(MaxDownloadSize), b.DownloadLimit())
+
+	_, err = b.Send(&Chat{ID: 1}, &Document{File: FromDisk(large)})
+	assert.Equal(t, ErrTooLarge, errors.Cause(err))
+	_, err = b.GetFile(&File{FileID: "big"})
+	assert.Equal(t, ErrTooLarge, errors.Cause(err))
+	assert.Equal(t, []string{"getFile"}, api.Methods())
+
+	b, err = NewBot(Settings{Offline: true, URL: api.URL, LocalServer: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(MaxLocalUploadSize), b.UploadLimit())
+	assert.Zero(t, b.DownloadLimit())
+
+	_, err = b.Send(&Chat{ID: 1}, &Document{File: FromDisk(large)})
+	assert.NoError(t, err)
+	reader, err := b.GetFile(&File{FileID: "big"})
+	require.NoError(t, err)
+	reader.Close()
+}
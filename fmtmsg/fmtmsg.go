@@ -0,0 +1,244 @@
+// Package fmtmsg builds formatted messages without escaping them
+// by hand. A Builder renders the same text as MarkdownV2, as HTML
+// or as plain text with its entities, so that a name with a dot or
+// an underscore no longer makes Telegram turn the message down.
+//
+// Example:
+//
+//		msg := fmtmsg.New().
+//			Text("Hi, ").Mention(user.FirstName, user).
+//			Text("! Your code is ").Code(code).Text(".")
+//
+//		m.Send(msg.MarkdownV2(), stb.ModeMarkdownV2)
+//		// or
+//		m.Send(msg.String(), msg.Options())
+//
+package fmtmsg
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/exp625/stb"
+)
+
+// Builder builds a formatted message, one part after the other.
+// The zero value is an empty message ready to use.
+type Builder struct {
+	parts []part
+}
+
+// part is a piece of the text with the entity it is formatted as.
+type part struct {
+	text   string
+	entity stb.EntityType
+	url    string
+	user   *stb.User
+	lang   string
+}
+
+// New returns an empty builder.
+func New() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) add(p part) *Builder {
+	if p.text != "" {
+		b.parts = append(b.parts, p)
+	}
+	return b
+}
+
+// Text adds plain text.
+func (b *Builder) Text(text string) *Builder {
+	return b.add(part{text: text})
+}
+
+// Bold adds bold text.
+func (b *Builder) Bold(text string) *Builder {
+	return b.add(part{text: text, entity: stb.EntityBold})
+}
+
+// Italic adds italic text.
+func (b *Builder) Italic(text string) *Builder {
+	return b.add(part{text: text, entity: stb.EntityItalic})
+}
+
+// Underline adds underlined text.
+func (b *Builder) Underline(text string) *Builder {
+	return b.add(part{text: text, entity: stb.EntityUnderline})
+}
+
+// Strike adds strikethrough text.
+func (b *Builder) Strike(text string) *Builder {
+	return b.add(part{text: text, entity: stb.EntityStrikethrough})
+}
+
+// Spoiler adds text hidden until tapped.
+func (b *Builder) Spoiler(text string) *Builder {
+	return b.add(part{text: text, entity: stb.EntitySpoiler})
+}
+
+// Code adds inline monospace text.
+func (b *Builder) Code(text string) *Builder {
+	return b.add(part{text: text, entity: stb.EntityCode})
+}
+
+// Pre adds a block of code in the language, which may be empty.
+func (b *Builder) Pre(text, lang string) *Builder {
+	return b.add(part{text: text, entity: stb.EntityCodeBlock, lang: lang})
+}
+
+// Link adds text opening the URL.
+func (b *Builder) Link(text, url string) *Builder {
+	return b.add(part{text: text, entity: stb.EntityTextLink, url: url})
+}
+
+// Mention adds text mentioning the user, who doesn't need a username.
+func (b *Builder) Mention(text string, user *stb.User) *Builder {
+	return b.add(part{text: text, entity: stb.EntityTMention, user: user})
+}
+
+// String returns the plain text of the message.
+func (b *Builder) String() string {
+	var sb strings.Builder
+	for _, p := range b.parts {
+		sb.WriteString(p.text)
+	}
+	return sb.String()
+}
+
+// Entities returns the entities of the plain text,
+// with their offsets in UTF-16 code units.
+func (b *Builder) Entities() []stb.MessageEntity {
+	var (
+		entities []stb.MessageEntity
+		offset   int
+	)
+	for _, p := range b.parts {
+		length := len(utf16.Encode([]rune(p.text)))
+		if p.entity != "" {
+			entities = append(entities, stb.MessageEntity{
+				Type:     p.entity,
+				Offset:   offset,
+				Length:   length,
+				URL:      p.url,
+				User:     p.user,
+				Language: p.lang,
+			})
+		}
+		offset += length
+	}
+	return entities
+}
+
+// Options returns the options sending the plain text with its entities.
+func (b *Builder) Options() *stb.SendOptions {
+	return &stb.SendOptions{Entities: b.Entities()}
+}
+
+// markdownV2 and markdownV2Code are the characters
+// escaped in MarkdownV2, outside and inside of code.
+var (
+	markdownV2 = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`,
+		")", `\)`, "~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`,
+		"-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`,
+		"!", `\!`,
+	)
+	markdownV2Code = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+	markdownV2URL  = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+)
+
+// EscapeMarkdownV2 escapes the text for MarkdownV2.
+func EscapeMarkdownV2(text string) string {
+	return markdownV2.Replace(text)
+}
+
+// MarkdownV2 returns the message in MarkdownV2.
+func (b *Builder) MarkdownV2() string {
+	var sb strings.Builder
+	for _, p := range b.parts {
+		var s string
+		switch p.entity {
+		case stb.EntityBold:
+			s = "*" + EscapeMarkdownV2(p.text) + "*"
+		case stb.EntityItalic:
+			s = "_" + EscapeMarkdownV2(p.text) + "_"
+		case stb.EntityUnderline:
+			s = "__" + EscapeMarkdownV2(p.text) + "__"
+		case stb.EntityStrikethrough:
+			s = "~" + EscapeMarkdownV2(p.text) + "~"
+		case stb.EntitySpoiler:
+			s = "||" + EscapeMarkdownV2(p.text) + "||"
+		case stb.EntityCode:
+			s = "`" + markdownV2Code.Replace(p.text) + "`"
+		case stb.EntityCodeBlock:
+			s = "```" + p.lang + "\n" + markdownV2Code.Replace(p.text) + "\n```"
+		case stb.EntityTextLink:
+			s = "[" + EscapeMarkdownV2(p.text) + "](" + markdownV2URL.Replace(p.url) + ")"
+		case stb.EntityTMention:
+			s = "[" + EscapeMarkdownV2(p.text) + "](" + userURL(p.user) + ")"
+		default:
+			s = EscapeMarkdownV2(p.text)
+		}
+		// "__" always toggles underline, an empty bold
+		// entity keeps italic and underline apart
+		if strings.HasSuffix(sb.String(), "_") && strings.HasPrefix(s, "_") {
+			sb.WriteString("**")
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+var html = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// EscapeHTML escapes the text for HTML.
+func EscapeHTML(text string) string {
+	return html.Replace(text)
+}
+
+// HTML returns the message in HTML.
+func (b *Builder) HTML() string {
+	var sb strings.Builder
+	for _, p := range b.parts {
+		text := EscapeHTML(p.text)
+		switch p.entity {
+		case stb.EntityBold:
+			sb.WriteString("<b>" + text + "</b>")
+		case stb.EntityItalic:
+			sb.WriteString("<i>" + text + "</i>")
+		case stb.EntityUnderline:
+			sb.WriteString("<u>" + text + "</u>")
+		case stb.EntityStrikethrough:
+			sb.WriteString("<s>" + text + "</s>")
+		case stb.EntitySpoiler:
+			sb.WriteString("<tg-spoiler>" + text + "</tg-spoiler>")
+		case stb.EntityCode:
+			sb.WriteString("<code>" + text + "</code>")
+		case stb.EntityCodeBlock:
+			if p.lang == "" {
+				sb.WriteString("<pre>" + text + "</pre>")
+			} else {
+				sb.WriteString(`<pre><code class="language-` + EscapeHTML(p.lang) + `">` + text + "</code></pre>")
+			}
+		case stb.EntityTextLink:
+			sb.WriteString(`<a href="` + EscapeHTML(p.url) + `">` + text + "</a>")
+		case stb.EntityTMention:
+			sb.WriteString(`<a href="` + userURL(p.user) + `">` + text + "</a>")
+		default:
+			sb.WriteString(text)
+		}
+	}
+	return sb.String()
+}
+
+// userURL returns the link mentioning the user.
+func userURL(user *stb.User) string {
+	if user == nil {
+		return ""
+	}
+	return "tg://user?id=" + strconv.Itoa(user.ID)
+}
@@ -0,0 +1,40 @@
+package fmtmsg
+
+import (
+	"testing"
+
+	"github.com/exp625/stb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	user := &stb.User{ID: 42}
+	msg := New().
+		Text("Hi, ").Mention("J. Doe", user).
+		Text("! 🎉 ").Bold("1+1=2").
+		Italic("a_b").Underline("c").
+		Code("x`y").Text(" ").
+		Link("docs (v2)", "https://example.com/a)b").
+		Spoiler("<boo>").Strike("").
+		Pre("fmt.Println()", "go")
+
+	assert.Equal(t, "Hi, J. Doe! 🎉 1+1=2a_bcx`y docs (v2)<boo>fmt.Println()", msg.String())
+
+	assert.Equal(t, "Hi, [J\\. Doe](tg://user?id=42)\\! 🎉 *1\\+1\\=2*_a\\_b_**__c__`x\\`y` "+
+		"[docs \\(v2\\)](https://example.com/a\\)b)||<boo\\>||```go\nfmt.Println()\n```", msg.MarkdownV2())
+
+	assert.Equal(t, `Hi, <a href="tg://user?id=42">J. Doe</a>! 🎉 <b>1+1=2</b><i>a_b</i><u>c</u><code>x`+"`"+`y</code> `+
+		`<a href="https://example.com/a)b">docs (v2)</a><tg-spoiler>&lt;boo&gt;</tg-spoiler>`+
+		`<pre><code class="language-go">fmt.Println()</code></pre>`, msg.HTML())
+
+	assert.Equal(t, []stb.MessageEntity{
+		{Type: stb.EntityTMention, Offset: 4, Length: 6, User: user},
+		{Type: stb.EntityBold, Offset: 15, Length: 5},
+		{Type: stb.EntityItalic, Offset: 20, Length: 3},
+		{Type: stb.EntityUnderline, Offset: 23, Length: 1},
+		{Type: stb.EntityCode, Offset: 24, Length: 3},
+		{Type: stb.EntityTextLink, Offset: 28, Length: 9, URL: "https://example.com/a)b"},
+		{Type: stb.EntitySpoiler, Offset: 37, Length: 5},
+		{Type: stb.EntityCodeBlock, Offset: 42, Length: 13, Language: "go"},
+	}, msg.Entities())
+}
@@ -0,0 +1,41 @@
+//go:build go1.18
+
+package stb
+
+// Handled are the types handlers are called with along
+// with the machine, see HandlerOf.
+type Handled interface {
+	*Message | []*Message | *Callback | *Query | *ChosenInlineResult |
+		*ShippingQuery | *PreCheckoutQuery | *PollAnswer |
+		*ChatMemberUpdated | *ChatJoinRequest | *MessageReaction |
+		*MessageReactionCount | *LiveLocation | *PaidMediaPurchased |
+		*BusinessConnection | *BusinessMessagesDeleted |
+		*ChatBoostUpdated | *ChatBoostRemoved | *Update
+}
+
+// HandlerOf adapts a typed handler for Handle, which takes any
+// function. Its signature is checked by the compiler rather than
+// when it is registered:
+//
+//     b.Handle(stb.OnCallback, stb.HandlerOf(func(c *stb.Callback, m *stb.Machine) error {
+//         return m.Answer(c)
+//     }))
+//
+// Handle still checks that the endpoint expects a T.
+// It requires Go 1.18.
+func HandlerOf[T Handled](handler func(T, *Machine) error) func(T, *Machine) error {
+	return handler
+}
+
+// HandleOf registers the typed handler for the endpoint in the
+// state, see HandlerOf. It requires Go 1.18.
+//
+// Example:
+//
+//     err := stb.HandleOf(quiz, stb.OnPollAnswer, func(a *stb.PollAnswer, m *stb.Machine) error {
+//         return m.SendEvent(Answered, a.Options)
+//     })
+//
+func HandleOf[T Handled](s *State, endpoint interface{}, handler func(T, *Machine) error) error {
+	return s.Handle(endpoint, handler)
+}
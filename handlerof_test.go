@@ -0,0 +1,32 @@
+//go:build go1.18
+
+package stb
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerOf(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+	s := b.Default(Default)
+
+	var answered []int
+	require.NoError(t, HandleOf(s, OnPollAnswer, func(a *PollAnswer, m *Machine) error {
+		answered = a.Options
+		return nil
+	}))
+	require.NoError(t, s.Handle(OnCallback, HandlerOf(func(c *Callback, m *Machine) error {
+		return nil
+	})))
+
+	err = HandleOf(s, OnText, func(c *Callback, m *Machine) error { return nil })
+	assert.Equal(t, ErrBadHandler, errors.Cause(err))
+
+	b.ProcessUpdate(Update{PollAnswer: &PollAnswer{User: User{ID: 1}, Options: []int{2}}})
+	assert.Equal(t, []int{2}, answered)
+}
@@ -0,0 +1,54 @@
+package stb
+
+import "errors"
+
+// ErrNoHistory is the error returned by Machine.Back when
+// there is no previous state to go back to.
+var ErrNoHistory = errors.New("stb: no previous state")
+
+// Back moves the machine into the state it was in before the last
+// transition and runs its action. Going back does not add to history,
+// so consecutive calls walk further into the past.
+func (m *Machine) Back() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.currentMu.Lock()
+	if len(m.history) == 0 {
+		m.currentMu.Unlock()
+		return ErrNoHistory
+	}
+	prev := m.history[len(m.history)-1]
+	if err := m.known(prev); err != nil {
+		m.currentMu.Unlock()
+		return err
+	}
+	m.history = m.history[:len(m.history)-1]
+	m.currentMu.Unlock()
+
+	m.setPayload(nil)
+	return m.enter(prev, "")
+}
+
+// History returns the previously visited states, the most recent last.
+func (m *Machine) History() []StateType {
+	m.currentMu.RLock()
+	defer m.currentMu.RUnlock()
+	return append([]StateType(nil), m.history...)
+}
+
+// remember pushes the state onto the history, dropping the
+// oldest entries beyond the history size.
+func (m *Machine) remember(t StateType) {
+	if m.historySize <= 0 {
+		return
+	}
+
+	m.currentMu.Lock()
+	defer m.currentMu.Unlock()
+
+	m.history = append(m.history, t)
+	if over := len(m.history) - m.historySize; over > 0 {
+		m.history = append(m.history[:0], m.history[over:]...)
+	}
+}
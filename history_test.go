@@ -0,0 +1,35 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineBack(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, HistorySize: 2})
+	require.NoError(t, err)
+
+	b.Default("A")
+	b.State("B")
+	b.State("C")
+	b.State("D")
+	b.Event("b", "B")
+	b.Event("c", "C")
+	b.Event("d", "D")
+
+	m := b.machine(&User{ID: 1})
+	assert.Equal(t, ErrNoHistory, m.Back())
+
+	require.NoError(t, m.SendEvent("b"))
+	require.NoError(t, m.SendEvent("c"))
+	require.NoError(t, m.SendEvent("d"))
+	assert.Equal(t, []StateType{"B", "C"}, m.History())
+
+	require.NoError(t, m.Back())
+	assert.Equal(t, StateType("C"), m.Current())
+	require.NoError(t, m.Back())
+	assert.Equal(t, StateType("B"), m.Current())
+	assert.Equal(t, ErrNoHistory, m.Back())
+}
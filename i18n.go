@@ -0,0 +1,321 @@
+package stb
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// PluralRule returns the plural form of a count in a language:
+// "zero", "one", "two", "few", "many" or "other".
+type PluralRule func(n int) string
+
+// Locales holds the message catalogs of a bot, one per language.
+// They must not be changed once the bot is started.
+//
+// Messages are looked up in the language of the machine, its base
+// language ("pt" for "pt-br") and the fallback language. Missing
+// messages come out as their key.
+//
+// Example:
+//
+//     locales := stb.NewLocales("en")
+//     locales.Add("en", map[string]string{
+//         "checkout.confirm": "Pay %s?",
+//         "cart.items.one":   "%d item",
+//         "cart.items.other": "%d items",
+//     })
+//
+//     m.Send(m.T("checkout.confirm", total))
+//     m.Send(m.TN("cart.items", len(cart)))
+//
+type Locales struct {
+	// Fallback is the language used when a message
+	// is missing in the language of the machine.
+	Fallback string
+
+	catalogs map[string]map[string]string
+	plurals  map[string]PluralRule
+}
+
+// NewLocales creates empty locales with the fallback language.
+func NewLocales(fallback string) *Locales {
+	return &Locales{
+		Fallback: fallback,
+		catalogs: make(map[string]map[string]string),
+		plurals:  make(map[string]PluralRule),
+	}
+}
+
+// Add adds the messages to the catalog of the language.
+func (l *Locales) Add(lang string, messages map[string]string) {
+	lang = normalizeLang(lang)
+	catalog, ok := l.catalogs[lang]
+	if !ok {
+		catalog = make(map[string]string)
+		l.catalogs[lang] = catalog
+	}
+	for key, msg := range messages {
+		catalog[key] = msg
+	}
+}
+
+// Load adds the messages of a YAML (or JSON) catalog to the
+// language. Nested keys are joined with dots, so
+//
+//     checkout:
+//       confirm: Pay %s?
+//
+// becomes "checkout.confirm".
+func (l *Locales) Load(lang string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return errors.Wrapf(err, "stb: locale %s", lang)
+	}
+
+	messages := make(map[string]string)
+	flattenMessages("", tree, messages)
+	l.Add(lang, messages)
+	return nil
+}
+
+// LoadDir loads every <lang>.yaml, <lang>.yml and <lang>.json
+// catalog of the directory, see Load.
+func (l *Locales) LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		ext := filepath.Ext(fi.Name())
+		if fi.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return err
+		}
+		err = l.Load(strings.TrimSuffix(fi.Name(), ext), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPlural sets the plural rule of the language. Rules for the
+// most common languages are built in, others use "one" and "other".
+func (l *Locales) SetPlural(lang string, rule PluralRule) {
+	l.plurals[normalizeLang(lang)] = rule
+}
+
+// Languages returns the languages having a catalog.
+func (l *Locales) Languages() []string {
+	langs := make([]string, 0, len(l.catalogs))
+	for lang := range l.catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// T returns the message of the key in the language,
+// formatted with the args like fmt.Sprintf.
+func (l *Locales) T(lang, key string, args ...interface{}) string {
+	msg, ok := l.lookup(lang, key)
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// TN returns the plural form of the message of the key for the count,
+// that is the message of key.one, key.few, ... or key.other. The
+// message is formatted with the count followed by the args.
+func (l *Locales) TN(lang, key string, n int, args ...interface{}) string {
+	args = append([]interface{}{n}, args...)
+
+	form := l.plural(lang)(n)
+	if _, ok := l.lookup(lang, key+"."+form); ok {
+		return l.T(lang, key+"."+form, args...)
+	}
+	if _, ok := l.lookup(lang, key+".other"); ok {
+		return l.T(lang, key+".other", args...)
+	}
+	return l.T(lang, key, args...)
+}
+
+func (l *Locales) lookup(lang, key string) (string, bool) {
+	for _, lang := range l.candidates(lang) {
+		if msg, ok := l.catalogs[lang][key]; ok {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// candidates returns the languages to look messages up in.
+func (l *Locales) candidates(lang string) []string {
+	lang = normalizeLang(lang)
+	langs := []string{lang}
+	if i := strings.IndexByte(lang, '-'); i > 0 {
+		langs = append(langs, lang[:i])
+	}
+	return append(langs, normalizeLang(l.Fallback))
+}
+
+func (l *Locales) plural(lang string) PluralRule {
+	for _, lang := range l.candidates(lang) {
+		if rule, ok := l.plurals[lang]; ok {
+			return rule
+		}
+		if rule, ok := pluralRules[lang]; ok {
+			return rule
+		}
+	}
+	return pluralOneOther
+}
+
+func normalizeLang(lang string) string {
+	return strings.ToLower(strings.Replace(lang, "_", "-", -1))
+}
+
+func flattenMessages(prefix string, tree map[string]interface{}, messages map[string]string) {
+	for key, v := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flattenMessages(key, v, messages)
+		case nil:
+		default:
+			messages[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func pluralOneOther(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func pluralEastSlavic(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "one"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "few"
+	}
+	return "many"
+}
+
+var pluralRules = map[string]PluralRule{
+	"ru": pluralEastSlavic,
+	"uk": pluralEastSlavic,
+	"be": pluralEastSlavic,
+	"pl": func(n int) string {
+		switch {
+		case n == 1:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		}
+		return "many"
+	},
+	"cs": func(n int) string {
+		switch {
+		case n == 1:
+			return "one"
+		case n >= 2 && n <= 4:
+			return "few"
+		}
+		return "other"
+	},
+	"fr": func(n int) string {
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+	"ja": func(int) string { return "other" },
+	"ko": func(int) string { return "other" },
+	"zh": func(int) string { return "other" },
+}
+
+// Language returns the language of the machine: the one set with
+// SetLanguage, the language of its user or the fallback language.
+func (m *Machine) Language() string {
+	m.currentMu.RLock()
+	lang := m.lang
+	m.currentMu.RUnlock()
+
+	switch {
+	case lang != "":
+		return lang
+	case m.who != nil && m.who.LanguageCode != "":
+		return m.who.LanguageCode
+	case m.bot != nil && m.bot.locales != nil:
+		return m.bot.locales.Fallback
+	}
+	return ""
+}
+
+// SetLanguage sets the language of the machine, which is persisted.
+func (m *Machine) SetLanguage(lang string) {
+	m.currentMu.Lock()
+	m.lang = lang
+	m.currentMu.Unlock()
+
+	m.save()
+}
+
+// T returns the message of the key in the language of the machine,
+// see Locales.T. Without Settings.Locales, the key is returned.
+func (m *Machine) T(key string, args ...interface{}) string {
+	if m.bot == nil || m.bot.locales == nil {
+		return key
+	}
+	return m.bot.locales.T(m.Language(), key, args...)
+}
+
+// TN returns the plural form of the message of the key in the
+// language of the machine, see Locales.TN.
+func (m *Machine) TN(key string, n int, args ...interface{}) string {
+	if m.bot == nil || m.bot.locales == nil {
+		return key
+	}
+	return m.bot.locales.TN(m.Language(), key, n, args...)
+}
+
+// tr is T for the texts of the library, which come out in
+// English, formatted like fmt.Sprintf, unless the key has
+// a message.
+func (m *Machine) tr(key, english string, args ...interface{}) string {
+	if m.bot != nil && m.bot.locales != nil {
+		if msg, ok := m.bot.locales.lookup(m.Language(), key); ok {
+			english = msg
+		}
+	}
+	return fmt.Sprintf(english, args...)
+}
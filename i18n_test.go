@@ -0,0 +1,79 @@
+package stb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLocales(t *testing.T) *Locales {
+	l := NewLocales("en")
+	l.Add("en", map[string]string{
+		"greet":            "Hello, %s!",
+		"cart.items.one":   "%d item",
+		"cart.items.other": "%d items",
+		"menu.order":       "Order",
+	})
+	require.NoError(t, l.Load("ru", strings.NewReader(`
+greet: Привет, %s!
+cart:
+  items:
+    one: "%d товар"
+    few: "%d товара"
+    many: "%d товаров"
+menu:
+  order: Заказать
+`)))
+	return l
+}
+
+func TestLocales(t *testing.T) {
+	l := testLocales(t)
+
+	assert.Equal(t, []string{"en", "ru"}, l.Languages())
+	assert.Equal(t, "Hello, Ann!", l.T("en", "greet", "Ann"))
+	assert.Equal(t, "Привет, Ann!", l.T("ru-RU", "greet", "Ann"))
+	assert.Equal(t, "Hello, Ann!", l.T("de", "greet", "Ann"))
+	assert.Equal(t, "missing.key", l.T("en", "missing.key"))
+
+	assert.Equal(t, "1 item", l.TN("en", "cart.items", 1))
+	assert.Equal(t, "5 items", l.TN("en", "cart.items", 5))
+	assert.Equal(t, "21 товар", l.TN("ru", "cart.items", 21))
+	assert.Equal(t, "3 товара", l.TN("ru", "cart.items", 3))
+	assert.Equal(t, "11 товаров", l.TN("ru", "cart.items", 11))
+
+	l.SetPlural("en", func(int) string { return "one" })
+	assert.Equal(t, "5 item", l.TN("en", "cart.items", 5))
+}
+
+func TestMachineLanguage(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store, Locales: testLocales(t)})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	var got []string
+	kb := NewReplyKeyboard().Row(Button("menu.order", func(msg *Message, m *Machine) {
+		got = append(got, msg.Text)
+	}))
+	require.NoError(t, kb.Register(b.global))
+
+	m := b.machine(&User{ID: 1, LanguageCode: "ru"})
+	assert.Equal(t, "ru", m.Language())
+	assert.Equal(t, "Привет, Ann!", m.T("greet", "Ann"))
+	assert.Equal(t, "Заказать", kb.MarkupFor(m).ReplyKeyboard[0][0].Text)
+
+	m.SetLanguage("en")
+	assert.Equal(t, "Order", kb.MarkupFor(m).ReplyKeyboard[0][0].Text)
+
+	snap, err := store.Load(m.ID())
+	require.NoError(t, err)
+	assert.Equal(t, "en", snap.Language)
+
+	user := &User{ID: 2}
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Text: "Заказать"}})
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Text: "Order"}})
+	assert.Equal(t, []string{"Заказать", "Order"}, got)
+}
@@ -0,0 +1,68 @@
+package stb
+
+// The constructors below fill in the required fields of the inline
+// query results, the optional ones can be set on the result after.
+
+// NewArticleResult creates an article sending the text when chosen.
+func NewArticleResult(title, text string) *ArticleResult {
+	r := &ArticleResult{Title: title}
+	r.SetContent(&InputTextMessageContent{Text: text})
+	return r
+}
+
+// NewAudioResult creates an audio result from the URL of an mp3 file.
+func NewAudioResult(url, title string) *AudioResult {
+	return &AudioResult{URL: url, Title: title}
+}
+
+// NewContactResult creates a contact result.
+func NewContactResult(phone, firstName string) *ContactResult {
+	return &ContactResult{PhoneNumber: phone, FirstName: firstName}
+}
+
+// NewDocumentResult creates a document result from the URL of
+// a PDF or ZIP file, mime is "application/pdf" or "application/zip".
+func NewDocumentResult(url, mime, title string) *DocumentResult {
+	return &DocumentResult{URL: url, MIME: mime, Title: title}
+}
+
+// NewGifResult creates an animated GIF result.
+func NewGifResult(url, thumbURL string) *GifResult {
+	return &GifResult{URL: url, ThumbURL: thumbURL}
+}
+
+// NewLocationResult creates a location result.
+func NewLocationResult(lat, lng float32, title string) *LocationResult {
+	return &LocationResult{Location: Location{Lat: lat, Lng: lng}, Title: title}
+}
+
+// NewMpeg4GifResult creates a soundless MPEG-4 animation result.
+func NewMpeg4GifResult(url, thumbURL string) *Mpeg4GifResult {
+	return &Mpeg4GifResult{URL: url, ThumbURL: thumbURL}
+}
+
+// NewPhotoResult creates a JPEG photo result.
+func NewPhotoResult(url, thumbURL string) *PhotoResult {
+	return &PhotoResult{URL: url, ThumbURL: thumbURL}
+}
+
+// NewVenueResult creates a venue result.
+func NewVenueResult(lat, lng float32, title, address string) *VenueResult {
+	return &VenueResult{Location: Location{Lat: lat, Lng: lng}, Title: title, Address: address}
+}
+
+// NewVideoResult creates a video result, mime is "text/html"
+// for embedded players or "video/mp4".
+func NewVideoResult(url, mime, thumbURL, title string) *VideoResult {
+	return &VideoResult{URL: url, MIME: mime, ThumbURL: thumbURL, Title: title}
+}
+
+// NewVoiceResult creates a voice result from the URL of an OGG file.
+func NewVoiceResult(url, title string) *VoiceResult {
+	return &VoiceResult{URL: url, Title: title}
+}
+
+// NewStickerResult creates a sticker result from its file id.
+func NewStickerResult(fileID string) *StickerResult {
+	return &StickerResult{Cache: fileID}
+}
@@ -0,0 +1,301 @@
+package stb
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// InlineQuery is an inline query handled with Bot.Inline. It pages
+// through the results with the offsets of the query and caches
+// them, so that the next pages don't fetch them again.
+type InlineQuery struct {
+	*Query
+
+	// PageSize is the number of results Answer sends at once.
+	PageSize int // Default: 20
+
+	// Personal keys the cache by user as well and tells Telegram
+	// to cache the answers for the user only.
+	Personal bool
+
+	bot  *Bot
+	data map[Result]interface{}
+}
+
+// Inline turns the handler into an OnQuery handler
+// getting the query as an InlineQuery.
+//
+// Example:
+//
+//     b.Handle(stb.OnQuery, b.Inline(func(q *stb.InlineQuery, m *stb.Machine) error {
+//         results, err := q.Results(time.Minute, func() (stb.Results, error) {
+//             return search(q.Text)
+//         })
+//         if err != nil {
+//             return err
+//         }
+//         return q.Answer(results, &stb.QueryResponse{CacheTime: 60})
+//     }))
+//
+func (b *Bot) Inline(handler func(q *InlineQuery, m *Machine) error) func(*Query, *Machine) error {
+	return func(q *Query, m *Machine) error {
+		return handler(&InlineQuery{Query: q, PageSize: 20, bot: b}, m)
+	}
+}
+
+// Results returns the results cached for the text of the query, or
+// fetches them and caches them for ttl. Results without an id are
+// given their index as id, which keeps ids unique across pages.
+// The cache keeps copies of its own, the results returned are
+// the caller's to change.
+func (q *InlineQuery) Results(ttl time.Duration, fetch func() (Results, error)) (Results, error) {
+	key := q.Text
+	if q.Personal {
+		key = strconv.Itoa(q.From.ID) + ":" + key
+	}
+
+	if results, ok := q.bot.inline.get(key); ok {
+		return copyResults(results), nil
+	}
+
+	results, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	numberResults(results)
+	q.bot.inline.put(key, copyResults(results), ttl)
+	return results, nil
+}
+
+// Answer answers the query with the page of the results at the
+// offset of the query, setting the offset of the next page. The
+// optional response sets the other fields of the answer.
+func (q *InlineQuery) Answer(results Results, resp ...*QueryResponse) error {
+	answer := &QueryResponse{}
+	if len(resp) > 0 {
+		copied := *resp[0]
+		answer = &copied
+	}
+	if q.Personal {
+		answer.IsPersonal = true
+	}
+
+	numberResults(results)
+
+	size := q.PageSize
+	if size <= 0 {
+		size = 20
+	}
+	start, _ := strconv.Atoi(q.Offset)
+	if start < 0 || start > len(results) {
+		start = len(results)
+	}
+	end := start + size
+	if end < len(results) {
+		answer.NextOffset = strconv.Itoa(end)
+	} else {
+		end = len(results)
+		answer.NextOffset = ""
+	}
+
+	// answering processes the results, which must not
+	// change the ones of the caller
+	page := results[start:end]
+	answer.Results = copyResults(page)
+	if err := q.bot.Answer(q.Query, answer); err != nil {
+		return err
+	}
+	q.bot.chosen.remember(q.Query, page, q.data)
+	return nil
+}
+
+// Attach attaches application data to the result, which is handed
+// to the handler of Bot.Chosen once the user chooses the result.
+func (q *InlineQuery) Attach(result Result, data interface{}) {
+	if q.data == nil {
+		q.data = make(map[Result]interface{})
+	}
+	q.data[result] = data
+}
+
+// numberResults gives the results without an id their index.
+func numberResults(results Results) {
+	for i, result := range results {
+		if result.ResultID() == "" {
+			result.SetResultID(strconv.Itoa(i))
+		}
+	}
+}
+
+// copyResults copies the results along with their keyboards,
+// which Bot.Answer rewrites, so that the copies can be answered
+// with while the originals are shared.
+func copyResults(results Results) Results {
+	copied := make(Results, len(results))
+	for i, result := range results {
+		copied[i] = copyResult(result)
+	}
+	return copied
+}
+
+func copyResult(result Result) Result {
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return result
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+
+	base := c.Elem().FieldByName("ResultBase")
+	if !base.IsValid() || base.Type() != reflect.TypeOf(ResultBase{}) {
+		return c.Interface().(Result)
+	}
+	rb := base.Addr().Interface().(*ResultBase)
+	if rb.ReplyMarkup != nil {
+		markup := *rb.ReplyMarkup
+		markup.InlineKeyboard = make([][]InlineButton, len(rb.ReplyMarkup.InlineKeyboard))
+		for i, row := range rb.ReplyMarkup.InlineKeyboard {
+			markup.InlineKeyboard[i] = append([]InlineButton(nil), row...)
+		}
+		rb.ReplyMarkup = &markup
+	}
+	return c.Interface().(Result)
+}
+
+// inlineCache caches the results of inline queries.
+type inlineCache struct {
+	mu      sync.Mutex
+	entries map[string]inlineEntry
+	swept   time.Time
+}
+
+type inlineEntry struct {
+	results Results
+	expires time.Time
+}
+
+func (c *inlineCache) get(key string) (Results, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.results, true
+}
+
+func (c *inlineCache) put(key string, results Results, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.entries == nil {
+		c.entries = make(map[string]inlineEntry)
+	}
+	// expired entries are dropped once a minute at most
+	if now.Sub(c.swept) > time.Minute {
+		c.swept = now
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = inlineEntry{results: results, expires: now.Add(ttl)}
+}
+
+// chosenMemory is how long answered queries are remembered for Bot.Chosen.
+const chosenMemory = time.Hour
+
+// InlineChoice is a chosen inline result handled with Bot.Chosen.
+type InlineChoice struct {
+	*ChosenInlineResult
+
+	// Origin is the query the result was the answer to, or
+	// nil if it was not answered with InlineQuery.Answer
+	// within the last hour.
+	Origin *Query
+
+	// Data is the data attached to the result, see InlineQuery.Attach.
+	Data interface{}
+}
+
+// Chosen turns the handler into an OnChosenInlineResult handler
+// getting the query the result answered and the data attached to
+// it, e.g. to edit the inline message later on or for analytics.
+// Telegram only sends chosen results if inline feedback is
+// enabled with @BotFather.
+//
+// Example:
+//
+//     b.Handle(stb.OnChosenInlineResult, b.Chosen(func(c *stb.InlineChoice, m *stb.Machine) error {
+//         if song, ok := c.Data.(Song); ok {
+//             stats.Played(song, c.Origin.Text)
+//         }
+//         return nil
+//     }))
+//
+func (b *Bot) Chosen(handler func(c *InlineChoice, m *Machine) error) func(*ChosenInlineResult, *Machine) error {
+	return func(r *ChosenInlineResult, m *Machine) error {
+		choice := &InlineChoice{ChosenInlineResult: r}
+		choice.Origin, choice.Data = b.chosen.lookup(r)
+		return handler(choice, m)
+	}
+}
+
+// chosenCache correlates chosen inline results with their queries.
+type chosenCache struct {
+	mu      sync.Mutex
+	entries map[string]chosenEntry
+	swept   time.Time
+}
+
+type chosenEntry struct {
+	query   *Query
+	data    interface{}
+	expires time.Time
+}
+
+func chosenKey(user int, query, result string) string {
+	return strconv.Itoa(user) + "\x00" + query + "\x00" + result
+}
+
+func (c *chosenCache) remember(q *Query, results Results, data map[Result]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.entries == nil {
+		c.entries = make(map[string]chosenEntry)
+	}
+	if now.Sub(c.swept) > time.Minute {
+		c.swept = now
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	for _, result := range results {
+		c.entries[chosenKey(q.From.ID, q.Text, result.ResultID())] = chosenEntry{
+			query:   q,
+			data:    data[result],
+			expires: now.Add(chosenMemory),
+		}
+	}
+}
+
+func (c *chosenCache) lookup(r *ChosenInlineResult) (*Query, interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[chosenKey(r.From.ID, r.Query, r.ResultID)]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, nil
+	}
+	return entry.query, entry.data
+}
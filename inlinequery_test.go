@@ -0,0 +1,122 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotInline(t *testing.T) {
+	var answers []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var answer map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&answer))
+		answers = append(answers, answer)
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	fetched := 0
+	b.Handle(OnQuery, b.Inline(func(q *InlineQuery, m *Machine) error {
+		q.PageSize = 2
+		results, err := q.Results(time.Minute, func() (Results, error) {
+			fetched++
+			var results Results
+			for i := 0; i < 5; i++ {
+				result := NewArticleResult(q.Text+strconv.Itoa(i), "text")
+				result.SetReplyMarkup([][]InlineButton{{{Unique: "u", Data: "d", Text: "go"}}})
+				results = append(results, result)
+			}
+			return results, nil
+		})
+		if err != nil {
+			return err
+		}
+		return q.Answer(results, &QueryResponse{CacheTime: 30})
+	}))
+
+	query := func(offset string) {
+		b.ProcessUpdate(Update{Query: &Query{ID: "q", From: User{ID: 1}, Text: "a", Offset: offset}})
+	}
+	query("")
+	query("2")
+	query("4")
+
+	assert.Equal(t, 1, fetched)
+	require.Len(t, answers, 3)
+
+	ids := func(answer map[string]interface{}) (ids []string) {
+		for _, r := range answer["results"].([]interface{}) {
+			ids = append(ids, r.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"0", "1"}, ids(answers[0]))
+	assert.Equal(t, "2", answers[0]["next_offset"])
+	assert.Equal(t, float64(30), answers[0]["cache_time"])
+	assert.Equal(t, []string{"2", "3"}, ids(answers[1]))
+	assert.Equal(t, []string{"4"}, ids(answers[2]))
+	assert.Equal(t, "", answers[2]["next_offset"])
+
+	article := answers[0]["results"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "article", article["type"])
+	assert.Equal(t, "a0", article["title"])
+	assert.Equal(t, "text", article["input_message_content"].(map[string]interface{})["message_text"])
+
+	// the cached results are not processed again
+	query("")
+	require.Len(t, answers, 4)
+	data := func(answer map[string]interface{}) interface{} {
+		result := answer["results"].([]interface{})[0].(map[string]interface{})
+		markup := result["reply_markup"].(map[string]interface{})
+		return markup["inline_keyboard"].([]interface{})[0].([]interface{})[0].(map[string]interface{})["callback_data"]
+	}
+	assert.Equal(t, "\fu|d", data(answers[0]))
+	assert.Equal(t, "\fu|d", data(answers[3]))
+}
+
+func TestBotChosen(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	b.Handle(OnQuery, b.Inline(func(q *InlineQuery, m *Machine) error {
+		song := NewAudioResult("https://example.com/song.mp3", "Song")
+		q.Attach(song, "song-42")
+		return q.Answer(Results{NewArticleResult("Lyrics", "..."), song})
+	}))
+
+	var choices []*InlineChoice
+	b.Handle(OnChosenInlineResult, b.Chosen(func(c *InlineChoice, m *Machine) error {
+		choices = append(choices, c)
+		return nil
+	}))
+
+	user := User{ID: 1}
+	b.ProcessUpdate(Update{Query: &Query{ID: "q", From: user, Text: "song"}})
+	b.ProcessUpdate(Update{ChosenInlineResult: &ChosenInlineResult{From: user, Query: "song", ResultID: "1"}})
+	b.ProcessUpdate(Update{ChosenInlineResult: &ChosenInlineResult{From: user, Query: "song", ResultID: "0"}})
+	b.ProcessUpdate(Update{ChosenInlineResult: &ChosenInlineResult{From: User{ID: 2}, Query: "song", ResultID: "1"}})
+
+	require.Len(t, choices, 3)
+	assert.Equal(t, "q", choices[0].Origin.ID)
+	assert.Equal(t, "song-42", choices[0].Data)
+	assert.Equal(t, "q", choices[1].Origin.ID)
+	assert.Nil(t, choices[1].Data)
+	assert.Nil(t, choices[2].Origin)
+}
@@ -0,0 +1,190 @@
+package stb
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MachineInfo describes a machine for the admin API, see Bot.AdminHandler.
+type MachineInfo struct {
+	ID    string    `json:"id"`
+	User  *User     `json:"user,omitempty"`
+	State StateType `json:"state"`
+
+	// Idle is the number of seconds since the last update.
+	Idle float64 `json:"idle_seconds"`
+
+	// ContextSize is the size of the JSON encoded context.
+	ContextSize int `json:"context_size"`
+
+	Deadline *time.Time  `json:"deadline,omitempty"`
+	History  []StateType `json:"history,omitempty"`
+
+	// Context is only included for a single machine.
+	Context json.RawMessage `json:"context,omitempty"`
+}
+
+// AdminHandler returns a JSON API to inspect the loaded machines
+// and to get stuck ones going again, meant for debugging in
+// production. Requests must carry the token as a bearer token
+// in the Authorization header, with an empty token every request
+// is forbidden. Don't expose the API to the public.
+//
+//     GET  /machines               the loaded machines
+//     GET  /machines/{id}          one machine, with its context
+//     POST /machines/{id}/state    {"state": "Menu"} forces the machine into the state
+//     POST /machines/{id}/event    {"event": "cancel"} sends the machine an event
+//
+// Machines that are not loaded are restored from the store, if the
+// bot has one. Forcing a state runs its action, like a transition.
+// The payload of an event, if there is one, is passed on as
+// json.RawMessage: {"event": "pick", "payload": 42}.
+//
+// Example:
+//
+//     http.Handle("/admin/", http.StripPrefix("/admin", b.AdminHandler(token)))
+//
+func (b *Bot) AdminHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeAdmin(w, http.StatusForbidden, errors.New("no token configured"))
+			return
+		}
+		auth := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+			writeAdmin(w, http.StatusUnauthorized, errors.New("bad token"))
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if parts[0] != "machines" || len(parts) > 3 {
+			writeAdmin(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+
+		switch {
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			b.adminList(w)
+		case len(parts) == 2 && r.Method == http.MethodGet:
+			b.adminMachine(w, parts[1], "", r)
+		case len(parts) == 3 && r.Method == http.MethodPost:
+			b.adminMachine(w, parts[1], parts[2], r)
+		default:
+			writeAdmin(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	})
+}
+
+func (b *Bot) adminList(w http.ResponseWriter) {
+	infos := []MachineInfo{}
+	b.machines.Range(func(m *Machine) bool {
+		info := m.info()
+		info.Context = nil
+		infos = append(infos, info)
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+
+	writeAdmin(w, http.StatusOK, infos)
+}
+
+func (b *Bot) adminMachine(w http.ResponseWriter, id, action string, r *http.Request) {
+	m, ok := b.machines.Get(id)
+	if !ok && b.store != nil {
+		if _, err := b.store.Load(id); err == nil {
+			m, ok = b.machines.obtain(id, nil), true
+		}
+	}
+	if !ok {
+		writeAdmin(w, http.StatusNotFound, errors.Errorf("machine %q is not loaded", id))
+		return
+	}
+
+	var req struct {
+		State   StateType       `json:"state"`
+		Event   EventType       `json:"event"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if action != "" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdmin(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	switch action {
+	case "":
+	case "state":
+		states, _ := b.config()
+		if _, ok := states[req.State]; !ok || req.State == "" {
+			writeAdmin(w, http.StatusBadRequest, errors.Errorf("state %q is not defined", req.State))
+			return
+		}
+		if err := m.force(req.State); err != nil {
+			writeAdmin(w, http.StatusInternalServerError, err)
+			return
+		}
+	case "event":
+		var payload []interface{}
+		if len(req.Payload) > 0 {
+			payload = append(payload, req.Payload)
+		}
+		if err := m.SendEvent(req.Event, payload...); err == ErrEventRejected {
+			writeAdmin(w, http.StatusConflict, errors.Errorf("event %q rejected in state %q", req.Event, m.Current()))
+			return
+		} else if err != nil {
+			writeAdmin(w, http.StatusInternalServerError, err)
+			return
+		}
+	default:
+		writeAdmin(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	writeAdmin(w, http.StatusOK, m.info())
+}
+
+// writeAdmin writes v, or the error, as JSON.
+func writeAdmin(w http.ResponseWriter, code int, v interface{}) {
+	if err, ok := v.(error); ok {
+		v = map[string]string{"error": err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// info describes the machine.
+func (m *Machine) info() MachineInfo {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	info := MachineInfo{
+		ID:    m.id,
+		User:  m.who,
+		State: m.Current(),
+		Idle:  time.Since(m.lastSeen).Seconds(),
+	}
+	if snap, err := m.Snapshot(); err == nil {
+		info.ContextSize = len(snap.Context)
+		info.Context = snap.Context
+		info.Deadline = snap.Deadline
+		info.History = snap.History
+	}
+	return info
+}
+
+// force moves the machine into the state, whatever its current one.
+func (m *Machine) force(t StateType) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.setPayload(nil)
+	return m.transition(t, "")
+}
@@ -0,0 +1,88 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminHandler(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+
+	var entered []interface{}
+	start := b.Default(Default)
+	start.Event("order", "Order")
+	order := b.State("Order")
+	order.Event("cancel", Default)
+	order.Action(func(m *Machine) {
+		entered = append(entered, m.Payload())
+	})
+
+	alice, bob := b.machine(&User{ID: 1}), b.machine(&User{ID: 2})
+	alice.Set(map[string]int{"items": 3})
+	require.NoError(t, store.Save("3", &Snapshot{State: "Order"}))
+
+	h := b.AdminHandler("secret")
+	do := func(method, path, body string, v interface{}) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if v != nil {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+		}
+		return rec.Code
+	}
+
+	var list []MachineInfo
+	assert.Equal(t, http.StatusOK, do("GET", "/machines", "", &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "1", list[0].ID)
+	assert.Equal(t, 1, list[0].User.ID)
+	assert.Equal(t, Default, list[0].State)
+	assert.Equal(t, len(`{"items":3}`), list[0].ContextSize)
+	assert.Nil(t, list[0].Context)
+	assert.Equal(t, "2", list[1].ID)
+
+	var info MachineInfo
+	assert.Equal(t, http.StatusOK, do("GET", "/machines/1", "", &info))
+	assert.JSONEq(t, `{"items":3}`, string(info.Context))
+
+	assert.Equal(t, http.StatusOK, do("POST", "/machines/2/state", `{"state":"Order"}`, &info))
+	assert.Equal(t, StateType("Order"), info.State)
+	assert.Equal(t, StateType("Order"), bob.Current())
+	assert.Equal(t, []StateType{Default}, info.History)
+
+	assert.Equal(t, http.StatusOK, do("POST", "/machines/1/event", `{"event":"order","payload":42}`, &info))
+	assert.Equal(t, StateType("Order"), alice.Current())
+	assert.Equal(t, []interface{}{nil, json.RawMessage("42")}, entered)
+
+	var failure map[string]string
+	assert.Equal(t, http.StatusConflict, do("POST", "/machines/1/event", `{"event":"order"}`, &failure))
+	assert.Equal(t, `event "order" rejected in state "Order"`, failure["error"])
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/machines/1/state", `{"state":"Nope"}`, nil))
+	assert.Equal(t, http.StatusNotFound, do("GET", "/machines/4", "", nil))
+	assert.Equal(t, http.StatusNotFound, do("GET", "/other", "", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, do("DELETE", "/machines/1", "", nil))
+
+	// stored machines are restored
+	assert.Equal(t, http.StatusOK, do("GET", "/machines/3", "", &info))
+	assert.Equal(t, StateType("Order"), info.State)
+
+	req := httptest.NewRequest("GET", "/machines", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req.Header.Set("Authorization", "Bearer ")
+	rec = httptest.NewRecorder()
+	b.AdminHandler("").ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
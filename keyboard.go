@@ -0,0 +1,210 @@
+package stb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Keyboard builds reply markup together with the handlers of its
+// buttons, so the callback uniques never have to be written by hand.
+//
+// Example:
+//
+//     kb := stb.NewInlineKeyboard().
+//         Row(stb.Button("Yes", onYes), stb.Button("No", onNo)).
+//         Row(stb.URLButton("Help", "https://example.com/help"))
+//
+//     markup, err := state.Keyboard(kb)
+//
+type Keyboard struct {
+	inline   bool
+	rows     []Row
+	handlers []keyHandler
+
+	resize  bool
+	oneTime bool
+
+	// registered are the states the handlers are registered in
+	mu         sync.Mutex
+	registered map[*State]bool
+}
+
+type keyHandler struct {
+	btn     Btn
+	handler interface{}
+}
+
+// KeyButton is a keyboard button with an optional handler.
+type KeyButton struct {
+	Btn
+	Handler interface{}
+}
+
+// Button creates a button with a handler. In an inline keyboard
+// it is a callback button, the handler being func(*Callback, *Machine).
+// In a reply keyboard it sends its text, the handler being
+// func(*Message, *Machine). The handler may be nil.
+func Button(text string, handler interface{}) KeyButton {
+	return KeyButton{Btn: Btn{Text: text}, Handler: handler}
+}
+
+// URLButton creates an inline button opening the url.
+func URLButton(text, url string) KeyButton {
+	return KeyButton{Btn: Btn{Text: text, URL: url}}
+}
+
+// WithUnique sets the callback unique of an inline button,
+// instead of the one derived from its text.
+func (b KeyButton) WithUnique(unique string) KeyButton {
+	b.Unique = unique
+	return b
+}
+
+// WithData sets the callback data of an inline button.
+func (b KeyButton) WithData(data string) KeyButton {
+	b.Data = data
+	return b
+}
+
+// NewInlineKeyboard creates a keyboard shown under the message.
+func NewInlineKeyboard() *Keyboard {
+	return &Keyboard{inline: true}
+}
+
+// NewReplyKeyboard creates a keyboard replacing the one of the user.
+func NewReplyKeyboard() *Keyboard {
+	return &Keyboard{}
+}
+
+// Row appends a row of buttons to the keyboard.
+func (k *Keyboard) Row(buttons ...KeyButton) *Keyboard {
+	row := make(Row, 0, len(buttons))
+	for _, b := range buttons {
+		if k.inline && b.isCallback() && b.Unique == "" {
+			b.Unique = deriveUnique(b.Text)
+		}
+		row = append(row, b.Btn)
+		if b.Handler != nil {
+			k.handlers = append(k.handlers, keyHandler{btn: b.Btn, handler: b.Handler})
+		}
+	}
+	k.rows = append(k.rows, row)
+	return k
+}
+
+// Resize asks clients to fit the reply keyboard to its buttons.
+func (k *Keyboard) Resize() *Keyboard {
+	k.resize = true
+	return k
+}
+
+// OneTime asks clients to hide the reply keyboard once it's been used.
+func (k *Keyboard) OneTime() *Keyboard {
+	k.oneTime = true
+	return k
+}
+
+// Markup returns the reply markup of the keyboard.
+func (k *Keyboard) Markup() *ReplyMarkup {
+	return k.markup(k.rows)
+}
+
+func (k *Keyboard) markup(rows []Row) *ReplyMarkup {
+	r := &ReplyMarkup{}
+	if k.inline {
+		r.Inline(rows...)
+	} else {
+		r.Reply(rows...)
+		r.ResizeReplyKeyboard = k.resize
+		r.OneTimeKeyboard = k.oneTime
+	}
+	return r
+}
+
+// MarkupFor returns the reply markup of the keyboard in the language
+// of the machine. Button texts are taken as message keys, texts
+// without a message in Settings.Locales are shown as they are.
+func (k *Keyboard) MarkupFor(m *Machine) *ReplyMarkup {
+	rows := make([]Row, len(k.rows))
+	for i, row := range k.rows {
+		rows[i] = make(Row, len(row))
+		for j, btn := range row {
+			btn.Text = m.T(btn.Text)
+			rows[i][j] = btn
+		}
+	}
+	return k.markup(rows)
+}
+
+// Register registers the handlers of the buttons in the state.
+// Reply buttons are registered for every translation of their
+// text as well, see MarkupFor. Like State.Handle, it is meant
+// for setting up the bot: the handlers are registered once per
+// state, the following calls do nothing.
+func (k *Keyboard) Register(s *State) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.registered[s] {
+		return nil
+	}
+	for _, h := range k.handlers {
+		for _, text := range k.texts(s, h.btn.Text) {
+			btn := h.btn
+			btn.Text = text
+			if err := s.Handle(&btn, h.handler); err != nil {
+				return errors.WithMessagef(err, "button %q", btn.Text)
+			}
+		}
+	}
+
+	if k.registered == nil {
+		k.registered = make(map[*State]bool)
+	}
+	k.registered[s] = true
+	return nil
+}
+
+// texts returns the texts a button with the text is sent with.
+func (k *Keyboard) texts(s *State, text string) []string {
+	texts := []string{text}
+	if k.inline || s.bot == nil || s.bot.locales == nil {
+		return texts
+	}
+
+	seen := map[string]bool{text: true}
+	for _, lang := range s.bot.locales.Languages() {
+		if t := s.bot.locales.T(lang, text); !seen[t] {
+			seen[t] = true
+			texts = append(texts, t)
+		}
+	}
+	return texts
+}
+
+// Keyboard registers the handlers of the keyboard buttons
+// in the state and returns its reply markup. Call it while
+// setting up the bot, and Markup or MarkupFor from the
+// handlers and actions, as the handlers of a running bot
+// must not change.
+func (s *State) Keyboard(k *Keyboard) (*ReplyMarkup, error) {
+	if err := k.Register(s); err != nil {
+		return nil, err
+	}
+	return k.Markup(), nil
+}
+
+func (b KeyButton) isCallback() bool {
+	return b.URL == "" && b.InlineQuery == "" && b.InlineQueryChat == "" && b.Login == nil
+}
+
+// deriveUnique returns a stable callback unique for the button text,
+// valid whatever characters the text is made of.
+func deriveUnique(text string) string {
+	h := fnv.New32a()
+	h.Write([]byte(text))
+	return fmt.Sprintf("kb%08x", h.Sum32())
+}
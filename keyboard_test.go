@@ -0,0 +1,54 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyboard(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+	s := b.Default(Default)
+
+	var got []string
+	kb := NewInlineKeyboard().
+		Row(
+			Button("Yes", func(c *Callback, _ *Machine) { got = append(got, "yes "+c.Data) }),
+			Button("No", func(*Callback, *Machine) { got = append(got, "no") }).WithUnique("no"),
+		).
+		Row(URLButton("Help", "https://example.com"))
+
+	markup, err := s.Keyboard(kb)
+	require.NoError(t, err)
+	require.Len(t, markup.InlineKeyboard, 2)
+	yes := markup.InlineKeyboard[0][0]
+	assert.Equal(t, deriveUnique("Yes"), yes.Unique)
+	assert.Equal(t, "no", markup.InlineKeyboard[0][1].Unique)
+	assert.Equal(t, "", markup.InlineKeyboard[1][0].Unique)
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{Callback: &Callback{Sender: user, Data: "\f" + yes.Unique + "|1"}})
+	b.ProcessUpdate(Update{Callback: &Callback{Sender: user, Data: "\fno"}})
+	assert.Equal(t, []string{"yes 1", "no"}, got)
+
+	// the handlers are registered once
+	_, err = s.Keyboard(kb)
+	require.NoError(t, err)
+	assert.Empty(t, s.duplicates)
+
+	reply := NewReplyKeyboard().Resize().
+		Row(Button("Cancel", func(*Message, *Machine) { got = append(got, "cancel") }))
+	markup, err = s.Keyboard(reply)
+	require.NoError(t, err)
+	assert.True(t, markup.ResizeReplyKeyboard)
+	assert.Equal(t, "Cancel", markup.ReplyKeyboard[0][0].Text)
+
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Text: "Cancel"}})
+	assert.Equal(t, "cancel", got[2])
+
+	bad := NewInlineKeyboard().Row(Button("Bad", func(*Message, *Machine) {}))
+	_, err = s.Keyboard(bad)
+	assert.ErrorIs(t, err, ErrBadHandler)
+}
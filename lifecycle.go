@@ -0,0 +1,89 @@
+package stb
+
+// Blocked tells whether the user of the machine blocked the bot.
+// Machine.Send notices it, as do my_chat_member updates of the
+// private chat, which also tell when the user unblocks the bot.
+// Blocked machines are skipped by Bot.Broadcast.
+func (m *Machine) Blocked() bool {
+	m.currentMu.RLock()
+	defer m.currentMu.RUnlock()
+	return m.blocked
+}
+
+// trackBlocked follows the user blocking and unblocking the bot.
+func (m *Machine) trackBlocked(upd Update) {
+	u := upd.MyChatMember
+	if u == nil || u.Chat.Type != ChatPrivate || u.NewChatMember == nil {
+		return
+	}
+
+	switch u.NewChatMember.Role {
+	case Kicked:
+		m.setBlocked(true)
+	case Member:
+		m.setBlocked(false)
+	}
+}
+
+// setBlocked marks the machine as blocked or unblocked, persists
+// the mark and calls the OnBotBlocked or OnBotUnblocked handlers.
+func (m *Machine) setBlocked(blocked bool) {
+	m.currentMu.Lock()
+	changed := m.blocked != blocked
+	m.blocked = blocked
+	m.currentMu.Unlock()
+	if !changed {
+		return
+	}
+
+	if m.peeked {
+		m.savePeeked(blocked)
+	} else {
+		m.save()
+	}
+
+	end := OnBotUnblocked
+	if blocked {
+		end = OnBotBlocked
+	}
+	m.lifecycle(end)
+
+	if blocked && m.bot != nil && m.bot.dropBlocked {
+		// the caller may hold the lock of the machine, which evict
+		// takes under the lock of the registry
+		go m.bot.machines.drop(m)
+	}
+}
+
+// savePeeked stores the blocked mark of a machine peeked by
+// Bot.Broadcast, leaving the rest of its snapshot as stored.
+func (m *Machine) savePeeked(blocked bool) {
+	store := m.bot.store
+	snap, err := store.Load(m.id)
+	if err == nil {
+		snap.Blocked = blocked
+		err = store.Save(m.id, snap)
+	}
+	if err != nil && err != ErrNotStored {
+		m.bot.debug(wrapError(err))
+	}
+}
+
+// lifecycle runs the first handler of the endpoint found in the
+// state of the machine, its parents or the global state.
+func (m *Machine) lifecycle(end string) {
+	if m.bot == nil {
+		return
+	}
+
+	states, global := m.bot.config()
+	for _, state := range append(lineage(states, m.Current()), global) {
+		if handler, ok := state.handlers[end]; ok {
+			handler := handler.(func(*Machine) error)
+			s := *state
+			s.machine = m
+			s.runHandler(end, func(m *Machine) error { return handler(m) })
+			return
+		}
+	}
+}
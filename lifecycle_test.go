@@ -0,0 +1,86 @@
+package stb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineBlocked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`))
+	}))
+	defer srv.Close()
+
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL, Store: store, EvictBlocked: true})
+	require.NoError(t, err)
+
+	var got []string
+	b.Default(Default)
+	b.MustHandle(OnBotBlocked, func(m *Machine) { got = append(got, "blocked "+m.ID()) })
+	b.MustHandle(OnBotUnblocked, func(m *Machine) { got = append(got, "unblocked "+m.ID()) })
+
+	user := &User{ID: 1}
+	m := b.machine(user)
+	_, err = m.Send("hi")
+	assert.Equal(t, ErrBlockedByUser, err)
+	assert.True(t, m.Blocked())
+	assert.Eventually(t, func() bool {
+		_, loaded := b.machines.Get("1")
+		return !loaded
+	}, time.Second, time.Millisecond)
+
+	snap, err := store.Load("1")
+	require.NoError(t, err)
+	assert.True(t, snap.Blocked)
+
+	member := func(role MemberStatus) Update {
+		return Update{MyChatMember: &ChatMemberUpdated{
+			From:          *user,
+			Chat:          Chat{ID: 1, Type: ChatPrivate},
+			NewChatMember: &ChatMember{User: user, Role: role},
+		}}
+	}
+	b.ProcessUpdate(member(Member))
+	assert.False(t, b.machine(user).Blocked())
+	b.ProcessUpdate(member(Kicked))
+	b.ProcessUpdate(member(Kicked))
+
+	assert.Equal(t, []string{"blocked 1", "unblocked 1", "blocked 1"}, got)
+
+	report, err := b.Broadcast(nil, "news")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, report.Unreachable)
+}
+
+func TestBroadcastBlockedPeeked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`))
+	}))
+	defer srv.Close()
+
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL, Store: store})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	m := b.machine(&User{ID: 2})
+	m.touch(&Chat{ID: 2, Type: ChatPrivate}, 0, "")
+	m.save()
+	b.machines.Delete("2")
+
+	report, err := b.Broadcast(nil, "news")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, report.Unreachable)
+
+	snap, err := store.Load("2")
+	require.NoError(t, err)
+	assert.True(t, snap.Blocked)
+	_, loaded := b.machines.Get("2")
+	assert.False(t, loaded)
+}
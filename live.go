@@ -0,0 +1,143 @@
+package stb
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LiveStatus tells what happened to a live location.
+type LiveStatus string
+
+const (
+	LiveStarted LiveStatus = "started"
+	LiveUpdated LiveStatus = "updated"
+	LiveStopped LiveStatus = "stopped"
+)
+
+// LiveLocation is an update of a live location, see OnLiveLocation.
+type LiveLocation struct {
+	// Message is the message of the live location,
+	// as of the latest update.
+	Message *Message
+
+	// Status tells whether the location started being
+	// shared, moved or stopped being shared.
+	Status LiveStatus
+
+	// Started is when sharing started and Until is when it ends,
+	// unless stopped before. Both are estimated from the first
+	// update seen if sharing started while the bot was down.
+	Started, Until time.Time
+
+	// Updates is the number of updates so far.
+	Updates int
+
+	// Expired tells the sharing stopped because its period
+	// ended, rather than being stopped by the user.
+	Expired bool
+}
+
+// Location returns the current location.
+func (l *LiveLocation) Location() *Location {
+	return l.Message.Location
+}
+
+// lives tracks the live locations being shared, by message.
+type lives struct {
+	mu       sync.Mutex
+	sessions map[string]*liveSession
+}
+
+type liveSession struct {
+	started, until time.Time
+	updates        int
+	last           *Message
+	timer          *time.Timer
+}
+
+// track returns the live location the update carries, if any.
+// Sessions not stopped by their user are stopped once their
+// period ends, by dispatching their last message as expired,
+// inflight counts the expirations being dispatched.
+func (l *lives) track(upd Update, inflight *sync.WaitGroup, dispatch func(Update)) *LiveLocation {
+	msg, edited := upd.Message, false
+	if upd.EditedMessage != nil {
+		msg, edited = upd.EditedMessage, true
+	}
+	if msg == nil || msg.Location == nil || msg.Chat == nil {
+		return nil
+	}
+	if !edited && msg.Location.LivePeriod == 0 {
+		return nil
+	}
+
+	key := strconv.FormatInt(msg.Chat.ID, 10) + ":" + strconv.Itoa(msg.ID)
+	period := time.Duration(msg.Location.LivePeriod) * time.Second
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sessions == nil {
+		l.sessions = make(map[string]*liveSession)
+	}
+
+	session, ok := l.sessions[key]
+	live := &LiveLocation{Message: msg, Status: LiveUpdated}
+	switch {
+	case !edited:
+		live.Status = LiveStarted
+		fallthrough
+	case !ok && period > 0:
+		started := sentAt(msg)
+		session = &liveSession{started: started, until: started.Add(period)}
+		l.sessions[key] = session
+		session.timer = time.AfterFunc(time.Until(session.until), func() {
+			inflight.Add(1)
+			defer inflight.Done()
+			l.expire(key, session, dispatch)
+		})
+	case period == 0:
+		live.Status = LiveStopped
+		if ok {
+			session.timer.Stop()
+			delete(l.sessions, key)
+		} else {
+			session = &liveSession{started: sentAt(msg), until: time.Now()}
+		}
+	}
+
+	session.updates++
+	session.last = msg
+	live.Started, live.Until, live.Updates = session.started, session.until, session.updates
+	return live
+}
+
+// sentAt returns when the message was sent, or now if unknown.
+func sentAt(msg *Message) time.Time {
+	if msg.Unixtime == 0 {
+		return time.Now()
+	}
+	return msg.Time()
+}
+
+// expire stops the session once its period ended.
+func (l *lives) expire(key string, session *liveSession, dispatch func(Update)) {
+	l.mu.Lock()
+	if l.sessions[key] != session {
+		l.mu.Unlock()
+		return
+	}
+	delete(l.sessions, key)
+	session.updates++
+	live := &LiveLocation{
+		Message: session.last,
+		Status:  LiveStopped,
+		Started: session.started,
+		Until:   session.until,
+		Updates: session.updates,
+		Expired: true,
+	}
+	l.mu.Unlock()
+
+	dispatch(Update{EditedMessage: session.last, live: live})
+}
@@ -0,0 +1,65 @@
+package stb
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotLiveLocation(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		lives []LiveLocation
+	)
+	b.Default(Default)
+	b.Handle(OnLiveLocation, func(l *LiveLocation, m *Machine) {
+		mu.Lock()
+		lives = append(lives, *l)
+		mu.Unlock()
+	})
+	located := 0
+	b.Handle(OnLocation, func(msg *Message, m *Machine) { located++ })
+
+	user, chat := &User{ID: 1}, &Chat{ID: 1}
+	msg := func(id, period int) *Message {
+		return &Message{ID: id, Sender: user, Chat: chat, Location: &Location{Lat: 1, Lng: 2, LivePeriod: period}}
+	}
+
+	b.ProcessUpdate(Update{Message: msg(1, 0)})
+	assert.Equal(t, 1, located)
+
+	b.ProcessUpdate(Update{Message: msg(2, 60)})
+	b.ProcessUpdate(Update{EditedMessage: msg(2, 60)})
+	b.ProcessUpdate(Update{EditedMessage: msg(2, 0)})
+	b.ProcessUpdate(Update{Message: msg(3, 1)})
+	b.ProcessUpdate(Update{EditedMessage: msg(3, 1)})
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(lives) == 6
+	}, 3*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var statuses []LiveStatus
+	for _, l := range lives {
+		statuses = append(statuses, l.Status)
+	}
+	assert.Equal(t, []LiveStatus{
+		LiveStarted, LiveUpdated, LiveStopped,
+		LiveStarted, LiveUpdated, LiveStopped,
+	}, statuses)
+	assert.Equal(t, 3, lives[2].Updates)
+	assert.False(t, lives[2].Expired)
+	assert.True(t, lives[5].Expired)
+	assert.Equal(t, 3, lives[5].Message.ID)
+	assert.Equal(t, time.Second, lives[5].Until.Sub(lives[5].Started))
+	assert.Equal(t, 1, located)
+}
@@ -1,21 +1,46 @@
 package stb
 
 import (
-	"errors"
-	"log"
+	"context"
+	"encoding/json"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // ErrEventRejected is the error returned when the state machine cannot process
 // an event in the state that it is in.
 var ErrEventRejected = errors.New("event rejected")
 
+var (
+	// ErrUnknownState is returned when the machine is to move into
+	// a state that is not defined. The machine stays where it is.
+	ErrUnknownState = errors.New("stb: unknown state")
+
+	// ErrNoAction is returned by Machine.Repeat if the current
+	// state has no action.
+	ErrNoAction = errors.New("stb: state has no action")
+)
+
 // Machine represents the state machine.
 type Machine struct {
+	*machineCore
+
+	// spanCtx is the context of the handler the machine is handed
+	// to: every handler gets a copy of the machine, see withContext.
+	spanCtx context.Context
+}
+
+// machineCore is the state of a machine, shared by its copies.
+type machineCore struct {
 	// Current represents the current state.
 	current StateType
 	who     *User
-	ctx     interface{}
+	payload interface{}
+
+	// ctx is the context of Set, guarded by currentMu.
+	ctx interface{}
 
 	// states holds the configuration of states and events handled by the state machine.
 	states       map[StateType]*State
@@ -23,16 +48,100 @@ type Machine struct {
 
 	// mutex ensures that only 1 event is processed by the state machine at any given time.
 	mutex sync.Mutex
+
+	// currentMu guards reads of the current state from outside of mutex,
+	// it is never held for longer than the read or the write itself.
+	currentMu sync.RWMutex
+
+	// saveMu serializes the saves, so that the store
+	// ends up with the latest snapshot.
+	saveMu sync.Mutex
+
+	// erased is set once the machine is erased, see Machines.Erase,
+	// and stops it from being saved again. Guarded by saveMu.
+	erased bool
+
+	// id is the key the machine is persisted under.
+	id       string
+	store    Store
+	reporter func(error)
+
+	// peeked is set on the machines restored by Bot.peek,
+	// which are not saved to the store.
+	peeked bool
+
+	// history holds the previously visited states, the most recent last.
+	history     []StateType
+	historySize int
+
+	// deadline is the moment the machine times out of the current
+	// state, zero if the state has no timeout. Guarded by currentMu.
+	deadline time.Time
+	timer    *time.Timer
+
+	// lastSeen is the moment the machine processed its last update.
+	lastSeen time.Time
+
+	// swept is the lastSeen of the idle period the machine
+	// expired in, see State.ExpireAfter.
+	swept time.Time
+
+	// chat, thread and business are the chat, the forum topic and
+	// the business connection of the latest update, guarded by currentMu.
+	chat     *Chat
+	thread   int
+	business string
+
+	// menu is the command menu last set for the machine,
+	// see Settings.SyncMenus. Guarded by menuMu.
+	menu   string
+	menuMu sync.Mutex
+
+	// lang is the language set with SetLanguage, guarded by currentMu.
+	lang string
+
+	// session is created on first use, guarded by currentMu.
+	session *Session
+
+	// generation is the reload of the bot the states are from.
+	generation int
+
+	// listeners are added with OnTransition, guarded by currentMu.
+	listeners []TransitionFunc
+
+	// deferred are the events waiting for a state that accepts
+	// them, see Bot.Defer. Guarded by currentMu.
+	deferred []deferredEvent
+
+	// raised are the events the actions of a synchronous
+	// bot send, see raise. Guarded by the mutex.
+	raised []deferredEvent
+
+	// scheduled are the events of SendEventAfter, guarded by currentMu.
+	scheduled []*scheduledEvent
+
+	// blocked tells whether the user blocked the bot, guarded by currentMu.
+	blocked bool
+
+	// outbox holds the messages not sent yet, see Settings.Outbox.
+	// Guarded by currentMu, outboxMu serializes the sends.
+	outbox   []OutboxEntry
+	outboxMu sync.Mutex
+
+	// seenIDs are the updates processed last, see Settings.Dedup.
+	// Guarded by currentMu, seenMu serializes the checks.
+	seenIDs []int
+	seenMu  sync.Mutex
+
+	bot *Bot
 }
 
 // getNextState returns the next state for the event given the machine's current
 // state, or an error if the event can't be handled in the given state.
 func (m *Machine) getNextState(event EventType) (StateType, error) {
-	if state, ok := m.states[m.current]; ok {
-		if state.Events != nil {
-			if next, ok := state.Events[event]; ok {
-				return next, nil
-			}
+	for _, state := range lineage(m.states, m.current) {
+		if next, ok := state.Events[event]; ok {
+			return next, nil
 		}
 	}
 
@@ -46,47 +155,367 @@ func (m *Machine) getNextState(event EventType) (StateType, error) {
 }
 
 // SendEvent sends an event to the state machine.
-func (m *Machine) SendEvent(event EventType) error {
+//
+// An optional payload is handed to the next state,
+// its action can pick it up with Machine.Payload.
+//
+// It returns ErrEventRejected if the current state has no
+// transition for the event, unless the event is deferrable
+// (see Bot.Defer), and ErrUnknownState if the
+// transition leads to a state that is not defined.
+func (m *Machine) SendEvent(event EventType, payload ...interface{}) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	return m.sendEventLocked(event, eventPayload(payload))
+}
+
+// sendEventLocked is SendEvent for the caller holding the mutex.
+func (m *Machine) sendEventLocked(event EventType, payload interface{}) error {
 	// Determine the next state for the event given the machine's current state.
 	nextState, err := m.getNextState(event)
 	if err != nil {
+		if m.bot != nil && m.bot.deferred(event) {
+			m.currentMu.Lock()
+			m.deferred = append(m.deferred, deferredEvent{event: event, payload: payload})
+			m.currentMu.Unlock()
+			return m.persist()
+		}
+		if m.bot != nil && m.bot.observer != nil {
+			m.bot.observer.ObserveRejected(m.current, event)
+		}
 		return ErrEventRejected
 	}
+	if err := m.known(nextState); err != nil {
+		return err
+	}
+
+	m.setPayload(payload)
+	return m.transition(nextState, event)
+}
+
+// eventPayload returns the optional payload of SendEvent.
+func eventPayload(payload []interface{}) interface{} {
+	if len(payload) > 0 {
+		return payload[0]
+	}
+	return nil
+}
+
+// Payload returns the payload of the event that moved the machine
+// into the current state, or nil. Payloads are not persisted.
+func (m *Machine) Payload() interface{} {
+	m.currentMu.RLock()
+	defer m.currentMu.RUnlock()
+	return m.payload
+}
+
+func (m *Machine) setPayload(data interface{}) {
+	m.currentMu.Lock()
+	m.payload = data
+	m.currentMu.Unlock()
+}
+
+// report passes the error to the reporter of the machine.
+func (m *Machine) report(err error) {
+	if err != nil && m.reporter != nil {
+		m.reporter(err)
+	}
+}
+
+// transition moves the machine into the next state and runs its action,
+// remembering the state it leaves. The event is the one that caused the
+// transition, if any. The caller must hold the mutex.
+func (m *Machine) transition(nextState StateType, event EventType) error {
+	if err := m.known(nextState); err != nil {
+		return err
+	}
+	if nextState == m.current && m.states[nextState].stay {
+		for _, listener := range m.transitionListeners() {
+			listener(nextState, nextState, event)
+		}
+		return nil
+	}
+	m.remember(m.current)
+	return m.enter(nextState, event)
+}
 
-	// Identify the state definition for the next state.
+// known returns ErrUnknownState if the state is not defined.
+func (m *Machine) known(t StateType) error {
+	if _, ok := m.states[t]; !ok {
+		return errors.Wrapf(ErrUnknownState, "%q", t)
+	}
+	return nil
+}
+
+// enter moves the machine into the next state and runs its action.
+// The caller must hold the mutex.
+func (m *Machine) enter(nextState StateType, event EventType) error {
 	state, ok := m.states[nextState]
-	if !ok || state.action == nil {
-		// configuration error
+	if !ok {
+		return errors.Wrapf(ErrUnknownState, "%q", nextState)
 	}
-	log.Println(nextState)
+
 	// Transition over to the next state.
+	m.currentMu.Lock()
+	prev := m.current
 	m.current = nextState
-	if state.action != nil {
-		action, ok := state.action.(func(*Machine))
-		if !ok {
-			panic("stb: action is bad")
-		}
+	m.currentMu.Unlock()
+	if m.bot != nil && m.bot.observer != nil {
+		m.bot.observer.ObserveTransition(prev, nextState)
+	}
+	for _, listener := range m.transitionListeners() {
+		listener(prev, nextState, event)
+	}
+	m.resetTimeout()
+	m.runAction(state)
+	if m.bot != nil && m.bot.menus {
+		m.syncMenuLater()
+	}
 
-		state.runHandler(func() { action(m) })
+	if err := m.persist(); err != nil {
+		return err
 	}
+	if err := m.sendRaised(); err != nil {
+		return err
+	}
+	return m.redeliver()
+}
 
+// raise sends the event from an action. The actions of a
+// synchronous bot run with the machine locked, their events
+// are sent once the transition is done. The others run in
+// the background and send it right away.
+func (m *Machine) raise(event EventType, payload interface{}) error {
+	if m.bot == nil || !m.bot.synchronous {
+		return m.SendEvent(event, payload)
+	}
+	m.raised = append(m.raised, deferredEvent{event: event, payload: payload})
 	return nil
 }
 
+// sendRaised sends the events raised by the actions run
+// so far. The caller must hold the mutex.
+func (m *Machine) sendRaised() error {
+	for len(m.raised) > 0 {
+		raised := m.raised[0]
+		m.raised = m.raised[1:]
+		if err := m.sendEventLocked(raised.event, raised.payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TransitionFunc is called with the state the machine left,
+// the one it entered and the event that caused the transition.
+// The event is empty for transitions without one, like timeouts
+// or going back.
+type TransitionFunc func(from, to StateType, event EventType)
+
+// OnTransition adds a listener that is called after every transition
+// of the machine, before the action of the new state runs, e.g. to
+// audit the transitions or feed analytics. Listeners are not
+// persisted. They run while the machine is locked and must not
+// send events to it.
+//
+// Example:
+//
+//     m.OnTransition(func(from, to stb.StateType, e stb.EventType) {
+//         log.Printf("%s: %s -(%s)-> %s", m.ID(), from, e, to)
+//     })
+//
+func (m *Machine) OnTransition(listener TransitionFunc) {
+	m.currentMu.Lock()
+	m.listeners = append(m.listeners, listener)
+	m.currentMu.Unlock()
+}
+
+func (m *Machine) transitionListeners() []TransitionFunc {
+	m.currentMu.RLock()
+	defer m.currentMu.RUnlock()
+	return m.listeners
+}
+
+// runAction runs the action of the state, if it has one.
+func (m *Machine) runAction(state *State) {
+	if state.action == nil {
+		return
+	}
+	s := *state
+	s.machine = m
+	s.runHandler("", func(m *Machine) error { state.action(m); return nil })
+}
+
+// Repeat runs the action of the current state again, e.g. to ask
+// the user again from a Fallback. It returns ErrNoAction if the
+// state has none.
+func (m *Machine) Repeat() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state, ok := m.states[m.current]
+	if !ok || state.action == nil {
+		return ErrNoAction
+	}
+	m.runAction(state)
+	return m.sendRaised()
+}
+
+// User returns the user the machine was created for. It is nil
+// if the scope of the machine is not tied to a user.
 func (m *Machine) User() *User {
 	return m.who
 }
 
+// ID returns the id the machine is stored under, see ScopeFunc.
+func (m *Machine) ID() string {
+	return m.id
+}
+
+// Bot returns the bot the machine belongs to, e.g. to tell
+// apart the bots of a Manager sharing the same handlers.
+func (m *Machine) Bot() *Bot {
+	return m.bot
+}
+
 func (m *Machine) Get() interface{} {
+	m.currentMu.RLock()
+	defer m.currentMu.RUnlock()
 	return m.ctx
 }
 
 func (m *Machine) Set(ctx interface{}) {
+	m.currentMu.Lock()
 	m.ctx = ctx
+	m.currentMu.Unlock()
+	m.save()
 }
 
 func (m *Machine) Current() StateType {
+	m.currentMu.RLock()
+	defer m.currentMu.RUnlock()
 	return m.current
 }
+
+// Snapshot returns the persisted form of the machine.
+func (m *Machine) Snapshot() (*Snapshot, error) {
+	m.currentMu.RLock()
+	snap := &Snapshot{State: m.current}
+	snap.Language = m.lang
+	if m.chat != nil {
+		snap.Chat = m.chat.ID
+	}
+	snap.Blocked = m.blocked
+	if len(m.seenIDs) > 0 {
+		snap.Seen = append([]int(nil), m.seenIDs...)
+	}
+	if len(m.outbox) > 0 {
+		snap.Outbox = append([]OutboxEntry(nil), m.outbox...)
+	}
+	for _, d := range m.deferred {
+		snap.Deferred = append(snap.Deferred, d.event)
+	}
+	if len(m.history) > 0 {
+		snap.History = append([]StateType(nil), m.history...)
+	}
+	if !m.deadline.IsZero() {
+		deadline := m.deadline
+		snap.Deadline = &deadline
+	}
+	snap.Scheduled = m.scheduledEvents()
+	session, ctx := m.session, m.ctx
+	m.currentMu.RUnlock()
+
+	if session != nil {
+		snap.Session = session.snapshot()
+	}
+	if ctx != nil {
+		data, err := json.Marshal(ctx)
+		if err != nil {
+			return nil, err
+		}
+		snap.Context = data
+	}
+	return snap, nil
+}
+
+// restore brings the machine into the snapshotted state.
+func (m *Machine) restore(snap *Snapshot, newCtx func() interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	known, err := m.restoreState(snap, newCtx)
+	if err != nil {
+		return err
+	}
+	for _, e := range snap.Scheduled {
+		m.scheduleEvent(e)
+	}
+	if known && snap.Deadline != nil {
+		m.schedule(*snap.Deadline)
+	}
+	return nil
+}
+
+// restoreState restores the snapshot but for the timers, and
+// reports whether the state of the snapshot is known.
+func (m *Machine) restoreState(snap *Snapshot, newCtx func() interface{}) (bool, error) {
+	ctx, err := decodeContext(snap.Context, newCtx)
+	if err != nil {
+		return false, err
+	}
+
+	m.currentMu.Lock()
+	m.ctx = ctx
+	m.lang = snap.Language
+	if snap.Chat != 0 {
+		m.chat = &Chat{ID: snap.Chat}
+	}
+	m.blocked = snap.Blocked
+	m.seenIDs = snap.Seen
+	if len(snap.Session) > 0 {
+		m.session = newSession(snap.Session)
+	}
+	for _, e := range snap.Deferred {
+		m.deferred = append(m.deferred, deferredEvent{event: e})
+	}
+	m.outbox = snap.Outbox
+	_, known := m.states[snap.State]
+	if known {
+		m.current = snap.State
+	}
+	m.currentMu.Unlock()
+
+	for _, t := range snap.History {
+		m.remember(t)
+	}
+	return known, nil
+}
+
+// save persists the machine and reports the error, for the
+// changes that have no caller to return it to.
+func (m *Machine) save() {
+	if err := m.persist(); err != nil && m.reporter != nil {
+		m.reporter(err)
+	}
+}
+
+// persist saves the machine to its store, if there is one. It is safe
+// with or without the mutex: the snapshot is taken under currentMu
+// and the saves are serialized.
+func (m *Machine) persist() error {
+	if m.store == nil {
+		return nil
+	}
+
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	if m.erased {
+		return nil
+	}
+	snap, err := m.Snapshot()
+	if err != nil {
+		return wrapError(err)
+	}
+	return m.store.Save(m.id, snap)
+}
@@ -0,0 +1,156 @@
+package stb
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachinePayload(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var got interface{}
+	b.Default("A").Event("b", "B")
+	b.State("B").Action(func(m *Machine) {
+		got = m.Payload()
+	})
+
+	m := b.machine(&User{ID: 1})
+	require.NoError(t, m.SendEvent("b", 42))
+	assert.Equal(t, 42, got)
+
+	require.NoError(t, m.Back())
+	assert.Nil(t, m.Payload())
+}
+
+func TestMachineUnknownState(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, HistorySize: 5})
+	require.NoError(t, err)
+
+	asked := 0
+	start := b.Default("A")
+	start.Event("lost", "Nowhere")
+	start.Event("ask", "Ask")
+	b.State("Ask").Action(func(*Machine) { asked++ })
+
+	m := b.machine(&User{ID: 1})
+	err = m.SendEvent("lost", 42)
+	assert.ErrorIs(t, err, ErrUnknownState)
+	assert.Contains(t, err.Error(), `"Nowhere"`)
+	assert.Equal(t, StateType("A"), m.Current())
+	assert.Nil(t, m.Payload())
+	assert.Empty(t, m.History())
+
+	assert.Equal(t, ErrNoAction, m.Repeat())
+	require.NoError(t, m.SendEvent("ask"))
+	require.NoError(t, m.Repeat())
+	assert.Equal(t, 2, asked)
+	assert.Equal(t, StateType("Ask"), m.Current())
+}
+
+func TestMachineOnTransition(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, HistorySize: 5})
+	require.NoError(t, err)
+
+	var got []string
+	b.Default("A").Event("next", "B")
+	b.State("B").Action(func(*Machine) { got = append(got, "action") })
+
+	m := b.machine(&User{ID: 1})
+	m.OnTransition(func(from, to StateType, e EventType) {
+		got = append(got, string(from)+" -"+string(e)+"-> "+string(to))
+	})
+
+	require.NoError(t, m.SendEvent("next"))
+	require.NoError(t, m.Back())
+	assert.Equal(t, ErrEventRejected, m.SendEvent("other"))
+
+	assert.Equal(t, []string{"A -next-> B", "action", "B --> A"}, got)
+}
+
+func TestMachineReenter(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, HistorySize: 5})
+	require.NoError(t, err)
+
+	var got []string
+	b.Default("A").Event("ask", "Ask")
+	ask := b.State("Ask")
+	ask.Event("retry", "Ask")
+	ask.Action(func(*Machine) { got = append(got, "ask") })
+
+	m := b.machine(&User{ID: 1})
+	m.OnTransition(func(from, to StateType, e EventType) {
+		got = append(got, string(e))
+	})
+
+	require.NoError(t, m.SendEvent("ask"))
+	require.NoError(t, m.SendEvent("retry"))
+	assert.Equal(t, []StateType{"A", "Ask"}, m.History())
+
+	ask.Reenter(false)
+	require.NoError(t, m.SendEvent("retry"))
+	assert.Equal(t, []StateType{"A", "Ask"}, m.History())
+	assert.Equal(t, StateType("Ask"), m.Current())
+
+	assert.Equal(t, []string{"ask", "ask", "retry", "ask", "retry"}, got)
+}
+
+func TestMachineDefer(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+
+	var paid interface{}
+	b.Defer("paid")
+	b.Default("Cart").Event("checkout", "Checkout")
+	b.State("Checkout").Event("paid", "Paid")
+	b.State("Paid").Action(func(m *Machine) { paid = m.Payload() })
+
+	m := b.machine(&User{ID: 1})
+	require.NoError(t, m.SendEvent("paid", 42))
+	assert.Equal(t, StateType("Cart"), m.Current())
+	assert.Equal(t, ErrEventRejected, m.SendEvent("other"))
+
+	snap, err := store.Load("1")
+	require.NoError(t, err)
+	assert.Equal(t, []EventType{"paid"}, snap.Deferred)
+
+	require.NoError(t, m.SendEvent("checkout"))
+	assert.Equal(t, StateType("Paid"), m.Current())
+	assert.Equal(t, 42, paid)
+
+	snap, err = store.Load("1")
+	require.NoError(t, err)
+	assert.Empty(t, snap.Deferred)
+}
+
+func TestMachineConcurrentPersist(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	m := b.machine(&User{ID: 1})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			m.Set(i)
+		}(i)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, m.SendEventAfter("later", time.Hour))
+		}()
+	}
+	wg.Wait()
+
+	snap, err := store.Load("1")
+	require.NoError(t, err)
+	assert.Len(t, snap.Scheduled, 10)
+	assert.NoError(t, m.CancelEvent("later"))
+}
@@ -0,0 +1,218 @@
+package stb
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// machineShards is the number of shards of the registry,
+// it keeps the lock contention low for bots with many users.
+const machineShards = 32
+
+// Machines is the registry of the machines of a bot.
+//
+// Machines are created on the first update of their user and,
+// if Settings.MachineTTL is set, evicted once they stay idle for
+// longer than that. Evicted machines are reloaded from the store
+// on their next update, without a store they start over.
+type Machines struct {
+	shards [machineShards]machineShard
+
+	create  func(id string, user *User) *Machine
+	store   Store
+	ttl     time.Duration
+	onEvict func(*Machine)
+
+	hooksMu   sync.Mutex
+	userHooks []userHook
+}
+
+type machineShard struct {
+	mu       sync.Mutex
+	machines map[string]*Machine
+
+	// loading are closed once the machines being
+	// created by obtain are in machines.
+	loading map[string]chan struct{}
+}
+
+func newMachines(create func(string, *User) *Machine, store Store, ttl time.Duration, onEvict func(*Machine)) *Machines {
+	ms := &Machines{create: create, store: store, ttl: ttl, onEvict: onEvict}
+	for i := range ms.shards {
+		ms.shards[i].machines = make(map[string]*Machine)
+		ms.shards[i].loading = make(map[string]chan struct{})
+	}
+	return ms
+}
+
+func (ms *Machines) shard(id string) *machineShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &ms.shards[h.Sum32()%machineShards]
+}
+
+// Get returns the machine with the given id, if it is loaded.
+func (ms *Machines) Get(id string) (*Machine, bool) {
+	shard := ms.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	m, ok := shard.machines[id]
+	return m, ok
+}
+
+// obtain returns the machine with the given id, creating it if needed.
+// The machine is created outside of the lock of the shard, as restoring
+// it loads the store, the other callers wanting it wait for it.
+func (ms *Machines) obtain(id string, user *User) *Machine {
+	shard := ms.shard(id)
+	for {
+		shard.mu.Lock()
+		if m, ok := shard.machines[id]; ok {
+			shard.mu.Unlock()
+			return m
+		}
+		loading, ok := shard.loading[id]
+		if !ok {
+			break
+		}
+		shard.mu.Unlock()
+		<-loading
+	}
+	loading := make(chan struct{})
+	shard.loading[id] = loading
+	shard.mu.Unlock()
+	defer func() {
+		shard.mu.Lock()
+		delete(shard.loading, id)
+		shard.mu.Unlock()
+		close(loading)
+	}()
+
+	m := ms.create(id, user)
+
+	shard.mu.Lock()
+	old, ok := shard.machines[id]
+	if !ok {
+		shard.machines[id] = m
+	}
+	shard.mu.Unlock()
+
+	if ok {
+		// imported while it was created
+		m.stopTimers()
+		return old
+	}
+	return m
+}
+
+// Delete unloads the machine with the given id. It does not
+// remove the machine from the store.
+func (ms *Machines) Delete(id string) {
+	shard := ms.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	delete(shard.machines, id)
+}
+
+// drop unloads the machine, unless another one was loaded since,
+// and reports whether it did.
+func (ms *Machines) drop(m *Machine) bool {
+	shard := ms.shard(m.id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if shard.machines[m.id] != m {
+		return false
+	}
+	delete(shard.machines, m.id)
+	return true
+}
+
+// Len returns the number of loaded machines.
+func (ms *Machines) Len() (n int) {
+	for i := range ms.shards {
+		shard := &ms.shards[i]
+		shard.mu.Lock()
+		n += len(shard.machines)
+		shard.mu.Unlock()
+	}
+	return n
+}
+
+// Range calls f for every loaded machine until f returns false.
+func (ms *Machines) Range(f func(m *Machine) bool) {
+	for i := range ms.shards {
+		shard := &ms.shards[i]
+		shard.mu.Lock()
+		machines := make([]*Machine, 0, len(shard.machines))
+		for _, m := range shard.machines {
+			machines = append(machines, m)
+		}
+		shard.mu.Unlock()
+
+		for _, m := range machines {
+			if !f(m) {
+				return
+			}
+		}
+	}
+}
+
+// evict unloads the machines idle since before the TTL and calls
+// the eviction callback for each of them. Machines waiting for
+// a state timeout, a scheduled event or to expire (see
+// State.ExpireAfter) are kept, so they still fire, as are the
+// ones with messages left in their outbox.
+func (ms *Machines) evict(now time.Time) {
+	if ms.ttl <= 0 {
+		return
+	}
+
+	// idle takes the lock of the machines, which may be held
+	// while the registry is used, so they are checked unlocked
+	var evicted []*Machine
+	ms.Range(func(m *Machine) bool {
+		if m.idle(now, ms.ttl) && ms.drop(m) {
+			evicted = append(evicted, m)
+		}
+		return true
+	})
+
+	if ms.onEvict != nil {
+		for _, m := range evicted {
+			ms.onEvict(m)
+		}
+	}
+}
+
+// janitor evicts idle machines until stop is closed.
+func (ms *Machines) janitor(stop chan struct{}) {
+	if ms.ttl <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(ms.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			ms.evict(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// idle reports whether the machine was last used before ttl and has
+// no pending timeout, scheduled event, expiry or outboxed message.
+func (m *Machine) idle(now time.Time, ttl time.Duration) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.deadline.IsZero() && len(m.scheduled) == 0 && !m.expiring() &&
+		!m.pending() && now.Sub(m.lastSeen) > ttl
+}
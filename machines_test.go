@@ -0,0 +1,78 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMachinesEvict(t *testing.T) {
+	var evicted []*Machine
+	b, err := NewBot(Settings{
+		Synchronous: true,
+		Offline:     true,
+		MachineTTL:  time.Minute,
+		OnEvict:     func(m *Machine) { evicted = append(evicted, m) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Default(Default)
+	b.State("Waiting").Timeout(time.Hour, Default)
+	b.Event("wait", "Waiting")
+
+	idle := b.machine(&User{ID: 1})
+	waiting := b.machine(&User{ID: 2})
+	assert.NoError(t, waiting.SendEvent("wait"))
+	assert.Same(t, idle, b.machine(&User{ID: 1}))
+	assert.Equal(t, 2, b.Machines().Len())
+
+	b.Machines().evict(time.Now())
+	assert.Equal(t, 2, b.Machines().Len())
+
+	b.Machines().evict(time.Now().Add(2 * time.Minute))
+	assert.Equal(t, []*Machine{idle}, evicted)
+	_, ok := b.Machines().Get("1")
+	assert.False(t, ok)
+	_, ok = b.Machines().Get("2")
+	assert.True(t, ok)
+
+	assert.NotSame(t, idle, b.machine(&User{ID: 1}))
+}
+
+// slowStore is a MemoryStore whose loads wait for release.
+type slowStore struct {
+	*MemoryStore
+	loading chan string
+	release chan struct{}
+}
+
+func (s *slowStore) Load(id string) (*Snapshot, error) {
+	s.loading <- id
+	<-s.release
+	return s.MemoryStore.Load(id)
+}
+
+func TestMachinesObtainUnlocked(t *testing.T) {
+	store := &slowStore{NewMemoryStore(), make(chan string, 2), make(chan struct{})}
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Default(Default)
+
+	got := make(chan *Machine, 2)
+	go func() { got <- b.machine(&User{ID: 1}) }()
+	assert.Equal(t, "1", <-store.loading)
+	go func() { got <- b.machine(&User{ID: 1}) }()
+
+	// the shard is not locked while the store loads
+	_, ok := b.Machines().Get("1")
+	assert.False(t, ok)
+
+	close(store.release)
+	first, second := <-got, <-got
+	assert.Same(t, first, second)
+	assert.Empty(t, store.loading)
+}
@@ -0,0 +1,250 @@
+package stb
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Manager runs several bots with the same states in one process,
+// e.g. the white-label bots of the tenants of a service. Every bot
+// is set up by the same function, has its own Me, machines and
+// Limiter, and keeps its machines in the shared Store under ids
+// prefixed with its own id.
+//
+// Example:
+//
+//     mgr := stb.NewManager(store, func(b *stb.Bot) error {
+//         return b.LoadDefinition(data, registry)
+//     })
+//
+//     for _, tenant := range tenants {
+//         pref := stb.Settings{
+//             Token:  tenant.Token,
+//             Poller: &stb.LongPoller{Timeout: 10 * time.Second},
+//         }
+//         if _, err := mgr.Add(pref); err != nil {
+//             log.Fatal(err)
+//         }
+//     }
+//     mgr.Start()
+//
+// Handlers reach the bot they run in with Machine.Bot.
+type Manager struct {
+	store Store
+	setup func(*Bot) error
+
+	mu      sync.Mutex
+	bots    map[string]*Bot
+	started bool
+	stopped chan struct{}
+	running sync.WaitGroup
+}
+
+// NewManager creates a manager keeping the machines of its
+// bots in the store, which may be nil, and setting up their
+// states with setup.
+func NewManager(store Store, setup func(*Bot) error) *Manager {
+	return &Manager{
+		store: store,
+		setup: setup,
+		bots:  make(map[string]*Bot),
+	}
+}
+
+// Add creates a bot with the settings, sets it up and starts
+// it if the manager is running. Unless set, the bot gets the
+// store of the manager and a Limiter of its own. It returns
+// an error if a bot with the same token was added already.
+func (mgr *Manager) Add(pref Settings) (*Bot, error) {
+	id := tokenID(pref.Token)
+
+	mgr.mu.Lock()
+	_, ok := mgr.bots[id]
+	mgr.mu.Unlock()
+	if ok {
+		return nil, errors.Errorf("stb: bot %s is managed already", id)
+	}
+
+	if pref.Store == nil && mgr.store != nil {
+		pref.Store = newPrefixedStore(mgr.store, id+"/")
+	}
+	if pref.Limiter == nil {
+		pref.Limiter = NewLimiter()
+	}
+
+	b, err := NewBot(pref)
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.setup(b); err != nil {
+		return nil, err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if _, ok := mgr.bots[id]; ok {
+		return nil, errors.Errorf("stb: bot %s is managed already", id)
+	}
+	mgr.bots[id] = b
+	if mgr.started {
+		mgr.start(b)
+	}
+	return b, nil
+}
+
+// Remove stops the bot with the id, the part of its token before
+// the colon, and forgets it. Its machines stay in the store.
+func (mgr *Manager) Remove(id string) {
+	mgr.mu.Lock()
+	b, ok := mgr.bots[id]
+	delete(mgr.bots, id)
+	started := mgr.started
+	mgr.mu.Unlock()
+
+	if ok && started {
+		b.Stop()
+	}
+}
+
+// Bot returns the bot with the id, the part of its token
+// before the colon.
+func (mgr *Manager) Bot(id string) (*Bot, bool) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	b, ok := mgr.bots[id]
+	return b, ok
+}
+
+// Bots returns the bots of the manager, sorted by id.
+func (mgr *Manager) Bots() []*Bot {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	ids := make([]string, 0, len(mgr.bots))
+	for id := range mgr.bots {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	bots := make([]*Bot, len(ids))
+	for i, id := range ids {
+		bots[i] = mgr.bots[id]
+	}
+	return bots
+}
+
+// Start starts all the bots and the ones added later.
+// Like Bot.Start, it blocks until the manager is stopped.
+func (mgr *Manager) Start() {
+	mgr.mu.Lock()
+	if mgr.started {
+		mgr.mu.Unlock()
+		panic("stb: manager started twice")
+	}
+	mgr.started = true
+	stopped := make(chan struct{})
+	mgr.stopped = stopped
+	for _, b := range mgr.bots {
+		mgr.start(b)
+	}
+	mgr.mu.Unlock()
+
+	<-stopped
+	mgr.running.Wait()
+}
+
+// Stop stops all the bots, see Bot.Stop, and makes Start return.
+func (mgr *Manager) Stop() {
+	mgr.mu.Lock()
+	if !mgr.started {
+		mgr.mu.Unlock()
+		return
+	}
+	mgr.started = false
+	defer close(mgr.stopped)
+	bots := make([]*Bot, 0, len(mgr.bots))
+	for _, b := range mgr.bots {
+		bots = append(bots, b)
+	}
+	mgr.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, b := range bots {
+		wg.Add(1)
+		go func(b *Bot) {
+			defer wg.Done()
+			b.Stop()
+		}(b)
+	}
+	wg.Wait()
+}
+
+// start runs the bot until it is stopped. The caller holds mu.
+func (mgr *Manager) start(b *Bot) {
+	mgr.running.Add(1)
+	go func() {
+		defer mgr.running.Done()
+		b.Start()
+	}()
+}
+
+// tokenID returns the id of the bot, the part of its token
+// before the colon.
+func tokenID(token string) string {
+	if i := strings.IndexByte(token, ':'); i >= 0 {
+		return token[:i]
+	}
+	return token
+}
+
+// prefixedStore keeps the machines of a managed bot
+// apart from the ones of the other bots.
+type prefixedStore struct {
+	Store
+	prefix string
+}
+
+// listingStore is a prefixedStore over a Lister.
+type listingStore struct {
+	*prefixedStore
+}
+
+// newPrefixedStore wraps the store, the wrapper is a Lister
+// only if the store is one.
+func newPrefixedStore(store Store, prefix string) Store {
+	s := &prefixedStore{Store: store, prefix: prefix}
+	if _, ok := store.(Lister); ok {
+		return listingStore{s}
+	}
+	return s
+}
+
+func (s *prefixedStore) Load(id string) (*Snapshot, error) {
+	return s.Store.Load(s.prefix + id)
+}
+
+func (s *prefixedStore) Save(id string, snap *Snapshot) error {
+	return s.Store.Save(s.prefix+id, snap)
+}
+
+func (s *prefixedStore) Delete(id string) error {
+	return s.Store.Delete(s.prefix + id)
+}
+
+// IDs returns the ids of the machines of the bot.
+func (s listingStore) IDs() ([]string, error) {
+	stored, err := s.Store.(Lister).IDs()
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, id := range stored {
+		if strings.HasPrefix(id, s.prefix) {
+			ids = append(ids, strings.TrimPrefix(id, s.prefix))
+		}
+	}
+	return ids, nil
+}
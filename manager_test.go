@@ -0,0 +1,70 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	store := NewMemoryStore()
+	handled := make(chan *Bot, 2)
+
+	mgr := NewManager(store, func(b *Bot) error {
+		b.Default(Default)
+		b.Handle(OnText, func(msg *Message, m *Machine) {
+			m.Session().Set("seen", true)
+			handled <- m.Bot()
+		})
+		return nil
+	})
+
+	first, second := newTestPoller(), newTestPoller()
+	a, err := mgr.Add(Settings{Token: "1:a", Offline: true, Poller: first})
+	require.NoError(t, err)
+	_, err = mgr.Add(Settings{Token: "1:a", Offline: true})
+	assert.Error(t, err)
+	assert.NotNil(t, a.limiter)
+
+	started := make(chan struct{})
+	go func() {
+		mgr.Start()
+		close(started)
+	}()
+
+	b, err := mgr.Add(Settings{Token: "2:b", Offline: true, Poller: second})
+	require.NoError(t, err)
+	assert.Equal(t, []*Bot{a, b}, mgr.Bots())
+
+	upd := Update{ID: 1, Message: &Message{Text: "hi", Sender: &User{ID: 7}, Chat: &Chat{ID: 7}}}
+	first.updates <- upd
+	assert.Equal(t, a, <-handled)
+	second.updates <- upd
+	assert.Equal(t, b, <-handled)
+
+	mgr.Stop()
+	<-started
+
+	ids, err := store.IDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1/7", "2/7"}, ids)
+
+	stored, err := b.store.(Lister).IDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"7"}, stored)
+
+	mgr.Remove("1")
+	_, ok := mgr.Bot("1")
+	assert.False(t, ok)
+}
+
+func TestPrefixedStore(t *testing.T) {
+	_, ok := newPrefixedStore(NewMemoryStore(), "1/").(Lister)
+	assert.True(t, ok)
+
+	// a store that can't list its machines
+	store := struct{ Store }{NewMemoryStore()}
+	_, ok = newPrefixedStore(store, "1/").(Lister)
+	assert.False(t, ok)
+}
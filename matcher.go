@@ -0,0 +1,100 @@
+package stb
+
+import "regexp"
+
+// MessageMatcher is an endpoint that matches messages by their
+// content instead of an exact string, see Regex and Filter.
+//
+// Matchers are tried in the order they were registered, after
+// commands and exact text endpoints and before OnCommand, OnText
+// and the media endpoints, unless registered with another
+// priority, see PriorityMatcher.
+type MessageMatcher interface {
+	Match(msg *Message) bool
+}
+
+// RegexEndpoint matches messages whose text, or caption
+// for media messages, matches a regular expression.
+type RegexEndpoint struct {
+	rx *regexp.Regexp
+}
+
+// Regex returns an endpoint matching the expression.
+// It panics if the expression can't be parsed.
+//
+// Example:
+//
+//     otp.Handle(stb.Regex(`^\d{6}$`), func(msg *stb.Message, m *stb.Machine) error {
+//         return m.SendEvent(Verify, msg.Text)
+//     })
+//
+func Regex(expr string) *RegexEndpoint {
+	return &RegexEndpoint{rx: regexp.MustCompile(expr)}
+}
+
+// Match implements MessageMatcher.
+func (e *RegexEndpoint) Match(msg *Message) bool {
+	return e.rx.MatchString(matchText(msg))
+}
+
+// Submatch returns the match of the expression and its
+// subexpressions in the message, nil if there is none.
+func (e *RegexEndpoint) Submatch(msg *Message) []string {
+	return e.rx.FindStringSubmatch(matchText(msg))
+}
+
+// FilterEndpoint matches messages the function returns true for.
+type FilterEndpoint func(*Message) bool
+
+// Filter returns an endpoint matching messages the function returns true for.
+//
+// Example:
+//
+//     upload.Handle(stb.Filter(func(msg *stb.Message) bool {
+//         return msg.Document != nil && msg.Document.MIME == "application/pdf"
+//     }), onPDF)
+//
+func Filter(f func(*Message) bool) FilterEndpoint {
+	return FilterEndpoint(f)
+}
+
+// Match implements MessageMatcher.
+func (f FilterEndpoint) Match(msg *Message) bool {
+	return f(msg)
+}
+
+// matchHandler is a handler registered for a MessageMatcher.
+type matchHandler struct {
+	matcher  MessageMatcher
+	handler  func(*Message, *Machine) error
+	priority int
+}
+
+// handleMatchers runs the handler of the first matcher the
+// message matches, if there is one. Matchers are kept sorted
+// by priority.
+func (s *State) handleMatchers(msg *Message, m *Machine) bool {
+	for _, h := range s.matchers {
+		if h.matcher.Match(msg) {
+			handler := h.handler
+			s.runHandler(matcherName(h.matcher), func(m *Machine) error { return handler(msg, m) })
+			return true
+		}
+	}
+	return false
+}
+
+// matcherName names the endpoint of a matcher for observers.
+func matcherName(matcher MessageMatcher) string {
+	if e, ok := matcher.(*RegexEndpoint); ok {
+		return "regex:" + e.rx.String()
+	}
+	return "filter"
+}
+
+func matchText(msg *Message) string {
+	if msg.Text != "" {
+		return msg.Text
+	}
+	return msg.Caption
+}
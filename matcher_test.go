@@ -0,0 +1,48 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateMatchers(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var got []string
+	code := Regex(`^(\d{3})-?(\d{3})$`)
+	s := b.Default(Default)
+	s.MustHandle(code, func(msg *Message, _ *Machine) {
+		got = append(got, "code "+code.Submatch(msg)[1])
+	})
+	s.MustHandle(Filter(func(msg *Message) bool {
+		return msg.Document != nil && msg.Document.MIME == "application/pdf"
+	}), func(msg *Message, _ *Machine) {
+		got = append(got, "pdf")
+	})
+	s.MustHandle("123456", func(*Message, *Machine) {
+		got = append(got, "exact")
+	})
+	s.MustHandle(OnText, func(msg *Message, _ *Machine) {
+		got = append(got, "text "+msg.Text)
+	})
+	s.MustHandle(OnDocument, func(*Message, *Machine) {
+		got = append(got, "document")
+	})
+	assert.Error(t, s.Handle(Regex(`x`), func(*Callback, *Machine) {}))
+
+	user := &User{ID: 1}
+	for _, msg := range []*Message{
+		{Sender: user, Text: "123-456"},
+		{Sender: user, Text: "123456"},
+		{Sender: user, Text: "12345"},
+		{Sender: user, Document: &Document{MIME: "application/pdf"}},
+		{Sender: user, Document: &Document{MIME: "image/png"}},
+	} {
+		b.ProcessUpdate(Update{Message: msg})
+	}
+
+	assert.Equal(t, []string{"code 123", "exact", "text 12345", "pdf", "document"}, got)
+}
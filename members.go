@@ -0,0 +1,164 @@
+package stb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Members caches the members of chats, so that handlers can tell
+// whether a user is an administrator of a chat without a getChatMember
+// round trip each time. It is fed by the chat_member and my_chat_member
+// updates the bot receives, which keep it current; members no update
+// told about are looked up once per TTL.
+//
+// Telegram sends chat_member updates only to the bots asking for them,
+// and only from the chats they administer: with Settings.Members set,
+// Bot.AllowedUpdates asks for them. Members is a RoleProvider too,
+// granting RoleAdmin like AdminRoles.
+//
+// Example:
+//
+//     members := stb.NewMembers(10 * time.Minute)
+//     b, _ := stb.NewBot(stb.Settings{Members: members, Roles: members})
+//
+//     b.Handle("/pin", func(msg *stb.Message, m *stb.Machine) error {
+//         admin, err := members.Admin(msg.Chat, msg.Sender)
+//         if err != nil || !admin {
+//             return err
+//         }
+//         return m.Bot().Pin(msg.ReplyTo)
+//     })
+//
+type Members struct {
+	bot *Bot
+	ttl time.Duration
+
+	mu    sync.Mutex
+	chats map[int64]map[int]cachedMember
+
+	// swept is when the expired members were last dropped.
+	swept time.Time
+}
+
+type cachedMember struct {
+	member  ChatMember
+	expires time.Time
+}
+
+// NewMembers creates a Members cache keeping members for ttl.
+func NewMembers(ttl time.Duration) *Members {
+	return &Members{
+		ttl:   ttl,
+		chats: make(map[int64]map[int]cachedMember),
+	}
+}
+
+func (c *Members) bind(b *Bot) {
+	c.mu.Lock()
+	c.bot = b
+	c.mu.Unlock()
+}
+
+// Member returns the user's membership of the chat, from the
+// cache or, when it does not know the user, from Telegram.
+func (c *Members) Member(chat *Chat, user *User) (*ChatMember, error) {
+	c.mu.Lock()
+	b := c.bot
+	cached, ok := c.chats[chat.ID][user.ID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		member := cached.member
+		return &member, nil
+	}
+	if b == nil {
+		return nil, errors.New("stb: members are not set on a bot")
+	}
+
+	member, err := b.ChatMemberOf(chat, user)
+	if err != nil {
+		return nil, err
+	}
+	c.store(chat.ID, member)
+	return member, nil
+}
+
+// Admin tells whether the user is the creator
+// or an administrator of the chat.
+func (c *Members) Admin(chat *Chat, user *User) (bool, error) {
+	member, err := c.Member(chat, user)
+	if err != nil {
+		return false, err
+	}
+	return member.Admin(), nil
+}
+
+// HasRole implements RoleProvider.
+func (c *Members) HasRole(user *User, chat *Chat, role string) (bool, error) {
+	if role != RoleAdmin || chat == nil || chat.Type == ChatPrivate {
+		return false, nil
+	}
+	return c.Admin(chat, user)
+}
+
+// Forget drops the cached members of the chat.
+func (c *Members) Forget(chat *Chat) {
+	c.mu.Lock()
+	delete(c.chats, chat.ID)
+	c.mu.Unlock()
+}
+
+// observe keeps the cache current with the chat member updates.
+// Once the bot itself leaves a chat, no update will tell about
+// its members anymore, so they are forgotten.
+func (c *Members) observe(upd Update) {
+	if u := upd.ChatMember; u != nil && u.NewChatMember != nil {
+		c.store(u.Chat.ID, u.NewChatMember)
+	}
+	if u := upd.MyChatMember; u != nil && u.NewChatMember != nil {
+		if u.NewChatMember.InChat() {
+			c.store(u.Chat.ID, u.NewChatMember)
+		} else {
+			c.Forget(&u.Chat)
+		}
+	}
+}
+
+func (c *Members) store(chat int64, member *ChatMember) {
+	if member.User == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.swept) >= c.ttl {
+		c.sweep(now)
+	}
+
+	members, ok := c.chats[chat]
+	if !ok {
+		members = make(map[int]cachedMember)
+		c.chats[chat] = members
+	}
+	members[member.User.ID] = cachedMember{member: *member, expires: now.Add(c.ttl)}
+}
+
+// sweep drops the expired members, once per TTL,
+// so that the cache doesn't grow with every user
+// ever seen. The caller must hold mu.
+func (c *Members) sweep(now time.Time) {
+	for chat, members := range c.chats {
+		for user, cached := range members {
+			if !now.Before(cached.expires) {
+				delete(members, user)
+			}
+		}
+		if len(members) == 0 {
+			delete(c.chats, chat)
+		}
+	}
+	c.swept = now
+}
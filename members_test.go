@@ -0,0 +1,74 @@
+package stb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMembers(t *testing.T) {
+	lookups := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		w.Write([]byte(`{"ok":true,"result":{"user":{"id":2},"status":"member"}}`))
+	}))
+	defer srv.Close()
+
+	members := NewMembers(time.Minute)
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL, Members: members})
+	require.NoError(t, err)
+	b.Default(Default)
+	assert.Contains(t, b.AllowedUpdates(), "chat_member")
+
+	chat := &Chat{ID: -100, Type: ChatSuperGroup}
+	admin, err := members.Admin(chat, &User{ID: 2})
+	require.NoError(t, err)
+	assert.False(t, admin)
+	_, err = members.Admin(chat, &User{ID: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 1, lookups)
+
+	// updates keep the cache current
+	b.ProcessUpdate(Update{ChatMember: &ChatMemberUpdated{
+		Chat:          *chat,
+		From:          User{ID: 1},
+		NewChatMember: &ChatMember{User: &User{ID: 2}, Role: Administrator},
+	}})
+	admin, err = members.HasRole(&User{ID: 2}, chat, RoleAdmin)
+	require.NoError(t, err)
+	assert.True(t, admin)
+	assert.Equal(t, 1, lookups)
+
+	// the bot leaving the chat forgets its members
+	b.ProcessUpdate(Update{MyChatMember: &ChatMemberUpdated{
+		Chat:          *chat,
+		From:          User{ID: 1},
+		NewChatMember: &ChatMember{User: &User{ID: 42}, Role: Left},
+	}})
+	_, err = members.Member(chat, &User{ID: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 2, lookups)
+}
+
+func TestMembersSweep(t *testing.T) {
+	members := NewMembers(time.Minute)
+	members.store(-1, &ChatMember{User: &User{ID: 1}})
+	members.store(-2, &ChatMember{User: &User{ID: 2}})
+
+	// once the members expired, the next store drops them
+	members.swept = time.Now().Add(-time.Hour)
+	for _, chat := range members.chats {
+		for id, cached := range chat {
+			cached.expires = time.Now().Add(-time.Second)
+			chat[id] = cached
+		}
+	}
+	members.store(-2, &ChatMember{User: &User{ID: 3}})
+
+	assert.Len(t, members.chats, 1)
+	assert.Len(t, members.chats[-2], 1)
+}
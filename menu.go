@@ -0,0 +1,145 @@
+package stb
+
+import (
+	"strconv"
+)
+
+// MenuItem is an entry of a Menu.
+type MenuItem struct {
+	// Label is the text of the item button.
+	Label string
+
+	// Value is the payload of the event sent when the item is chosen.
+	Value interface{}
+}
+
+// Menu is a paginated inline keyboard over a list of items. It
+// handles paging itself, editing the message in place, and sends
+// Event to the machine, with the chosen MenuItem as payload, once
+// an item is chosen.
+//
+// Example:
+//
+//     menu := shop.Menu("products", func(m *stb.Machine) []stb.MenuItem {
+//         return productItems()
+//     })
+//     menu.Event = "picked"
+//
+//     shop.Action(func(m *stb.Machine) {
+//         menu.Show(m.User(), m, "Pick a product")
+//     })
+//
+type Menu struct {
+	// PageSize is the number of items per page.
+	PageSize int // Default: 5
+
+	// Event is sent to the machine when an item is chosen.
+	Event EventType
+
+	// Prev and Next are the labels of the paging buttons.
+	Prev, Next string // Default: «, »
+
+	unique string
+	items  func(m *Machine) []MenuItem
+	state  *State
+}
+
+// Menu creates a menu handled by the state. The items are
+// listed anew for every page, the unique must be unique
+// among the callback endpoints of the state.
+func (s *State) Menu(unique string, items func(m *Machine) []MenuItem) *Menu {
+	menu := &Menu{
+		PageSize: 5,
+		Prev:     "«",
+		Next:     "»",
+		unique:   unique,
+		items:    items,
+		state:    s,
+	}
+
+	s.MustHandle(&Btn{Unique: unique + "-page"}, menu.page)
+	s.MustHandle(&Btn{Unique: unique + "-pick"}, menu.pick)
+	return menu
+}
+
+// Show sends the first page of the menu.
+func (menu *Menu) Show(to Recipient, m *Machine, what interface{}, options ...interface{}) (*Message, error) {
+	options = append(options, menu.Markup(m, 0))
+	return menu.state.bot.Send(to, what, options...)
+}
+
+// Markup returns the inline keyboard of the page.
+func (menu *Menu) Markup(m *Machine, page int) *ReplyMarkup {
+	items := menu.items(m)
+
+	size := menu.PageSize
+	if size <= 0 {
+		size = 5
+	}
+	pages := (len(items) + size - 1) / size
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	var rows []Row
+	for i := page * size; i < len(items) && i < (page+1)*size; i++ {
+		rows = append(rows, Row{{
+			Unique: menu.unique + "-pick",
+			Text:   items[i].Label,
+			Data:   strconv.Itoa(i),
+		}})
+	}
+
+	var nav Row
+	if page > 0 {
+		nav = append(nav, Btn{Unique: menu.unique + "-page", Text: menu.Prev, Data: strconv.Itoa(page - 1)})
+	}
+	if page < pages-1 {
+		nav = append(nav, Btn{Unique: menu.unique + "-page", Text: menu.Next, Data: strconv.Itoa(page + 1)})
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+
+	markup := &ReplyMarkup{}
+	markup.Inline(rows...)
+	return markup
+}
+
+func (menu *Menu) page(c *Callback, m *Machine) error {
+	bot := menu.state.bot
+	if err := bot.Respond(c); err != nil {
+		return err
+	}
+
+	page, err := strconv.Atoi(c.Data)
+	if err != nil {
+		return err
+	}
+	_, err = bot.EditReplyMarkup(c.Message, menu.Markup(m, page))
+	return err
+}
+
+func (menu *Menu) pick(c *Callback, m *Machine) error {
+	i, err := strconv.Atoi(c.Data)
+	if err != nil {
+		return err
+	}
+
+	items := menu.items(m)
+	if i < 0 || i >= len(items) {
+		// the items changed since the page was shown
+		return menu.state.bot.Respond(c)
+	}
+
+	if err := menu.state.bot.Respond(c); err != nil {
+		return err
+	}
+	if menu.Event == "" {
+		return nil
+	}
+	return m.SendEvent(menu.Event, items[i])
+}
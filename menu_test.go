@@ -0,0 +1,48 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMenu(t *testing.T) {
+	api := newFakeAPI(t, `{"message_id":1}`)
+	b, err := NewBot(api.Settings())
+	require.NoError(t, err)
+
+	items := []MenuItem{{"a", 1}, {"b", 2}, {"c", 3}}
+	shop := b.Default(Default)
+	shop.Event("picked", "Picked")
+	b.State("Picked")
+
+	menu := shop.Menu("items", func(*Machine) []MenuItem { return items })
+	menu.PageSize = 2
+	menu.Event = "picked"
+
+	markup := menu.Markup(nil, 0)
+	require.Len(t, markup.InlineKeyboard, 3)
+	assert.Equal(t, "a", markup.InlineKeyboard[0][0].Text)
+	assert.Equal(t, []InlineButton{{Unique: "items-page", Text: "»", Data: "1"}}, markup.InlineKeyboard[2])
+
+	markup = menu.Markup(nil, 1)
+	require.Len(t, markup.InlineKeyboard, 2)
+	assert.Equal(t, "c", markup.InlineKeyboard[0][0].Text)
+	assert.Equal(t, "«", markup.InlineKeyboard[1][0].Text)
+
+	menu.PageSize = 0
+	markup = menu.Markup(nil, 0)
+	assert.Len(t, markup.InlineKeyboard, 3)
+	menu.PageSize = 2
+
+	user := &User{ID: 1}
+	msg := &Message{ID: 1, Chat: &Chat{ID: 1}}
+	b.ProcessUpdate(Update{Callback: &Callback{Sender: user, Message: msg, Data: "\fitems-page|1"}})
+	b.ProcessUpdate(Update{Callback: &Callback{Sender: user, Message: msg, Data: "\fitems-pick|2"}})
+
+	m := b.machine(user)
+	assert.Equal(t, StateType("Picked"), m.Current())
+	assert.Equal(t, items[2], m.Payload())
+	assert.Equal(t, []string{"answerCallbackQuery", "editMessageReplyMarkup", "answerCallbackQuery"}, api.Methods())
+}
@@ -57,6 +57,10 @@ type Message struct {
 	// (Optional) Time of last edit in Unix
 	LastEdit int64 `json:"edit_date"`
 
+	// IsEdited is set on edited messages by the bot,
+	// see Settings.RouteEdits.
+	IsEdited bool `json:"-"`
+
 	// AlbumID is the unique identifier of a media message group
 	// this message belongs to.
 	AlbumID string `json:"media_group_id"`
@@ -209,12 +213,40 @@ type Message struct {
 	// if it is itself a reply.
 	PinnedMessage *Message `json:"pinned_message"`
 
+	// (Optional) Unique identifier of the forum topic the message belongs to.
+	ThreadID int `json:"message_thread_id"`
+
+	// True, if the message is sent to a forum topic.
+	TopicMessage bool `json:"is_topic_message"`
+
+	// Service messages about forum topics.
+	TopicCreated  *TopicCreated  `json:"forum_topic_created"`
+	TopicEdited   *TopicEdited   `json:"forum_topic_edited"`
+	TopicClosed   *TopicClosed   `json:"forum_topic_closed"`
+	TopicReopened *TopicReopened `json:"forum_topic_reopened"`
+
+	// Unique identifier of the business connection the message was
+	// received from or sent on behalf of.
+	BusinessConnectionID string `json:"business_connection_id"`
+
+	// The bot that actually sent the message on behalf of the business account.
+	SenderBusinessBot *User `json:"sender_business_bot"`
+
+	// Data sent by a Web App.
+	WebAppData *WebAppData `json:"web_app_data"`
+
 	// Message is an invoice for a payment.
 	Invoice *Invoice `json:"invoice"`
 
 	// Message is a service message about a successful payment.
 	Payment *Payment `json:"successful_payment"`
 
+	// Message is a service message about a refunded payment.
+	RefundedPayment *RefundedPayment `json:"refunded_payment"`
+
+	// Message contains paid media.
+	PaidMedia *PaidMediaInfo `json:"paid_media"`
+
 	// The domain name of the website on which the user has logged in.
 	ConnectedWebsite string `json:"connected_website,omitempty"`
 
@@ -267,6 +299,9 @@ type MessageEntity struct {
 
 	// (Optional) For EntityCodeBlock entity type only.
 	Language string `json:"language,omitempty"`
+
+	// (Optional) For EntityCustomEmoji entity type only.
+	CustomEmojiID string `json:"custom_emoji_id,omitempty"`
 }
 
 // MessageSig satisfies Editable interface (see Editable.)
@@ -0,0 +1,329 @@
+// Package metrics collects metrics of a bot for Prometheus.
+//
+// Example:
+//
+//		collector := metrics.New(metrics.Options{Namespace: "mybot"})
+//
+//		b, err := stb.NewBot(stb.Settings{
+//			Token:    "TOKEN_HERE",
+//			Observer: collector,
+//		})
+//		collector.Watch(b)
+//
+//		http.Handle("/metrics", collector)
+//
+// The collector is a prometheus.Collector as well, to be registered
+// along with the other metrics of the process:
+//
+//		prometheus.MustRegister(collector)
+//
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exp625/stb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// DefaultBuckets are the upper bounds of the latency
+// histograms in seconds, like those of Prometheus.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Options configures a Collector.
+type Options struct {
+	// Namespace prefixes the names of the metrics.
+	Namespace string // Default: "stb"
+
+	// Buckets are the upper bounds of the latency histograms.
+	Buckets []float64 // Default: DefaultBuckets
+}
+
+// Collector is a stb.Observer counting updates, handler calls,
+// transitions, rejected events and API requests. It implements
+// prometheus.Collector, and serves its own metrics over HTTP.
+type Collector struct {
+	registry *prometheus.Registry
+
+	mu          sync.Mutex
+	updates     *counter
+	handlers    *histogram
+	handlerErrs *counter
+	transitions *counter
+	rejected    *counter
+	api         *histogram
+	apiErrs     *counter
+
+	machines     func() int
+	machinesDesc *prometheus.Desc
+}
+
+// New creates a Collector.
+func New(opts Options) *Collector {
+	if opts.Namespace == "" {
+		opts.Namespace = "stb"
+	}
+	if opts.Buckets == nil {
+		opts.Buckets = DefaultBuckets
+	}
+
+	ns := opts.Namespace
+	c := &Collector{
+		registry:     prometheus.NewRegistry(),
+		updates:      newCounter(ns, "updates_total", "Updates received by type.", "type"),
+		handlers:     newHistogram(ns, "handler_duration_seconds", "Handler latency by state and endpoint.", opts.Buckets, "state", "endpoint"),
+		handlerErrs:  newCounter(ns, "handler_errors_total", "Handler errors by state and endpoint.", "state", "endpoint"),
+		transitions:  newCounter(ns, "transitions_total", "State transitions of machines.", "from", "to"),
+		rejected:     newCounter(ns, "rejected_events_total", "Events rejected by machines.", "state", "event"),
+		api:          newHistogram(ns, "api_request_duration_seconds", "Bot API request latency by method.", opts.Buckets, "method"),
+		apiErrs:      newCounter(ns, "api_errors_total", "Failed Bot API requests by method and error code.", "method", "code"),
+		machinesDesc: prometheus.NewDesc(ns+"_machines", "Machines loaded in memory.", nil, nil),
+	}
+	c.registry.MustRegister(c)
+	return c
+}
+
+// Watch reports the number of loaded machines of the bot.
+func (c *Collector) Watch(b *stb.Bot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.machines = b.Machines().Len
+}
+
+// ObserveUpdate implements stb.Observer.
+func (c *Collector) ObserveUpdate(upd stb.Update) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updates.inc(stb.UpdateType(upd))
+}
+
+// ObserveHandler implements stb.Observer.
+func (c *Collector) ObserveHandler(state stb.StateType, endpoint string, took time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	end := endpointLabel(endpoint)
+	c.handlers.observe(took.Seconds(), string(state), end)
+	if err != nil {
+		c.handlerErrs.inc(string(state), end)
+	}
+}
+
+// ObserveTransition implements stb.Observer.
+func (c *Collector) ObserveTransition(from, to stb.StateType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transitions.inc(string(from), string(to))
+}
+
+// ObserveRejected implements stb.Observer.
+func (c *Collector) ObserveRejected(state stb.StateType, event stb.EventType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rejected.inc(string(state), string(event))
+}
+
+// ObserveAPI implements stb.Observer.
+func (c *Collector) ObserveAPI(method string, took time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.api.observe(took.Seconds(), method)
+	if err != nil {
+		c.apiErrs.inc(method, errorCode(err))
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range []*counter{c.updates, &c.handlers.counter, c.handlerErrs, c.transitions, c.rejected, &c.api.counter, c.apiErrs} {
+		ch <- m.desc
+	}
+	ch <- c.machinesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.updates.collect(ch)
+	c.handlers.collect(ch)
+	c.handlerErrs.collect(ch)
+	c.transitions.collect(ch)
+	c.rejected.collect(ch)
+	c.api.collect(ch)
+	c.apiErrs.collect(ch)
+
+	if c.machines != nil {
+		ch <- prometheus.MustNewConstMetric(c.machinesDesc, prometheus.GaugeValue, float64(c.machines()))
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	families, err := c.registry.Gather()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		n   int64
+		enc = expfmt.NewEncoder(&countingWriter{w: w, n: &n}, expfmt.FmtText)
+	)
+	for _, family := range families {
+		if err := enc.Encode(family); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// countingWriter counts the bytes written for WriteTo.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
+
+// endpointLabel makes endpoints readable: "\atext" becomes
+// "text", the "\funique" of a callback "callback:unique".
+func endpointLabel(end string) string {
+	switch {
+	case end == "":
+		return "action"
+	case end[0] == '\a':
+		return end[1:]
+	case end[0] == '\f':
+		return "callback:" + end[1:]
+	}
+	return end
+}
+
+// errorCode returns the code of an API error, "network" otherwise.
+func errorCode(err error) string {
+	switch e := cause(err).(type) {
+	case *stb.APIError:
+		return strconv.Itoa(e.Code)
+	case stb.FloodError:
+		return strconv.Itoa(e.Code)
+	}
+	return "network"
+}
+
+func cause(err error) error {
+	type causer interface {
+		Cause() error
+	}
+	for {
+		c, ok := err.(causer)
+		if !ok {
+			return err
+		}
+		err = c.Cause()
+	}
+}
+
+type series struct {
+	labels []string
+	value  float64
+
+	// histograms only
+	buckets []uint64
+	count   uint64
+}
+
+type counter struct {
+	desc   *prometheus.Desc
+	series map[string]*series
+}
+
+func newCounter(ns, name, help string, labels ...string) *counter {
+	return &counter{
+		desc:   prometheus.NewDesc(ns+"_"+name, help, labels, nil),
+		series: make(map[string]*series),
+	}
+}
+
+func (c *counter) inc(values ...string) {
+	key := strings.Join(values, "\xff")
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{labels: values}
+		c.series[key] = s
+	}
+	s.value++
+}
+
+func (c *counter) collect(ch chan<- prometheus.Metric) {
+	for _, s := range sorted(c.series) {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, s.value, s.labels...)
+	}
+}
+
+type histogram struct {
+	counter
+	bounds []float64
+}
+
+func newHistogram(ns, name, help string, bounds []float64, labels ...string) *histogram {
+	return &histogram{counter: *newCounter(ns, name, help, labels...), bounds: bounds}
+}
+
+func (h *histogram) observe(v float64, values ...string) {
+	key := strings.Join(values, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &series{labels: values, buckets: make([]uint64, len(h.bounds))}
+		h.series[key] = s
+	}
+	for i, bound := range h.bounds {
+		if v <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.value += v
+	s.count++
+}
+
+func (h *histogram) collect(ch chan<- prometheus.Metric) {
+	for _, s := range sorted(h.series) {
+		buckets := make(map[float64]uint64, len(h.bounds))
+		for i, bound := range h.bounds {
+			buckets[bound] = s.buckets[i]
+		}
+		ch <- prometheus.MustNewConstHistogram(h.desc, s.count, s.value, buckets, s.labels...)
+	}
+}
+
+func sorted(m map[string]*series) []*series {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]*series, len(keys))
+	for i, key := range keys {
+		list[i] = m[key]
+	}
+	return list
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exp625/stb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+	}))
+	defer srv.Close()
+
+	c := New(Options{Buckets: []float64{1}})
+	b, err := stb.NewBot(stb.Settings{Synchronous: true, Offline: true, URL: srv.URL, Observer: c})
+	require.NoError(t, err)
+	c.Watch(b)
+
+	start := b.Default(stb.Default)
+	start.Event("start", "Menu")
+	start.MustHandle("/start", func(msg *stb.Message, m *stb.Machine) error {
+		if err := m.SendEvent("start"); err != nil {
+			return err
+		}
+		return m.SendEvent("start")
+	})
+	b.State("Menu").MustHandle(stb.OnText, func(msg *stb.Message, m *stb.Machine) error {
+		_, err := m.Send("hi")
+		return err
+	})
+
+	user := &stb.User{ID: 1}
+	b.ProcessUpdate(stb.Update{Message: &stb.Message{Sender: user, Text: "/start"}})
+	b.ProcessUpdate(stb.Update{Message: &stb.Message{Sender: user, Text: "hello"}})
+	b.ProcessUpdate(stb.Update{Callback: &stb.Callback{Sender: user}})
+
+	var sb strings.Builder
+	_, err = c.WriteTo(&sb)
+	require.NoError(t, err)
+	out := sb.String()
+
+	for _, line := range []string{
+		`stb_updates_total{type="message"} 2`,
+		`stb_updates_total{type="callback_query"} 1`,
+		`stb_handler_duration_seconds_count{endpoint="/start",state="Default"} 1`,
+		`stb_handler_duration_seconds_bucket{endpoint="text",state="Menu",le="+Inf"} 1`,
+		`stb_handler_errors_total{endpoint="/start",state="Default"} 1`,
+		`stb_handler_errors_total{endpoint="text",state="Menu"} 1`,
+		`stb_transitions_total{from="Default",to="Menu"} 1`,
+		`stb_rejected_events_total{event="start",state="Menu"} 1`,
+		`stb_api_request_duration_seconds_count{method="sendMessage"} 1`,
+		`stb_api_errors_total{code="400",method="sendMessage"} 1`,
+		`stb_machines 1`,
+		`# TYPE stb_handler_duration_seconds histogram`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+}
+
+func TestCollectorFormat(t *testing.T) {
+	c := New(Options{Namespace: "bot", Buckets: []float64{0.1, 1}})
+	c.ObserveHandler("A", "\fbtn", 500*time.Millisecond, nil)
+	c.ObserveHandler("A", "", 2*time.Second, errors.New("failed"))
+	c.ObserveAPI("getMe", time.Millisecond, errors.New("dial tcp: timeout"))
+	c.ObserveRejected("A", `say "hi"`)
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, `# HELP bot_api_errors_total Failed Bot API requests by method and error code.
+# TYPE bot_api_errors_total counter
+bot_api_errors_total{code="network",method="getMe"} 1
+# HELP bot_api_request_duration_seconds Bot API request latency by method.
+# TYPE bot_api_request_duration_seconds histogram
+bot_api_request_duration_seconds_bucket{method="getMe",le="0.1"} 1
+bot_api_request_duration_seconds_bucket{method="getMe",le="1"} 1
+bot_api_request_duration_seconds_bucket{method="getMe",le="+Inf"} 1
+bot_api_request_duration_seconds_sum{method="getMe"} 0.001
+bot_api_request_duration_seconds_count{method="getMe"} 1
+# HELP bot_handler_duration_seconds Handler latency by state and endpoint.
+# TYPE bot_handler_duration_seconds histogram
+bot_handler_duration_seconds_bucket{endpoint="action",state="A",le="0.1"} 0
+bot_handler_duration_seconds_bucket{endpoint="action",state="A",le="1"} 0
+bot_handler_duration_seconds_bucket{endpoint="action",state="A",le="+Inf"} 1
+bot_handler_duration_seconds_sum{endpoint="action",state="A"} 2
+bot_handler_duration_seconds_count{endpoint="action",state="A"} 1
+bot_handler_duration_seconds_bucket{endpoint="callback:btn",state="A",le="0.1"} 0
+bot_handler_duration_seconds_bucket{endpoint="callback:btn",state="A",le="1"} 1
+bot_handler_duration_seconds_bucket{endpoint="callback:btn",state="A",le="+Inf"} 1
+bot_handler_duration_seconds_sum{endpoint="callback:btn",state="A"} 0.5
+bot_handler_duration_seconds_count{endpoint="callback:btn",state="A"} 1
+# HELP bot_handler_errors_total Handler errors by state and endpoint.
+# TYPE bot_handler_errors_total counter
+bot_handler_errors_total{endpoint="action",state="A"} 1
+# HELP bot_rejected_events_total Events rejected by machines.
+# TYPE bot_rejected_events_total counter
+bot_rejected_events_total{event="say \"hi\"",state="A"} 1
+`, rec.Body.String())
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	// the collector joins the other metrics of the process
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(c))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	assert.Len(t, families, 5)
+}
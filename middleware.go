@@ -0,0 +1,67 @@
+package stb
+
+// UpdateHandler processes a single update.
+type UpdateHandler func(Update)
+
+// MiddlewareFunc wraps an UpdateHandler with extra behaviour.
+// A middleware may inspect or modify the update, call next
+// to pass it on, or not call next to drop it.
+type MiddlewareFunc func(next UpdateHandler) UpdateHandler
+
+// Use adds middleware to the bot. Middleware runs before the update
+// is routed to a state, in the order it was added.
+//
+// Example:
+//
+//     b.Use(func(next stb.UpdateHandler) stb.UpdateHandler {
+//         return func(upd stb.Update) {
+//             start := time.Now()
+//             next(upd)
+//             log.Println(upd.ID, time.Since(start))
+//         }
+//     })
+//
+func (b *Bot) Use(middleware ...MiddlewareFunc) {
+	b.middleware = append(b.middleware, middleware...)
+}
+
+// Use adds middleware to the state. It runs after the bot's middleware
+// for every update routed to the state, before the state's handlers.
+//
+// A middleware that does not call next consumes the update: neither
+// the parent states nor the global handlers will see it.
+//
+// Example:
+//
+//     admin.Use(func(next stb.UpdateHandler) stb.UpdateHandler {
+//         return func(upd stb.Update) {
+//             if upd.Message != nil && !upd.Message.Private() {
+//                 return
+//             }
+//             next(upd)
+//         }
+//     })
+//
+func (s *State) Use(middleware ...MiddlewareFunc) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// dispatch runs the update through the state's middleware
+// and handlers. It reports whether the update was consumed.
+func (s *State) dispatch(upd Update, m *Machine) bool {
+	if len(s.middleware) == 0 {
+		return s.processUpdate(upd, m)
+	}
+
+	var called, handled bool
+	handler := UpdateHandler(func(upd Update) {
+		called = true
+		handled = s.processUpdate(upd, m)
+	})
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		handler = s.middleware[i](handler)
+	}
+	handler(upd)
+
+	return !called || handled
+}
@@ -0,0 +1,73 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotUse(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	var got []string
+	trace := func(name string) MiddlewareFunc {
+		return func(next UpdateHandler) UpdateHandler {
+			return func(upd Update) {
+				got = append(got, name)
+				next(upd)
+			}
+		}
+	}
+	b.Use(trace("first"), trace("second"))
+	b.Use(func(next UpdateHandler) UpdateHandler {
+		return func(upd Update) {
+			if upd.ID != 0 {
+				next(upd)
+			}
+		}
+	})
+
+	b.Handle(OnText, func(*Message, *Machine) {
+		got = append(got, "handler")
+	})
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{ID: 1, Message: &Message{Text: "hi", Sender: user}})
+	b.ProcessUpdate(Update{ID: 0, Message: &Message{Text: "hi", Sender: user}})
+
+	assert.Equal(t, []string{"first", "second", "handler", "first", "second"}, got)
+}
+
+func TestStateUse(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var got []string
+	private := b.Default(Default)
+	private.Use(func(next UpdateHandler) UpdateHandler {
+		return func(upd Update) {
+			if upd.Message.Private() {
+				next(upd)
+			}
+		}
+	})
+	private.Handle(OnText, func(*Message, *Machine) {
+		got = append(got, "state")
+	})
+	b.Handle(OnText, func(*Message, *Machine) {
+		got = append(got, "global")
+	})
+	b.Handle(OnPhoto, func(*Message, *Machine) {
+		got = append(got, "global photo")
+	})
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{Message: &Message{Text: "hi", Sender: user, Chat: &Chat{Type: ChatPrivate}}})
+	b.ProcessUpdate(Update{Message: &Message{Text: "hi", Sender: user, Chat: &Chat{Type: ChatGroup}}})
+	b.ProcessUpdate(Update{Message: &Message{Photo: &Photo{}, Sender: user, Chat: &Chat{Type: ChatPrivate}}})
+
+	assert.Equal(t, []string{"state", "global photo"}, got)
+}
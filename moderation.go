@@ -0,0 +1,117 @@
+package stb
+
+import "time"
+
+// moderated returns the chat the moderation helpers act on
+// and the user they target, the machine's user if nil.
+func (m *Machine) moderated(user *User) (*Chat, *User, error) {
+	chat := m.Chat()
+	if chat == nil {
+		return nil, nil, ErrBadRecipient
+	}
+	if user == nil {
+		user = m.User()
+	}
+	if user == nil {
+		return nil, nil, ErrBadRecipient
+	}
+	return chat, user, nil
+}
+
+// until converts a duration into the until date of Telegram,
+// zero meaning forever.
+func until(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return time.Now().Add(d).Unix()
+}
+
+// Member returns the member of the chat of the machine (see
+// Machine.Chat) the user is, the machine's user if nil.
+func (m *Machine) Member(user *User) (*ChatMember, error) {
+	chat, user, err := m.moderated(user)
+	if err != nil {
+		return nil, err
+	}
+	span := m.trace("stb.member")
+	member, err := m.bot.ChatMemberOf(chat, user)
+	span.End(err)
+	return member, err
+}
+
+// Ban bans the user, the machine's user if nil, from the chat of
+// the machine for d, or forever if d is zero. Telegram considers
+// bans shorter than 30 seconds or longer than 366 days as forever.
+//
+// Example:
+//
+//     b.Handle("/ban", func(m *stb.Message, mc *stb.Machine) {
+//         if m.ReplyTo != nil {
+//             mc.Ban(m.ReplyTo.Sender, 24*time.Hour)
+//         }
+//     })
+//
+func (m *Machine) Ban(user *User, d time.Duration) error {
+	chat, user, err := m.moderated(user)
+	if err != nil {
+		return err
+	}
+	span := m.trace("stb.ban")
+	err = m.bot.Ban(chat, &ChatMember{User: user, RestrictedUntil: until(d)})
+	span.End(err)
+	return err
+}
+
+// Unban lifts the ban of the user, the machine's user if nil, from
+// the chat of the machine. Members that are not banned are left alone.
+func (m *Machine) Unban(user *User) error {
+	chat, user, err := m.moderated(user)
+	if err != nil {
+		return err
+	}
+	span := m.trace("stb.unban")
+	err = m.bot.Unban(chat, user, true)
+	span.End(err)
+	return err
+}
+
+// Restrict limits the user, the machine's user if nil, to the rights
+// in the chat of the machine for d, or forever if d is zero.
+// Restrict with NoRestrictions() lifts the restrictions.
+func (m *Machine) Restrict(user *User, rights Rights, d time.Duration) error {
+	chat, user, err := m.moderated(user)
+	if err != nil {
+		return err
+	}
+	span := m.trace("stb.restrict")
+	err = m.bot.Restrict(chat, &ChatMember{User: user, Rights: rights, RestrictedUntil: until(d)})
+	span.End(err)
+	return err
+}
+
+// Promote sets the admin rights of the user, the machine's user if
+// nil, in the chat of the machine. Promote with NoRights() demotes.
+func (m *Machine) Promote(user *User, rights Rights) error {
+	chat, user, err := m.moderated(user)
+	if err != nil {
+		return err
+	}
+	span := m.trace("stb.promote")
+	err = m.bot.Promote(chat, &ChatMember{User: user, Rights: rights})
+	span.End(err)
+	return err
+}
+
+// SetPermissions sets the default rights of the members of the chat
+// of the machine, see Bot.SetGroupPermissions.
+func (m *Machine) SetPermissions(rights Rights) error {
+	chat := m.Chat()
+	if chat == nil {
+		return ErrBadRecipient
+	}
+	span := m.trace("stb.permissions")
+	err := m.bot.SetGroupPermissions(chat, rights)
+	span.End(err)
+	return err
+}
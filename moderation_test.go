@@ -0,0 +1,74 @@
+package stb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineModeration(t *testing.T) {
+	calls := make(map[string]map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndexByte(r.URL.Path, '/')+1:]
+		var params map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+		calls[method] = make(map[string]string)
+		for k, v := range params {
+			calls[method][k] = fmt.Sprint(v)
+		}
+
+		if method == "getChatMember" {
+			w.Write([]byte(`{"ok":true,"result":{"user":{"id":2},"status":"restricted","is_member":true,"until_date":1700000000,"can_send_messages":false}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+
+	m := b.machine(&User{ID: 1})
+	assert.Equal(t, ErrBadRecipient, m.Ban(nil, 0))
+	assert.Equal(t, ErrBadRecipient, m.SetPermissions(NoRights()))
+
+	m.currentMu.Lock()
+	m.chat = &Chat{ID: -100, Type: ChatSuperGroup}
+	m.currentMu.Unlock()
+
+	require.NoError(t, m.Ban(nil, 0))
+	assert.Equal(t, "-100", calls["kickChatMember"]["chat_id"])
+	assert.Equal(t, "1", calls["kickChatMember"]["user_id"])
+	assert.Equal(t, "0", calls["kickChatMember"]["until_date"])
+
+	require.NoError(t, m.Restrict(&User{ID: 2}, NoRights(), time.Hour))
+	assert.Equal(t, "2", calls["restrictChatMember"]["user_id"])
+	assert.NotEqual(t, "0", calls["restrictChatMember"]["until_date"])
+
+	require.NoError(t, m.Unban(&User{ID: 2}))
+	assert.Equal(t, "true", calls["unbanChatMember"]["only_if_banned"])
+
+	require.NoError(t, m.Promote(nil, AdminRights()))
+	assert.Equal(t, "1", calls["promoteChatMember"]["user_id"])
+
+	require.NoError(t, m.SetPermissions(NoRestrictions()))
+	assert.Equal(t, "-100", calls["setChatPermissions"]["chat_id"])
+
+	member, err := m.Member(&User{ID: 2})
+	require.NoError(t, err)
+	assert.Equal(t, Restricted, member.Role)
+	assert.False(t, member.Admin())
+	assert.True(t, member.InChat())
+	assert.Equal(t, time.Unix(1700000000, 0), member.Until())
+
+	assert.True(t, (&ChatMember{Role: Creator}).Admin())
+	assert.False(t, (&ChatMember{Role: Kicked}).InChat())
+	assert.True(t, (&ChatMember{Role: Kicked}).Until().IsZero())
+}
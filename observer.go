@@ -0,0 +1,96 @@
+package stb
+
+import "time"
+
+// Observer is notified about the work of a bot, e.g. to collect
+// metrics (see package metrics). Its methods are called from many
+// goroutines at once and must not block.
+type Observer interface {
+	// ObserveUpdate is called for every update before it is routed.
+	ObserveUpdate(upd Update)
+
+	// ObserveHandler is called once a handler returned. The
+	// endpoint of state actions is empty, panics are not observed.
+	ObserveHandler(state StateType, endpoint string, took time.Duration, err error)
+
+	// ObserveTransition is called when a machine enters a state.
+	ObserveTransition(from, to StateType)
+
+	// ObserveRejected is called when a machine rejects an event.
+	ObserveRejected(state StateType, event EventType)
+
+	// ObserveAPI is called after every request to the Bot API.
+	ObserveAPI(method string, took time.Duration, err error)
+}
+
+// UpdateType returns the type of an update as named by the
+// Bot API, like "message" or "callback_query".
+func UpdateType(upd Update) string {
+	switch {
+	case upd.Message != nil || upd.album != nil:
+		return "message"
+	case upd.EditedMessage != nil:
+		return "edited_message"
+	case upd.ChannelPost != nil:
+		return "channel_post"
+	case upd.EditedChannelPost != nil:
+		return "edited_channel_post"
+	case upd.Callback != nil:
+		return "callback_query"
+	case upd.Query != nil:
+		return "inline_query"
+	case upd.ChosenInlineResult != nil:
+		return "chosen_inline_result"
+	case upd.ShippingQuery != nil:
+		return "shipping_query"
+	case upd.PreCheckoutQuery != nil:
+		return "pre_checkout_query"
+	case upd.Poll != nil:
+		return "poll"
+	case upd.PollAnswer != nil:
+		return "poll_answer"
+	case upd.MyChatMember != nil:
+		return "my_chat_member"
+	case upd.ChatMember != nil:
+		return "chat_member"
+	case upd.ChatJoinRequest != nil:
+		return "chat_join_request"
+	case upd.MessageReaction != nil:
+		return "message_reaction"
+	case upd.MessageReactionCount != nil:
+		return "message_reaction_count"
+	case upd.PaidMediaPurchased != nil:
+		return "purchased_paid_media"
+	case upd.BusinessConnection != nil:
+		return "business_connection"
+	case upd.BusinessMessage != nil:
+		return "business_message"
+	case upd.EditedBusinessMessage != nil:
+		return "edited_business_message"
+	case upd.DeletedBusinessMessages != nil:
+		return "deleted_business_messages"
+	case upd.ChatBoost != nil:
+		return "chat_boost"
+	case upd.ChatBoostRemoved != nil:
+		return "removed_chat_boost"
+	}
+	return "unknown"
+}
+
+func (b *Bot) observeUpdate(upd Update) {
+	if b.observer != nil {
+		b.observer.ObserveUpdate(upd)
+	}
+}
+
+func (b *Bot) observeHandler(state StateType, end string, took time.Duration, err error) {
+	if b != nil && b.observer != nil {
+		b.observer.ObserveHandler(state, end, took, err)
+	}
+}
+
+func (b *Bot) observeAPI(method string, took time.Duration, err error) {
+	if b.observer != nil {
+		b.observer.ObserveAPI(method, took, err)
+	}
+}
@@ -26,6 +26,12 @@ const (
 
 	// OneTimeKeyboard = ReplyMarkup.OneTimeKeyboard
 	OneTimeKeyboard
+
+	// Protected = SendOptions.ProtectContent
+	Protected
+
+	// Split = SendOptions.Split
+	Split
 )
 
 // SendOptions has most complete control over in what way the message
@@ -56,6 +62,33 @@ type SendOptions struct {
 
 	// AllowWithoutReply allows sending messages not a as reply if the replied-to message has already been deleted.
 	AllowWithoutReply bool
+
+	// ThreadID is the forum topic to send the message to.
+	ThreadID int
+
+	// BusinessConnectionID sends the message on behalf
+	// of a connected business account.
+	BusinessConnectionID string
+
+	// ProtectContent protects the message from forwarding and saving.
+	ProtectContent bool
+
+	// ReplyParams describes the message to reply to, e.g. in another
+	// chat or quoting a part of it. It takes precedence over ReplyTo.
+	ReplyParams *ReplyParams
+
+	// LinkPreview controls the preview of the links in the text.
+	LinkPreview *PreviewOptions
+
+	// EffectID is the effect added to the message, in private chats only.
+	EffectID string
+
+	// Entities format the text instead of a parse mode, see fmtmsg.
+	Entities []MessageEntity
+
+	// Split sends long texts and captions in several messages,
+	// see Bot.SendSplit. Send returns the last one.
+	Split bool
 }
 
 func (og *SendOptions) copy() *SendOptions {
@@ -63,9 +96,53 @@ func (og *SendOptions) copy() *SendOptions {
 	if cp.ReplyMarkup != nil {
 		cp.ReplyMarkup = cp.ReplyMarkup.copy()
 	}
+	if cp.ReplyParams != nil {
+		params := *cp.ReplyParams
+		cp.ReplyParams = &params
+	}
+	if cp.LinkPreview != nil {
+		preview := *cp.LinkPreview
+		cp.LinkPreview = &preview
+	}
 	return &cp
 }
 
+// ReplyParams describes the message a message replies to.
+type ReplyParams struct {
+	// MessageID is the message to reply to.
+	MessageID int `json:"message_id"`
+
+	// (Optional) ChatID is the chat of the message,
+	// if it is not the chat the reply is sent to.
+	ChatID int64 `json:"chat_id,omitempty"`
+
+	// AllowWithoutReply sends the message even
+	// if the message to reply to is not found.
+	AllowWithoutReply bool `json:"allow_sending_without_reply,omitempty"`
+
+	// (Optional) Quote is the part of the message to quote,
+	// at QuotePosition in UTF-16 code units.
+	Quote          string    `json:"quote,omitempty"`
+	QuoteParseMode ParseMode `json:"quote_parse_mode,omitempty"`
+	QuotePosition  int       `json:"quote_position,omitempty"`
+}
+
+// PreviewOptions describes the preview of the links in a message.
+type PreviewOptions struct {
+	// Disabled disables the preview.
+	Disabled bool `json:"is_disabled,omitempty"`
+
+	// (Optional) URL is the link to preview,
+	// the first one in the text by default.
+	URL string `json:"url,omitempty"`
+
+	// SmallMedia and LargeMedia shrink or enlarge the media
+	// of the preview, AboveText shows it above the text.
+	SmallMedia bool `json:"prefer_small_media,omitempty"`
+	LargeMedia bool `json:"prefer_large_media,omitempty"`
+	AboveText  bool `json:"show_above_text,omitempty"`
+}
+
 // ReplyMarkup controls two convenient options for bot-user communications
 // such as reply keyboard and inline "keyboard" (a grid of buttons as a part
 // of the message).
@@ -110,6 +187,10 @@ type ReplyMarkup struct {
 	// 2) If the bot's message is a reply (has SendOptions.ReplyTo),
 	//       sender of the original message.
 	Selective bool `json:"selective,omitempty"`
+
+	// Placeholder is shown in the input field while the
+	// keyboard is shown or a reply is forced.
+	Placeholder string `json:"input_field_placeholder,omitempty"`
 }
 
 func (r *ReplyMarkup) copy() *ReplyMarkup {
@@ -142,9 +223,10 @@ func (r *ReplyMarkup) copy() *ReplyMarkup {
 type ReplyButton struct {
 	Text string `json:"text"`
 
-	Contact  bool     `json:"request_contact,omitempty"`
-	Location bool     `json:"request_location,omitempty"`
-	Poll     PollType `json:"request_poll,omitempty"`
+	Contact  bool        `json:"request_contact,omitempty"`
+	Location bool        `json:"request_location,omitempty"`
+	Poll     PollType    `json:"request_poll,omitempty"`
+	WebApp   *WebAppInfo `json:"web_app,omitempty"`
 }
 
 // InlineKeyboardMarkup represents an inline keyboard that appears
@@ -252,6 +334,10 @@ func (r *ReplyMarkup) Login(text string, login *Login) Btn {
 	return Btn{Login: login, Text: text}
 }
 
+func (r *ReplyMarkup) WebApp(text string, app *WebAppInfo) Btn {
+	return Btn{WebApp: app, Text: text}
+}
+
 // Btn is a constructor button, which will later become either a reply, or an inline button.
 type Btn struct {
 	Unique          string
@@ -264,6 +350,7 @@ type Btn struct {
 	Location        bool
 	Poll            PollType
 	Login           *Login
+	WebApp          *WebAppInfo
 }
 
 func (b Btn) Inline() *InlineButton {
@@ -275,6 +362,7 @@ func (b Btn) Inline() *InlineButton {
 		InlineQuery:     b.InlineQuery,
 		InlineQueryChat: b.InlineQueryChat,
 		Login:           b.Login,
+		WebApp:          b.WebApp,
 	}
 }
 
@@ -288,5 +376,6 @@ func (b Btn) Reply() *ReplyButton {
 		Contact:  b.Contact,
 		Location: b.Location,
 		Poll:     b.Poll,
+		WebApp:   b.WebApp,
 	}
 }
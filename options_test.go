@@ -62,3 +62,29 @@ func TestOptions(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, []byte(`{"type":"quiz"}`), data)
 }
+
+func TestEmbedSendOptions(t *testing.T) {
+	b, err := NewBot(Settings{Offline: true})
+	require.NoError(t, err)
+
+	params := make(map[string]string)
+	b.embedSendOptions(params, extractOptions([]interface{}{
+		&SendOptions{
+			ReplyTo:     &Message{ID: 1},
+			ReplyParams: &ReplyParams{MessageID: 2, ChatID: 3, Quote: "q"},
+			LinkPreview: &PreviewOptions{URL: "https://example.com", AboveText: true},
+			EffectID:    "e",
+		},
+		&ReplyMarkup{Placeholder: "Your age"},
+		ForceReply,
+		Protected,
+	}))
+
+	assert.Equal(t, map[string]string{
+		"reply_parameters":     `{"message_id":2,"chat_id":3,"quote":"q"}`,
+		"link_preview_options": `{"url":"https://example.com","show_above_text":true}`,
+		"message_effect_id":    "e",
+		"protect_content":      "true",
+		"reply_markup":         `{"force_reply":true,"input_field_placeholder":"Your age"}`,
+	}, params)
+}
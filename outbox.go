@@ -0,0 +1,167 @@
+package stb
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OutboxEntry is a message waiting in the outbox of a machine,
+// see Settings.Outbox.
+type OutboxEntry struct {
+	// Method and Params are the request sending the message.
+	Method string            `json:"method"`
+	Params map[string]string `json:"params"`
+
+	// Queued is when the message was sent.
+	Queued time.Time `json:"queued"`
+}
+
+// outboxEvery is how often the messages left in the outboxes are retried.
+var outboxEvery = time.Minute
+
+// sendOutboxed queues the request in the outbox of the machine,
+// persists it and sends the messages of the outbox in order.
+func (m *Machine) sendOutboxed(method string, params map[string]string) (*Message, error) {
+	m.outboxMu.Lock()
+	defer m.outboxMu.Unlock()
+
+	m.currentMu.Lock()
+	m.outbox = append(m.outbox, OutboxEntry{Method: method, Params: params, Queued: time.Now()})
+	m.currentMu.Unlock()
+	if err := m.persist(); err != nil {
+		m.currentMu.Lock()
+		m.outbox = m.outbox[:len(m.outbox)-1]
+		m.currentMu.Unlock()
+		return nil, err
+	}
+
+	return m.flushOutbox()
+}
+
+// FlushOutbox sends the messages left in the outbox of the machine,
+// e.g. when the API was unreachable when they were sent. Machines
+// restored with messages in their outbox flush it right away.
+func (m *Machine) FlushOutbox() error {
+	m.outboxMu.Lock()
+	defer m.outboxMu.Unlock()
+
+	_, err := m.flushOutbox()
+	m.checkBlocked(err)
+	return err
+}
+
+// flushRestored flushes the outbox of a restored machine
+// in the background.
+func (m *Machine) flushRestored() {
+	if m.bot == nil {
+		return
+	}
+	m.bot.inflight.Add(1)
+	go func() {
+		defer m.bot.inflight.Done()
+		if err := m.FlushOutbox(); err != nil && m.reporter != nil {
+			m.reporter(err)
+		}
+	}()
+}
+
+// flushOutbox sends the messages of the outbox one after the other
+// and returns the last one. Messages Telegram turns down are dropped,
+// the error of the last one is returned and the others are reported.
+// The outbox stops at the first message that fails for another
+// reason, to be retried later. The caller holds outboxMu.
+func (m *Machine) flushOutbox() (*Message, error) {
+	var last *Message
+	for {
+		m.currentMu.RLock()
+		if len(m.outbox) == 0 {
+			m.currentMu.RUnlock()
+			return last, nil
+		}
+		entry := m.outbox[0]
+		m.currentMu.RUnlock()
+
+		data, err := m.bot.Raw(entry.Method, entry.Params)
+		if err != nil && undelivered(err) {
+			return nil, errors.Wrap(err, "stb: message kept in the outbox")
+		}
+
+		m.currentMu.Lock()
+		m.outbox = m.outbox[1:]
+		m.currentMu.Unlock()
+		m.save()
+
+		last = nil
+		if err == nil {
+			last, err = extractMessage(data)
+		}
+
+		m.currentMu.RLock()
+		done := len(m.outbox) == 0
+		m.currentMu.RUnlock()
+		if done {
+			return last, err
+		}
+		if err != nil && m.reporter != nil {
+			m.reporter(errors.Wrapf(err, "stb: outbox %s", entry.Method))
+		}
+		m.checkBlocked(err)
+	}
+}
+
+// undelivered reports whether the error leaves the message
+// unsent, rather than turned down by Telegram.
+func undelivered(err error) bool {
+	if _, ok := errors.Cause(err).(FloodError); ok {
+		return true
+	}
+	return retryable(err)
+}
+
+// retryOutboxes flushes the outboxes of the loaded machines
+// every outboxEvery until stop is closed.
+func (b *Bot) retryOutboxes(stop chan struct{}) {
+	ticker := time.NewTicker(outboxEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flushOutboxes()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// flushOutboxes flushes the outboxes of the loaded machines
+// with messages left in them.
+func (b *Bot) flushOutboxes() {
+	var pending []*Machine
+	b.machines.Range(func(m *Machine) bool {
+		if m.pending() {
+			pending = append(pending, m)
+		}
+		return true
+	})
+
+	for _, m := range pending {
+		if err := m.FlushOutbox(); err != nil && m.reporter != nil {
+			m.reporter(err)
+		}
+	}
+}
+
+// pending reports whether messages are left in the outbox.
+func (m *Machine) pending() bool {
+	m.currentMu.RLock()
+	defer m.currentMu.RUnlock()
+	return len(m.outbox) > 0
+}
+
+// outboxed reports whether a text sent with the
+// options goes through the outbox of the machine.
+func (m *Machine) outboxed(options []interface{}) bool {
+	return m.bot.outbox && m.store != nil && !extractOptions(options).Split
+}
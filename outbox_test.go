@@ -0,0 +1,102 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		down = true
+		sent []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"ok":false,"error_code":500,"description":"Internal Server Error"}`))
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			var params map[string]string
+			json.NewDecoder(r.Body).Decode(&params)
+			sent = append(sent, params["text"])
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`))
+	}))
+	defer srv.Close()
+
+	store := NewMemoryStore()
+	pref := Settings{
+		Synchronous: true,
+		Offline:     true,
+		URL:         srv.URL,
+		Store:       store,
+		Outbox:      true,
+		Retry:       &RetryPolicy{},
+		MachineTTL:  time.Minute,
+	}
+
+	b, err := NewBot(pref)
+	require.NoError(t, err)
+	b.Default(Default)
+
+	var sendErr error
+	b.Handle("/hi", func(msg *Message, m *Machine) {
+		_, sendErr = m.Send("hello")
+	})
+	b.ProcessUpdate(Update{Message: &Message{Text: "/hi", Sender: &User{ID: 1}, Chat: &Chat{ID: 1}}})
+
+	require.Error(t, sendErr)
+	snap, err := store.Load("1")
+	require.NoError(t, err)
+	require.Len(t, snap.Outbox, 1)
+	assert.Equal(t, "sendMessage", snap.Outbox[0].Method)
+	assert.Equal(t, "hello", snap.Outbox[0].Params["text"])
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+
+	b, err = NewBot(pref)
+	require.NoError(t, err)
+	b.Default(Default)
+	b.Handle("/hi", func(msg *Message, m *Machine) {
+		_, sendErr = m.Send("hello again")
+	})
+	b.loadStored()
+	b.inflight.Wait()
+
+	mu.Lock()
+	assert.Equal(t, []string{"hello"}, sent)
+	down = true
+	mu.Unlock()
+	snap, err = store.Load("1")
+	require.NoError(t, err)
+	assert.Empty(t, snap.Outbox)
+
+	// while the bot runs, the loaded machines retry their outbox
+	b.ProcessUpdate(Update{Message: &Message{Text: "/hi", Sender: &User{ID: 1}, Chat: &Chat{ID: 1}}})
+	require.Error(t, sendErr)
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	b.machines.evict(time.Now().Add(time.Hour))
+	_, loaded := b.machines.Get("1")
+	assert.True(t, loaded)
+	b.flushOutboxes()
+
+	mu.Lock()
+	assert.Equal(t, []string{"hello", "hello again"}, sent)
+	mu.Unlock()
+}
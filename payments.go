@@ -5,6 +5,10 @@ import (
 	"math"
 )
 
+// CurrencyStars is the currency of payments in Telegram Stars.
+// Invoices in Stars must be sent without a provider token.
+const CurrencyStars = "XTR"
+
 // ShippingQuery contains information about an incoming shipping query.
 type ShippingQuery struct {
 	Sender  *User           `json:"from"`
@@ -41,6 +45,43 @@ type Payment struct {
 	ProviderChargeID string `json:"provider_payment_charge_id"`
 }
 
+// RefundedPayment contains basic information about a refunded payment.
+type RefundedPayment struct {
+	Currency         string `json:"currency"`
+	Total            int    `json:"total_amount"`
+	Payload          string `json:"invoice_payload"`
+	TelegramChargeID string `json:"telegram_payment_charge_id"`
+	ProviderChargeID string `json:"provider_payment_charge_id"`
+}
+
+// PaidMediaInfo describes the paid media added to a message.
+type PaidMediaInfo struct {
+	// The number of Telegram Stars to pay to access the media.
+	Stars int `json:"star_count"`
+
+	Media []PaidMedia `json:"paid_media"`
+}
+
+// PaidMedia describes a single paid media. Until it is purchased,
+// only the Type and, for previews, the dimensions are known.
+type PaidMedia struct {
+	// One of "preview", "photo" or "video".
+	Type string `json:"type"`
+
+	Width    int `json:"width,omitempty"`
+	Height   int `json:"height,omitempty"`
+	Duration int `json:"duration,omitempty"`
+
+	Photo *Photo `json:"photo,omitempty"`
+	Video *Video `json:"video,omitempty"`
+}
+
+// PaidMediaPurchased contains information about a paid media purchase.
+type PaidMediaPurchased struct {
+	From    User   `json:"from"`
+	Payload string `json:"paid_media_payload"`
+}
+
 // PreCheckoutQuery contains information about an incoming pre-checkout query.
 type PreCheckoutQuery struct {
 	Sender   *User  `json:"from"`
@@ -129,4 +170,12 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	if _, ok := SupportedCurrencies[CurrencyStars]; !ok {
+		SupportedCurrencies[CurrencyStars] = Currency{
+			Code:   CurrencyStars,
+			Title:  "Telegram Stars",
+			Symbol: "⭐",
+			Native: "⭐",
+		}
+	}
 }
@@ -0,0 +1,73 @@
+package stb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefundStars(t *testing.T) {
+	api := newFakeAPI(t, "true")
+	api.Result = func(call apiCall) string {
+		if call.Method == "sendMessage" {
+			return `{"message_id":1}`
+		}
+		return "true"
+	}
+	b, err := NewBot(api.Settings())
+	require.NoError(t, err)
+
+	b.Default(Default).Handle(OnPaidMediaPurchased, func(p *PaidMediaPurchased, m *Machine) error {
+		if _, err := m.Send("thanks"); err != nil {
+			return err
+		}
+		return b.RefundStars(&p.From, "charge")
+	})
+
+	b.ProcessUpdate(Update{PaidMediaPurchased: &PaidMediaPurchased{
+		From:    User{ID: 1},
+		Payload: "album",
+	}})
+
+	var calls []string
+	for _, call := range api.Calls() {
+		if call.Method == "sendMessage" {
+			calls = append(calls, call.Method+" "+call.Param("chat_id"))
+		} else {
+			calls = append(calls, call.Method+" "+call.Param("user_id")+" "+call.Param("telegram_payment_charge_id"))
+		}
+	}
+	assert.Equal(t, []string{"sendMessage 1", "refundStarPayment 1 charge"}, calls)
+}
+
+func TestStatePaidMedia(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var got []string
+	s := b.Default(Default)
+	s.Handle(OnPaidMedia, func(msg *Message, _ *Machine) {
+		got = append(got, msg.PaidMedia.Media[0].Type)
+	})
+	s.Handle(OnRefund, func(msg *Message, _ *Machine) {
+		got = append(got, msg.RefundedPayment.Currency)
+	})
+
+	var msg Message
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"from": {"id": 1},
+		"paid_media": {"star_count": 5, "paid_media": [{"type": "preview", "width": 10}]}
+	}`), &msg))
+	assert.Equal(t, 5, msg.PaidMedia.Stars)
+
+	b.ProcessUpdate(Update{Message: &msg})
+	b.ProcessUpdate(Update{Message: &Message{
+		Sender:          &User{ID: 1},
+		RefundedPayment: &RefundedPayment{Currency: CurrencyStars, Total: 5},
+	}})
+
+	assert.Equal(t, []string{"preview", CurrencyStars}, got)
+	assert.Equal(t, 0, SupportedCurrencies[CurrencyStars].Exp)
+}
@@ -14,8 +14,10 @@ type Poller interface {
 	// subscription channel and start polling
 	// for Updates immediately.
 	//
-	// Poller must listen for stop constantly and close
-	// it as soon as it's done polling.
+	// Poller must listen for stop constantly and return
+	// as soon as it is closed. The stop channel is owned
+	// by the bot, pollers must not close it. A poller
+	// returning on its own makes Bot.Start return.
 	Poll(b *Bot, updates chan Update, stop chan struct{})
 }
 
@@ -47,17 +49,28 @@ func (p *MiddlewarePoller) Poll(b *Bot, dest chan Update, stop chan struct{}) {
 
 	middle := make(chan Update, p.Capacity)
 	stopPoller := make(chan struct{})
+	polled := make(chan struct{})
 
-	go p.Poller.Poll(b, middle, stopPoller)
+	go func() {
+		p.Poller.Poll(b, middle, stopPoller)
+		close(polled)
+	}()
 
 	for {
 		select {
 		case <-stop:
 			close(stopPoller)
 			return
+		case <-polled:
+			return
 		case upd := <-middle:
 			if p.Filter(&upd) {
-				dest <- upd
+				select {
+				case dest <- upd:
+				case <-stop:
+					close(stopPoller)
+					return
+				}
 			}
 		}
 	}
@@ -85,6 +98,8 @@ type LongPoller struct {
 	// 		poll
 	// 		poll_answer
 	//
+	// If empty, Bot.AllowedUpdates is asked for with
+	// Settings.NarrowUpdates, every update type otherwise.
 	AllowedUpdates []string
 }
 
@@ -97,7 +112,12 @@ func (p *LongPoller) Poll(b *Bot, dest chan Update, stop chan struct{}) {
 		default:
 		}
 
-		updates, err := b.getUpdates(p.LastUpdateID+1, p.Limit, p.Timeout, p.AllowedUpdates)
+		allowed := p.AllowedUpdates
+		if len(allowed) == 0 && b.narrow {
+			allowed = b.AllowedUpdates()
+		}
+
+		updates, err := b.getUpdates(p.LastUpdateID+1, p.Limit, p.Timeout, allowed)
 		if err != nil {
 			b.debug(err)
 			b.debug(ErrCouldNotUpdate)
@@ -105,8 +125,12 @@ func (p *LongPoller) Poll(b *Bot, dest chan Update, stop chan struct{}) {
 		}
 
 		for _, update := range updates {
-			p.LastUpdateID = update.ID
-			dest <- update
+			select {
+			case dest <- update:
+				p.LastUpdateID = update.ID
+			case <-stop:
+				return
+			}
 		}
 	}
 }
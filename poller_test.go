@@ -1,9 +1,13 @@
 package stb
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type testPoller struct {
@@ -42,6 +46,7 @@ func TestMiddlewarePoller(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	b.Default(Default)
 	b.Poller = NewMiddlewarePoller(tp, func(u *Update) bool {
 		if u.ID > 0 {
 			ids = append(ids, u.ID)
@@ -65,3 +70,67 @@ func TestMiddlewarePoller(t *testing.T) {
 	assert.Contains(t, ids, 1)
 	assert.Contains(t, ids, 2)
 }
+
+func TestBotStop(t *testing.T) {
+	b, err := NewBot(Settings{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Default(Default)
+
+	tp := newTestPoller()
+	polling := make(chan struct{})
+	b.Poller = NewMiddlewarePoller(tp, func(u *Update) bool {
+		close(polling)
+		return true
+	})
+
+	started := make(chan struct{})
+	go func() {
+		b.Start()
+		close(started)
+	}()
+
+	tp.updates <- Update{ID: 1}
+	<-polling
+	b.Stop()
+
+	select {
+	case <-started:
+	default:
+		t.Fatal("Start did not return after Stop")
+	}
+}
+
+func TestBotShutdown(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Offline: true, Store: store})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	running, release := make(chan struct{}), make(chan struct{})
+	b.Handle(OnText, func(msg *Message, m *Machine) {
+		close(running)
+		<-release
+	})
+
+	tp := newTestPoller()
+	b.Poller = tp
+	go b.Start()
+
+	tp.updates <- Update{ID: 1, Message: &Message{Text: "hi", Sender: &User{ID: 1}, Chat: &Chat{ID: 1}}}
+	<-running
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = b.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	close(release)
+
+	_, err = store.Load("1")
+	assert.NoError(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, b.Shutdown(ctx), "the bot is not running anymore")
+}
@@ -0,0 +1,146 @@
+package stb
+
+import (
+	"sort"
+	"strings"
+)
+
+// The default priorities of the endpoints competing for a text
+// message. A state offers the text to the endpoints with a handler
+// from the highest priority to the lowest, until one takes it:
+//
+//     1. the command, "/start" deep links first (PriorityCommand)
+//     2. the exact text (PriorityText)
+//     3. the message matchers, in the order they were registered
+//        (PriorityMatcher)
+//     4. OnCommand for texts starting with a slash, OnText for
+//        the others (PriorityCatchAll)
+//
+// Endpoints of the same priority keep this order. HandlePriority
+// moves an endpoint elsewhere, and State.Routes tells the order
+// for a given message.
+const (
+	PriorityCommand  = 30
+	PriorityText     = 20
+	PriorityMatcher  = 10
+	PriorityCatchAll = 0
+)
+
+// HandlePriority is like Handle, with the priority the endpoint
+// competes for text messages with, instead of the default one of
+// its kind. It only matters for commands, exact texts, message
+// matchers, OnCommand and OnText, the priority of the other
+// endpoints is ignored.
+//
+// Example:
+//
+//     // a pasted OTP wins over a command that happens to match
+//     otp.HandlePriority(stb.Regex(`^/?\d{6}$`), verify, stb.PriorityCommand+1)
+//
+func (s *State) HandlePriority(endpoint interface{}, handler interface{}, priority int) error {
+	return s.handlePriority(endpoint, handler, &priority)
+}
+
+// priority returns the priority of the endpoint.
+func (s *State) priority(end string, def int) int {
+	if p, ok := s.priorities[end]; ok {
+		return p
+	}
+	return def
+}
+
+// Routes returns the endpoints the state offers the message to, in
+// order, among the ones it has a handler for. Only text messages
+// have several candidates, see PriorityCommand.
+func (s *State) Routes(msg *Message) []string {
+	if msg.Text == "" || msg.Text[0] == '\a' {
+		return nil
+	}
+	copied := *msg
+	routes, _ := s.textRoutes(&copied)
+
+	ends := make([]string, len(routes))
+	for i, r := range routes {
+		ends[i] = r.end
+	}
+	return ends
+}
+
+// textRoute is an endpoint a text message is offered to.
+type textRoute struct {
+	end      string
+	priority int
+	run      func(m *Machine) bool
+}
+
+// textRoutes returns the endpoints the text message is offered to,
+// sorted by priority. It sets the payload of commands. It reports
+// false for the commands addressed to another bot.
+func (s *State) textRoutes(msg *Message) ([]textRoute, bool) {
+	var routes []textRoute
+
+	// Syntax: "</command>@<bot> <payload>"
+	if match := cmdRx.FindStringSubmatch(msg.Text); match != nil {
+		command, botName := match[1], match[3]
+		if botName != "" && !strings.EqualFold(s.Me.Username, botName) {
+			return nil, false
+		}
+
+		msg.Payload = match[5]
+		start := command == "/start" && msg.Payload != "" && len(s.starts) > 0
+		if _, ok := s.handlers[command]; ok || start {
+			routes = append(routes, textRoute{
+				end:      command,
+				priority: s.priority(command, PriorityCommand),
+				run: func(m *Machine) bool {
+					if start && s.handleStart(msg, m) {
+						return true
+					}
+					return s.handle(command, msg, m)
+				},
+			})
+		}
+	}
+
+	if _, ok := s.handlers[msg.Text]; ok {
+		text := msg.Text
+		routes = append(routes, textRoute{
+			end:      text,
+			priority: s.priority(text, PriorityText),
+			run:      func(m *Machine) bool { return s.handle(text, msg, m) },
+		})
+	}
+
+	for _, h := range s.matchers {
+		if !h.matcher.Match(msg) {
+			continue
+		}
+		h := h
+		name := matcherName(h.matcher)
+		routes = append(routes, textRoute{
+			end:      name,
+			priority: h.priority,
+			run: func(m *Machine) bool {
+				s.runHandler(name, func(m *Machine) error { return h.handler(msg, m) })
+				return true
+			},
+		})
+	}
+
+	catchAll := OnText
+	if msg.Text[0] == '/' {
+		catchAll = OnCommand
+	}
+	if _, ok := s.handlers[catchAll]; ok {
+		routes = append(routes, textRoute{
+			end:      catchAll,
+			priority: s.priority(catchAll, PriorityCatchAll),
+			run:      func(m *Machine) bool { return s.handle(catchAll, msg, m) },
+		})
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].priority > routes[j].priority
+	})
+	return routes, true
+}
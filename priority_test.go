@@ -0,0 +1,47 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlePriority(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+	s := b.Default(Default)
+
+	var handled []string
+	record := func(name string) func(*Message, *Machine) {
+		return func(*Message, *Machine) { handled = append(handled, name) }
+	}
+	s.MustHandle("/123456", record("command"))
+	s.MustHandle("/123456 now", record("text"))
+	s.MustHandle(Regex(`\d{6}`), record("regex"))
+	s.MustHandle(OnCommand, record("command catch-all"))
+	s.MustHandle(OnText, record("text catch-all"))
+
+	otp := &Message{Text: "/123456 now"}
+	assert.Equal(t, []string{"/123456", "/123456 now", "regex:\\d{6}", OnCommand}, s.Routes(otp))
+	assert.Empty(t, otp.Payload)
+	assert.Equal(t, []string{"regex:\\d{6}", OnText}, s.Routes(&Message{Text: "code 123456"}))
+	assert.Empty(t, s.Routes(&Message{Text: "/123456@other_bot"}))
+
+	require.NoError(t, s.HandlePriority(Regex(`^/\d{6}`), record("otp"), PriorityCommand+1))
+	require.NoError(t, s.HandlePriority(OnText, record("text catch-all"), PriorityText+1))
+	assert.Equal(t, []string{"regex:^/\\d{6}", "/123456", "/123456 now", "regex:\\d{6}", OnCommand}, s.Routes(otp))
+	assert.Equal(t, []string{OnText, "regex:\\d{6}"}, s.Routes(&Message{Text: "code 123456"}))
+
+	send := func(text string) {
+		b.ProcessUpdate(Update{Message: &Message{Text: text, Sender: &User{ID: 1}, Chat: &Chat{ID: 1}}})
+	}
+	send("/123456 now")
+	send("code 123456")
+	send("/other")
+	assert.Equal(t, []string{"otp", "text catch-all", "command catch-all"}, handled)
+
+	// registering the endpoint again restores the default priority
+	s.MustHandle(OnText, record("text catch-all"))
+	assert.Equal(t, []string{"regex:\\d{6}", OnText}, s.Routes(&Message{Text: "code 123456"}))
+}
@@ -0,0 +1,26 @@
+package stb
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// proxyClient returns a client sending the requests
+// through the proxy, see Settings.Proxy.
+func proxyClient(proxy string) (*http.Client, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.Wrap(err, "stb: invalid proxy")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, errors.Errorf("stb: unsupported proxy scheme %q", u.Scheme)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,139 @@
+package stb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pollMemory is how long polls without a deadline are remembered.
+const pollMemory = 24 * time.Hour
+
+// scoreKey is the session key of Machine.Score.
+const scoreKey = "stb.score"
+
+// polls remembers the polls sent with Machine.SendPoll.
+type polls struct {
+	mu   sync.Mutex
+	sent map[string]sentPoll
+}
+
+type sentPoll struct {
+	chat    *Chat
+	quiz    bool
+	correct int
+}
+
+func (p *polls) remember(id string, poll sentPoll) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sent == nil {
+		p.sent = make(map[string]sentPoll)
+	}
+	p.sent[id] = poll
+}
+
+func (p *polls) forget(id string) {
+	p.mu.Lock()
+	delete(p.sent, id)
+	p.mu.Unlock()
+}
+
+// answered returns the poll the update answers, if it was sent
+// with Machine.SendPoll.
+func (p *polls) answered(upd Update) (sentPoll, bool) {
+	if upd.PollAnswer == nil {
+		return sentPoll{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	poll, ok := p.sent[upd.PollAnswer.PollID]
+	return poll, ok
+}
+
+// SendPoll sends the poll to the chat of the machine, see Machine.Send.
+// The bot remembers the poll, so that the answers reach the machine
+// of the user who answered in that chat, whatever the scope, and
+// the correct answers to quizzes count towards their Machine.Score.
+// The poll must not be anonymous for answers to arrive.
+//
+// With closeAfter, the poll is closed once it passed, which is not
+// limited to the 10 minutes of Poll.OpenPeriod. Polls are remembered
+// until then, or for a day without a deadline. They are not persisted,
+// after a restart the answers are routed as usual.
+//
+// Example:
+//
+//     poll := &stb.Poll{Type: stb.PollRegular, Question: "Pizza or pasta?"}
+//     poll.AddOptions("Pizza", "Pasta")
+//     m.SendPoll(poll, time.Hour)
+//
+func (m *Machine) SendPoll(poll *Poll, closeAfter time.Duration, options ...interface{}) (*Message, error) {
+	msg, err := m.Send(poll, options...)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Poll == nil {
+		return msg, nil
+	}
+
+	b, id := m.bot, msg.Poll.ID
+	b.polls.remember(id, sentPoll{
+		chat:    msg.Chat,
+		quiz:    poll.IsQuiz(),
+		correct: poll.CorrectOption,
+	})
+
+	if closeAfter <= 0 {
+		time.AfterFunc(pollMemory, func() { b.polls.forget(id) })
+		return msg, nil
+	}
+	time.AfterFunc(closeAfter, func() {
+		b.polls.forget(id)
+		if _, err := b.StopPoll(msg); err != nil {
+			b.debug(errors.Wrap(err, "stb: closing poll"))
+		}
+	})
+	return msg, nil
+}
+
+// SendQuiz sends a quiz with the answers, the one at index correct
+// being right, see SendPoll.
+//
+// Example:
+//
+//     m.SendQuiz("2 + 2?", []string{"3", "4", "5"}, 1, time.Minute)
+//
+func (m *Machine) SendQuiz(question string, answers []string, correct int, closeAfter time.Duration, options ...interface{}) (*Message, error) {
+	if correct < 0 || correct >= len(answers) {
+		return nil, errors.Errorf("stb: correct answer %d out of %d", correct, len(answers))
+	}
+	poll := &Poll{Type: PollQuiz, Question: question, CorrectOption: correct}
+	poll.AddOptions(answers...)
+	return m.SendPoll(poll, closeAfter, options...)
+}
+
+// Score returns the number of quizzes sent with SendQuiz
+// the user of the machine answered correctly. The score is
+// kept in the session of the machine.
+func (m *Machine) Score() int {
+	var score int
+	m.Session().Get(scoreKey, &score)
+	return score
+}
+
+// ResetScore sets the score of the machine back to zero.
+func (m *Machine) ResetScore() {
+	m.Session().Delete(scoreKey)
+}
+
+// scoreAnswer counts a correct answer to a quiz.
+func (m *Machine) scoreAnswer(poll sentPoll, answer *PollAnswer) {
+	if !poll.quiz || len(answer.Options) != 1 || answer.Options[0] != poll.correct {
+		return
+	}
+	if err := m.Session().Set(scoreKey, m.Score()+1); err != nil && m.reporter != nil {
+		m.reporter(err)
+	}
+}
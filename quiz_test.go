@@ -0,0 +1,53 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineSendQuiz(t *testing.T) {
+	api := newFakeAPI(t, `{"message_id":5,"chat":{"id":-100},"poll":{"id":"p1","type":"quiz"},"id":"p1","type":"quiz"}`)
+	settings := api.Settings()
+	settings.Scope = ScopeChatUser
+	b, err := NewBot(settings)
+	require.NoError(t, err)
+	b.Default(Default)
+
+	var answered []string
+	b.Handle(OnPollAnswer, func(a *PollAnswer, m *Machine) {
+		answered = append(answered, m.ID())
+	})
+
+	host := b.machines.obtain("-100:1", &User{ID: 1})
+	host.touch(&Chat{ID: -100, Type: ChatSuperGroup}, 0, "")
+
+	_, err = host.SendQuiz("2 + 2?", []string{"3", "4"}, 2, 0)
+	assert.Error(t, err)
+	_, err = host.SendQuiz("2 + 2?", []string{"3", "4"}, 1, 50*time.Millisecond)
+	require.NoError(t, err)
+
+	answer := func(user, option int) {
+		b.ProcessUpdate(Update{PollAnswer: &PollAnswer{PollID: "p1", User: User{ID: user}, Options: []int{option}}})
+	}
+	answer(2, 1)
+	answer(3, 0)
+
+	assert.Equal(t, []string{"-100:2", "-100:3"}, answered)
+	right, _ := b.machines.Get("-100:2")
+	wrong, _ := b.machines.Get("-100:3")
+	assert.Equal(t, 1, right.Score())
+	assert.Equal(t, 0, wrong.Score())
+	assert.Equal(t, int64(-100), right.Chat().ID)
+
+	right.ResetScore()
+	assert.Equal(t, 0, right.Score())
+
+	assert.Eventually(t, func() bool {
+		return api.Count("stopPoll") == 1
+	}, time.Second, 5*time.Millisecond)
+	_, known := b.polls.answered(Update{PollAnswer: &PollAnswer{PollID: "p1"}})
+	assert.False(t, known)
+}
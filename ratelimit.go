@@ -0,0 +1,155 @@
+package stb
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter paces outgoing messages to stay within the flood limits
+// of Telegram: 30 messages per second overall, one per second to
+// the same private chat and 20 per minute to the same group.
+// Messages over the limits wait for their turn, and requests that
+// get a 429 anyway are retried after the time Telegram asks for.
+//
+// Example:
+//
+//     b, err := stb.NewBot(stb.Settings{
+//         Token:   "TOKEN_HERE",
+//         Limiter: stb.NewLimiter(),
+//     })
+//
+// The zero Limiter paces nothing and doesn't retry,
+// it only holds the requests back during a flood pause.
+type Limiter struct {
+	// Global, Private and Group are the minimal intervals between
+	// two messages overall, to a private chat and to a group.
+	Global  time.Duration
+	Private time.Duration
+	Group   time.Duration
+
+	// Retries is how many times a request is retried after a 429.
+	Retries int
+
+	mu     sync.Mutex
+	next   time.Time
+	chats  map[int64]time.Time
+	paused time.Time
+
+	// booked are the slots of chats in the order they were
+	// booked, so forget drops them without scanning chats.
+	booked []chatSlot
+
+	// sleep is replaced in tests.
+	sleep func(time.Duration)
+}
+
+// NewLimiter creates a Limiter with the limits documented by Telegram.
+func NewLimiter() *Limiter {
+	return &Limiter{
+		Global:  time.Second / 30,
+		Private: time.Second,
+		Group:   3 * time.Second,
+		Retries: 3,
+	}
+}
+
+// chatSlot is the next slot of a chat, see Limiter.forget.
+type chatSlot struct {
+	chat int64
+	next time.Time
+}
+
+// wait blocks until the request may be sent. Only sending methods
+// are paced, every request waits for a flood pause to end.
+func (l *Limiter) wait(method string, chatID int64) {
+	sleep := l.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	sleep(l.reserve(time.Now(), method, chatID))
+}
+
+// reserve books the earliest slot the request may be sent in
+// and returns how long to wait for it.
+func (l *Limiter) reserve(now time.Time, method string, chatID int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slot := now
+	if l.paused.After(slot) {
+		slot = l.paused
+	}
+
+	if !isSending(method) {
+		return slot.Sub(now)
+	}
+
+	if l.next.After(slot) {
+		slot = l.next
+	}
+	if chatID != 0 {
+		if next := l.chats[chatID]; next.After(slot) {
+			slot = next
+		}
+	}
+
+	l.next = slot.Add(l.Global)
+	if chatID != 0 {
+		interval := l.Private
+		if chatID < 0 {
+			interval = l.Group
+		}
+		if l.chats == nil {
+			l.chats = make(map[int64]time.Time)
+		}
+		l.chats[chatID] = slot.Add(interval)
+		l.booked = append(l.booked, chatSlot{chatID, slot.Add(interval)})
+		l.forget(now)
+	}
+
+	return slot.Sub(now)
+}
+
+// pause holds every request back for d.
+func (l *Limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.paused) {
+		l.paused = until
+	}
+}
+
+// forget drops the chats whose slots are in the past. The slots are
+// booked nearly in order, the few booked out of it wait for the
+// earlier ones.
+func (l *Limiter) forget(now time.Time) {
+	n := 0
+	for ; n < len(l.booked) && l.booked[n].next.Before(now); n++ {
+		// a chat booked again is kept for its later slot
+		if slot := l.booked[n]; l.chats[slot.chat] == slot.next {
+			delete(l.chats, slot.chat)
+		}
+	}
+	l.booked = l.booked[n:]
+}
+
+// isSending tells whether the method sends a message,
+// chat actions are not counted by Telegram.
+func isSending(method string) bool {
+	return strings.HasPrefix(method, "send") && method != "sendChatAction" ||
+		method == "forwardMessage" ||
+		method == "copyMessage"
+}
+
+// payloadChat returns the chat a request is sent to, or 0.
+func payloadChat(payload interface{}) int64 {
+	params, ok := payload.(map[string]string)
+	if !ok {
+		return 0
+	}
+	id, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	return id
+}
@@ -0,0 +1,78 @@
+package stb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	l := NewLimiter()
+	now := time.Now()
+
+	assert.Equal(t, time.Duration(0), l.reserve(now, "sendMessage", 1))
+	assert.Equal(t, time.Second/30, l.reserve(now, "sendMessage", 2))
+	assert.Equal(t, time.Second, l.reserve(now, "sendPhoto", 1))
+	assert.Equal(t, time.Duration(0), l.reserve(now, "getMe", 0))
+	assert.Equal(t, time.Duration(0), l.reserve(now, "sendChatAction", 1))
+
+	assert.Equal(t, time.Second+time.Second/30, l.reserve(now, "sendMessage", -3))
+	assert.Equal(t, 4*time.Second+time.Second/30, l.reserve(now, "sendMessage", -3))
+
+	l.pause(time.Minute)
+	assert.True(t, l.reserve(now, "getMe", 0) > 59*time.Second)
+}
+
+func TestLimiterForget(t *testing.T) {
+	l := NewLimiter()
+	now := time.Now()
+
+	l.reserve(now, "sendMessage", 1)
+	l.reserve(now, "sendMessage", -2)
+	l.reserve(now.Add(500*time.Millisecond), "sendMessage", 1)
+	assert.Len(t, l.chats, 2)
+
+	l.reserve(now.Add(2500*time.Millisecond), "sendMessage", 3)
+	assert.Len(t, l.chats, 3)
+
+	l.reserve(now.Add(time.Minute), "sendMessage", 4)
+	assert.Equal(t, map[int64]time.Time{4: now.Add(time.Minute + time.Second)}, l.chats)
+	assert.Len(t, l.booked, 1)
+}
+
+func TestLimiterZero(t *testing.T) {
+	var l Limiter
+	l.wait("sendMessage", 1)
+	l.wait("sendMessage", 1)
+	assert.Equal(t, time.Duration(0), l.reserve(time.Now(), "sendMessage", -1))
+}
+
+func TestLimiterRetry(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(429)
+			w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 5","parameters":{"retry_after":5}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer srv.Close()
+
+	var slept time.Duration
+	l := NewLimiter()
+	l.sleep = func(d time.Duration) { slept += d }
+
+	b, err := NewBot(Settings{Offline: true, URL: srv.URL, Limiter: l})
+	require.NoError(t, err)
+
+	_, err = b.Send(&User{ID: 1}, "hi")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.True(t, slept > 4*time.Second)
+}
@@ -0,0 +1,74 @@
+package stb
+
+import "time"
+
+// ReactionType describes a reaction.
+type ReactionType struct {
+	// Type is either "emoji" or "custom_emoji".
+	Type string `json:"type"`
+
+	// Emoji is the reaction emoji, for emoji reactions.
+	Emoji string `json:"emoji,omitempty"`
+
+	// CustomEmojiID is the custom emoji identifier,
+	// for custom emoji reactions.
+	CustomEmojiID string `json:"custom_emoji_id,omitempty"`
+}
+
+// ReactionCount is a reaction added to a message
+// along with the number of times it was added.
+type ReactionCount struct {
+	Type  ReactionType `json:"type"`
+	Count int          `json:"total_count"`
+}
+
+// MessageReaction object represents a change of
+// a reaction on a message performed by a user.
+type MessageReaction struct {
+	// The chat containing the message the user reacted to.
+	Chat Chat `json:"chat"`
+
+	// Unique identifier of the message inside the chat.
+	MessageID int `json:"message_id"`
+
+	// (Optional) The user that changed the reaction,
+	// if the user isn't anonymous.
+	User *User `json:"user,omitempty"`
+
+	// (Optional) The chat on behalf of which the reaction
+	// was changed, if the user is anonymous.
+	ActorChat *Chat `json:"actor_chat,omitempty"`
+
+	// Unixtime, use MessageReaction.Time() to get time.Time
+	Unixtime int64 `json:"date"`
+
+	// Previous and new list of reaction types set by the user.
+	OldReaction []ReactionType `json:"old_reaction"`
+	NewReaction []ReactionType `json:"new_reaction"`
+}
+
+// Time returns the moment of the change in local time.
+func (r *MessageReaction) Time() time.Time {
+	return time.Unix(r.Unixtime, 0)
+}
+
+// MessageReactionCount object represents reaction changes
+// on a message with anonymous reactions.
+type MessageReactionCount struct {
+	// The chat containing the message.
+	Chat Chat `json:"chat"`
+
+	// Unique message identifier inside the chat.
+	MessageID int `json:"message_id"`
+
+	// Unixtime, use MessageReactionCount.Time() to get time.Time
+	Unixtime int64 `json:"date"`
+
+	// List of reactions that are present on the message.
+	Reactions []ReactionCount `json:"reactions"`
+}
+
+// Time returns the moment of the change in local time.
+func (r *MessageReactionCount) Time() time.Time {
+	return time.Unix(r.Unixtime, 0)
+}
@@ -0,0 +1,84 @@
+package stb
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Recorder returns middleware writing every update to w as a line
+// of JSON, so the updates can be fed back with ReplayUpdates. Each
+// message of an album is written as an update of its own. Errors
+// writing an update are reported to the bot's reporter and don't
+// keep the update from being handled.
+//
+// Example:
+//
+//     f, err := os.OpenFile("updates.jsonl", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+//     if err != nil {
+//         log.Fatal(err)
+//     }
+//     defer f.Close()
+//
+//     b.Use(b.Recorder(f))
+//
+func (b *Bot) Recorder(w io.Writer) MiddlewareFunc {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+
+	return func(next UpdateHandler) UpdateHandler {
+		return func(upd Update) {
+			records := []Update{upd}
+			if upd.album != nil {
+				records = records[:0]
+				for _, msg := range upd.album {
+					records = append(records, Update{ID: upd.ID, Message: msg})
+				}
+			}
+
+			mu.Lock()
+			for _, rec := range records {
+				if err := enc.Encode(rec); err != nil {
+					b.debug(errors.Wrap(err, "stb: recording update"))
+					break
+				}
+			}
+			mu.Unlock()
+
+			next(upd)
+		}
+	}
+}
+
+// ReplayUpdates reads the updates written by Recorder from r and
+// feeds them through the bot against a fresh set of machines, which
+// start over in the default state, to reproduce a conversation.
+// It returns once all the updates are handled.
+//
+// Replay on a bot that is not polling and has no Store, machines
+// are restored from it otherwise. The requests handlers make go to
+// the Bot API as usual, point Settings.URL to a test server if needed.
+func (b *Bot) ReplayUpdates(r io.Reader) error {
+	machines := newMachines(b.newMachine, b.store, b.machines.ttl, b.machines.onEvict)
+	machines.userHooks = b.machines.userHooks
+	b.machines = machines
+
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var upd Update
+		err := dec.Decode(&upd)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			b.inflight.Wait()
+			return errors.Wrapf(err, "stb: replaying update #%d", n)
+		}
+		b.ProcessUpdate(upd)
+	}
+
+	b.inflight.Wait()
+	return nil
+}
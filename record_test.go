@@ -0,0 +1,56 @@
+package stb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var log bytes.Buffer
+	var texts []string
+
+	setup := func(b *Bot) {
+		start := b.Default(Default)
+		start.Event("start", "Name")
+		start.MustHandle("/start", func(msg *Message, m *Machine) error {
+			return m.SendEvent("start")
+		})
+		b.State("Name").MustHandle(OnText, func(msg *Message, m *Machine) {
+			texts = append(texts, msg.Text)
+		})
+	}
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+	setup(b)
+	b.Use(b.Recorder(&log))
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{ID: 1, Message: &Message{Sender: user, Text: "/start"}})
+	b.ProcessUpdate(Update{ID: 2, Message: &Message{Sender: user, Text: "Alice"}})
+	b.ProcessUpdate(Update{ID: 3, Message: &Message{Sender: user, Text: "Bob"}})
+	assert.Equal(t, []string{"Alice", "Bob"}, texts)
+	assert.Equal(t, 3, strings.Count(log.String(), "\n"))
+	recorded := append([]byte(nil), log.Bytes()...)
+
+	// the same bot replays against fresh machines
+	texts = nil
+	require.NoError(t, b.ReplayUpdates(bytes.NewReader(recorded)))
+	assert.Equal(t, []string{"Alice", "Bob"}, texts)
+
+	// and so does a new one
+	texts = nil
+	replay, err := NewBot(Settings{Offline: true})
+	require.NoError(t, err)
+	setup(replay)
+	require.NoError(t, replay.ReplayUpdates(bytes.NewReader(recorded)))
+	assert.Equal(t, []string{"Alice", "Bob"}, texts)
+	assert.Equal(t, StateType("Name"), replay.machine(user).Current())
+
+	err = replay.ReplayUpdates(strings.NewReader(`{"update_id":1}` + "\n{"))
+	assert.EqualError(t, err, "stb: replaying update #2: unexpected EOF")
+}
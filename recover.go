@@ -0,0 +1,107 @@
+package stb
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Panic is a panic recovered from a handler, along with
+// the context it happened in.
+type Panic struct {
+	// Value is the value the handler panicked with.
+	Value interface{}
+
+	// Update is the update being processed, if any.
+	// It is empty for panics in state actions.
+	Update Update
+
+	// State is the state the panicking handler belongs to.
+	State StateType
+
+	// ChatID and UserID identify where the update came from,
+	// they are zero when unknown.
+	ChatID int64
+	UserID int
+
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// Error implements error.
+func (p *Panic) Error() string {
+	return fmt.Sprintf("stb: panic in state %q (chat %d, user %d, update %d): %v",
+		p.State, p.ChatID, p.UserID, p.Update.ID, p.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (p *Panic) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// Recoverer receives the panics recovered from handlers and actions.
+type Recoverer interface {
+	Recover(p *Panic)
+}
+
+// RecovererFunc is an adapter to use ordinary functions as a Recoverer.
+type RecovererFunc func(p *Panic)
+
+// Recover implements Recoverer.
+func (f RecovererFunc) Recover(p *Panic) {
+	f(p)
+}
+
+// newPanic collects the context of a recovered panic.
+func newPanic(value interface{}, upd Update, state StateType) *Panic {
+	p := &Panic{
+		Value:  value,
+		Update: upd,
+		State:  state,
+		Stack:  debug.Stack(),
+	}
+	if chat := updateChat(upd); chat != nil {
+		p.ChatID = chat.ID
+	}
+	if user, err := DefaultRecognizer(upd); err == nil && user != nil {
+		p.UserID = user.ID
+	}
+	return p
+}
+
+// updateChat returns the chat an update comes from or nil.
+func updateChat(upd Update) *Chat {
+	switch {
+	case upd.Message != nil:
+		return upd.Message.Chat
+	case upd.EditedMessage != nil:
+		return upd.EditedMessage.Chat
+	case upd.ChannelPost != nil:
+		return upd.ChannelPost.Chat
+	case upd.EditedChannelPost != nil:
+		return upd.EditedChannelPost.Chat
+	case upd.Callback != nil && upd.Callback.Message != nil:
+		return upd.Callback.Message.Chat
+	case upd.MyChatMember != nil:
+		return &upd.MyChatMember.Chat
+	case upd.ChatMember != nil:
+		return &upd.ChatMember.Chat
+	case upd.ChatJoinRequest != nil:
+		return &upd.ChatJoinRequest.Chat
+	case upd.MessageReaction != nil:
+		return &upd.MessageReaction.Chat
+	case upd.MessageReactionCount != nil:
+		return &upd.MessageReactionCount.Chat
+	case upd.BusinessMessage != nil:
+		return upd.BusinessMessage.Chat
+	case upd.EditedBusinessMessage != nil:
+		return upd.EditedBusinessMessage.Chat
+	case upd.DeletedBusinessMessages != nil:
+		return &upd.DeletedBusinessMessages.Chat
+	case upd.ChatBoost != nil:
+		return &upd.ChatBoost.Chat
+	case upd.ChatBoostRemoved != nil:
+		return &upd.ChatBoostRemoved.Chat
+	}
+	return nil
+}
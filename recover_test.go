@@ -0,0 +1,39 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverer(t *testing.T) {
+	var got *Panic
+	b, err := NewBot(Settings{
+		Synchronous: true,
+		Offline:     true,
+		Recoverer:   RecovererFunc(func(p *Panic) { got = p }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Default(Default).Handle(OnText, func(*Message, *Machine) {
+		panic("boom")
+	})
+
+	b.ProcessUpdate(Update{ID: 3, Message: &Message{
+		Text:   "hi",
+		Sender: &User{ID: 1},
+		Chat:   &Chat{ID: 2},
+	}})
+
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "boom", got.Value)
+		assert.Equal(t, 3, got.Update.ID)
+		assert.Equal(t, Default, got.State)
+		assert.Equal(t, int64(2), got.ChatID)
+		assert.Equal(t, 1, got.UserID)
+		assert.NotEmpty(t, got.Stack)
+		assert.Contains(t, got.Error(), "boom")
+	}
+}
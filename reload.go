@@ -0,0 +1,164 @@
+package stb
+
+import "github.com/pkg/errors"
+
+// RenameFunc maps the states renamed by a reload to their new
+// names. It returns all the other states as they are.
+type RenameFunc func(StateType) StateType
+
+// Reload replaces the states, events (including the deferrable
+// ones) and global handlers of the bot
+// with the ones setup defines, e.g. from a reloaded definition,
+// without dropping machines: every machine stays in its state and
+// keeps its context, history and session. Machines in states renamed
+// by rename, which may be nil, move to the new names, machines in
+// states that are gone move to the default state. No actions are run.
+//
+// Reload is safe while the bot is running. Updates handled until
+// setup returns see the old states, the following ones see the
+// new states, and setup may use the bot meanwhile. Machines restored from the store later are renamed as well.
+// If setup fails, the bot keeps its states. With NarrowUpdates,
+// the webhook is set again for the update types of the new
+// handlers, and the error setting it is returned.
+//
+// Example:
+//
+//     err := b.Reload(func(b *stb.Bot) error {
+//         return b.LoadDefinition(data, registry)
+//     }, func(t stb.StateType) stb.StateType {
+//         if t == "AskName" {
+//             return "Name"
+//         }
+//         return t
+//     })
+//
+func (b *Bot) Reload(setup func(*Bot) error, rename RenameFunc) error {
+	b.reloadMu.Lock()
+	defer b.reloadMu.Unlock()
+
+	// setup runs unlocked and may use the bot,
+	// the machines keep the old states meanwhile
+	b.configMu.Lock()
+	old := b.current()
+	b.frozen = old
+	b.configMu.Unlock()
+
+	b.states = make(map[StateType]*State)
+	b.events = make(map[EventType]StateType)
+	b.deferrable = make(map[EventType]bool)
+	b.global = b.State("")
+
+	err := setup(b)
+	if _, ok := b.states[b.defaultState]; err == nil && !ok {
+		err = errors.Errorf("stb: default state %q is not defined", b.defaultState)
+	}
+
+	b.configMu.Lock()
+	b.frozen = nil
+	if err != nil {
+		b.states, b.events, b.global, b.defaultState = old.states, old.events, old.global, old.defaultState
+		b.deferrable = old.deferrable
+		b.configMu.Unlock()
+		return err
+	}
+	b.generation++
+	b.rename = rename
+	webhook := b.webhook
+	b.configMu.Unlock()
+
+	b.machines.Range(func(m *Machine) bool {
+		b.reload(m)
+		return true
+	})
+
+	if b.narrow && webhook != nil && len(webhook.AllowedUpdates) == 0 {
+		return b.SetWebhook(webhook)
+	}
+	return nil
+}
+
+// botConfig is the states and events the machines run on.
+type botConfig struct {
+	states       map[StateType]*State
+	defaultState StateType
+	global       *State
+	events       map[EventType]StateType
+	deferrable   map[EventType]bool
+}
+
+// current returns the states and events the machines run on,
+// the frozen ones while Reload runs. The caller must hold configMu.
+func (b *Bot) current() *botConfig {
+	if b.frozen != nil {
+		return b.frozen
+	}
+	return &botConfig{
+		states:       b.states,
+		defaultState: b.defaultState,
+		global:       b.global,
+		events:       b.events,
+		deferrable:   b.deferrable,
+	}
+}
+
+// config returns the states and the global state of the bot.
+func (b *Bot) config() (map[StateType]*State, *State) {
+	b.configMu.RLock()
+	defer b.configMu.RUnlock()
+	cfg := b.current()
+	return cfg.states, cfg.global
+}
+
+// reload moves the machine over to the current states of the bot.
+func (b *Bot) reload(m *Machine) {
+	b.configMu.RLock()
+	cfg, generation, rename := b.current(), b.generation, b.rename
+	b.configMu.RUnlock()
+	states, events, def := cfg.states, cfg.events, cfg.defaultState
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// machines created since the reload have the new states already
+	if m.generation == generation {
+		return
+	}
+	m.generation = generation
+	m.states, m.globalEvents = states, events
+
+	m.currentMu.Lock()
+	m.current = renameState(m.current, states, rename, def)
+	m.history = renameHistory(m.history, states, rename)
+	m.currentMu.Unlock()
+
+	m.resetTimeout()
+	if err := m.persist(); err != nil {
+		b.debug(err)
+	}
+}
+
+// renameState returns the name of the state among the states,
+// the default state if it is gone.
+func renameState(t StateType, states map[StateType]*State, rename RenameFunc, def StateType) StateType {
+	if _, ok := states[t]; ok {
+		return t
+	}
+	if rename != nil {
+		if t = rename(t); t != "" && states[t] != nil {
+			return t
+		}
+	}
+	return def
+}
+
+// renameHistory renames the states of the history,
+// dropping the ones that are gone.
+func renameHistory(history []StateType, states map[StateType]*State, rename RenameFunc) []StateType {
+	kept := history[:0]
+	for _, t := range history {
+		if t = renameState(t, states, rename, ""); t != "" {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,125 @@
+package stb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotReload(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, HistorySize: 5})
+	require.NoError(t, err)
+
+	var got []string
+	reg := Registry{
+		"cancel":   func(_ *Message, m *Machine) error { return m.SendEvent("cancel") },
+		"order":    func(_ *Message, m *Machine) error { return m.SendEvent("order") },
+		"askSize":  func(*Machine) { got = append(got, "ask") },
+		"pickSize": func(msg *Message, _ *Machine) { got = append(got, "old "+msg.Text) },
+		"confirm":  func(*Callback, *Machine) {},
+		"pickNew":  func(msg *Message, _ *Machine) { got = append(got, "new "+msg.Text) },
+	}
+	require.NoError(t, b.LoadDefinition([]byte(testDefinition), reg))
+
+	alice, bob := &User{ID: 1}, &User{ID: 2}
+	b.ProcessUpdate(Update{Message: &Message{Text: "/order", Sender: alice}})
+	b.machine(alice).Set("context")
+	b.ProcessUpdate(Update{Message: &Message{Text: "hi", Sender: bob}})
+
+	// Order is renamed to Size, and its text handler changed
+	v2 := strings.NewReplacer("Order", "Size", "pickSize", "pickNew").Replace(testDefinition)
+	err = b.Reload(func(b *Bot) error {
+		return b.LoadDefinition([]byte(v2), reg)
+	}, func(t StateType) StateType {
+		if t == "Order" {
+			return "Size"
+		}
+		return t
+	})
+	require.NoError(t, err)
+
+	m := b.machine(alice)
+	assert.Equal(t, StateType("Size"), m.Current())
+	assert.Equal(t, "context", m.Get())
+	assert.Equal(t, []StateType{Default}, m.History())
+	assert.Equal(t, Default, b.machine(bob).Current())
+
+	b.ProcessUpdate(Update{Message: &Message{Text: "large", Sender: alice}})
+	b.ProcessUpdate(Update{Message: &Message{Text: "/cancel", Sender: alice}})
+	assert.Equal(t, []string{"ask", "new large"}, got)
+	assert.Equal(t, Default, m.Current())
+
+	// the states left behind by a failed reload are kept
+	err = b.Reload(func(b *Bot) error {
+		b.Default("Other")
+		return errors.New("broken")
+	}, nil)
+	assert.EqualError(t, err, "broken")
+	assert.Equal(t, Default, b.defaultState)
+	assert.Contains(t, b.states, StateType("Size"))
+
+	err = b.Reload(func(b *Bot) error {
+		b.State("Lonely")
+		return nil
+	}, nil)
+	assert.EqualError(t, err, `stb: default state "Default" is not defined`)
+
+	// states that are gone move machines to the default state
+	b.ProcessUpdate(Update{Message: &Message{Text: "/order", Sender: alice}})
+	require.NoError(t, b.Reload(func(b *Bot) error {
+		b.Default(Default)
+		return nil
+	}, nil))
+	assert.Equal(t, Default, m.Current())
+	assert.Equal(t, []StateType{Default, Default}, m.History())
+}
+
+func TestBotReloadSetup(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var got []string
+	b.Default(Default).Handle(OnText, func(msg *Message, _ *Machine) {
+		got = append(got, "old "+msg.Text)
+	})
+
+	// updates handled while setup runs see the old states
+	user := &User{ID: 1}
+	require.NoError(t, b.Reload(func(b *Bot) error {
+		b.Default(Default).Handle(OnText, func(msg *Message, _ *Machine) {
+			got = append(got, "new "+msg.Text)
+		})
+		b.ProcessUpdate(Update{Message: &Message{Text: "during", Sender: user}})
+		return nil
+	}, nil))
+	b.ProcessUpdate(Update{Message: &Message{Text: "after", Sender: user}})
+
+	assert.Equal(t, []string{"old during", "new after"}, got)
+}
+
+func TestBotReloadStore(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+
+	b.Default(Default).Event("next", "Old")
+	b.State("Old")
+
+	user := &User{ID: 1}
+	require.NoError(t, b.machine(user).SendEvent("next"))
+	b.Machines().Delete("1")
+
+	require.NoError(t, b.Reload(func(b *Bot) error {
+		b.Default(Default).Event("next", "New")
+		b.State("New")
+		return nil
+	}, func(t StateType) StateType {
+		return StateType(strings.Replace(string(t), "Old", "New", 1))
+	}))
+
+	// machines restored from the store are renamed as well
+	assert.Equal(t, StateType("New"), b.machine(user).Current())
+}
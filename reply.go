@@ -0,0 +1,76 @@
+package stb
+
+import (
+	"strconv"
+	"time"
+)
+
+// askMemory is how long asked questions await their replies.
+const askMemory = 24 * time.Hour
+
+// question is what the machine remembers about a question it asked.
+type question struct {
+	Tag string `json:"tag"`
+}
+
+// Reply returns the endpoint of the replies to the
+// questions asked with the tag, see Machine.Ask.
+//
+// Handler: func(*Message, *Machine)
+func Reply(tag string) string {
+	return "\areply/" + tag
+}
+
+// askKey is the session key of the question sent as the message.
+func askKey(chat int64, message int) string {
+	return "stb.ask/" + strconv.FormatInt(chat, 10) + ":" + strconv.Itoa(message)
+}
+
+// Ask sends the question like Send, forcing the user to reply to it,
+// and tags it. A reply to the question goes to the Reply(tag) handler
+// of the current state, its parents or the global state, before any
+// other endpoint, even if the machine has moved on since. Replies of
+// other users reach their own machines and aren't taken for answers,
+// unless machines are shared by the chat (ScopeChat). Questions are
+// answered once and forgotten after a day.
+//
+// Example:
+//
+//     b.Handle(stb.Reply("age"), func(msg *stb.Message, m *stb.Machine) error {
+//         return saveAge(m, msg.Text)
+//     })
+//
+//     m.Ask("age", "How old are you?")
+//
+func (m *Machine) Ask(tag string, what interface{}, options ...interface{}) (*Message, error) {
+	msg, err := m.Send(what, append(options, ForceReply)...)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Chat == nil {
+		return msg, nil
+	}
+	return msg, m.Session().Set(askKey(msg.Chat.ID, msg.ID), question{Tag: tag}, askMemory)
+}
+
+// replied runs the Reply handler of the question the update
+// answers, if any, and reports whether there was one.
+func (b *Bot) replied(upd Update, m *Machine, chain []*State) bool {
+	msg := upd.Message
+	if msg == nil || msg.ReplyTo == nil || msg.Chat == nil {
+		return false
+	}
+
+	key := askKey(msg.Chat.ID, msg.ReplyTo.ID)
+	var q question
+	if !m.Session().Get(key, &q) {
+		return false
+	}
+	for _, state := range chain {
+		if state.processReply(Reply(q.Tag), upd, m) {
+			m.Session().Delete(key)
+			return true
+		}
+	}
+	return false
+}
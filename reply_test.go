@@ -0,0 +1,48 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineAsk(t *testing.T) {
+	var markup map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		json.NewDecoder(r.Body).Decode(&params)
+		json.Unmarshal([]byte(params["reply_markup"]), &markup)
+		w.Write([]byte(`{"ok":true,"result":{"message_id":7,"chat":{"id":1}}}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+	b.Default(Default).Event("next", "Next")
+
+	var got []string
+	b.State("Next").Handle(OnText, func(msg *Message, m *Machine) {
+		got = append(got, "text "+msg.Text)
+	})
+	b.Handle(Reply("age"), func(msg *Message, m *Machine) {
+		got = append(got, "age "+msg.Text)
+	})
+
+	user, chat := &User{ID: 1}, &Chat{ID: 1}
+	m := b.machine(user)
+	_, err = m.Ask("age", "How old are you?")
+	require.NoError(t, err)
+	assert.Equal(t, true, markup["force_reply"])
+	require.NoError(t, m.SendEvent("next"))
+
+	question := &Message{ID: 7, Chat: chat}
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: chat, Text: "30", ReplyTo: question}})
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: chat, Text: "31", ReplyTo: question}})
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: chat, Text: "hi"}})
+
+	assert.Equal(t, []string{"age 30", "text 31", "text hi"}, got)
+}
@@ -0,0 +1,100 @@
+package stb
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy decides how API calls failing with a network error
+// or a 5xx response are retried. Note that a message can be sent
+// twice if the connection breaks after Telegram received it.
+type RetryPolicy struct {
+	// Retries is the number of retries after the first attempt,
+	// zero disables retrying.
+	Retries int
+
+	// MinBackoff and MaxBackoff bound the exponential backoff
+	// between attempts, the actual wait is jittered.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// sleep is replaced in tests.
+	sleep func(time.Duration)
+}
+
+// DefaultRetryPolicy is the policy used when Settings.Retry is nil.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		Retries:    3,
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+	}
+}
+
+// backoff returns the wait before the retry following the
+// given number of failures: a random duration up to the
+// exponentially growing cap ("full jitter").
+func (p *RetryPolicy) backoff(failures int) time.Duration {
+	limit := p.MinBackoff << uint(failures)
+	if limit <= 0 || limit > p.MaxBackoff {
+		limit = p.MaxBackoff
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+func (p *RetryPolicy) wait(failures int) {
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	sleep(p.backoff(failures))
+}
+
+// serverError is returned by API calls answered with a 5xx status.
+type serverError struct {
+	code int
+	err  error
+}
+
+func (e *serverError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("stb: server error (%d)", e.code)
+}
+
+func (e *serverError) Unwrap() error {
+	return e.err
+}
+
+// retryable reports whether the call failed for a transient reason:
+// a 5xx response, a timeout or a broken connection.
+func retryable(err error) bool {
+	var (
+		server *serverError
+		dns    *net.DNSError
+		op     *net.OpError
+		netErr net.Error
+	)
+	switch {
+	case errors.As(err, &server):
+		return true
+	case errors.As(err, &dns):
+		return dns.IsTimeout || dns.IsTemporary
+	case errors.As(err, &op):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package stb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	failures := 2
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= failures {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>Bad Gateway</html>"))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	retry := DefaultRetryPolicy()
+	retry.sleep = func(d time.Duration) { waits = append(waits, d) }
+
+	b, err := NewBot(Settings{Offline: true, URL: srv.URL, Retry: retry})
+	require.NoError(t, err)
+
+	_, err = b.Send(&User{ID: 1}, "hi")
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Len(t, waits, 2)
+
+	calls, failures = 0, 10
+	_, err = b.Send(&User{ID: 1}, "hi")
+	assert.EqualError(t, err, "stb: sendMessage failed after 4 attempts: stb: server error (502)")
+	assert.Equal(t, 4, calls)
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, retry.backoff(i) < retry.MaxBackoff)
+	}
+}
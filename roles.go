@@ -0,0 +1,265 @@
+package stb
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RoleAdmin is the role of the creator and the administrators of a chat.
+const RoleAdmin = "admin"
+
+// ErrForbidden is returned by the handlers guarded with RequireRole
+// when the user lacks the role. Handle it with Bot.OnError to
+// answer politely.
+var ErrForbidden = errors.New("stb: forbidden")
+
+// RoleProvider tells whether users have roles, see RequireRole.
+// It is set with Settings.Roles.
+type RoleProvider interface {
+	// HasRole reports whether the user has the role in the chat.
+	// The chat is nil if the handler is not about one.
+	HasRole(user *User, chat *Chat, role string) (bool, error)
+}
+
+// RoleFunc is a RoleProvider asking an external source,
+// e.g. the user database of the service behind the bot.
+type RoleFunc func(user *User, chat *Chat, role string) (bool, error)
+
+// HasRole implements RoleProvider.
+func (f RoleFunc) HasRole(user *User, chat *Chat, role string) (bool, error) {
+	return f(user, chat, role)
+}
+
+// StaticRoles is a RoleProvider with fixed lists of user ids by role.
+//
+// Example:
+//
+//     stb.StaticRoles{"support": {1234, 5678}}
+//
+type StaticRoles map[string][]int
+
+// HasRole implements RoleProvider.
+func (r StaticRoles) HasRole(user *User, _ *Chat, role string) (bool, error) {
+	for _, id := range r[role] {
+		if id == user.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RoleProviders grants the roles any of its providers grants.
+//
+// Example:
+//
+//     Roles: stb.RoleProviders{
+//         stb.StaticRoles{"support": {1234}},
+//         stb.NewAdminRoles(time.Minute),
+//     }
+//
+type RoleProviders []RoleProvider
+
+// HasRole implements RoleProvider.
+func (p RoleProviders) HasRole(user *User, chat *Chat, role string) (bool, error) {
+	for _, provider := range p {
+		ok, err := provider.HasRole(user, chat, role)
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (p RoleProviders) bind(b *Bot) {
+	for _, provider := range p {
+		if binder, ok := provider.(interface{ bind(*Bot) }); ok {
+			binder.bind(b)
+		}
+	}
+}
+
+// AdminRoles is a RoleProvider granting RoleAdmin to the creator and
+// the administrators of the chat. The administrators of a chat are
+// looked up once per TTL, by the bot the provider is set on.
+type AdminRoles struct {
+	bot *Bot
+	ttl time.Duration
+
+	mu     sync.Mutex
+	admins map[int64]chatAdmins
+}
+
+type chatAdmins struct {
+	ids     map[int]bool
+	expires time.Time
+}
+
+// NewAdminRoles creates an AdminRoles caching the
+// administrators of chats for ttl.
+func NewAdminRoles(ttl time.Duration) *AdminRoles {
+	return &AdminRoles{
+		ttl:    ttl,
+		admins: make(map[int64]chatAdmins),
+	}
+}
+
+func (r *AdminRoles) bind(b *Bot) {
+	r.mu.Lock()
+	r.bot = b
+	r.mu.Unlock()
+}
+
+// HasRole implements RoleProvider.
+func (r *AdminRoles) HasRole(user *User, chat *Chat, role string) (bool, error) {
+	if role != RoleAdmin || chat == nil || chat.Type == ChatPrivate {
+		return false, nil
+	}
+
+	r.mu.Lock()
+	b := r.bot
+	cached, ok := r.admins[chat.ID]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.ids[user.ID], nil
+	}
+	if b == nil {
+		return false, errors.New("stb: admin roles are not set on a bot")
+	}
+
+	members, err := b.AdminsOf(chat)
+	if err != nil {
+		return false, err
+	}
+	cached = chatAdmins{ids: make(map[int]bool), expires: time.Now().Add(r.ttl)}
+	for _, member := range members {
+		if member.User != nil {
+			cached.ids[member.User.ID] = true
+		}
+	}
+
+	r.mu.Lock()
+	r.admins[chat.ID] = cached
+	r.mu.Unlock()
+	return cached.ids[user.ID], nil
+}
+
+// Forget drops the cached administrators of the chat,
+// e.g. when a chat member update promotes someone.
+func (r *AdminRoles) Forget(chat *Chat) {
+	r.mu.Lock()
+	delete(r.admins, chat.ID)
+	r.mu.Unlock()
+}
+
+// RequireRole guards the handler: it only runs for users who have the
+// role according to Settings.Roles, others get ErrForbidden instead.
+// The user is the sender of the message, callback, query, etc. the
+// handler is called with, the chat is the chat of the machine. The
+// handler must take a *Machine, RequireRole panics otherwise.
+//
+// Example:
+//
+//     b.Handle("/refund", stb.RequireRole("support", refund))
+//
+//     b.OnError(func(err error, upd stb.Update) {
+//         if errors.Cause(err) == stb.ErrForbidden {
+//             b.Send(upd.Message.Chat, "Sorry, you can't do that.")
+//         }
+//     })
+//
+func RequireRole(role string, handler interface{}) interface{} {
+	h := reflect.ValueOf(handler)
+	if h.Kind() != reflect.Func {
+		panic("stb: RequireRole needs a handler function")
+	}
+	t := h.Type()
+
+	in, machineArg := handlerArgs(t)
+	if machineArg < 0 {
+		panic("stb: RequireRole needs a handler taking a *Machine")
+	}
+
+	guarded := reflect.FuncOf(in, []reflect.Type{errorType}, false)
+	return reflect.MakeFunc(guarded, func(args []reflect.Value) []reflect.Value {
+		result := func(err error) []reflect.Value {
+			return []reflect.Value{reflect.ValueOf(&err).Elem()}
+		}
+
+		m := args[machineArg].Interface().(*Machine)
+		if m == nil || m.bot == nil {
+			return result(errors.Wrapf(ErrForbidden, "%q", role))
+		}
+		user := m.User()
+		if sender := senderOf(args[0].Interface()); sender != nil {
+			user = sender
+		}
+		if user == nil {
+			return result(errors.Wrapf(ErrForbidden, "%q", role))
+		}
+
+		ok, err := m.bot.roles.HasRole(user, m.Chat(), role)
+		if err != nil {
+			return result(errors.Wrapf(err, "stb: checking role %q", role))
+		}
+		if !ok {
+			return result(errors.Wrapf(ErrForbidden, "%q", role))
+		}
+
+		out := h.Call(args)
+		if len(out) == 0 {
+			return result(nil)
+		}
+		return out
+	}).Interface()
+}
+
+// RequireAdmin guards the handler with RequireRole(RoleAdmin, ...).
+func RequireAdmin(handler interface{}) interface{} {
+	return RequireRole(RoleAdmin, handler)
+}
+
+var machineType = reflect.TypeOf((*Machine)(nil))
+
+// handlerArgs returns the arguments of the handler type
+// and the index of its *Machine, -1 if it takes none.
+func handlerArgs(t reflect.Type) ([]reflect.Type, int) {
+	machineArg := -1
+	in := make([]reflect.Type, t.NumIn())
+	for i := range in {
+		in[i] = t.In(i)
+		if in[i] == machineType {
+			machineArg = i
+		}
+	}
+	return in, machineArg
+}
+
+// senderOf returns the user behind the first argument of a handler.
+func senderOf(arg interface{}) *User {
+	switch a := arg.(type) {
+	case *Message:
+		return a.Sender
+	case *Callback:
+		return a.Sender
+	case *Query:
+		return &a.From
+	case *ChosenInlineResult:
+		return &a.From
+	case *ShippingQuery:
+		return a.Sender
+	case *PreCheckoutQuery:
+		return a.Sender
+	case *PollAnswer:
+		return &a.User
+	case *ChatMemberUpdated:
+		return &a.From
+	case *ChatJoinRequest:
+		return &a.From
+	case *MessageReaction:
+		return a.User
+	}
+	return nil
+}
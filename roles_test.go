@@ -0,0 +1,70 @@
+package stb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireRole(t *testing.T) {
+	lookups := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		w.Write([]byte(`{"ok":true,"result":[{"user":{"id":1},"status":"creator"}]}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{
+		Synchronous: true,
+		Offline:     true,
+		URL:         srv.URL,
+		Roles: RoleProviders{
+			StaticRoles{"support": {2}},
+			RoleFunc(func(user *User, _ *Chat, role string) (bool, error) {
+				return role == "billing" && user.ID == 3, nil
+			}),
+			NewAdminRoles(time.Hour),
+		},
+	})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	var got, denied []string
+	b.OnError(func(err error, upd Update) {
+		if errors.Cause(err) == ErrForbidden {
+			denied = append(denied, upd.Message.Text)
+		}
+	})
+	b.MustHandle("/ban", RequireAdmin(func(msg *Message, _ *Machine) {
+		got = append(got, msg.Text)
+	}))
+	b.MustHandle("/refund", RequireRole("support", func(msg *Message, _ *Machine) error {
+		got = append(got, msg.Text)
+		return nil
+	}))
+	b.MustHandle("/invoice", RequireRole("billing", func(msg *Message, _ *Machine) {
+		got = append(got, msg.Text)
+	}))
+
+	group := &Chat{ID: -100, Type: ChatSuperGroup}
+	send := func(user int, text string) {
+		b.ProcessUpdate(Update{Message: &Message{Text: text, Sender: &User{ID: user}, Chat: group}})
+	}
+	send(1, "/ban")
+	send(2, "/ban")
+	send(2, "/refund")
+	send(1, "/refund")
+	send(3, "/invoice")
+	send(2, "/invoice")
+
+	assert.Equal(t, []string{"/ban", "/refund", "/invoice"}, got)
+	assert.Equal(t, []string{"/ban", "/refund", "/invoice"}, denied)
+	assert.Equal(t, 1, lookups)
+
+	assert.Panics(t, func() { RequireAdmin(func(*Message) {}) })
+}
@@ -0,0 +1,49 @@
+package stb
+
+import "strconv"
+
+// ScopeFunc returns the id of the machine an update belongs to.
+// Updates with an empty id are only seen by the global handlers,
+// without a machine.
+type ScopeFunc func(upd Update) string
+
+// ScopeUser gives every user a machine of their own,
+// shared across all the chats they talk to the bot in.
+func ScopeUser(upd Update) string {
+	user, err := DefaultRecognizer(upd)
+	if err != nil || user == nil {
+		return ""
+	}
+	return strconv.Itoa(user.ID)
+}
+
+// ScopeChat gives every chat a machine, shared by all its members.
+// It suits channels and group tools.
+func ScopeChat(upd Update) string {
+	chat := updateChat(upd)
+	if chat == nil {
+		return ""
+	}
+	return strconv.FormatInt(chat.ID, 10)
+}
+
+// ScopeChatUser gives every user a machine per chat,
+// so conversations in groups don't get mixed up.
+func ScopeChatUser(upd Update) string {
+	chat, user := ScopeChat(upd), ScopeUser(upd)
+	if chat == "" || user == "" {
+		return ""
+	}
+	return chat + ":" + user
+}
+
+// recognizerScope keys machines by the user the recognizer returns.
+func recognizerScope(recognizer RecognizerFunc) ScopeFunc {
+	return func(upd Update) string {
+		user, err := recognizer(upd)
+		if err != nil || user == nil {
+			return ""
+		}
+		return strconv.Itoa(user.ID)
+	}
+}
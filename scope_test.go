@@ -0,0 +1,53 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScope(t *testing.T) {
+	upd := Update{Message: &Message{Sender: &User{ID: 1}, Chat: &Chat{ID: -2}}}
+	assert.Equal(t, "1", ScopeUser(upd))
+	assert.Equal(t, "-2", ScopeChat(upd))
+	assert.Equal(t, "-2:1", ScopeChatUser(upd))
+
+	post := Update{ChannelPost: &Message{Chat: &Chat{ID: -3}}}
+	assert.Equal(t, "", ScopeUser(post))
+	assert.Equal(t, "-3", ScopeChat(post))
+	assert.Equal(t, "", ScopeChatUser(post))
+}
+
+func TestBotScope(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Scope: ScopeChatUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	b.Default(Default).Handle(OnText, func(msg *Message, m *Machine) {
+		ids = append(ids, m.ID())
+	})
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{Message: &Message{Text: "a", Sender: user, Chat: &Chat{ID: 10}}})
+	b.ProcessUpdate(Update{Message: &Message{Text: "b", Sender: user, Chat: &Chat{ID: 20}}})
+
+	assert.Equal(t, []string{"10:1", "20:1"}, ids)
+	assert.Equal(t, 2, b.Machines().Len())
+}
+
+func TestScopeTopic(t *testing.T) {
+	upd := Update{Message: &Message{
+		Sender:       &User{ID: 1},
+		Chat:         &Chat{ID: -2},
+		ThreadID:     7,
+		TopicMessage: true,
+	}}
+	assert.Equal(t, "-2/7", ScopeTopic(upd))
+	assert.Equal(t, "-2/7:1", ScopeTopicUser(upd))
+
+	upd.Message.TopicMessage = false
+	assert.Equal(t, "-2", ScopeTopic(upd))
+	assert.Equal(t, "-2:1", ScopeTopicUser(upd))
+}
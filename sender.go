@@ -0,0 +1,142 @@
+package stb
+
+import "github.com/pkg/errors"
+
+// Send sends what to the chat the machine talks in: the chat of
+// its latest update or, before any update, its user. In forums,
+// the message goes to the topic of the latest update and business
+// messages are answered on behalf of the business account, unless
+// options include SendOptions. See Bot.Send for what and options.
+// With Settings.Outbox, texts go through the outbox of the machine.
+func (m *Machine) Send(what interface{}, options ...interface{}) (*Message, error) {
+	to := m.recipient()
+	if to == nil {
+		return nil, ErrBadRecipient
+	}
+
+	span := m.trace("stb.send")
+	var (
+		msg *Message
+		err error
+	)
+	if text, ok := what.(string); ok && m.outboxed(options) {
+		params := m.bot.textParams(to, text, extractOptions(m.sendOptions(options)))
+		msg, err = m.sendOutboxed("sendMessage", params)
+	} else {
+		msg, err = m.bot.Send(to, what, m.sendOptions(options)...)
+	}
+	span.End(err)
+	m.checkBlocked(err)
+	return msg, err
+}
+
+// SendSplit sends what like Send, splitting long texts
+// and captions into several messages, see Bot.SendSplit.
+func (m *Machine) SendSplit(what interface{}, options ...interface{}) ([]*Message, error) {
+	to := m.recipient()
+	if to == nil {
+		return nil, ErrBadRecipient
+	}
+
+	span := m.trace("stb.send")
+	sent, err := m.bot.SendSplit(to, what, m.sendOptions(options)...)
+	span.End(err)
+	m.checkBlocked(err)
+	return sent, err
+}
+
+// sendOptions puts the forum topic and the business
+// connection of the machine in front of the options.
+func (m *Machine) sendOptions(options []interface{}) []interface{} {
+	m.currentMu.RLock()
+	thread, business := m.thread, m.business
+	m.currentMu.RUnlock()
+	if thread != 0 || business != "" {
+		opts := &SendOptions{ThreadID: thread, BusinessConnectionID: business}
+		options = append([]interface{}{opts}, options...)
+	}
+	return options
+}
+
+// checkBlocked marks the machine blocked if the error tells
+// the user blocked the bot or deleted their account.
+func (m *Machine) checkBlocked(err error) {
+	if errors.Cause(err) == ErrBlockedByUser || errors.Cause(err) == ErrUserIsDeactivated {
+		m.setBlocked(true)
+	}
+}
+
+// Edit edits a message, see Bot.Edit.
+func (m *Machine) Edit(msg Editable, what interface{}, options ...interface{}) (*Message, error) {
+	span := m.trace("stb.edit")
+	edited, err := m.bot.Edit(msg, what, options...)
+	span.End(err)
+	return edited, err
+}
+
+// Delete deletes a message, see Bot.Delete.
+func (m *Machine) Delete(msg Editable) error {
+	span := m.trace("stb.delete")
+	err := m.bot.Delete(msg)
+	span.End(err)
+	return err
+}
+
+// Answer responds to a callback, see Bot.Respond.
+func (m *Machine) Answer(c *Callback, resp ...*CallbackResponse) error {
+	span := m.trace("stb.answer")
+	err := m.bot.Respond(c, resp...)
+	span.End(err)
+	return err
+}
+
+// Chat returns the chat of the latest update of the machine, or nil.
+func (m *Machine) Chat() *Chat {
+	m.currentMu.RLock()
+	defer m.currentMu.RUnlock()
+	return m.chat
+}
+
+func (m *Machine) recipient() Recipient {
+	if chat := m.Chat(); chat != nil {
+		return chat
+	}
+	if m.who != nil {
+		return m.who
+	}
+	return nil
+}
+
+// Approve approves the chat join request, see Bot.ApproveJoinRequest.
+func (m *Machine) Approve(r *ChatJoinRequest) error {
+	span := m.trace("stb.approve")
+	err := m.bot.ApproveJoinRequest(&r.Chat, &r.From)
+	span.End(err)
+	return err
+}
+
+// Decline declines the chat join request, see Bot.DeclineJoinRequest.
+func (m *Machine) Decline(r *ChatJoinRequest) error {
+	span := m.trace("stb.decline")
+	err := m.bot.DeclineJoinRequest(&r.Chat, &r.From)
+	span.End(err)
+	return err
+}
+
+// replyChat returns the chat the machine should answer an update in.
+// Join requests come from a chat the user is not a member of yet,
+// the conversation goes on in the private chat with the user.
+// Paid media purchases carry no chat at all and are answered
+// in the private chat as well.
+func replyChat(upd Update) *Chat {
+	if r := upd.ChatJoinRequest; r != nil && r.UserChatID != 0 {
+		return &Chat{ID: r.UserChatID, Type: ChatPrivate}
+	}
+	if p := upd.PaidMediaPurchased; p != nil {
+		return &Chat{ID: int64(p.From.ID), Type: ChatPrivate}
+	}
+	if c := upd.BusinessConnection; c != nil && c.UserChatID != 0 {
+		return &Chat{ID: c.UserChatID, Type: ChatPrivate}
+	}
+	return updateChat(upd)
+}
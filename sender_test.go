@@ -0,0 +1,48 @@
+package stb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineSend(t *testing.T) {
+	var chats, threads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		json.NewDecoder(r.Body).Decode(&params)
+		chats = append(chats, params["chat_id"])
+		threads = append(threads, params["message_thread_id"])
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+
+	b.Default(Default).Handle(OnText, func(msg *Message, m *Machine) error {
+		_, err := m.Send("hi " + msg.Text)
+		return err
+	})
+
+	user := &User{ID: 1}
+	_, err = b.machine(user).Send("before")
+	require.NoError(t, err)
+
+	b.ProcessUpdate(Update{Message: &Message{Text: "there", Sender: user, Chat: &Chat{ID: -5}}})
+	assert.Equal(t, []string{"1", "-5"}, chats)
+	assert.Equal(t, int64(-5), b.machine(user).Chat().ID)
+
+	b.ProcessUpdate(Update{Message: &Message{
+		Text:         "topic",
+		Sender:       user,
+		Chat:         &Chat{ID: -5},
+		ThreadID:     3,
+		TopicMessage: true,
+	}})
+	assert.Equal(t, []string{"", "", "3"}, threads)
+}
@@ -0,0 +1,167 @@
+package stb
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionEntry is the persisted form of a session value.
+type SessionEntry struct {
+	// Value is the JSON encoded value.
+	Value json.RawMessage `json:"value"`
+
+	// Expires is the moment the value expires, if it has a TTL.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+func (e SessionEntry) expired(now time.Time) bool {
+	return e.Expires != nil && !now.Before(*e.Expires)
+}
+
+// Session is a key-value store of a machine, for flows keeping more
+// than a single context (see Machine.Set). Values are stored in their
+// JSON form and persisted together with the machine, values with a
+// TTL are dropped once it passed.
+//
+// Example:
+//
+//     m.Session().Set("cart", cart, time.Hour)
+//
+//     var cart Cart
+//     if m.Session().Get("cart", &cart) { ... }
+//
+type Session struct {
+	mu      sync.Mutex
+	entries map[string]SessionEntry
+	persist func()
+}
+
+// Session returns the session of the machine.
+func (m *Machine) Session() *Session {
+	m.currentMu.Lock()
+	defer m.currentMu.Unlock()
+
+	if m.session == nil {
+		m.session = newSession(nil)
+	}
+	if m.session.persist == nil {
+		m.session.persist = m.save
+	}
+	return m.session
+}
+
+func newSession(entries map[string]SessionEntry) *Session {
+	if entries == nil {
+		entries = make(map[string]SessionEntry)
+	}
+	return &Session{entries: entries}
+}
+
+// Set stores the value under the key. With a ttl,
+// the value expires once the ttl has passed.
+func (s *Session) Set(key string, value interface{}, ttl ...time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	entry := SessionEntry{Value: data}
+	if len(ttl) > 0 && ttl[0] > 0 {
+		expires := time.Now().Add(ttl[0])
+		entry.Expires = &expires
+	}
+
+	s.mu.Lock()
+	s.entries[key] = entry
+	s.mu.Unlock()
+
+	s.save()
+	return nil
+}
+
+// Get decodes the value stored under the key into ptr and
+// reports whether there was one. Expired values are missing.
+func (s *Session) Get(key string, ptr interface{}) bool {
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	if ok && entry.expired(time.Now()) {
+		delete(s.entries, key)
+		ok = false
+	}
+	s.mu.Unlock()
+
+	return ok && json.Unmarshal(entry.Value, ptr) == nil
+}
+
+// Has reports whether a value is stored under the key.
+func (s *Session) Has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	return ok && !entry.expired(time.Now())
+}
+
+// Delete removes the value stored under the key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	_, ok := s.entries[key]
+	delete(s.entries, key)
+	s.mu.Unlock()
+
+	if ok {
+		s.save()
+	}
+}
+
+// Keys returns the sorted keys of the values stored.
+func (s *Session) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.entries))
+	for key, entry := range s.entries {
+		if !entry.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Clear removes all values.
+func (s *Session) Clear() {
+	s.mu.Lock()
+	s.entries = make(map[string]SessionEntry)
+	s.mu.Unlock()
+
+	s.save()
+}
+
+func (s *Session) save() {
+	if s.persist != nil {
+		s.persist()
+	}
+}
+
+// snapshot returns the entries which did not expire yet, or nil.
+func (s *Session) snapshot() map[string]SessionEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var entries map[string]SessionEntry
+	for key, entry := range s.entries {
+		if entry.expired(now) {
+			continue
+		}
+		if entries == nil {
+			entries = make(map[string]SessionEntry)
+		}
+		entries[key] = entry
+	}
+	return entries
+}
@@ -0,0 +1,55 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCart struct {
+	Items []string
+	Total int
+}
+
+func TestSession(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	user := &User{ID: 1}
+	s := b.machine(user).Session()
+	require.NoError(t, s.Set("cart", testCart{Items: []string{"tea"}, Total: 3}))
+	require.NoError(t, s.Set("step", 2, time.Hour))
+	require.NoError(t, s.Set("code", "1234", time.Nanosecond))
+	assert.Error(t, s.Set("bad", func() {}))
+
+	time.Sleep(time.Millisecond)
+	assert.False(t, s.Has("code"))
+	assert.Equal(t, []string{"cart", "step"}, s.Keys())
+
+	// a machine restored from the store gets the session back
+	b.machines.Delete(b.machine(user).ID())
+	s = b.machine(user).Session()
+
+	var cart testCart
+	require.True(t, s.Get("cart", &cart))
+	assert.Equal(t, testCart{Items: []string{"tea"}, Total: 3}, cart)
+
+	var step int
+	require.True(t, s.Get("step", &step))
+	assert.Equal(t, 2, step)
+
+	s.Delete("cart")
+	assert.False(t, s.Get("cart", &cart))
+
+	snap, err := store.Load("1")
+	require.NoError(t, err)
+	assert.Len(t, snap.Session, 1)
+
+	s.Clear()
+	snap, _ = store.Load("1")
+	assert.Nil(t, snap.Session)
+}
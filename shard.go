@@ -0,0 +1,119 @@
+package stb
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// forwardedHeader marks the requests of ForwardWebhooks, whose
+// updates are handled by the receiving instance in any case.
+const forwardedHeader = "X-Stb-Forwarded"
+
+// Sharding serves one bot from several instances, e.g. behind a
+// load balancer in front of their webhooks. Every machine is owned
+// by one of the instances, the shard, which handles all of its
+// updates. Updates reaching other instances are forwarded to it.
+//
+// Machines are assigned to shards by their id, as returned by the
+// scope of the bot. Updates with no machine are handled where they
+// arrive. Give all the instances the same Store, so machines
+// survive changes to the number of shards.
+type Sharding struct {
+	// Shards is the number of instances, Shard the index of this one.
+	Shards int
+	Shard  int
+
+	// Forward hands an update over to the shard owning it,
+	// see ForwardWebhooks. Required with more than one shard.
+	// When it fails on an update received by a Webhook, the
+	// webhook answers with an error, for Telegram to retry.
+	Forward func(shard int, upd Update) error
+}
+
+func (s *Sharding) validate() error {
+	switch {
+	case s == nil:
+		return nil
+	case s.Shard < 0 || s.Shard >= s.Shards && s.Shards > 0:
+		return errors.Errorf("stb: shard %d out of %d shards", s.Shard, s.Shards)
+	case s.Shards > 1 && s.Forward == nil:
+		return errors.New("stb: sharding needs a Forward function")
+	}
+	return nil
+}
+
+// ForwardWebhooks returns a Sharding.Forward posting updates to the
+// webhooks of the instances, urls[i] being the one of shard i. The
+// secret is the Webhook.SecretToken shared by the instances.
+func ForwardWebhooks(urls []string, secret string) func(int, Update) error {
+	return func(shard int, upd Update) error {
+		data, err := json.Marshal(upd)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, urls[shard], bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(forwardedHeader, "1")
+		if secret != "" {
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return wrapError(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return errors.Errorf("stb: shard %d answered %s", shard, resp.Status)
+		}
+		return nil
+	}
+}
+
+// shardOf returns the shard owning the machine of the
+// update, -1 if the update has no machine.
+func (b *Bot) shardOf(upd Update) int {
+	id := b.scope(upd)
+	if id == "" {
+		return -1
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(b.sharding.Shards))
+}
+
+// foreign returns the shard owning the update if it is another
+// one than this instance, -1 if the update is to be handled here.
+func (b *Bot) foreign(upd Update) int {
+	if b.sharding == nil || b.sharding.Shards <= 1 || upd.forwarded {
+		return -1
+	}
+
+	shard := b.shardOf(upd)
+	if shard == b.sharding.Shard {
+		return -1
+	}
+	return shard
+}
+
+// forward hands the update over to the shard owning
+// it and reports whether it is owned by another one.
+func (b *Bot) forward(upd Update) bool {
+	shard := b.foreign(upd)
+	if shard < 0 {
+		return false
+	}
+	if err := b.sharding.Forward(shard, upd); err != nil {
+		b.debug(errors.WithMessagef(err, "stb: forwarding update %d", upd.ID))
+	}
+	return true
+}
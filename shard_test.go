@@ -0,0 +1,103 @@
+package stb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharding(t *testing.T) {
+	var dests [2]chan Update
+	var urls []string
+	for i := range dests {
+		dests[i] = make(chan Update, 1)
+		srv := httptest.NewServer(&Webhook{
+			Path:        "/hook",
+			SecretToken: "secret",
+			dest:        dests[i],
+			stop:        make(chan struct{}),
+			bot:         &Bot{},
+		})
+		defer srv.Close()
+		urls = append(urls, srv.URL+"/hook")
+	}
+
+	var bots [2]*Bot
+	handled := make(map[int][]int)
+	for i := range bots {
+		i := i
+		b, err := NewBot(Settings{Synchronous: true, Offline: true, Sharding: &Sharding{
+			Shards:  2,
+			Shard:   i,
+			Forward: ForwardWebhooks(urls, "secret"),
+		}})
+		require.NoError(t, err)
+		b.Default(Default).MustHandle(OnText, func(msg *Message, m *Machine) {
+			handled[i] = append(handled[i], msg.Sender.ID)
+		})
+		bots[i] = b
+	}
+
+	// find a user owned by each of the shards
+	var owned [2]*User
+	for id := 1; owned[0] == nil || owned[1] == nil; id++ {
+		user := &User{ID: id}
+		owned[bots[0].shardOf(Update{Message: &Message{Sender: user}})] = user
+	}
+
+	bots[0].ProcessUpdate(Update{ID: 1, Message: &Message{Sender: owned[0], Text: "a"}})
+	bots[0].ProcessUpdate(Update{ID: 2, Message: &Message{Sender: owned[1], Text: "b"}})
+	assert.Equal(t, []int{owned[0].ID}, handled[0])
+	assert.Empty(t, handled[1])
+
+	// the second update arrived at the webhook of its shard
+	upd := <-dests[1]
+	assert.Equal(t, 2, upd.ID)
+	assert.True(t, upd.forwarded)
+
+	// forwarded updates are never forwarded again
+	bots[0].ProcessUpdate(upd)
+	bots[1].ProcessUpdate(upd)
+	assert.Equal(t, []int{owned[0].ID, owned[1].ID}, handled[0])
+	assert.Equal(t, []int{owned[1].ID}, handled[1])
+	assert.Empty(t, dests[0])
+
+	// updates with no machine are handled where they arrive
+	assert.Equal(t, -1, bots[1].shardOf(Update{}))
+	assert.False(t, bots[1].forward(Update{}))
+}
+
+func TestShardingForwardFailure(t *testing.T) {
+	_, err := NewBot(Settings{Offline: true, Sharding: &Sharding{Shards: 2}})
+	assert.Error(t, err)
+	_, err = NewBot(Settings{Offline: true, Sharding: &Sharding{Shards: 2, Shard: 2, Forward: ForwardWebhooks(nil, "")}})
+	assert.Error(t, err)
+
+	b, err := NewBot(Settings{Offline: true, Sharding: &Sharding{
+		Shards:  2,
+		Forward: func(int, Update) error { return errors.New("unreachable") },
+	}})
+	require.NoError(t, err)
+
+	var user *User
+	for id := 1; user == nil; id++ {
+		if b.shardOf(Update{Message: &Message{Sender: &User{ID: id}}}) == 1 {
+			user = &User{ID: id}
+		}
+	}
+
+	h := &Webhook{dest: make(chan Update, 1), stop: make(chan struct{}), bot: b}
+	body, err := json.Marshal(Update{ID: 1, Message: &Message{Sender: user}})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Empty(t, h.dest)
+}
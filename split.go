@@ -0,0 +1,206 @@
+package stb
+
+import "unicode/utf16"
+
+// The limits of the texts and captions of messages,
+// in UTF-16 code units.
+const (
+	MaxTextLength    = 4096
+	MaxCaptionLength = 1024
+)
+
+// SendSplit sends what like Send, splitting texts longer than
+// MaxTextLength into several messages. Media with a caption longer
+// than MaxCaptionLength is sent with the beginning of the caption,
+// the rest follows in text messages. Texts are split at line breaks
+// or spaces and never within the entities of SendOptions, unless an
+// entity is too long to fit in a message. Texts with a parse mode are
+// split the same way, which must not fall within their formatting.
+//
+// The reply options apply to the first message, the reply markup
+// to the last one. It returns the messages sent, up to the failure
+// if sending one of them fails.
+func (b *Bot) SendSplit(to Recipient, what interface{}, options ...interface{}) ([]*Message, error) {
+	if to == nil {
+		return nil, ErrBadRecipient
+	}
+	return b.sendSplit(to, what, extractOptions(options))
+}
+
+func (b *Bot) sendSplit(to Recipient, what interface{}, opt *SendOptions) ([]*Message, error) {
+	var (
+		parts []textPart
+		sends []interface{}
+	)
+	switch object := what.(type) {
+	case string:
+		parts = splitText(object, opt.Entities, MaxTextLength, MaxTextLength)
+		sends = append(sends, parts[0].text)
+	case Sendable:
+		caption := captionOf(object)
+		if caption == nil {
+			parts = []textPart{{entities: opt.Entities}}
+			sends = append(sends, object)
+			break
+		}
+		parts = splitText(*caption, opt.Entities, MaxCaptionLength, MaxTextLength)
+		sends = append(sends, object)
+
+		// the media goes with the beginning of its caption
+		full := *caption
+		*caption = parts[0].text
+		defer func() { *caption = full }()
+	default:
+		return nil, ErrUnsupportedWhat
+	}
+	for _, p := range parts[1:] {
+		sends = append(sends, p.text)
+	}
+
+	opts := splitOptions(opt, parts)
+	var sent []*Message
+	for i, part := range sends {
+		var (
+			msg *Message
+			err error
+		)
+		switch object := part.(type) {
+		case string:
+			msg, err = b.sendText(to, object, opts[i])
+		case Sendable:
+			msg, err = object.Send(b, to, opts[i])
+		}
+		if err != nil {
+			return sent, err
+		}
+		sent = append(sent, msg)
+	}
+	return sent, nil
+}
+
+// splitOptions returns the options of each part.
+func splitOptions(opt *SendOptions, parts []textPart) []*SendOptions {
+	opts := make([]*SendOptions, len(parts))
+	for i, p := range parts {
+		o := opt.copy()
+		o.Split = false
+		o.Entities = p.entities
+		if i > 0 {
+			o.ReplyTo, o.ReplyParams = nil, nil
+		}
+		if i < len(parts)-1 {
+			o.ReplyMarkup = nil
+		}
+		opts[i] = o
+	}
+	return opts
+}
+
+// captionOf returns the caption of the media, or nil.
+func captionOf(what interface{}) *string {
+	switch media := what.(type) {
+	case *Photo:
+		return &media.Caption
+	case *Audio:
+		return &media.Caption
+	case *Document:
+		return &media.Caption
+	case *Video:
+		return &media.Caption
+	case *Animation:
+		return &media.Caption
+	case *Voice:
+		return &media.Caption
+	}
+	return nil
+}
+
+// textPart is a part of a split text with its entities.
+type textPart struct {
+	text     string
+	entities []MessageEntity
+}
+
+// splitText splits the text into parts of limit UTF-16 code units
+// at most, first for the first one. Parts end at the last line break
+// in their second half or else the last space, outside of the
+// entities, or right at the limit if an entity takes it all.
+func splitText(text string, entities []MessageEntity, first, limit int) []textPart {
+	encoded := utf16.Encode([]rune(text))
+
+	var parts []textPart
+	start := 0
+	for len(encoded)-start > first {
+		cut, skip := cutAt(encoded, entities, start, start+first)
+		parts = append(parts, textPart{
+			text:     utf16Slice(encoded, start, cut),
+			entities: clipEntities(entities, start, cut),
+		})
+		start, first = cut+skip, limit
+	}
+	return append(parts, textPart{
+		text:     utf16Slice(encoded, start, len(encoded)),
+		entities: clipEntities(entities, start, len(encoded)),
+	})
+}
+
+// cutAt returns where to cut the text before end and
+// how many separating code units to skip after the cut.
+func cutAt(text []uint16, entities []MessageEntity, start, end int) (int, int) {
+	inside := func(i int) bool {
+		for _, e := range entities {
+			if e.Offset < i && i < e.Offset+e.Length {
+				return true
+			}
+		}
+		return false
+	}
+
+	half := start + (end-start)/2
+	for i := end; i > half; i-- {
+		if text[i] == '\n' && !inside(i) {
+			return i, 1
+		}
+	}
+	for i := end; i > start; i-- {
+		if text[i] == ' ' && !inside(i) {
+			return i, 1
+		}
+	}
+	for i := end; i > start; i-- {
+		if !inside(i) && !lowSurrogate(text[i]) {
+			return i, 0
+		}
+	}
+	if lowSurrogate(text[end]) {
+		end--
+	}
+	return end, 0
+}
+
+// lowSurrogate reports whether the code unit is the second half
+// of a surrogate pair, which the text can't be cut before.
+func lowSurrogate(c uint16) bool {
+	return c >= 0xdc00 && c <= 0xdfff
+}
+
+// clipEntities returns the entities within the part of the
+// text between the offsets, relative to the part.
+func clipEntities(entities []MessageEntity, start, end int) []MessageEntity {
+	var clipped []MessageEntity
+	for _, e := range entities {
+		from, to := e.Offset, e.Offset+e.Length
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		if from >= to {
+			continue
+		}
+		e.Offset, e.Length = from-start, to-from
+		clipped = append(clipped, e)
+	}
+	return clipped
+}
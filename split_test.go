@@ -0,0 +1,72 @@
+package stb
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitText(t *testing.T) {
+	parts := splitText("aaaa bbbb\ncccc dddd", nil, 12, 12)
+	require.Len(t, parts, 2)
+	assert.Equal(t, "aaaa bbbb", parts[0].text)
+	assert.Equal(t, "cccc dddd", parts[1].text)
+
+	// the space within the bold entity is no place to cut
+	entities := []MessageEntity{{Type: EntityBold, Offset: 5, Length: 9}}
+	parts = splitText("aaaa bbbb cccc dddd", entities, 12, 12)
+	assert.Equal(t, []textPart{
+		{text: "aaaa"},
+		{text: "bbbb cccc", entities: []MessageEntity{{Type: EntityBold, Length: 9}}},
+		{text: "dddd"},
+	}, parts)
+
+	// without spaces, the text is cut at the limit, but not within an emoji
+	parts = splitText("aaa😀bbbbb", []MessageEntity{{Type: EntityItalic, Length: 10}}, 4, 4)
+	assert.Equal(t, []textPart{
+		{text: "aaa", entities: []MessageEntity{{Type: EntityItalic, Length: 3}}},
+		{text: "😀bb", entities: []MessageEntity{{Type: EntityItalic, Length: 4}}},
+		{text: "bbb", entities: []MessageEntity{{Type: EntityItalic, Length: 3}}},
+	}, parts)
+}
+
+func TestBotSendSplit(t *testing.T) {
+	api := newFakeAPI(t, "")
+	n := 0
+	api.Result = func(apiCall) string {
+		n++
+		return `{"message_id":` + strconv.Itoa(n) + `,"photo":[{"file_id":"p"}]}`
+	}
+
+	b, err := NewBot(Settings{Offline: true, URL: api.URL})
+	require.NoError(t, err)
+
+	line := strings.Repeat("a", 3000) + "\n"
+	markup := &ReplyMarkup{ForceReply: true}
+	msgs, err := b.SendSplit(&Chat{ID: 1}, line+line+line, &SendOptions{ReplyTo: &Message{ID: 9}}, markup)
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+	sent := api.Calls()
+	assert.Equal(t, 3, msgs[2].ID)
+	require.Len(t, sent, 3)
+	assert.Equal(t, "9", sent[0].Param("reply_to_message_id"))
+	assert.Empty(t, sent[1].Param("reply_to_message_id"))
+	assert.Empty(t, sent[0].Param("reply_markup"))
+	assert.NotEmpty(t, sent[2].Param("reply_markup"))
+	assert.Equal(t, strings.Repeat("a", 3000), sent[1].Param("text"))
+
+	n = 0
+	photo := &Photo{File: FromURL("https://example.com/a.jpg"), Caption: strings.Repeat("b ", 600)}
+	msg, err := b.Send(&Chat{ID: 1}, photo, Split)
+	require.NoError(t, err)
+	assert.Equal(t, 2, msg.ID)
+	sent = api.Calls()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "sendPhoto", sent[0].Method)
+	assert.Len(t, sent[0].Param("caption"), 1023)
+	assert.Equal(t, "sendMessage", sent[1].Method)
+	assert.Len(t, sent[1].Param("text"), 176)
+}
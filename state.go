@@ -1,8 +1,13 @@
 package stb
 
 import (
-	"fmt"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 type StateType string
@@ -14,33 +19,224 @@ type State struct {
 	Type     StateType
 	handlers map[string]interface{}
 	Events   map[EventType]StateType
-	action   interface{}
+	action   func(*Machine)
+
+	// parent is consulted for handlers and events
+	// the state does not define itself.
+	parent StateType
+
+	timeout       time.Duration
+	timeoutTarget StateType
+
+	// expireAfter is the idle limit of State.ExpireAfter.
+	expireAfter time.Duration
+
+	// stay keeps the machine in the state on self-transitions
+	// instead of entering it again, see Reenter.
+	stay bool
+
+	middleware []MiddlewareFunc
+
+	// duplicates are the endpoints that got a handler more
+	// than once, reported by ValidateStates.
+	duplicates map[string]bool
+
+	// starts are the deep link handlers, see HandleStart.
+	starts []startHandler
+
+	// matchers are the handlers of MessageMatcher endpoints.
+	matchers []matchHandler
+
+	// priorities are the endpoints registered with HandlePriority.
+	priorities map[string]int
+
+	// commands are the commands registered with Command.
+	commands []*CommandSpec
 
 	synchronous bool
 	verbose     bool
 	reporter    func(error)
+
+	// inflight counts the handlers running in the background.
+	inflight *sync.WaitGroup
+
+	bot *Bot
+	// upd is the update being processed and machine the machine
+	// it is processed by, only set on copies of the state.
+	upd     *Update
+	machine *Machine
 }
 
-func (s *State) Handle(endpoint interface{}, handler interface{}) {
-	switch end := endpoint.(type) {
+// Handle registers the handler for the endpoint in the state.
+// Endpoints are strings, callback buttons or message matchers
+// (see Regex and Filter).
+//
+// The handler signature is checked against the endpoint, a
+// mismatch is reported right away instead of when the endpoint
+// is triggered for the first time.
+func (s *State) Handle(endpoint interface{}, handler interface{}) error {
+	return s.handlePriority(endpoint, handler, nil)
+}
+
+// handlePriority registers the handler, with the priority
+// of the endpoint if not nil, see HandlePriority.
+func (s *State) handlePriority(endpoint interface{}, handler interface{}, priority *int) error {
+	var end string
+	switch e := endpoint.(type) {
 	case string:
-		s.handlers[end] = handler
+		end = e
 	case CallbackEndpoint:
-		s.handlers[end.CallbackUnique()] = handler
+		end = e.CallbackUnique()
+	case MessageMatcher:
+		if err := checkHandler(OnText, handler); err != nil {
+			return err
+		}
+		h := matchHandler{
+			matcher:  e,
+			handler:  withError(handler).(func(*Message, *Machine) error),
+			priority: PriorityMatcher,
+		}
+		if priority != nil {
+			h.priority = *priority
+		}
+		s.matchers = append(s.matchers, h)
+		sort.SliceStable(s.matchers, func(i, j int) bool {
+			return s.matchers[i].priority > s.matchers[j].priority
+		})
+		return nil
 	default:
-		panic("stb: unsupported endpoint")
+		return ErrUnsupportedEndpoint
+	}
+
+	if err := checkHandler(end, handler); err != nil {
+		return err
+	}
+
+	if _, ok := s.handlers[end]; ok {
+		s.duplicate(end)
+	}
+	if end == OnAlbum && s.bot != nil {
+		s.bot.albums.mu.Lock()
+		s.bot.albums.enabled = true
+		s.bot.albums.mu.Unlock()
+	}
+	s.handlers[end] = withError(handler)
+	if priority != nil {
+		if s.priorities == nil {
+			s.priorities = make(map[string]int)
+		}
+		s.priorities[end] = *priority
+	} else {
+		delete(s.priorities, end)
 	}
+	return nil
 }
 
-func (s *State) Action(handler interface{}) {
-	s.action = handler
+// MustHandle is like Handle but panics if the handler can't be registered.
+func (s *State) MustHandle(endpoint interface{}, handler interface{}) {
+	if err := s.Handle(endpoint, handler); err != nil {
+		panic(err)
+	}
+}
+
+func (s *State) Action(action func(*Machine)) {
+	s.action = action
 }
 
 func (s *State) Event(e EventType, t StateType) {
 	s.Events[e] = t
 }
 
+// Fallback sets the handler for the messages the state and its
+// parents have no handler for, e.g. to ask for a photo again when
+// the user sent text. The handler signature is the one of OnText.
+// It comes before OnAnyUpdate.
+//
+// Example:
+//
+//     askPhoto.Fallback(func(msg *stb.Message, m *stb.Machine) error {
+//         _, err := m.Send("Please send a photo, not text.")
+//         return err
+//     })
+//
+func (s *State) Fallback(handler interface{}) error {
+	return s.Handle(onFallback, handler)
+}
+
+// Reenter sets what happens on self-transitions, events that lead
+// from the state to itself. By default the machine enters the state
+// again: the action runs again, the timeout starts over and the
+// state is added to the history, e.g. to retry a step. Without
+// rerun the machine just stays in the state, only the
+// OnTransition listeners are called.
+func (s *State) Reenter(rerun bool) {
+	s.stay = !rerun
+}
+
+// Parent makes the state inherit handlers and events of
+// the parent state. The state's own handlers and events
+// take precedence, parents can have parents of their own.
+func (s *State) Parent(t StateType) {
+	s.parent = t
+}
+
+// lineage returns the state of type t followed by its ancestors,
+// from the closest to the farthest. Unknown states and cycles
+// end the lineage.
+func lineage(states map[StateType]*State, t StateType) []*State {
+	var chain []*State
+	seen := make(map[StateType]bool)
+
+	for !seen[t] {
+		state, ok := states[t]
+		if !ok {
+			break
+		}
+		seen[t] = true
+		chain = append(chain, state)
+
+		if state.parent == "" {
+			break
+		}
+		t = state.parent
+	}
+
+	return chain
+}
+
 func (s State) processUpdate(upd Update, m *Machine) bool {
+	// s is a copy, so it can carry the update down to runHandler
+	s.upd = &upd
+	s.machine = m
+
+	if upd.album != nil {
+		if handler, ok := s.handlers[OnAlbum]; ok {
+			handler := handler.(func([]*Message, *Machine) error)
+			s.runHandler(OnAlbum, func(m *Machine) error { return handler(upd.album, m) })
+			return true
+		}
+
+		handled := false
+		for _, msg := range upd.album {
+			part := upd
+			part.Message, part.album = msg, nil
+			if s.processUpdate(part, m) {
+				handled = true
+			}
+		}
+		return handled
+	}
+
+	if upd.live != nil {
+		if handler, ok := s.handlers[OnLiveLocation]; ok {
+			handler := handler.(func(*LiveLocation, *Machine) error)
+			s.runHandler(OnLiveLocation, func(m *Machine) error { return handler(upd.live, m) })
+			return true
+		}
+		if upd.live.Expired {
+			return false
+		}
+	}
 
 	if upd.Message != nil {
 		msh := upd.Message
@@ -49,39 +245,41 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 			return s.handle(OnPinned, msh, m)
 		}
 
-		// Commands
+		switch {
+		case msh.TopicCreated != nil:
+			return s.handle(OnTopicCreated, msh, m)
+		case msh.TopicEdited != nil:
+			return s.handle(OnTopicEdited, msh, m)
+		case msh.TopicClosed != nil:
+			return s.handle(OnTopicClosed, msh, m)
+		case msh.TopicReopened != nil:
+			return s.handle(OnTopicReopened, msh, m)
+		}
+
 		if msh.Text != "" {
 			// Filtering malicious messages
 			if msh.Text[0] == '\a' {
 				return false
 			}
 
-			match := cmdRx.FindAllStringSubmatch(msh.Text, -1)
-			if match != nil {
-				// Syntax: "</command>@<bot> <payload>"
-
-				command, botName := match[0][1], match[0][3]
-				if botName != "" && !strings.EqualFold(s.Me.Username, botName) {
-					return false
-				}
-
-				msh.Payload = match[0][5]
-				if s.handle(command, msh, m) {
+			routes, ok := s.textRoutes(msh)
+			if !ok {
+				return false
+			}
+			for _, route := range routes {
+				if route.run(m) {
 					return true
 				}
 			}
+			return false
+		}
 
-			// 1:1 satisfaction
-			if s.handle(msh.Text, msh, m) {
-				return true
-			}
-
-			if msh.Text[0] == '/' {
-				return s.handle(OnCommand, msh, m)
-			}
-
-			return s.handle(OnText, msh, m)
+		if s.handleMatchers(msh, m) {
+			return true
+		}
 
+		if msh.PaidMedia != nil {
+			return s.handle(OnPaidMedia, msh, m)
 		}
 
 		if s.handleMedia(msh, m) {
@@ -98,6 +296,14 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 		}
 
+		if msh.RefundedPayment != nil {
+			return s.handle(OnRefund, msh, m)
+		}
+
+		if msh.WebAppData != nil {
+			return s.handle(OnWebAppData, msh, m)
+		}
+
 		wasAdded := (msh.UserJoined != nil && msh.UserJoined.ID == s.Me.ID) ||
 			(msh.UsersJoined != nil && isUserInList(s.Me, msh.UsersJoined))
 		if msh.GroupCreated || msh.SuperGroupCreated || wasAdded {
@@ -145,12 +351,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 		if msh.MigrateTo != 0 {
 			if handler, ok := s.handlers[OnMigration]; ok {
-				handler, ok := handler.(func(int64, int64))
-				if !ok {
-					panic("stb: migration handler is bad")
-				}
+				handler := handler.(func(int64, int64) error)
 
-				s.runHandler(func() { handler(msh.Chat.ID, msh.MigrateTo) })
+				s.runHandler(OnMigration, func(*Machine) error { return handler(msh.Chat.ID, msh.MigrateTo) })
 				return true
 			}
 
@@ -159,12 +362,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 		if msh.VoiceChatStarted != nil {
 			if handler, ok := s.handlers[OnVoiceChatStarted]; ok {
-				handler, ok := handler.(func(*Message))
-				if !ok {
-					panic("stb: voice chat started handler is bad")
-				}
+				handler := handler.(func(*Message) error)
 
-				s.runHandler(func() { handler(msh) })
+				s.runHandler(OnVoiceChatStarted, func(*Machine) error { return handler(msh) })
 				return true
 			}
 
@@ -173,12 +373,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 		if msh.VoiceChatEnded != nil {
 			if handler, ok := s.handlers[OnVoiceChatEnded]; ok {
-				handler, ok := handler.(func(*Message))
-				if !ok {
-					panic("stb: voice chat ended handler is bad")
-				}
+				handler := handler.(func(*Message) error)
 
-				s.runHandler(func() { handler(msh) })
+				s.runHandler(OnVoiceChatEnded, func(*Machine) error { return handler(msh) })
 				return true
 			}
 
@@ -187,12 +384,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 		if msh.VoiceChatParticipantsInvited != nil {
 			if handler, ok := s.handlers[OnVoiceChatParticipantsInvited]; ok {
-				handler, ok := handler.(func(*Message))
-				if !ok {
-					panic("stb: voice chat participants invited handler is bad")
-				}
+				handler := handler.(func(*Message) error)
 
-				s.runHandler(func() { handler(msh) })
+				s.runHandler(OnVoiceChatParticipantsInvited, func(*Machine) error { return handler(msh) })
 				return true
 			}
 
@@ -201,12 +395,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 		if msh.ProximityAlert != nil {
 			if handler, ok := s.handlers[OnProximityAlert]; ok {
-				handler, ok := handler.(func(*Message))
-				if !ok {
-					panic("stb: proximity alert handler is bad")
-				}
+				handler := handler.(func(*Message) error)
 
-				s.runHandler(func() { handler(msh) })
+				s.runHandler(OnProximityAlert, func(*Machine) error { return handler(msh) })
 				return true
 			}
 
@@ -215,12 +406,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 		if msh.AutoDeleteTimer != nil {
 			if handler, ok := s.handlers[OnAutoDeleteTimer]; ok {
-				handler, ok := handler.(func(*Message))
-				if !ok {
-					panic("stb: auto delete timer handler is bad")
-				}
+				handler := handler.(func(*Message) error)
 
-				s.runHandler(func() { handler(msh) })
+				s.runHandler(OnAutoDeleteTimer, func(*Machine) error { return handler(msh) })
 				return true
 			}
 
@@ -229,12 +417,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 		if msh.VoiceChatSchedule != nil {
 			if handler, ok := s.handlers[OnVoiceChatScheduled]; ok {
-				handler, ok := handler.(func(*Message))
-				if !ok {
-					panic("stb: voice chat scheduled is bad")
-				}
+				handler := handler.(func(*Message) error)
 
-				s.runHandler(func() { handler(msh) })
+				s.runHandler(OnVoiceChatScheduled, func(*Machine) error { return handler(msh) })
 				return true
 			}
 
@@ -243,6 +428,14 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 	}
 
 	if upd.EditedMessage != nil {
+		upd.EditedMessage.IsEdited = true
+		if s.bot != nil && s.bot.routeEdits {
+			fresh := upd
+			fresh.Message, fresh.EditedMessage = upd.EditedMessage, nil
+			if s.processUpdate(fresh, m) {
+				return true
+			}
+		}
 		return s.handle(OnEdited, upd.EditedMessage, m)
 
 	}
@@ -281,13 +474,10 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 					unique, payload := match[0][1], match[0][3]
 
 					if handler, ok := s.handlers["\f"+unique]; ok {
-						handler, ok := handler.(func(*Callback, *Machine))
-						if !ok {
-							panic(fmt.Errorf("stb: %s callback handler is bad", unique))
-						}
+						handler := handler.(func(*Callback, *Machine) error)
 
 						upd.Callback.Data = payload
-						s.runHandler(func() { handler(upd.Callback, m) })
+						s.runHandler("\f"+unique, func(m *Machine) error { return handler(upd.Callback, m) })
 
 						return true
 					}
@@ -296,12 +486,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 		}
 
 		if handler, ok := s.handlers[OnCallback]; ok {
-			handler, ok := handler.(func(*Callback, *Machine))
-			if !ok {
-				panic("stb: callback handler is bad")
-			}
+			handler := handler.(func(*Callback, *Machine) error)
 
-			s.runHandler(func() { handler(upd.Callback, m) })
+			s.runHandler(OnCallback, func(m *Machine) error { return handler(upd.Callback, m) })
 			return true
 		}
 
@@ -310,12 +497,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 	if upd.Query != nil {
 		if handler, ok := s.handlers[OnQuery]; ok {
-			handler, ok := handler.(func(*Query, *Machine))
-			if !ok {
-				panic("stb: query handler is bad")
-			}
+			handler := handler.(func(*Query, *Machine) error)
 
-			s.runHandler(func() { handler(upd.Query, m) })
+			s.runHandler(OnQuery, func(m *Machine) error { return handler(upd.Query, m) })
 			return true
 		}
 
@@ -324,12 +508,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 	if upd.ChosenInlineResult != nil {
 		if handler, ok := s.handlers[OnChosenInlineResult]; ok {
-			handler, ok := handler.(func(*ChosenInlineResult, *Machine))
-			if !ok {
-				panic("stb: chosen inline result handler is bad")
-			}
+			handler := handler.(func(*ChosenInlineResult, *Machine) error)
 
-			s.runHandler(func() { handler(upd.ChosenInlineResult, m) })
+			s.runHandler(OnChosenInlineResult, func(m *Machine) error { return handler(upd.ChosenInlineResult, m) })
 			return true
 		}
 
@@ -338,12 +519,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 	if upd.ShippingQuery != nil {
 		if handler, ok := s.handlers[OnShipping]; ok {
-			handler, ok := handler.(func(*ShippingQuery, *Machine))
-			if !ok {
-				panic("stb: shipping query handler is bad")
-			}
+			handler := handler.(func(*ShippingQuery, *Machine) error)
 
-			s.runHandler(func() { handler(upd.ShippingQuery, m) })
+			s.runHandler(OnShipping, func(m *Machine) error { return handler(upd.ShippingQuery, m) })
 			return true
 		}
 
@@ -352,12 +530,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 	if upd.PreCheckoutQuery != nil {
 		if handler, ok := s.handlers[OnCheckout]; ok {
-			handler, ok := handler.(func(*PreCheckoutQuery, *Machine))
-			if !ok {
-				panic("stb: pre checkout query handler is bad")
-			}
+			handler := handler.(func(*PreCheckoutQuery, *Machine) error)
 
-			s.runHandler(func() { handler(upd.PreCheckoutQuery, m) })
+			s.runHandler(OnCheckout, func(m *Machine) error { return handler(upd.PreCheckoutQuery, m) })
 			return true
 		}
 
@@ -366,12 +541,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 	if upd.Poll != nil {
 		if handler, ok := s.handlers[OnPoll]; ok {
-			handler, ok := handler.(func(*Poll))
-			if !ok {
-				panic("stb: poll handler is bad")
-			}
+			handler := handler.(func(*Poll) error)
 
-			s.runHandler(func() { handler(upd.Poll) })
+			s.runHandler(OnPoll, func(*Machine) error { return handler(upd.Poll) })
 			return true
 		}
 
@@ -380,12 +552,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 	if upd.PollAnswer != nil {
 		if handler, ok := s.handlers[OnPollAnswer]; ok {
-			handler, ok := handler.(func(*PollAnswer, *Machine))
-			if !ok {
-				panic("stb: poll answer handler is bad")
-			}
+			handler := handler.(func(*PollAnswer, *Machine) error)
 
-			s.runHandler(func() { handler(upd.PollAnswer, m) })
+			s.runHandler(OnPollAnswer, func(m *Machine) error { return handler(upd.PollAnswer, m) })
 			return true
 		}
 
@@ -394,12 +563,9 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 	if upd.MyChatMember != nil {
 		if handler, ok := s.handlers[OnMyChatMember]; ok {
-			handler, ok := handler.(func(*ChatMemberUpdated, *Machine))
-			if !ok {
-				panic("stb: my chat member handler is bad")
-			}
+			handler := handler.(func(*ChatMemberUpdated, *Machine) error)
 
-			s.runHandler(func() { handler(upd.MyChatMember, m) })
+			s.runHandler(OnMyChatMember, func(m *Machine) error { return handler(upd.MyChatMember, m) })
 			return true
 		}
 
@@ -408,12 +574,105 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 
 	if upd.ChatMember != nil {
 		if handler, ok := s.handlers[OnChatMember]; ok {
-			handler, ok := handler.(func(*ChatMemberUpdated, *Machine))
-			if !ok {
-				panic("stb: chat member handler is bad")
-			}
+			handler := handler.(func(*ChatMemberUpdated, *Machine) error)
+
+			s.runHandler(OnChatMember, func(m *Machine) error { return handler(upd.ChatMember, m) })
+			return true
+		}
+
+		return false
+	}
+
+	if upd.ChatJoinRequest != nil {
+		if handler, ok := s.handlers[OnChatJoinRequest]; ok {
+			handler := handler.(func(*ChatJoinRequest, *Machine) error)
+
+			s.runHandler(OnChatJoinRequest, func(m *Machine) error { return handler(upd.ChatJoinRequest, m) })
+			return true
+		}
+
+		return false
+	}
+
+	if upd.MessageReaction != nil {
+		if handler, ok := s.handlers[OnReaction]; ok {
+			handler := handler.(func(*MessageReaction, *Machine) error)
+
+			s.runHandler(OnReaction, func(m *Machine) error { return handler(upd.MessageReaction, m) })
+			return true
+		}
+
+		return false
+	}
+
+	if upd.MessageReactionCount != nil {
+		if handler, ok := s.handlers[OnReactionCount]; ok {
+			handler := handler.(func(*MessageReactionCount, *Machine) error)
+
+			s.runHandler(OnReactionCount, func(m *Machine) error { return handler(upd.MessageReactionCount, m) })
+			return true
+		}
+
+		return false
+	}
+
+	if upd.BusinessConnection != nil {
+		if handler, ok := s.handlers[OnBusinessConnection]; ok {
+			handler := handler.(func(*BusinessConnection, *Machine) error)
+
+			s.runHandler(OnBusinessConnection, func(m *Machine) error { return handler(upd.BusinessConnection, m) })
+			return true
+		}
+
+		return false
+	}
+
+	if upd.BusinessMessage != nil {
+		return s.handle(OnBusinessMessage, upd.BusinessMessage, m)
+	}
+
+	if upd.EditedBusinessMessage != nil {
+		return s.handle(OnEditedBusinessMessage, upd.EditedBusinessMessage, m)
+	}
+
+	if upd.DeletedBusinessMessages != nil {
+		if handler, ok := s.handlers[OnDeletedBusinessMessages]; ok {
+			handler := handler.(func(*BusinessMessagesDeleted, *Machine) error)
+
+			s.runHandler(OnDeletedBusinessMessages, func(m *Machine) error { return handler(upd.DeletedBusinessMessages, m) })
+			return true
+		}
+
+		return false
+	}
+
+	if upd.ChatBoost != nil {
+		if handler, ok := s.handlers[OnChatBoost]; ok {
+			handler := handler.(func(*ChatBoostUpdated, *Machine) error)
+
+			s.runHandler(OnChatBoost, func(m *Machine) error { return handler(upd.ChatBoost, m) })
+			return true
+		}
+
+		return false
+	}
+
+	if upd.ChatBoostRemoved != nil {
+		if handler, ok := s.handlers[OnChatBoostRemoved]; ok {
+			handler := handler.(func(*ChatBoostRemoved, *Machine) error)
 
-			s.runHandler(func() { handler(upd.ChatMember, m) })
+			s.runHandler(OnChatBoostRemoved, func(m *Machine) error { return handler(upd.ChatBoostRemoved, m) })
+			return true
+		}
+
+		return false
+	}
+
+	if upd.PaidMediaPurchased != nil {
+		if handler, ok := s.handlers[OnPaidMediaPurchased]; ok {
+			handler := handler.(func(*PaidMediaPurchased, *Machine) error)
+
+			s.runHandler(OnPaidMediaPurchased, func(m *Machine) error { return handler(upd.PaidMediaPurchased, m) })
 			return true
 		}
 
@@ -422,26 +681,92 @@ func (s State) processUpdate(upd Update, m *Machine) bool {
 	return false
 }
 
-func (s *State) runHandler(handler func()) {
+// processFallback runs the Fallback handler for a message.
+func (s State) processFallback(upd Update, m *Machine) bool {
+	if upd.Message == nil {
+		return false
+	}
+
+	s.upd = &upd
+	s.machine = m
+	return s.handle(onFallback, upd.Message, m)
+}
+
+// processReply runs the Reply handler for a reply to a question.
+func (s State) processReply(end string, upd Update, m *Machine) bool {
+	s.upd = &upd
+	s.machine = m
+	return s.handle(end, upd.Message, m)
+}
+
+// processAny runs the handler of an endpoint taking the whole
+// update, OnAnyUpdate or OnEveryUpdate. It reports whether there
+// was one.
+func (s State) processAny(end string, upd Update, m *Machine) bool {
+	handler, ok := s.handlers[end]
+	if !ok {
+		return false
+	}
+
+	s.upd = &upd
+	s.machine = m
+	h := handler.(func(*Update, *Machine) error)
+	s.runHandler(end, func(m *Machine) error { return h(&upd, m) })
+	return true
+}
+
+func (s *State) runHandler(end string, handler func(m *Machine) error) {
+	var upd Update
+	if s.upd != nil {
+		upd = *s.upd
+	}
+
 	f := func() {
-		defer s.deferDebug()
-		handler()
+		defer s.deferDebug(upd)
+
+		ctx := upd.ctx
+		if ctx == nil && s.machine != nil {
+			ctx = s.machine.Context()
+		}
+		attrs := map[string]interface{}{
+			"stb.state":    string(s.Type),
+			"stb.endpoint": end,
+		}
+		if s.machine != nil {
+			attrs["stb.machine"] = s.machine.id
+		}
+		ctx, span := s.bot.startSpan(ctx, "stb.handler", attrs)
+		m := s.machine
+		if m != nil {
+			m = m.withContext(ctx)
+		}
+
+		start := time.Now()
+		err := handler(m)
+		s.bot.observeHandler(s.Type, end, time.Since(start), err)
+		span.End(err)
+		if err != nil {
+			s.bot.handleError(err, upd)
+		}
 	}
-	if s.synchronous {
+	// handlers of an update already run on the worker of its chat,
+	// only actions are moved into the background
+	if s.synchronous || s.upd != nil {
 		f()
 	} else {
-		go f()
+		s.inflight.Add(1)
+		go func() {
+			defer s.inflight.Done()
+			f()
+		}()
 	}
 }
 
 func (s *State) handle(end string, msg *Message, m *Machine) bool {
 
 	if handler, ok := s.handlers[end]; ok {
-		handler, ok := handler.(func(*Message, *Machine))
-		if !ok {
-			panic(fmt.Errorf("stb: %s handler is bad", end))
-		}
-		s.runHandler(func() { handler(msg, m) })
+		handler := handler.(func(*Message, *Machine) error)
+		s.runHandler(end, func(m *Machine) error { return handler(msg, m) })
 
 		return true
 	}
@@ -449,34 +774,162 @@ func (s *State) handle(end string, msg *Message, m *Machine) bool {
 	return false
 }
 
+// duplicate records that the endpoint got one more handler.
+func (s *State) duplicate(end string) {
+	if s.duplicates == nil {
+		s.duplicates = make(map[string]bool)
+	}
+	s.duplicates[end] = true
+}
+
+// handleMedia reports whether the state has a handler for the
+// media of the message. Media it has none for go on to the parent
+// states and the bot, like the other updates, see State.Use.
 func (s *State) handleMedia(msg *Message, m *Machine) bool {
 	switch {
 	case msg.Photo != nil:
-		s.handle(OnPhoto, msg, m)
+		return s.handle(OnPhoto, msg, m)
 	case msg.Voice != nil:
-		s.handle(OnVoice, msg, m)
+		return s.handle(OnVoice, msg, m)
 	case msg.Audio != nil:
-		s.handle(OnAudio, msg, m)
+		return s.handle(OnAudio, msg, m)
 	case msg.Animation != nil:
-		s.handle(OnAnimation, msg, m)
+		return s.handle(OnAnimation, msg, m)
 	case msg.Document != nil:
-		s.handle(OnDocument, msg, m)
+		return s.handle(OnDocument, msg, m)
 	case msg.Sticker != nil:
-		s.handle(OnSticker, msg, m)
+		return s.handle(OnSticker, msg, m)
 	case msg.Video != nil:
-		s.handle(OnVideo, msg, m)
+		return s.handle(OnVideo, msg, m)
 	case msg.VideoNote != nil:
-		s.handle(OnVideoNote, msg, m)
+		return s.handle(OnVideoNote, msg, m)
 	case msg.Contact != nil:
-		s.handle(OnContact, msg, m)
+		return s.handle(OnContact, msg, m)
 	case msg.Location != nil:
-		s.handle(OnLocation, msg, m)
+		return s.handle(OnLocation, msg, m)
 	case msg.Venue != nil:
-		s.handle(OnVenue, msg, m)
+		return s.handle(OnVenue, msg, m)
 	case msg.Dice != nil:
-		s.handle(OnDice, msg, m)
+		return s.handle(OnDice, msg, m)
 	default:
 		return false
 	}
-	return true
+}
+
+// handlerTypes maps endpoints to the handler signature they expect.
+// Any other endpoint expects func(*Message, *Machine).
+var handlerTypes = map[string]interface{}{
+	OnMigration:                    func(int64, int64) {},
+	OnVoiceChatStarted:             func(*Message) {},
+	OnVoiceChatEnded:               func(*Message) {},
+	OnVoiceChatParticipantsInvited: func(*Message) {},
+	OnProximityAlert:               func(*Message) {},
+	OnAutoDeleteTimer:              func(*Message) {},
+	OnVoiceChatScheduled:           func(*Message) {},
+	OnCallback:                     func(*Callback, *Machine) {},
+	OnQuery:                        func(*Query, *Machine) {},
+	OnChosenInlineResult:           func(*ChosenInlineResult, *Machine) {},
+	OnShipping:                     func(*ShippingQuery, *Machine) {},
+	OnCheckout:                     func(*PreCheckoutQuery, *Machine) {},
+	OnPoll:                         func(*Poll) {},
+	OnPollAnswer:                   func(*PollAnswer, *Machine) {},
+	OnMyChatMember:                 func(*ChatMemberUpdated, *Machine) {},
+	OnChatMember:                   func(*ChatMemberUpdated, *Machine) {},
+	OnChatJoinRequest:              func(*ChatJoinRequest, *Machine) {},
+	OnReaction:                     func(*MessageReaction, *Machine) {},
+	OnReactionCount:                func(*MessageReactionCount, *Machine) {},
+	OnAlbum:                        func([]*Message, *Machine) {},
+	OnLiveLocation:                 func(*LiveLocation, *Machine) {},
+	OnPaidMediaPurchased:           func(*PaidMediaPurchased, *Machine) {},
+	OnBusinessConnection:           func(*BusinessConnection, *Machine) {},
+	OnDeletedBusinessMessages:      func(*BusinessMessagesDeleted, *Machine) {},
+	OnChatBoost:                    func(*ChatBoostUpdated, *Machine) {},
+	OnChatBoostRemoved:             func(*ChatBoostRemoved, *Machine) {},
+	OnAnyUpdate:                    func(*Update, *Machine) {},
+	OnBotBlocked:                   func(*Machine) {},
+	OnBotUnblocked:                 func(*Machine) {},
+	OnExpire:                       func(*Machine) {},
+	OnEveryUpdate:                  func(*Update, *Machine) {},
+}
+
+// checkHandler returns ErrBadHandler if the handler does not have
+// the signature the endpoint expects, with or without an error result.
+func checkHandler(end string, handler interface{}) error {
+	want, ok := handlerTypes[end]
+	switch {
+	case ok:
+	case strings.HasPrefix(end, "\f"):
+		want = handlerTypes[OnCallback]
+	default:
+		want = func(*Message, *Machine) {}
+	}
+
+	plain := reflect.TypeOf(want)
+	in := make([]reflect.Type, plain.NumIn())
+	for i := range in {
+		in[i] = plain.In(i)
+	}
+	failable := reflect.FuncOf(in, []reflect.Type{errorType}, false)
+
+	if t := reflect.TypeOf(handler); t != plain && t != failable {
+		return errors.Wrapf(ErrBadHandler, "%q expects %T, got %T", end, want, handler)
+	}
+	return nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// withError turns a handler into its error returning form,
+// which is the only one processUpdate has to deal with.
+func withError(handler interface{}) interface{} {
+	switch h := handler.(type) {
+	case func(*Message, *Machine):
+		return func(msg *Message, m *Machine) error { h(msg, m); return nil }
+	case func(*Message):
+		return func(msg *Message) error { h(msg); return nil }
+	case func(int64, int64):
+		return func(from, to int64) error { h(from, to); return nil }
+	case func(*Callback, *Machine):
+		return func(c *Callback, m *Machine) error { h(c, m); return nil }
+	case func(*Query, *Machine):
+		return func(q *Query, m *Machine) error { h(q, m); return nil }
+	case func(*ChosenInlineResult, *Machine):
+		return func(r *ChosenInlineResult, m *Machine) error { h(r, m); return nil }
+	case func(*ShippingQuery, *Machine):
+		return func(q *ShippingQuery, m *Machine) error { h(q, m); return nil }
+	case func(*PreCheckoutQuery, *Machine):
+		return func(q *PreCheckoutQuery, m *Machine) error { h(q, m); return nil }
+	case func(*Poll):
+		return func(p *Poll) error { h(p); return nil }
+	case func(*PollAnswer, *Machine):
+		return func(a *PollAnswer, m *Machine) error { h(a, m); return nil }
+	case func(*ChatMemberUpdated, *Machine):
+		return func(u *ChatMemberUpdated, m *Machine) error { h(u, m); return nil }
+	case func(*ChatJoinRequest, *Machine):
+		return func(r *ChatJoinRequest, m *Machine) error { h(r, m); return nil }
+	case func(*MessageReaction, *Machine):
+		return func(r *MessageReaction, m *Machine) error { h(r, m); return nil }
+	case func(*MessageReactionCount, *Machine):
+		return func(r *MessageReactionCount, m *Machine) error { h(r, m); return nil }
+	case func([]*Message, *Machine):
+		return func(msgs []*Message, m *Machine) error { h(msgs, m); return nil }
+	case func(*LiveLocation, *Machine):
+		return func(l *LiveLocation, m *Machine) error { h(l, m); return nil }
+	case func(*PaidMediaPurchased, *Machine):
+		return func(p *PaidMediaPurchased, m *Machine) error { h(p, m); return nil }
+	case func(*BusinessConnection, *Machine):
+		return func(c *BusinessConnection, m *Machine) error { h(c, m); return nil }
+	case func(*BusinessMessagesDeleted, *Machine):
+		return func(d *BusinessMessagesDeleted, m *Machine) error { h(d, m); return nil }
+	case func(*ChatBoostUpdated, *Machine):
+		return func(u *ChatBoostUpdated, m *Machine) error { h(u, m); return nil }
+	case func(*ChatBoostRemoved, *Machine):
+		return func(r *ChatBoostRemoved, m *Machine) error { h(r, m); return nil }
+	case func(*Machine):
+		return func(m *Machine) error { h(m); return nil }
+	case func(*Update, *Machine):
+		return func(upd *Update, m *Machine) error { h(upd, m); return nil }
+	default:
+		return handler
+	}
 }
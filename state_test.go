@@ -0,0 +1,325 @@
+package stb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateHandle(t *testing.T) {
+	b, err := NewBot(Settings{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := b.State("A")
+
+	assert.NoError(t, s.Handle("/start", func(*Message, *Machine) {}))
+	assert.NoError(t, s.Handle(OnCallback, func(*Callback, *Machine) {}))
+	assert.NoError(t, s.Handle(&InlineButton{Unique: "u"}, func(*Callback, *Machine) {}))
+	assert.NoError(t, s.Handle(OnMigration, func(int64, int64) {}))
+
+	err = s.Handle("/start", func(*Message) {})
+	assert.True(t, errors.Is(err, ErrBadHandler))
+	err = s.Handle(&InlineButton{Unique: "u"}, func(*Message, *Machine) {})
+	assert.True(t, errors.Is(err, ErrBadHandler))
+	assert.Error(t, s.Handle(OnText, nil))
+	assert.Equal(t, ErrUnsupportedEndpoint, s.Handle(1, func() {}))
+
+	assert.Panics(t, func() { s.MustHandle(OnQuery, func(*Query) {}) })
+}
+
+func TestStateParent(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	settings := b.State("Settings")
+	settings.Event("cancel", Default)
+	settings.Handle("/cancel", func(msg *Message, m *Machine) {
+		got = append(got, "settings")
+		assert.NoError(t, m.SendEvent("cancel"))
+	})
+	settings.Handle(OnText, func(*Message, *Machine) {
+		got = append(got, "settings text")
+	})
+
+	lang := b.State("Language")
+	lang.Parent("Settings")
+	lang.Handle(OnText, func(*Message, *Machine) {
+		got = append(got, "language text")
+	})
+
+	b.Default(Default).Event("lang", "Language")
+
+	user := &User{ID: 1}
+	m := b.machine(user)
+	assert.NoError(t, m.SendEvent("lang"))
+
+	b.ProcessUpdate(Update{Message: &Message{Text: "en", Sender: user}})
+	b.ProcessUpdate(Update{Message: &Message{Text: "/cancel", Sender: user}})
+
+	assert.Equal(t, []string{"language text", "settings"}, got)
+	assert.Equal(t, Default, m.Current())
+
+	// cycles must not hang the lookup
+	settings.Parent("Language")
+	assert.Len(t, lineage(b.states, "Language"), 2)
+}
+
+func TestStateMedia(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	settings := b.State("Settings")
+	settings.Handle(OnPhoto, func(*Message, *Machine) {
+		got = append(got, "settings photo")
+	})
+	lang := b.State("Language")
+	lang.Parent("Settings")
+	lang.Handle(OnVoice, func(*Message, *Machine) {
+		got = append(got, "language voice")
+	})
+	b.Handle(OnVoice, func(*Message, *Machine) {
+		got = append(got, "global voice")
+	})
+	b.Handle(OnSticker, func(*Message, *Machine) {
+		got = append(got, "global sticker")
+	})
+	b.Default(Default).Event("lang", "Language")
+
+	user := &User{ID: 1}
+	assert.NoError(t, b.machine(user).SendEvent("lang"))
+
+	// media the state has no handler for go on to its parent and the bot
+	b.ProcessUpdate(Update{Message: &Message{Voice: &Voice{}, Sender: user}})
+	b.ProcessUpdate(Update{Message: &Message{Photo: &Photo{}, Sender: user}})
+	b.ProcessUpdate(Update{Message: &Message{Sticker: &Sticker{}, Sender: user}})
+
+	assert.Equal(t, []string{"language voice", "settings photo", "global sticker"}, got)
+}
+
+func TestStateHandleError(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		gotErr error
+		gotUpd Update
+	)
+	b.OnError(func(err error, upd Update) {
+		gotErr, gotUpd = err, upd
+	})
+
+	failed := errors.New("failed")
+	s := b.Default(Default)
+	assert.NoError(t, s.Handle("/fail", func(*Message, *Machine) error { return failed }))
+	assert.NoError(t, s.Handle(OnCallback, func(*Callback, *Machine) error { return nil }))
+	assert.True(t, errors.Is(s.Handle(OnText, func(*Message) error { return nil }), ErrBadHandler))
+
+	upd := Update{ID: 7, Message: &Message{Text: "/fail", Sender: &User{ID: 1}}}
+	b.ProcessUpdate(upd)
+	assert.Equal(t, failed, gotErr)
+	assert.Equal(t, 7, gotUpd.ID)
+}
+
+func TestStateReaction(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		votes  []string
+		counts int
+	)
+	s := b.Default(Default)
+	s.Handle(OnReaction, func(r *MessageReaction, m *Machine) {
+		votes = append(votes, r.NewReaction[0].Emoji)
+		assert.Equal(t, "1", m.ID())
+	})
+	b.Handle(OnReactionCount, func(r *MessageReactionCount, m *Machine) {
+		counts = r.Reactions[0].Count
+	})
+
+	b.ProcessUpdate(Update{MessageReaction: &MessageReaction{
+		User:        &User{ID: 1},
+		NewReaction: []ReactionType{{Type: "emoji", Emoji: "👍"}},
+	}})
+	b.ProcessUpdate(Update{MessageReactionCount: &MessageReactionCount{
+		Reactions: []ReactionCount{{Type: ReactionType{Type: "emoji", Emoji: "👍"}, Count: 3}},
+	}})
+
+	assert.Equal(t, []string{"👍"}, votes)
+	assert.Equal(t, 3, counts)
+}
+
+func TestStateTopic(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	s := b.Default(Default)
+	s.Handle(OnTopicCreated, func(msg *Message, _ *Machine) {
+		got = append(got, "created "+msg.TopicCreated.Name)
+	})
+	s.Handle(OnTopicClosed, func(*Message, *Machine) {
+		got = append(got, "closed")
+	})
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, TopicCreated: &TopicCreated{Name: "news"}}})
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, TopicClosed: &TopicClosed{}}})
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, TopicReopened: &TopicReopened{}}})
+
+	assert.Equal(t, []string{"created news", "closed"}, got)
+}
+
+func TestStateChatBoost(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	s := b.Default(Default)
+	s.Handle(OnChatBoost, func(u *ChatBoostUpdated, m *Machine) {
+		got = append(got, string(u.Boost.Source.Source)+" "+m.ID())
+	})
+	s.Handle(OnChatBoostRemoved, func(r *ChatBoostRemoved, _ *Machine) {
+		got = append(got, "removed "+r.BoostID)
+	})
+	b.Handle(OnChatBoost, func(u *ChatBoostUpdated, m *Machine) {
+		got = append(got, fmt.Sprintf("unclaimed %v", m == nil))
+	})
+
+	var upd Update
+	err = json.Unmarshal([]byte(`{"chat_boost": {
+		"chat": {"id": -100, "type": "channel"},
+		"boost": {"boost_id": "b1", "add_date": 1, "expiration_date": 2,
+			"source": {"source": "premium", "user": {"id": 5}}}
+	}}`), &upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ProcessUpdate(upd)
+
+	b.ProcessUpdate(Update{ChatBoost: &ChatBoostUpdated{
+		Chat:  Chat{ID: -100},
+		Boost: ChatBoost{Source: ChatBoostSource{Source: BoostGiveaway, Unclaimed: true}},
+	}})
+	b.ProcessUpdate(Update{ChatBoostRemoved: &ChatBoostRemoved{
+		Chat:    Chat{ID: -100},
+		BoostID: "b1",
+		Source:  ChatBoostSource{Source: BoostPremium, User: &User{ID: 5}},
+	}})
+
+	assert.Equal(t, []string{"premium 5", "unclaimed true", "removed b1"}, got)
+}
+
+func TestStateAnyUpdate(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	b.MustHandle(OnEveryUpdate, func(upd *Update, m *Machine) {
+		got = append(got, fmt.Sprintf("tap %d", upd.ID))
+	})
+	b.MustHandle(OnAnyUpdate, func(upd *Update, m *Machine) {
+		got = append(got, fmt.Sprintf("global %d %v", upd.ID, m == nil))
+	})
+
+	start := b.Default(Default)
+	start.Event("photo", "Photo")
+	start.MustHandle(OnText, func(*Message, *Machine) {
+		got = append(got, "text")
+	})
+	photo := b.State("Photo")
+	photo.MustHandle(OnPhoto, func(*Message, *Machine) {})
+	photo.MustHandle(OnAnyUpdate, func(upd *Update, m *Machine) {
+		got = append(got, fmt.Sprintf("photo %d in %s", upd.ID, m.Current()))
+	})
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{ID: 1, Message: &Message{Text: "hi", Sender: user}})
+	b.ProcessUpdate(Update{ID: 2, Message: &Message{Sticker: &Sticker{}, Sender: user}})
+	b.ProcessUpdate(Update{ID: 3, Poll: &Poll{}})
+	assert.NoError(t, b.machine(user).SendEvent("photo"))
+	b.ProcessUpdate(Update{ID: 4, Message: &Message{Text: "hi", Sender: user}})
+
+	assert.Equal(t, []string{
+		"tap 1", "text",
+		"tap 2", "global 2 false",
+		"tap 3", "global 3 true",
+		"tap 4", "photo 4 in Photo",
+	}, got)
+}
+
+func TestStateFallback(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	b.MustHandle("/cancel", func(*Message, *Machine) {
+		got = append(got, "cancel")
+	})
+	b.MustHandle(OnAnyUpdate, func(*Update, *Machine) {
+		got = append(got, "any")
+	})
+
+	ask := b.Default(Default)
+	ask.MustHandle(OnPhoto, func(*Message, *Machine) {
+		got = append(got, "photo")
+	})
+	assert.NoError(t, ask.Fallback(func(msg *Message, m *Machine) error {
+		got = append(got, "fallback "+msg.Text)
+		return nil
+	}))
+	assert.True(t, errors.Is(ask.Fallback(func(*Callback, *Machine) {}), ErrBadHandler))
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{Message: &Message{Photo: &Photo{}, Sender: user}})
+	b.ProcessUpdate(Update{Message: &Message{Text: "hi", Sender: user}})
+	b.ProcessUpdate(Update{Message: &Message{Text: "/cancel", Sender: user}})
+	b.ProcessUpdate(Update{Callback: &Callback{Sender: user}})
+
+	assert.Equal(t, []string{"photo", "fallback hi", "cancel", "any"}, got)
+}
+
+func TestStateRouteEdits(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, RouteEdits: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	s := b.Default(Default)
+	s.Handle("/age", func(msg *Message, m *Machine) {
+		got = append(got, fmt.Sprintf("age %s %v", msg.Payload, msg.IsEdited))
+	})
+	s.Handle(OnEdited, func(msg *Message, m *Machine) {
+		got = append(got, "edited "+msg.Text)
+	})
+
+	user, chat := &User{ID: 1}, &Chat{ID: 1}
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: chat, Text: "/age 3"}})
+	b.ProcessUpdate(Update{EditedMessage: &Message{Sender: user, Chat: chat, Text: "/age 30"}})
+	b.ProcessUpdate(Update{EditedMessage: &Message{Sender: user, Chat: chat, Text: "hi"}})
+
+	assert.Equal(t, []string{"age 3 false", "age 30 true", "edited hi"}, got)
+}
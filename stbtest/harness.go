@@ -0,0 +1,217 @@
+package stbtest
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/exp625/stb"
+)
+
+// Harness runs the states of a bot against a Server and checks
+// what a conversation does, one update at a time.
+//
+// Example:
+//
+//     h := stbtest.NewHarness(t, func(b *stb.Bot) {
+//         b.Default(stb.Default).Handle("/start", onStart)
+//         b.State("AskName").Handle(stb.OnText, onName)
+//     })
+//
+//     user := &stb.User{ID: 1}
+//     h.SendText(user, "/start").
+//         ExpectState("AskName").
+//         ExpectReplyContains("What is your name")
+//
+type Harness struct {
+	t      testing.TB
+	bot    *stb.Bot
+	server *Server
+}
+
+// NewHarness creates a synchronous bot on a new Server and
+// lets states set it up. Both are closed with the test.
+func NewHarness(t testing.TB, states func(*stb.Bot)) *Harness {
+	t.Helper()
+
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+
+	b, err := srv.NewBot(stb.Settings{Synchronous: true})
+	if err != nil {
+		t.Fatalf("stbtest: creating bot: %v", err)
+	}
+	states(b)
+
+	return &Harness{t: t, bot: b, server: srv}
+}
+
+// Bot returns the bot of the harness.
+func (h *Harness) Bot() *stb.Bot {
+	return h.bot
+}
+
+// Server returns the server the bot of the harness talks to.
+func (h *Harness) Server() *Server {
+	return h.server
+}
+
+// Send processes the update and returns the step to check
+// what the bot did about it.
+func (h *Harness) Send(upd stb.Update) *Step {
+	h.server.Reset()
+	if upd.ID == 0 {
+		upd.ID = nextUpdateID()
+	}
+	h.bot.ProcessUpdate(upd)
+
+	user, _ := stb.DefaultRecognizer(upd)
+	return &Step{h: h, user: user, calls: h.server.Calls()}
+}
+
+// SendText sends a text message from the user
+// in the private chat, see TextMessage.
+func (h *Harness) SendText(user *stb.User, text string) *Step {
+	return h.Send(TextMessage(user, nil, text))
+}
+
+// SendCallback presses the inline button with the unique and
+// the data on a message in the private chat, see CallbackFrom.
+func (h *Harness) SendCallback(user *stb.User, unique string, data ...string) *Step {
+	return h.Send(CallbackFrom(user, unique, data...))
+}
+
+// Step is what the bot did about an update sent with a Harness.
+// Its methods report failed expectations to the test and
+// return the step, so they can be chained.
+type Step struct {
+	h     *Harness
+	user  *stb.User
+	calls []Call
+}
+
+// Calls returns the requests the bot made, only those to
+// the given methods if there are any.
+func (s *Step) Calls(methods ...string) []Call {
+	var calls []Call
+	for _, call := range s.calls {
+		if len(methods) == 0 || contains(methods, call.Method) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Replies returns the texts and captions of the messages
+// the bot sent or edited, in order.
+func (s *Step) Replies() []string {
+	var texts []string
+	for _, call := range s.calls {
+		if !replying(call.Method) {
+			continue
+		}
+		if text, ok := call.Params["text"]; ok {
+			texts = append(texts, text)
+		} else if caption, ok := call.Params["caption"]; ok {
+			texts = append(texts, caption)
+		}
+	}
+	return texts
+}
+
+// ExpectState checks the machine of the user is in the state.
+// Machines are looked up by user, as with the default scope.
+func (s *Step) ExpectState(state stb.StateType) *Step {
+	s.h.t.Helper()
+	if s.user == nil {
+		s.h.t.Errorf("stbtest: update has no user to expect state %q of", state)
+		return s
+	}
+
+	m, ok := s.h.bot.Machines().Get(strconv.Itoa(s.user.ID))
+	switch {
+	case !ok:
+		s.h.t.Errorf("stbtest: user %d has no machine, expected state %q", s.user.ID, state)
+	case m.Current() != state:
+		s.h.t.Errorf("stbtest: expected state %q, machine is in %q", state, m.Current())
+	}
+	return s
+}
+
+// ExpectReply checks the bot sent or edited a message with the text.
+func (s *Step) ExpectReply(text string) *Step {
+	s.h.t.Helper()
+	for _, reply := range s.Replies() {
+		if reply == text {
+			return s
+		}
+	}
+	s.h.t.Errorf("stbtest: expected reply %q, got %q", text, s.Replies())
+	return s
+}
+
+// ExpectReplyContains checks the bot sent or edited
+// a message with a text containing substr.
+func (s *Step) ExpectReplyContains(substr string) *Step {
+	s.h.t.Helper()
+	for _, reply := range s.Replies() {
+		if strings.Contains(reply, substr) {
+			return s
+		}
+	}
+	s.h.t.Errorf("stbtest: expected a reply containing %q, got %q", substr, s.Replies())
+	return s
+}
+
+// ExpectNoReply checks the bot sent or edited no message.
+func (s *Step) ExpectNoReply() *Step {
+	s.h.t.Helper()
+	if replies := s.Replies(); len(replies) > 0 {
+		s.h.t.Errorf("stbtest: expected no reply, got %q", replies)
+	}
+	return s
+}
+
+// ExpectKeyboard checks the last message the bot sent or edited
+// has a keyboard, inline or not, with the buttons in order.
+func (s *Step) ExpectKeyboard(buttons ...string) *Step {
+	s.h.t.Helper()
+
+	var markup *stb.ReplyMarkup
+	for _, call := range s.calls {
+		if replying(call.Method) {
+			markup = nil
+			if data, ok := call.Params["reply_markup"]; ok {
+				markup = &stb.ReplyMarkup{}
+				json.Unmarshal([]byte(data), markup)
+			}
+		}
+	}
+	if markup == nil {
+		s.h.t.Errorf("stbtest: expected keyboard %q, the last reply has none", buttons)
+		return s
+	}
+
+	var got []string
+	for _, row := range markup.InlineKeyboard {
+		for _, btn := range row {
+			got = append(got, btn.Text)
+		}
+	}
+	for _, row := range markup.ReplyKeyboard {
+		for _, btn := range row {
+			got = append(got, btn.Text)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(buttons, "\n") {
+		s.h.t.Errorf("stbtest: expected keyboard %q, got %q", buttons, got)
+	}
+	return s
+}
+
+// replying reports whether the method sends or edits a message.
+func replying(method string) bool {
+	return strings.HasPrefix(method, "send") && method != "sendChatAction" ||
+		strings.HasPrefix(method, "edit")
+}
@@ -0,0 +1,97 @@
+package stbtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/exp625/stb"
+)
+
+func TestHarness(t *testing.T) {
+	h := NewHarness(t, func(b *stb.Bot) {
+		start := b.Default(stb.Default)
+		start.Event("start", "AskName")
+		start.MustHandle("/start", func(msg *stb.Message, m *stb.Machine) error {
+			return m.SendEvent("start")
+		})
+
+		ask := b.State("AskName")
+		ask.Event("named", "Confirm")
+		ask.Action(func(m *stb.Machine) {
+			m.Send("What is your name?")
+		})
+		ask.MustHandle(stb.OnText, func(msg *stb.Message, m *stb.Machine) error {
+			return m.SendEvent("named", msg.Text)
+		})
+
+		confirm := b.State("Confirm")
+		confirm.Event("yes", stb.Default)
+		confirm.Action(func(m *stb.Machine) {
+			markup := &stb.ReplyMarkup{}
+			markup.Inline(markup.Row(markup.Data("Yes", "yes"), markup.Data("No", "no")))
+			m.Send("Are you "+m.Payload().(string)+"?", markup)
+		})
+		confirm.MustHandle(&stb.InlineButton{Unique: "yes"}, func(c *stb.Callback, m *stb.Machine) error {
+			return m.SendEvent("yes")
+		})
+	})
+
+	user := &stb.User{ID: 1}
+	h.SendText(user, "/start").
+		ExpectState("AskName").
+		ExpectReplyContains("What is your name")
+	h.SendText(user, "Alice").
+		ExpectState("Confirm").
+		ExpectReply("Are you Alice?").
+		ExpectKeyboard("Yes", "No")
+	h.SendCallback(user, "yes").
+		ExpectState(stb.Default).
+		ExpectNoReply()
+}
+
+func TestHarnessFailures(t *testing.T) {
+	rec := &recorder{TB: t}
+	h := NewHarness(t, func(b *stb.Bot) {
+		b.Default(stb.Default).MustHandle(stb.OnText, func(msg *stb.Message, m *stb.Machine) error {
+			_, err := m.Send("echo: " + msg.Text)
+			return err
+		})
+	})
+	h.t = rec
+
+	user := &stb.User{ID: 1}
+	h.SendText(user, "hi").
+		ExpectState("Other").
+		ExpectReply("hi").
+		ExpectReplyContains("bye").
+		ExpectNoReply().
+		ExpectKeyboard("Yes")
+
+	want := []string{
+		`stbtest: expected state "Other", machine is in "Default"`,
+		`stbtest: expected reply "hi", got ["echo: hi"]`,
+		`stbtest: expected a reply containing "bye", got ["echo: hi"]`,
+		`stbtest: expected no reply, got ["echo: hi"]`,
+		`stbtest: expected keyboard ["Yes"], the last reply has none`,
+	}
+	if len(rec.errors) != len(want) {
+		t.Fatalf("got errors %q", rec.errors)
+	}
+	for i := range want {
+		if rec.errors[i] != want[i] {
+			t.Errorf("error #%d is %q, want %q", i, rec.errors[i], want[i])
+		}
+	}
+}
+
+// recorder records the errors reported to it instead of failing.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,347 @@
+// Package stbtest helps to test bots without network access.
+//
+// Server is a fake Bot API server. It answers every request the
+// way Telegram would, records it, and delivers the updates a test
+// injects to the bots polling it.
+//
+// Example:
+//
+//     func TestGreeting(t *testing.T) {
+//         srv := stbtest.NewServer()
+//         defer srv.Close()
+//
+//         b, err := srv.NewBot(stb.Settings{Synchronous: true})
+//         if err != nil {
+//             t.Fatal(err)
+//         }
+//         b.Default(stb.Default).Handle("/start", onStart)
+//
+//         b.ProcessUpdate(stb.Update{Message: &stb.Message{
+//             Sender: &stb.User{ID: 1},
+//             Chat:   &stb.Chat{ID: 1},
+//             Text:   "/start",
+//         }})
+//
+//         sent := srv.Calls("sendMessage")
+//         if len(sent) != 1 || sent[0].Params["text"] != "Hello!" {
+//             t.Fatal("no greeting")
+//         }
+//     }
+//
+package stbtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exp625/stb"
+)
+
+// Token is the token of the bots created by Server.NewBot.
+const Token = "123456:TEST"
+
+// Me is the user of the bots served by Server.
+var Me = stb.User{ID: 123456, IsBot: true, FirstName: "Test", Username: "test_bot"}
+
+// Call is a request the server received.
+type Call struct {
+	Method string
+
+	// Params are the parameters of the request. Values which are
+	// not strings, like reply_markup, are kept as JSON, uploaded
+	// files are named by their file name.
+	Params map[string]string
+}
+
+// Server is a fake Bot API server, see the package documentation.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	calls     []Call
+	results   map[string]json.RawMessage
+	failures  map[string]stb.APIError
+	updates   []stb.Update
+	lastID    int
+	messageID int
+
+	// updated is closed and replaced when updates are injected.
+	updated chan struct{}
+}
+
+// NewServer starts a Server. Close it when the test is finished.
+func NewServer() *Server {
+	s := &Server{
+		results:  make(map[string]json.RawMessage),
+		failures: make(map[string]stb.APIError),
+		updated:  make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// NewBot creates a bot talking to the server.
+func (s *Server) NewBot(pref stb.Settings) (*stb.Bot, error) {
+	pref.URL = s.URL
+	pref.Token = Token
+	pref.Offline = false
+	return stb.NewBot(pref)
+}
+
+// Calls returns the requests received so far, only those to
+// the given methods if there are any, in the order they came in.
+func (s *Server) Calls(methods ...string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var calls []Call
+	for _, call := range s.calls {
+		if len(methods) == 0 || contains(methods, call.Method) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the requests received so far.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+// Handle makes the server answer requests to the method with
+// the result, encoded as JSON, instead of the default one.
+func (s *Server) Handle(method string, result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[method] = data
+	delete(s.failures, method)
+	return nil
+}
+
+// Fail makes requests to the method fail with the error code and description.
+func (s *Server) Fail(method string, code int, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = stb.APIError{Code: code, Description: description}
+}
+
+// Inject queues updates for the bots polling the server. Updates
+// with no ID are numbered after the ones injected before.
+func (s *Server) Inject(updates ...stb.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, upd := range updates {
+		if upd.ID == 0 {
+			upd.ID = s.lastID + 1
+		}
+		if upd.ID > s.lastID {
+			s.lastID = upd.ID
+		}
+		s.updates = append(s.updates, upd)
+	}
+	close(s.updated)
+	s.updated = make(chan struct{})
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	call := Call{Method: method, Params: readParams(r)}
+
+	if method == "getUpdates" {
+		s.writeResult(w, s.poll(r, call.Params))
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	failure, failed := s.failures[method]
+	result, ok := s.results[method]
+	if !ok && !failed {
+		result = s.defaultResult(call)
+	}
+	s.mu.Unlock()
+
+	if failed {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":          false,
+			"error_code":  failure.Code,
+			"description": failure.Description,
+		})
+		return
+	}
+	s.writeResult(w, result)
+}
+
+func (s *Server) writeResult(w http.ResponseWriter, result json.RawMessage) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+// poll returns the updates from the offset on, waiting
+// for them up to the timeout of the request.
+func (s *Server) poll(r *http.Request, params map[string]string) json.RawMessage {
+	offset, _ := strconv.Atoi(params["offset"])
+	limit, _ := strconv.Atoi(params["limit"])
+	timeout, _ := strconv.Atoi(params["timeout"])
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		s.mu.Lock()
+		pending := s.updates[:0]
+		for _, upd := range s.updates {
+			if upd.ID >= offset {
+				pending = append(pending, upd)
+			}
+		}
+		s.updates = pending
+		updated := s.updated
+
+		if len(pending) > 0 || timeout == 0 {
+			if limit > 0 && len(pending) > limit {
+				pending = pending[:limit]
+			}
+			data, _ := json.Marshal(pending)
+			s.mu.Unlock()
+			return data
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-deadline:
+			return json.RawMessage("[]")
+		case <-r.Context().Done():
+			return json.RawMessage("[]")
+		}
+	}
+}
+
+// defaultResult answers the call like the Bot API would:
+// with the bot for getMe, a message for the methods sending
+// or editing one, and true for everything else.
+func (s *Server) defaultResult(call Call) json.RawMessage {
+	var result interface{} = true
+
+	switch m := call.Method; {
+	case m == "getMe":
+		result = Me
+	case m == "sendMediaGroup":
+		var media []json.RawMessage
+		json.Unmarshal([]byte(call.Params["media"]), &media)
+		msgs := make([]map[string]interface{}, len(media))
+		for i := range msgs {
+			msgs[i] = s.message(call)
+		}
+		result = msgs
+	case m == "copyMessage":
+		s.messageID++
+		result = map[string]int{"message_id": s.messageID}
+	case strings.HasPrefix(m, "send") && m != "sendChatAction",
+		m == "forwardMessage":
+		result = s.message(call)
+	case strings.HasPrefix(m, "edit") && call.Params["inline_message_id"] == "":
+		result = s.message(call)
+	}
+
+	data, _ := json.Marshal(result)
+	return data
+}
+
+// message returns a message as sent by the call.
+func (s *Server) message(call Call) map[string]interface{} {
+	var id int
+	if strings.HasPrefix(call.Method, "edit") {
+		id, _ = strconv.Atoi(call.Params["message_id"])
+	}
+	if id == 0 {
+		s.messageID++
+		id = s.messageID
+	}
+	chatID, _ := strconv.ParseInt(call.Params["chat_id"], 10, 64)
+
+	msg := map[string]interface{}{
+		"message_id": id,
+		"from":       Me,
+		"date":       time.Now().Unix(),
+		"chat":       map[string]interface{}{"id": chatID, "type": chatType(chatID)},
+	}
+	for _, key := range []string{"text", "caption"} {
+		if v, ok := call.Params[key]; ok {
+			msg[key] = v
+		}
+	}
+	if markup, ok := call.Params["reply_markup"]; ok && strings.Contains(markup, "inline_keyboard") {
+		msg["reply_markup"] = json.RawMessage(markup)
+	}
+	return msg
+}
+
+func chatType(id int64) stb.ChatType {
+	if id < 0 {
+		return stb.ChatSuperGroup
+	}
+	return stb.ChatPrivate
+}
+
+// readParams reads the parameters of a JSON or multipart request.
+func readParams(r *http.Request) map[string]string {
+	params := make(map[string]string)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return params
+		}
+		for key, values := range r.MultipartForm.Value {
+			params[key] = values[0]
+		}
+		for key, files := range r.MultipartForm.File {
+			params[key] = files[0].Filename
+		}
+		return params
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	var raw map[string]interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return params
+	}
+	for key, v := range raw {
+		switch v := v.(type) {
+		case string:
+			params[key] = v
+		case json.Number:
+			params[key] = v.String()
+		default:
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			enc.Encode(v)
+			params[key] = strings.TrimSpace(buf.String())
+		}
+	}
+	return params
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package stbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/exp625/stb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	b, err := srv.NewBot(stb.Settings{Synchronous: true})
+	require.NoError(t, err)
+	assert.Equal(t, "test_bot", b.Me.Username)
+
+	start := b.Default(stb.Default)
+	start.MustHandle("/start", func(msg *stb.Message, m *stb.Machine) error {
+		markup := &stb.ReplyMarkup{}
+		markup.Inline(markup.Row(markup.Data("Go", "go")))
+		sent, err := m.Send("<b>Hello!</b>", markup, stb.ModeHTML)
+		if err != nil {
+			return err
+		}
+		_, err = m.Edit(sent, "Bye")
+		return err
+	})
+
+	user := &stb.User{ID: 1}
+	b.ProcessUpdate(stb.Update{Message: &stb.Message{Sender: user, Chat: &stb.Chat{ID: 1}, Text: "/start"}})
+
+	calls := srv.Calls("sendMessage", "editMessageText")
+	require.Len(t, calls, 2)
+	assert.Equal(t, "1", calls[0].Params["chat_id"])
+	assert.Equal(t, "<b>Hello!</b>", calls[0].Params["text"])
+	assert.Contains(t, calls[0].Params["reply_markup"], `"callback_data":"\fgo"`)
+	assert.Equal(t, "1", calls[1].Params["message_id"])
+	assert.Equal(t, "Bye", calls[1].Params["text"])
+	assert.Len(t, srv.Calls(), 3) // getMe as well
+
+	srv.Reset()
+	assert.Empty(t, srv.Calls())
+}
+
+func TestServerResults(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	b, err := srv.NewBot(stb.Settings{Synchronous: true})
+	require.NoError(t, err)
+
+	require.NoError(t, srv.Handle("getChat", stb.Chat{ID: 5, Title: "Club"}))
+	chat, err := b.ChatByID("5")
+	require.NoError(t, err)
+	assert.Equal(t, "Club", chat.Title)
+
+	srv.Fail("sendMessage", 403, "Forbidden: bot was blocked by the user")
+	_, err = b.Send(&stb.User{ID: 1}, "hi")
+	assert.Equal(t, stb.ErrBlockedByUser, err)
+}
+
+func TestServerInject(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	b, err := srv.NewBot(stb.Settings{Poller: &stb.LongPoller{Timeout: time.Second}})
+	require.NoError(t, err)
+
+	texts := make(chan string, 2)
+	b.Default(stb.Default).MustHandle(stb.OnText, func(msg *stb.Message, m *stb.Machine) {
+		texts <- msg.Text
+	})
+
+	go b.Start()
+	defer b.Stop()
+
+	user := &stb.User{ID: 1}
+	srv.Inject(
+		stb.Update{Message: &stb.Message{Sender: user, Chat: &stb.Chat{ID: 1}, Text: "one"}},
+		stb.Update{Message: &stb.Message{Sender: user, Chat: &stb.Chat{ID: 1}, Text: "two"}},
+	)
+
+	for _, want := range []string{"one", "two"} {
+		select {
+		case text := <-texts:
+			assert.Equal(t, want, text)
+		case <-time.After(3 * time.Second):
+			t.Fatal("update was not delivered")
+		}
+	}
+}
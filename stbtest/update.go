@@ -0,0 +1,118 @@
+package stbtest
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf16"
+
+	"github.com/exp625/stb"
+)
+
+// lastUpdateID and lastMessageID number the updates and
+// the messages made by the builders, starting at 1.
+var lastUpdateID, lastMessageID int64
+
+func nextUpdateID() int {
+	return int(atomic.AddInt64(&lastUpdateID, 1))
+}
+
+func nextMessageID() int {
+	return int(atomic.AddInt64(&lastMessageID, 1))
+}
+
+// PrivateChat returns the private chat of the user with the bot.
+func PrivateChat(user *stb.User) *stb.Chat {
+	return &stb.Chat{
+		ID:        int64(user.ID),
+		Type:      stb.ChatPrivate,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Username:  user.Username,
+	}
+}
+
+// TextMessage returns an update with a text message from the user
+// in the chat, the private chat with the bot if chat is nil.
+// A leading command gets its bot_command entity, like in updates
+// from Telegram.
+func TextMessage(user *stb.User, chat *stb.Chat, text string) stb.Update {
+	if chat == nil {
+		chat = PrivateChat(user)
+	}
+
+	msg := &stb.Message{
+		ID:       nextMessageID(),
+		Sender:   user,
+		Chat:     chat,
+		Unixtime: time.Now().Unix(),
+		Text:     text,
+		Entities: commandEntities(text),
+	}
+
+	return stb.Update{ID: nextUpdateID(), Message: msg}
+}
+
+// CallbackFrom returns an update with the user pressing the inline
+// button with the unique and the data, as made by ReplyMarkup.Data,
+// on a message the bot sent in the private chat.
+func CallbackFrom(user *stb.User, unique string, data ...string) stb.Update {
+	payload := strings.Join(data, "|")
+	switch {
+	case unique != "" && payload != "":
+		payload = "\f" + unique + "|" + payload
+	case unique != "":
+		payload = "\f" + unique
+	}
+
+	id := nextUpdateID()
+	return stb.Update{ID: id, Callback: &stb.Callback{
+		ID:     strconv.Itoa(id),
+		Sender: user,
+		Message: &stb.Message{
+			ID:       nextMessageID(),
+			Sender:   &Me,
+			Chat:     PrivateChat(user),
+			Unixtime: time.Now().Unix(),
+		},
+		Data: payload,
+	}}
+}
+
+// Edited returns an update with the message of upd edited to the text.
+// upd must be a message or a channel post, like from TextMessage.
+func Edited(upd stb.Update, text string) stb.Update {
+	edit := stb.Update{ID: nextUpdateID()}
+
+	var msg stb.Message
+	if upd.ChannelPost != nil {
+		msg = *upd.ChannelPost
+		edit.EditedChannelPost = &msg
+	} else {
+		msg = *upd.Message
+		edit.EditedMessage = &msg
+	}
+
+	msg.LastEdit = time.Now().Unix()
+	if msg.Caption != "" {
+		msg.Caption = text
+	} else {
+		msg.Text = text
+		msg.Entities = commandEntities(text)
+	}
+	return edit
+}
+
+// commandEntities returns the entity of the command
+// the text starts with, if it starts with one.
+func commandEntities(text string) []stb.MessageEntity {
+	if !strings.HasPrefix(text, "/") {
+		return nil
+	}
+	command := strings.Fields(text)[0]
+	return []stb.MessageEntity{{
+		Type:   stb.EntityCommand,
+		Length: len(utf16.Encode([]rune(command))),
+	}}
+}
@@ -0,0 +1,57 @@
+package stbtest
+
+import (
+	"testing"
+
+	"github.com/exp625/stb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextMessage(t *testing.T) {
+	user := &stb.User{ID: 1, FirstName: "Alice"}
+
+	upd := TextMessage(user, nil, "/start ref")
+	require.NotNil(t, upd.Message)
+	assert.NotZero(t, upd.ID)
+	assert.NotZero(t, upd.Message.ID)
+	assert.NotZero(t, upd.Message.Unixtime)
+	assert.Equal(t, &stb.Chat{ID: 1, Type: stb.ChatPrivate, FirstName: "Alice"}, upd.Message.Chat)
+	assert.Equal(t, []stb.MessageEntity{{Type: stb.EntityCommand, Length: 6}}, upd.Message.Entities)
+
+	group := &stb.Chat{ID: -5, Type: stb.ChatGroup}
+	next := TextMessage(user, group, "hi")
+	assert.Greater(t, next.ID, upd.ID)
+	assert.Greater(t, next.Message.ID, upd.Message.ID)
+	assert.Equal(t, group, next.Message.Chat)
+	assert.Empty(t, next.Message.Entities)
+
+	edit := Edited(next, "/help")
+	require.NotNil(t, edit.EditedMessage)
+	assert.Equal(t, next.Message.ID, edit.EditedMessage.ID)
+	assert.Equal(t, "/help", edit.EditedMessage.Text)
+	assert.Equal(t, "hi", next.Message.Text)
+	assert.NotZero(t, edit.EditedMessage.LastEdit)
+	assert.Len(t, edit.EditedMessage.Entities, 1)
+}
+
+func TestCallbackFrom(t *testing.T) {
+	b, err := stb.NewBot(stb.Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var got []string
+	b.Default(stb.Default).MustHandle(&stb.InlineButton{Unique: "buy"}, func(c *stb.Callback, m *stb.Machine) {
+		got = append(got, c.Data)
+	})
+
+	user := &stb.User{ID: 1}
+	b.ProcessUpdate(CallbackFrom(user, "buy", "42"))
+	b.ProcessUpdate(CallbackFrom(user, "buy", "42", "red"))
+	b.ProcessUpdate(CallbackFrom(user, "buy"))
+	assert.Equal(t, []string{"42", "42|red", ""}, got)
+
+	upd := CallbackFrom(user, "", "raw")
+	assert.Equal(t, "raw", upd.Callback.Data)
+	assert.Equal(t, int64(1), upd.Callback.Message.Chat.ID)
+	assert.Equal(t, &Me, upd.Callback.Message.Sender)
+}
@@ -0,0 +1,157 @@
+package stb
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotStored is the error returned by a Store when there is
+// no snapshot saved under the requested id.
+var ErrNotStored = errors.New("stb: machine is not stored")
+
+// Snapshot is the persisted form of a Machine.
+type Snapshot struct {
+	// State is the state the machine was in when it was saved.
+	State StateType `json:"state"`
+
+	// Context is the JSON encoded machine context (see Machine.Set).
+	Context json.RawMessage `json:"context,omitempty"`
+
+	// History is the list of previously visited states (see Machine.History).
+	History []StateType `json:"history,omitempty"`
+
+	// Deadline is the moment the machine times out of
+	// the state (see State.Timeout).
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// Language is the language set with Machine.SetLanguage.
+	Language string `json:"language,omitempty"`
+
+	// Session holds the values of Machine.Session.
+	Session map[string]SessionEntry `json:"session,omitempty"`
+
+	// Deferred are the events waiting for a state that accepts
+	// them (see Bot.Defer), without their payloads.
+	Deferred []EventType `json:"deferred,omitempty"`
+
+	// Scheduled are the events of Machine.SendEventAfter.
+	Scheduled []ScheduledEvent `json:"scheduled,omitempty"`
+
+	// Chat is the id of the chat the machine was last used
+	// from, so it can be messaged after a restart.
+	Chat int64 `json:"chat,omitempty"`
+
+	// Blocked tells whether the user blocked the bot (see Machine.Blocked).
+	Blocked bool `json:"blocked,omitempty"`
+
+	// Outbox holds the messages not sent yet (see Settings.Outbox).
+	Outbox []OutboxEntry `json:"outbox,omitempty"`
+
+	// Seen are the ids of the updates processed last (see Settings.Dedup).
+	Seen []int `json:"seen,omitempty"`
+}
+
+// Store persists machines across restarts of the bot.
+//
+// Ids are opaque strings, which allows to key machines by user,
+// by chat or by any combination of both.
+type Store interface {
+	// Load returns the snapshot saved under id or ErrNotStored.
+	Load(id string) (*Snapshot, error)
+
+	// Save creates or replaces the snapshot saved under id.
+	Save(id string, snap *Snapshot) error
+
+	// Delete removes the snapshot saved under id.
+	// Deleting a missing snapshot is not an error.
+	Delete(id string) error
+}
+
+// Lister is implemented by the stores that can list the ids of
+// their machines, which Bot.Broadcast needs to reach all of them.
+type Lister interface {
+	// IDs returns the ids of all the stored machines.
+	IDs() ([]string, error)
+}
+
+// MemoryStore is a Store that keeps snapshots in memory.
+// It does not survive restarts and is mostly useful for testing.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	snaps map[string]Snapshot
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{snaps: make(map[string]Snapshot)}
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load(id string) (*Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap, ok := s.snaps[id]
+	if !ok {
+		return nil, ErrNotStored
+	}
+	return &snap, nil
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(id string, snap *Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snaps[id] = *snap
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.snaps, id)
+	return nil
+}
+
+// IDs implements Lister.
+func (s *MemoryStore) IDs() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0, len(s.snaps))
+	for id := range s.snaps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// decodeContext restores a machine context from its JSON form.
+//
+// newCtx must return a pointer, the value it points to becomes
+// the context. Without newCtx, the context is decoded into
+// generic JSON values (maps, slices, float64, ...).
+func decodeContext(data json.RawMessage, newCtx func() interface{}) (interface{}, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	if newCtx == nil {
+		var ctx interface{}
+		err := json.Unmarshal(data, &ctx)
+		return ctx, err
+	}
+
+	ptr := newCtx()
+	if err := json.Unmarshal(data, ptr); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(ptr).Elem().Interface(), nil
+}
@@ -0,0 +1,269 @@
+// Package redis implements a stb.Store on top of Redis.
+//
+// Example:
+//
+//		store := redis.New(redis.Options{
+//			Addr:   "localhost:6379",
+//			Prefix: "mybot:",
+//			TTL:    30 * 24 * time.Hour,
+//		})
+//		defer store.Close()
+//
+//		b, err := stb.NewBot(stb.Settings{
+//			Token: "TOKEN_HERE",
+//			Store: store,
+//		})
+//
+package redis
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exp625/stb"
+)
+
+// Options configures the connection and the key layout of a Store.
+type Options struct {
+	// Addr is the host:port of the server.
+	Addr string // Default: localhost:6379
+
+	// Password is sent with AUTH after connecting, if set.
+	Password string
+
+	// DB is selected with SELECT after connecting, if set.
+	DB int
+
+	// Prefix is prepended to every machine id to build the key.
+	Prefix string // Default: stb:
+
+	// TTL is the lifetime of a machine since it was last saved,
+	// rounded up to milliseconds. Zero means machines never expire.
+	TTL time.Duration
+
+	// DialTimeout limits the time spent on connecting.
+	DialTimeout time.Duration // Default: 5s
+}
+
+// Store is a stb.Store backed by a single Redis connection.
+// It connects lazily and reconnects after network errors.
+type Store struct {
+	opts Options
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+	wr   *bufio.Writer
+}
+
+// New creates a Store, no connection is made until the first call.
+func New(opts Options) *Store {
+	if opts.Addr == "" {
+		opts.Addr = "localhost:6379"
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "stb:"
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	return &Store{opts: opts}
+}
+
+// Load implements stb.Store.
+func (s *Store) Load(id string) (*stb.Snapshot, error) {
+	replies, err := s.do([]string{"GET", s.key(id)})
+	if err != nil {
+		return nil, err
+	}
+	if replies[0] == errNil {
+		return nil, stb.ErrNotStored
+	}
+	if err, ok := replies[0].(error); ok {
+		return nil, err
+	}
+
+	var snap stb.Snapshot
+	if err := json.Unmarshal([]byte(replies[0].(string)), &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// Save implements stb.Store.
+func (s *Store) Save(id string, snap *stb.Snapshot) error {
+	return s.SaveBatch(map[string]*stb.Snapshot{id: snap})
+}
+
+// SaveBatch saves many snapshots in a single pipelined round trip.
+func (s *Store) SaveBatch(snaps map[string]*stb.Snapshot) error {
+	cmds := make([][]string, 0, len(snaps))
+	for id, snap := range snaps {
+		data, err := json.Marshal(snap)
+		if err != nil {
+			return err
+		}
+		cmd := []string{"SET", s.key(id), string(data)}
+		if s.opts.TTL > 0 {
+			ms := (s.opts.TTL + time.Millisecond - 1) / time.Millisecond
+			cmd = append(cmd, "PX", strconv.FormatInt(int64(ms), 10))
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	replies, err := s.do(cmds...)
+	if err != nil {
+		return err
+	}
+	return firstError(replies)
+}
+
+// Delete implements stb.Store.
+func (s *Store) Delete(id string) error {
+	replies, err := s.do([]string{"DEL", s.key(id)})
+	if err != nil {
+		return err
+	}
+	return firstError(replies)
+}
+
+// IDs implements stb.Lister. It scans the keys with the prefix,
+// so it is slow on large databases.
+func (s *Store) IDs() ([]string, error) {
+	var ids []string
+	cursor := "0"
+	for {
+		replies, err := s.do([]string{"SCAN", cursor, "MATCH", s.opts.Prefix + "*", "COUNT", "1000"})
+		if err != nil {
+			return nil, err
+		}
+		if err := firstError(replies); err != nil {
+			return nil, err
+		}
+
+		page, ok := replies[0].([]interface{})
+		if !ok || len(page) != 2 {
+			return nil, errors.New("redis: bad SCAN reply")
+		}
+		keys, _ := page[1].([]interface{})
+		for _, key := range keys {
+			if key, ok := key.(string); ok {
+				ids = append(ids, strings.TrimPrefix(key, s.opts.Prefix))
+			}
+		}
+
+		cursor, _ = page[0].(string)
+		if cursor == "0" || cursor == "" {
+			return ids, nil
+		}
+	}
+}
+
+// Close closes the underlying connection.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Store) key(id string) string {
+	return s.opts.Prefix + id
+}
+
+// do pipelines the commands and returns one reply per command.
+// Error replies are returned in place, network errors drop the
+// connection so the next call reconnects.
+func (s *Store) do(cmds ...[]string) ([]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range cmds {
+		writeCommand(s.wr, cmd...)
+	}
+	if err := s.wr.Flush(); err != nil {
+		s.drop()
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	for i := range cmds {
+		reply, err := readReply(s.rd)
+		switch err.(type) {
+		case nil:
+			replies[i] = reply
+		case Error:
+			replies[i] = err
+		default:
+			if err != errNil {
+				s.drop()
+				return nil, err
+			}
+			replies[i] = err
+		}
+	}
+	return replies, nil
+}
+
+func (s *Store) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", s.opts.Addr, s.opts.DialTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.rd = bufio.NewReader(conn)
+	s.wr = bufio.NewWriter(conn)
+
+	var setup [][]string
+	if s.opts.Password != "" {
+		setup = append(setup, []string{"AUTH", s.opts.Password})
+	}
+	if s.opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.opts.DB)})
+	}
+	for _, cmd := range setup {
+		writeCommand(s.wr, cmd...)
+		if err := s.wr.Flush(); err != nil {
+			s.drop()
+			return err
+		}
+		if _, err := readReply(s.rd); err != nil {
+			s.drop()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) drop() {
+	s.conn.Close()
+	s.conn = nil
+}
+
+func firstError(replies []interface{}) error {
+	for _, reply := range replies {
+		if err, ok := reply.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
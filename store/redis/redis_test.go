@@ -0,0 +1,145 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exp625/stb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer speaks just enough RESP to serve GET, SET and DEL.
+type fakeServer struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	data map[string]string
+	cmds [][]interface{}
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &fakeServer{ln: ln, data: make(map[string]string)}
+	go srv.serve()
+	return srv
+}
+
+func (srv *fakeServer) serve() {
+	for {
+		conn, err := srv.ln.Accept()
+		if err != nil {
+			return
+		}
+		go srv.handle(conn)
+	}
+}
+
+func (srv *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	rd, wr := bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	for {
+		req, err := readReply(rd)
+		if err != nil {
+			return
+		}
+		cmd := req.([]interface{})
+
+		srv.mu.Lock()
+		srv.cmds = append(srv.cmds, cmd)
+		switch cmd[0] {
+		case "GET":
+			if v, ok := srv.data[cmd[1].(string)]; ok {
+				fmt.Fprintf(wr, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				wr.WriteString("$-1\r\n")
+			}
+		case "SET":
+			srv.data[cmd[1].(string)] = cmd[2].(string)
+			wr.WriteString("+OK\r\n")
+		case "DEL":
+			delete(srv.data, cmd[1].(string))
+			wr.WriteString(":1\r\n")
+		case "SCAN":
+			// one key per page, the cursor is the index of the next key
+			var keys []string
+			for k := range srv.data {
+				if strings.HasPrefix(k, strings.TrimSuffix(cmd[3].(string), "*")) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			i, _ := strconv.Atoi(cmd[1].(string))
+			if i >= len(keys) {
+				wr.WriteString("*2\r\n$1\r\n0\r\n*0\r\n")
+				break
+			}
+			next := strconv.Itoa(i + 1)
+			if i+1 == len(keys) {
+				next = "0"
+			}
+			fmt.Fprintf(wr, "*2\r\n$%d\r\n%s\r\n*1\r\n$%d\r\n%s\r\n", len(next), next, len(keys[i]), keys[i])
+		default:
+			wr.WriteString("-ERR unknown command\r\n")
+		}
+		srv.mu.Unlock()
+		wr.Flush()
+	}
+}
+
+func TestStore(t *testing.T) {
+	srv := newFakeServer(t)
+	defer srv.ln.Close()
+
+	s := New(Options{Addr: srv.ln.Addr().String(), Prefix: "test:", TTL: time.Minute})
+	defer s.Close()
+
+	_, err := s.Load("1")
+	assert.Equal(t, stb.ErrNotStored, err)
+
+	require.NoError(t, s.Save("1", &stb.Snapshot{State: "A"}))
+	snap, err := s.Load("1")
+	require.NoError(t, err)
+	assert.Equal(t, stb.StateType("A"), snap.State)
+	assert.Contains(t, srv.data, "test:1")
+
+	require.NoError(t, s.SaveBatch(map[string]*stb.Snapshot{
+		"2": {State: "B"},
+		"3": {State: "C"},
+	}))
+	assert.Len(t, srv.data, 3)
+
+	srv.mu.Lock()
+	last := srv.cmds[len(srv.cmds)-1]
+	srv.mu.Unlock()
+	assert.Equal(t, []interface{}{"PX", "60000"}, last[3:])
+
+	require.NoError(t, s.Delete("1"))
+	_, err = s.Load("1")
+	assert.Equal(t, stb.ErrNotStored, err)
+
+	srv.mu.Lock()
+	srv.data["other:4"] = "{}"
+	srv.mu.Unlock()
+	ids, err := s.IDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "3"}, ids)
+
+	// Redis rejects PX 0, so shorter TTLs are rounded up
+	short := New(Options{Addr: srv.ln.Addr().String(), TTL: time.Microsecond})
+	defer short.Close()
+	require.NoError(t, short.Save("5", &stb.Snapshot{State: "E"}))
+	srv.mu.Lock()
+	last = srv.cmds[len(srv.cmds)-1]
+	srv.mu.Unlock()
+	assert.Equal(t, []interface{}{"PX", "1"}, last[3:])
+}
@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// errNil is the reply to a GET of a missing key.
+var errNil = errors.New("redis: nil")
+
+// Error is an error reply of the server.
+type Error string
+
+// Error implements error interface.
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// writeCommand encodes a command as a RESP array of bulk strings.
+//
+// Write errors are sticky in bufio.Writer and surface on Flush.
+func writeCommand(w *bufio.Writer, args ...string) {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readReply decodes a single RESP reply.
+//
+// Simple strings and bulk strings are returned as string,
+// integers as int64 and arrays as []interface{}. A null bulk
+// string is reported as errNil, an error reply as Error.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			arr[i], err = readReply(r)
+			if err != nil && err != errNil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
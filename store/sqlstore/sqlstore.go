@@ -0,0 +1,190 @@
+// Package sqlstore implements a stb.Store on top of database/sql.
+//
+// It works with SQLite and PostgreSQL, the driver is up to you:
+//
+//		db, err := sql.Open("sqlite3", "bot.db")
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//
+//		store, err := sqlstore.New(db, sqlstore.SQLite)
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/exp625/stb"
+)
+
+// Dialect describes the differences between SQL databases
+// the store has to care about.
+type Dialect struct {
+	// Placeholder returns the bind parameter for the n-th (1-based) argument.
+	Placeholder func(n int) string
+}
+
+var (
+	// SQLite uses question mark placeholders.
+	SQLite = Dialect{
+		Placeholder: func(int) string { return "?" },
+	}
+
+	// Postgres uses numbered placeholders.
+	Postgres = Dialect{
+		Placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	}
+)
+
+// migrations are applied in order, each exactly once.
+// The version of a migration is its index plus one.
+//
+// Never edit or reorder existing entries, append new ones.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS stb_machines (
+		id         TEXT PRIMARY KEY,
+		state      TEXT NOT NULL,
+		data       TEXT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS stb_machines_state ON stb_machines (state)`,
+}
+
+// Store is a stb.Store backed by an SQL database.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// New creates a Store and migrates the schema to the latest version.
+func New(db *sql.DB, dialect Dialect) (*Store, error) {
+	s := &Store{db: db, dialect: dialect}
+	if err := s.Migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Version returns the version of the current schema.
+func (s *Store) Version() (int, error) {
+	var version sql.NullInt64
+	err := s.db.QueryRow(`SELECT MAX(version) FROM stb_migrations`).Scan(&version)
+	return int(version.Int64), err
+}
+
+// Migrate applies all the migrations that were not applied yet.
+func (s *Store) Migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS stb_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	version, err := s.Version()
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlstore: migration %d: %w", i+1, err)
+		}
+		_, err = tx.Exec(s.query(`INSERT INTO stb_migrations (version, applied_at) VALUES (?, ?)`),
+			i+1, time.Now().Unix())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load implements stb.Store.
+func (s *Store) Load(id string) (*stb.Snapshot, error) {
+	var data string
+	err := s.db.QueryRow(s.query(`SELECT data FROM stb_machines WHERE id = ?`), id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, stb.ErrNotStored
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap stb.Snapshot
+	if err := json.Unmarshal([]byte(data), &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// Save implements stb.Store.
+func (s *Store) Save(id string, snap *stb.Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(s.query(`INSERT INTO stb_machines (id, state, data, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET state = excluded.state, data = excluded.data, updated_at = excluded.updated_at`),
+		id, string(snap.State), string(data), time.Now().Unix())
+	return err
+}
+
+// Delete implements stb.Store.
+func (s *Store) Delete(id string) error {
+	_, err := s.db.Exec(s.query(`DELETE FROM stb_machines WHERE id = ?`), id)
+	return err
+}
+
+// IDs implements stb.Lister.
+func (s *Store) IDs() ([]string, error) {
+	rows, err := s.db.Query(`SELECT id FROM stb_machines ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// query rewrites ? placeholders into the ones of the dialect.
+func (s *Store) query(q string) string {
+	var (
+		sb strings.Builder
+		n  int
+	)
+	for _, r := range q {
+		if r == '?' {
+			n++
+			sb.WriteString(s.dialect.Placeholder(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,205 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/exp625/stb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriver understands just the statements the store issues,
+// keeping the tables of every data source name in memory.
+type fakeDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+type fakeDB struct {
+	queries    []string
+	migrations []int64
+	machines   map[string]string
+}
+
+var fake = &fakeDriver{dbs: make(map[string]*fakeDB)}
+
+func init() {
+	sql.Register("stbfake", fake)
+}
+
+func openFake(t *testing.T) (*sql.DB, *fakeDB) {
+	fake.mu.Lock()
+	db := &fakeDB{machines: make(map[string]string)}
+	fake.dbs[t.Name()] = db
+	fake.mu.Unlock()
+
+	sqldb, err := sql.Open("stbfake", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { sqldb.Close() })
+	return sqldb, db
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &fakeConn{db: d.dbs[name]}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	db := s.db
+	db.queries = append(db.queries, s.query)
+	switch {
+	case strings.HasPrefix(s.query, "CREATE "):
+	case strings.HasPrefix(s.query, "INSERT INTO stb_migrations"):
+		db.migrations = append(db.migrations, args[0].(int64))
+	case strings.HasPrefix(s.query, "INSERT INTO stb_machines"):
+		db.machines[args[0].(string)] = args[2].(string)
+	case strings.HasPrefix(s.query, "DELETE FROM stb_machines"):
+		delete(db.machines, args[0].(string))
+	default:
+		return nil, io.ErrUnexpectedEOF
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	db := s.db
+	db.queries = append(db.queries, s.query)
+	rows := &fakeRows{}
+	switch {
+	case strings.HasPrefix(s.query, "SELECT MAX(version)"):
+		var max driver.Value
+		for _, v := range db.migrations {
+			if max == nil || v > max.(int64) {
+				max = v
+			}
+		}
+		rows.values = [][]driver.Value{{max}}
+	case strings.HasPrefix(s.query, "SELECT data FROM stb_machines"):
+		if data, ok := db.machines[args[0].(string)]; ok {
+			rows.values = [][]driver.Value{{data}}
+		}
+	case strings.HasPrefix(s.query, "SELECT id FROM stb_machines"):
+		var ids []string
+		for id := range db.machines {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			rows.values = append(rows.values, []driver.Value{id})
+		}
+	default:
+		return nil, io.ErrUnexpectedEOF
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"value"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	sqldb, db := openFake(t)
+
+	s, err := New(sqldb, SQLite)
+	require.NoError(t, err)
+
+	version, err := s.Version()
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+
+	_, err = s.Load("1")
+	assert.Equal(t, stb.ErrNotStored, err)
+
+	snap := &stb.Snapshot{State: "Menu", History: []stb.StateType{"Default"}}
+	require.NoError(t, s.Save("1", snap))
+	require.NoError(t, s.Save("2", &stb.Snapshot{State: "Default"}))
+
+	loaded, err := s.Load("1")
+	require.NoError(t, err)
+	assert.Equal(t, snap.State, loaded.State)
+	assert.Equal(t, snap.History, loaded.History)
+
+	snap.State = "Cart"
+	require.NoError(t, s.Save("1", snap))
+	loaded, err = s.Load("1")
+	require.NoError(t, err)
+	assert.Equal(t, stb.StateType("Cart"), loaded.State)
+
+	ids, err := s.IDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids)
+
+	require.NoError(t, s.Delete("1"))
+	_, err = s.Load("1")
+	assert.Equal(t, stb.ErrNotStored, err)
+
+	ids, err = s.IDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+
+	// the migrations are applied once
+	_, err = New(sqldb, SQLite)
+	require.NoError(t, err)
+	assert.Len(t, db.migrations, len(migrations))
+}
+
+func TestStorePostgres(t *testing.T) {
+	sqldb, db := openFake(t)
+
+	s, err := New(sqldb, Postgres)
+	require.NoError(t, err)
+	require.NoError(t, s.Save("1", &stb.Snapshot{State: "Default"}))
+	require.NoError(t, s.Delete("1"))
+
+	for _, q := range db.queries {
+		assert.NotContains(t, q, "?")
+	}
+	assert.Contains(t, db.queries[len(db.queries)-2], "VALUES ($1, $2, $3, $4)")
+	assert.Contains(t, db.queries[len(db.queries)-1], "WHERE id = $1")
+}
@@ -0,0 +1,65 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testForm struct {
+	Name string
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+
+	_, err := s.Load("1")
+	assert.Equal(t, ErrNotStored, err)
+
+	require.NoError(t, s.Save("1", &Snapshot{State: "A"}))
+	snap, err := s.Load("1")
+	require.NoError(t, err)
+	assert.Equal(t, StateType("A"), snap.State)
+
+	require.NoError(t, s.Delete("1"))
+	_, err = s.Load("1")
+	assert.Equal(t, ErrNotStored, err)
+}
+
+func TestBotStore(t *testing.T) {
+	store := NewMemoryStore()
+	pref := Settings{
+		Synchronous: true,
+		Offline:     true,
+		Store:       store,
+		NewContext:  func() interface{} { return new(testForm) },
+	}
+
+	b, err := NewBot(pref)
+	require.NoError(t, err)
+
+	b.Default("A").Event("next", "B")
+	b.State("B")
+	b.Handle("/next", func(msg *Message, m *Machine) {
+		m.Set(testForm{Name: msg.Sender.FirstName})
+		assert.NoError(t, m.SendEvent("next"))
+	})
+
+	user := &User{ID: 1, FirstName: "Alice"}
+	b.ProcessUpdate(Update{Message: &Message{Text: "/next", Sender: user}})
+
+	snap, err := store.Load("1")
+	require.NoError(t, err)
+	assert.Equal(t, StateType("B"), snap.State)
+
+	// A fresh bot picks the conversation up where it was left.
+	b, err = NewBot(pref)
+	require.NoError(t, err)
+	b.Default("A")
+	b.State("B")
+
+	m := b.machine(user)
+	assert.Equal(t, StateType("B"), m.Current())
+	assert.Equal(t, testForm{Name: "Alice"}, m.Get())
+}
@@ -0,0 +1,90 @@
+package stb
+
+import "time"
+
+// Expire is the event sent to machines left idle in a state
+// for longer than its limit, see State.ExpireAfter.
+const Expire EventType = "expire"
+
+// sweepEvery is how often idle machines are looked for.
+var sweepEvery = 10 * time.Second
+
+// ExpireAfter makes machines left idle in the state for longer
+// than d expire, e.g. to nudge users who left a checkout half
+// done or to clean up after them. Once the bot is started, it
+// looks for such machines every few seconds and runs the
+// OnExpire handler of the state, its parents or the global
+// state, then sends them the Expire event, which the state may
+// or may not accept. A machine expires once per idle period and
+// is not evicted before it expired.
+//
+// Unlike Timeout, it needs no timer per machine and is checked
+// only for the machines loaded in memory.
+//
+// Example:
+//
+//     checkout.ExpireAfter(30 * time.Minute)
+//     checkout.Event(stb.Expire, Default)
+//     checkout.Handle(stb.OnExpire, func(m *stb.Machine) error {
+//         _, err := m.Send("Your cart is waiting for you.")
+//         return err
+//     })
+//
+func (s *State) ExpireAfter(d time.Duration) {
+	s.expireAfter = d
+}
+
+// sweeper expires the idle machines until stop is closed.
+func (b *Bot) sweeper(stop chan struct{}) {
+	ticker := time.NewTicker(sweepEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			b.sweep(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sweep expires the machines idle for longer than
+// the limit of their state.
+func (b *Bot) sweep(now time.Time) {
+	var due []*Machine
+	b.machines.Range(func(m *Machine) bool {
+		if m.due(now) {
+			due = append(due, m)
+		}
+		return true
+	})
+
+	for _, m := range due {
+		m.lifecycle(OnExpire)
+		if err := m.SendEvent(Expire); err != nil && err != ErrEventRejected && m.reporter != nil {
+			m.reporter(err)
+		}
+	}
+}
+
+// due reports whether the machine has to expire, and marks
+// its current idle period as expired if so.
+func (m *Machine) due(now time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.expiring() || now.Sub(m.lastSeen) <= m.states[m.current].expireAfter {
+		return false
+	}
+	m.swept = m.lastSeen
+	return true
+}
+
+// expiring reports whether the machine is in a state with an idle
+// limit and did not expire since its last update. The caller must
+// hold the mutex.
+func (m *Machine) expiring() bool {
+	state, ok := m.states[m.current]
+	return ok && state.expireAfter > 0 && !m.swept.Equal(m.lastSeen)
+}
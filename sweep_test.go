@@ -0,0 +1,48 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateExpireAfter(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, MachineTTL: time.Millisecond})
+	require.NoError(t, err)
+
+	var expired []StateType
+	def := b.Default(Default)
+	def.Event("buy", "Checkout")
+	checkout := b.State("Checkout")
+	checkout.ExpireAfter(time.Minute)
+	checkout.Event(Expire, Default)
+	checkout.Handle(OnExpire, func(m *Machine) {
+		expired = append(expired, m.Current())
+	})
+
+	m := b.machine(&User{ID: 1})
+	require.NoError(t, m.SendEvent("buy"))
+
+	now := time.Now()
+	b.sweep(now)
+	assert.Empty(t, expired)
+
+	// the machine is not evicted before it expired
+	b.machines.evict(now.Add(2 * time.Minute))
+	_, ok := b.machines.Get("1")
+	assert.True(t, ok)
+
+	b.sweep(now.Add(2 * time.Minute))
+	assert.Equal(t, []StateType{"Checkout"}, expired)
+	assert.Equal(t, Default, m.Current())
+
+	// it expires once per idle period
+	b.sweep(now.Add(3 * time.Minute))
+	assert.Len(t, expired, 1)
+
+	b.machines.evict(now.Add(3 * time.Minute))
+	_, ok = b.machines.Get("1")
+	assert.False(t, ok)
+}
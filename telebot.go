@@ -35,6 +35,9 @@ var (
 	ErrUnsupportedWhat = errors.New("stb: unsupported what argument")
 	ErrCouldNotUpdate  = errors.New("stb: could not fetch new updates")
 	ErrTrueResult      = errors.New("stb: result is True")
+
+	ErrUnsupportedEndpoint = errors.New("stb: unsupported endpoint")
+	ErrBadHandler          = errors.New("stb: bad handler")
 )
 
 const DefaultApiURL = "https://api.telegram.org"
@@ -46,7 +49,7 @@ const DefaultApiURL = "https://api.telegram.org"
 const (
 	// Basic message handlers.
 	//
-	// Handler: func(*Message)
+	// Handler: func(*Message, *Machine)
 	OnText              = "\atext"
 	OnCommand           = "\acommand"
 	OnPhoto             = "\aphoto"
@@ -67,6 +70,9 @@ const (
 	OnDice              = "\adice"
 	OnInvoice           = "\ainvoice"
 	OnPayment           = "\apayment"
+	OnRefund            = "\arefunded_payment"
+	OnPaidMedia         = "\apaid_media"
+	OnWebAppData        = "\aweb_app_data"
 
 	// Will fire when bot is added to a group.
 	OnAddedToGroup = "\aadded_to_group"
@@ -88,29 +94,68 @@ const (
 
 	// Will fire on callback requests.
 	//
-	// Handler: func(*Callback)
+	// Handler: func(*Callback, *Machine)
 	OnCallback = "\acallback"
 
 	// Will fire on incoming inline queries.
 	//
-	// Handler: func(*Query)
+	// Handler: func(*Query, *Machine)
 	OnQuery = "\aquery"
 
 	// Will fire on chosen inline results.
 	//
-	// Handler: func(*ChosenInlineResult)
+	// Handler: func(*ChosenInlineResult, *Machine)
 	OnChosenInlineResult = "\achosen_inline_result"
 
 	// Will fire on ShippingQuery.
 	//
-	// Handler: func(*ShippingQuery)
+	// Handler: func(*ShippingQuery, *Machine)
 	OnShipping = "\ashipping_query"
 
 	// Will fire on PreCheckoutQuery.
 	//
-	// Handler: func(*PreCheckoutQuery)
+	// Handler: func(*PreCheckoutQuery, *Machine)
 	OnCheckout = "\apre_checkout_query"
 
+	// Will fire when a user purchases paid media with a non-empty
+	// payload sent by the bot in a non-channel chat.
+	//
+	// Handler: func(*PaidMediaPurchased, *Machine)
+	OnPaidMediaPurchased = "\apurchased_paid_media"
+
+	// Will fire when the bot is connected to or disconnected from
+	// a business account. The machine of the business account user
+	// talks to them in their private chat.
+	//
+	// Handler: func(*BusinessConnection, *Machine)
+	OnBusinessConnection = "\abusiness_connection"
+
+	// Will fire on new and edited messages in chats of a connected
+	// business account. Machine.Send answers them on behalf of the
+	// business account.
+	//
+	// Handler: func(*Message, *Machine)
+	OnBusinessMessage       = "\abusiness_message"
+	OnEditedBusinessMessage = "\aedited_business_message"
+
+	// Will fire when messages are deleted from a connected business account.
+	//
+	// Handler: func(*BusinessMessagesDeleted, *Machine)
+	OnDeletedBusinessMessages = "\adeleted_business_messages"
+
+	// Will fire when a chat the bot administers gets boosted
+	// or a boost is changed. Unclaimed giveaway prizes have no
+	// user, unless machines are scoped by chat (see ScopeChat),
+	// they only reach global handlers with a nil machine.
+	//
+	// Handler: func(*ChatBoostUpdated, *Machine)
+	OnChatBoost = "\achat_boost"
+
+	// Will fire when a boost is removed from a chat the bot administers.
+	//
+	// Handler: func(*ChatBoostRemoved, *Machine)
+	OnChatBoostRemoved = "\aremoved_chat_boost"
+
 	// Will fire on Poll.
 	//
 	// Handler: func(*Poll)
@@ -118,17 +163,17 @@ const (
 
 	// Will fire on PollAnswer.
 	//
-	// Handler: func(*PollAnswer)
+	// Handler: func(*PollAnswer, *Machine)
 	OnPollAnswer = "\apoll_answer"
 
 	// Will fire on MyChatMember
 	//
-	// Handler: func(*ChatMemberUpdated)
+	// Handler: func(*ChatMemberUpdated, *Machine)
 	OnMyChatMember = "\amy_chat_member"
 
 	// Will fire on ChatMember
 	//
-	// Handler: func(*ChatMemberUpdated)
+	// Handler: func(*ChatMemberUpdated, *Machine)
 	OnChatMember = "\achat_member"
 
 	// Will fire on VoiceChatStarted
@@ -160,6 +205,83 @@ const (
 	//
 	// Handler: func(*Message)
 	OnVoiceChatScheduled = "\avoice_chat_scheduled"
+
+	// Will fire on forum topic service messages.
+	//
+	// Handler: func(*Message, *Machine)
+	OnTopicCreated  = "\atopic_created"
+	OnTopicEdited   = "\atopic_edited"
+	OnTopicClosed   = "\atopic_closed"
+	OnTopicReopened = "\atopic_reopened"
+
+	// Will fire on requests to join a chat the bot administers.
+	// The machine talks to the user in their private chat,
+	// see Machine.Approve and Machine.Decline.
+	//
+	// Handler: func(*ChatJoinRequest, *Machine)
+	OnChatJoinRequest = "\achat_join_request"
+
+	// Will fire on changes of the reactions of a user.
+	//
+	// Handler: func(*MessageReaction, *Machine)
+	OnReaction = "\amessage_reaction"
+
+	// Will fire on changes of anonymous reactions.
+	//
+	// Handler: func(*MessageReactionCount, *Machine)
+	OnReactionCount = "\amessage_reaction_count"
+
+	// Will fire on albums, once all their messages arrived
+	// (see Settings.AlbumWait). Without an OnAlbum handler,
+	// the messages of albums are handled one by one.
+	//
+	// Handler: func([]*Message, *Machine)
+	OnAlbum = "\aalbum"
+
+	// Will fire when a live location starts being shared, moves
+	// and stops being shared, whether by the user or once its
+	// period ended. Without an OnLiveLocation handler, live
+	// locations are handled by OnLocation and OnEdited.
+	//
+	// Handler: func(*LiveLocation, *Machine)
+	OnLiveLocation = "\alive_location"
+
+	// Will fire on every update no other handler took care of,
+	// in the state of the machine, its parents or the global
+	// state, e.g. to tell the user what the bot expects from
+	// them. The machine is nil for updates without a chat.
+	//
+	// Handler: func(*Update, *Machine)
+	OnAnyUpdate = "\aany_update"
+
+	// Will fire on every update before it is routed, without
+	// consuming it, e.g. to log the traffic. The handlers of the
+	// state of the machine, its parents and the global state
+	// all fire.
+	//
+	// Handler: func(*Update, *Machine)
+	OnEveryUpdate = "\aevery_update"
+
+	// Will fire when the user blocks the bot, noticed either by
+	// a my_chat_member update of the private chat or by a failing
+	// Machine.Send, see Machine.Blocked.
+	//
+	// Handler: func(*Machine)
+	OnBotBlocked = "\abot_blocked"
+
+	// Will fire when the user unblocks the bot again.
+	//
+	// Handler: func(*Machine)
+	OnBotUnblocked = "\abot_unblocked"
+
+	// Will fire when the machine stayed idle in a state
+	// for longer than its limit, see State.ExpireAfter.
+	//
+	// Handler: func(*Machine)
+	OnExpire = "\aexpire"
+
+	// onFallback is the endpoint of State.Fallback.
+	onFallback = "\afallback"
 )
 
 // ChatAction is a client-side status indicating bot activity.
@@ -207,6 +329,9 @@ const (
 	EntityCode          EntityType = "code"
 	EntityCodeBlock     EntityType = "pre"
 	EntityTextLink      EntityType = "text_link"
+	EntitySpoiler       EntityType = "spoiler"
+	EntityCustomEmoji   EntityType = "custom_emoji"
+	EntityBlockquote    EntityType = "blockquote"
 )
 
 // ChatType represents one of the possible chat types.
@@ -0,0 +1,108 @@
+package stb
+
+import "time"
+
+// Timeout makes machines that stay idle in the state for longer
+// than d transition into the target state. Every update processed
+// by the machine resets the timer. The deadline is persisted, and
+// the bot loads the stored machines waiting for one on Start.
+//
+// Example:
+//
+//     checkout.Timeout(10*time.Minute, Default)
+//
+func (s *State) Timeout(d time.Duration, target StateType) {
+	s.timeout = d
+	s.timeoutTarget = target
+}
+
+// touch marks the machine as used from the chat and forum
+// topic and resets the timeout of the current state.
+func (m *Machine) touch(chat *Chat, thread int, business string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.lastSeen = time.Now()
+	moved := false
+	if chat != nil {
+		m.currentMu.Lock()
+		moved = m.chat == nil || m.chat.ID != chat.ID
+		m.chat, m.thread, m.business = chat, thread, business
+		m.currentMu.Unlock()
+	}
+
+	// the chat is persisted, so the machine can be messaged later on
+	if m.resetTimeout() || moved {
+		m.save()
+	}
+}
+
+// resetTimeout restarts the timer if the current state has a
+// timeout, otherwise stops it. It reports whether the timer runs.
+// The caller must hold the mutex.
+func (m *Machine) resetTimeout() bool {
+	state, ok := m.states[m.current]
+	if !ok || state.timeout <= 0 {
+		if m.timer != nil {
+			m.timer.Stop()
+		}
+		m.currentMu.Lock()
+		m.deadline = time.Time{}
+		m.currentMu.Unlock()
+		return false
+	}
+
+	m.schedule(time.Now().Add(state.timeout))
+	return true
+}
+
+// stopTimers stops the timeout and the scheduled events
+// of a machine that is replaced.
+func (m *Machine) stopTimers() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	for _, se := range m.scheduled {
+		se.timer.Stop()
+	}
+	m.currentMu.Lock()
+	m.deadline = time.Time{}
+	m.scheduled = nil
+	m.currentMu.Unlock()
+}
+
+// schedule arms the timer to fire at the deadline.
+func (m *Machine) schedule(deadline time.Time) {
+	m.currentMu.Lock()
+	m.deadline = deadline
+	m.currentMu.Unlock()
+	if m.timer == nil {
+		m.timer = time.AfterFunc(time.Until(deadline), m.expire)
+	} else {
+		m.timer.Reset(time.Until(deadline))
+	}
+}
+
+// expire moves the machine into the timeout target of the current state.
+func (m *Machine) expire() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// the timer could have been reset or stopped while firing
+	if m.deadline.IsZero() || time.Now().Before(m.deadline) {
+		return
+	}
+
+	state, ok := m.states[m.current]
+	if !ok || state.timeout <= 0 {
+		return
+	}
+
+	m.setPayload(nil)
+	if err := m.transition(state.timeoutTarget, ""); err != nil && m.reporter != nil {
+		m.reporter(err)
+	}
+}
@@ -0,0 +1,59 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateTimeout(t *testing.T) {
+	store := NewMemoryStore()
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+
+	entered := make(chan struct{}, 1)
+	def := b.Default(Default)
+	def.Event("wait", "Waiting")
+	def.Action(func(*Machine) { entered <- struct{}{} })
+	waiting := b.State("Waiting")
+	waiting.Timeout(time.Hour, Default)
+
+	user := &User{ID: 1}
+	m := b.machine(user)
+	require.NoError(t, m.SendEvent("wait"))
+
+	snap, err := store.Load("1")
+	require.NoError(t, err)
+	require.NotNil(t, snap.Deadline)
+	deadline := *snap.Deadline
+
+	// updates keep the machine alive
+	time.Sleep(time.Millisecond)
+	b.ProcessUpdate(Update{Message: &Message{Text: "hi", Sender: user}})
+	snap, err = store.Load("1")
+	require.NoError(t, err)
+	assert.True(t, snap.Deadline.After(deadline))
+	assert.Equal(t, StateType("Waiting"), m.Current())
+
+	waiting.Timeout(10*time.Millisecond, Default)
+	b.ProcessUpdate(Update{Message: &Message{Text: "hi", Sender: user}})
+	select {
+	case <-entered:
+	case <-time.After(time.Second):
+		t.Fatal("machine did not time out")
+	}
+	assert.Equal(t, Default, m.Current())
+
+	// a restored machine keeps its deadline
+	past := time.Now().Add(-time.Second)
+	require.NoError(t, store.Save("2", &Snapshot{State: "Waiting", Deadline: &past}))
+	b.machine(&User{ID: 2})
+
+	select {
+	case <-entered:
+	case <-time.After(time.Second):
+		t.Fatal("restored machine did not time out")
+	}
+}
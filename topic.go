@@ -0,0 +1,66 @@
+package stb
+
+import "strconv"
+
+// TopicCreated represents a service message about
+// a new forum topic created in the chat.
+type TopicCreated struct {
+	Name              string `json:"name"`
+	IconColor         int    `json:"icon_color"`
+	IconCustomEmojiID string `json:"icon_custom_emoji_id,omitempty"`
+}
+
+// TopicEdited represents a service message about an edited forum
+// topic. Fields are only set if they were changed.
+type TopicEdited struct {
+	Name              string  `json:"name,omitempty"`
+	IconCustomEmojiID *string `json:"icon_custom_emoji_id,omitempty"`
+}
+
+// TopicClosed represents a service message about a forum
+// topic closed in the chat. It holds no information.
+type TopicClosed struct{}
+
+// TopicReopened represents a service message about a forum
+// topic reopened in the chat. It holds no information.
+type TopicReopened struct{}
+
+// ScopeTopic gives every forum topic a machine, shared by all the
+// members talking in it. Outside of forums it acts like ScopeChat.
+func ScopeTopic(upd Update) string {
+	chat := ScopeChat(upd)
+	if chat == "" {
+		return ""
+	}
+	if thread := updateThread(upd); thread != 0 {
+		return chat + "/" + strconv.Itoa(thread)
+	}
+	return chat
+}
+
+// ScopeTopicUser gives every user a machine per forum topic.
+// Outside of forums it acts like ScopeChatUser.
+func ScopeTopicUser(upd Update) string {
+	topic, user := ScopeTopic(upd), ScopeUser(upd)
+	if topic == "" || user == "" {
+		return ""
+	}
+	return topic + ":" + user
+}
+
+// updateThread returns the forum topic an update comes from or 0.
+func updateThread(upd Update) int {
+	var msg *Message
+	switch {
+	case upd.Message != nil:
+		msg = upd.Message
+	case upd.EditedMessage != nil:
+		msg = upd.EditedMessage
+	case upd.Callback != nil:
+		msg = upd.Callback.Message
+	}
+	if msg == nil || !msg.TopicMessage {
+		return 0
+	}
+	return msg.ThreadID
+}
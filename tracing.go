@@ -0,0 +1,95 @@
+package stb
+
+import "context"
+
+// Tracer starts the spans of a trace, see Settings.Tracer.
+//
+// The bot traces every update with a "stb.update" span, the
+// handlers and actions it runs with "stb.handler" spans, and the
+// requests machines make with spans like "stb.send" or "stb.edit".
+// Handlers continue the trace with Machine.Context.
+//
+// Tracer is small enough to be backed by any tracing library,
+// e.g. OpenTelemetry:
+//
+//     type otelTracer struct{ trace.Tracer }
+//
+//     func (t otelTracer) Start(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, stb.Span) {
+//         ctx, span := t.Tracer.Start(ctx, name)
+//         for k, v := range attrs {
+//             span.SetAttributes(attribute.String(k, fmt.Sprint(v)))
+//         }
+//         return ctx, otelSpan{span}
+//     }
+//
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx, if
+	// there is one, and returns ctx with the new span.
+	Start(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, Span)
+}
+
+// Span is an operation of a trace started by a Tracer.
+type Span interface {
+	// SetAttribute adds an attribute to the span.
+	SetAttribute(key string, value interface{})
+
+	// End ends the span, err is the error it failed with or nil.
+	End(err error)
+}
+
+// Context returns the context of the handler the machine was
+// handed to, carrying its span if the bot has a Tracer. Pass it
+// on to continue the trace of the update. Outside of handlers,
+// it returns context.Background.
+func (m *Machine) Context() context.Context {
+	if m.spanCtx == nil {
+		return context.Background()
+	}
+	return m.spanCtx
+}
+
+// withContext returns a copy of the machine with the context. The
+// copies share their state, but each handler running at the same
+// time as others has its own context.
+func (m *Machine) withContext(ctx context.Context) *Machine {
+	return &Machine{machineCore: m.machineCore, spanCtx: ctx}
+}
+
+// noSpan is started when the bot has no tracer.
+type noSpan struct{}
+
+func (noSpan) SetAttribute(string, interface{}) {}
+func (noSpan) End(error)                        {}
+
+// startSpan starts a span with the tracer of the bot, if there is one.
+func (b *Bot) startSpan(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if b == nil || b.tracer == nil {
+		return ctx, noSpan{}
+	}
+	return b.tracer.Start(ctx, name, attrs)
+}
+
+// traceUpdate starts the span of an update.
+func (b *Bot) traceUpdate(upd Update) (context.Context, Span) {
+	attrs := map[string]interface{}{
+		"stb.update.id":   upd.ID,
+		"stb.update.type": UpdateType(upd),
+	}
+	if chat := updateChat(upd); chat != nil {
+		attrs["stb.chat"] = chat.ID
+	}
+	return b.startSpan(context.Background(), "stb.update", attrs)
+}
+
+// trace starts a span of a request the machine makes.
+func (m *Machine) trace(name string) Span {
+	attrs := map[string]interface{}{"stb.machine": m.id}
+	if chat := m.Chat(); chat != nil {
+		attrs["stb.chat"] = chat.ID
+	}
+	_, span := m.bot.startSpan(m.Context(), name, attrs)
+	return span
+}
@@ -0,0 +1,133 @@
+package stb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type spanKey struct{}
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	ended  bool
+	err    error
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *testSpan) End(err error)                              { s.ended, s.err = true, err }
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent, _ := ctx.Value(spanKey{}).(*testSpan)
+	span := &testSpan{name: name, parent: parent, attrs: attrs}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestTracer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer srv.Close()
+
+	tracer := &testTracer{}
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL, Tracer: tracer})
+	require.NoError(t, err)
+
+	var handlerCtx context.Context
+	start := b.Default(Default)
+	start.Event("start", "Menu")
+	start.MustHandle("/start", func(msg *Message, m *Machine) error {
+		handlerCtx = m.Context()
+		return m.SendEvent("start")
+	})
+	menu := b.State("Menu")
+	menu.Action(func(m *Machine) {
+		m.Send("menu")
+	})
+	menu.MustHandle(OnText, func(msg *Message, m *Machine) error {
+		return errors.New("failed")
+	})
+
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{ID: 5, Message: &Message{Sender: user, Chat: &Chat{ID: 1}, Text: "/start"}})
+
+	require.Len(t, tracer.spans, 4)
+	update, handler, action, send := tracer.spans[0], tracer.spans[1], tracer.spans[2], tracer.spans[3]
+
+	assert.Equal(t, "stb.update", update.name)
+	assert.Nil(t, update.parent)
+	assert.Equal(t, 5, update.attrs["stb.update.id"])
+	assert.Equal(t, "message", update.attrs["stb.update.type"])
+
+	assert.Equal(t, "stb.handler", handler.name)
+	assert.Equal(t, update, handler.parent)
+	assert.Equal(t, "Default", handler.attrs["stb.state"])
+	assert.Equal(t, "/start", handler.attrs["stb.endpoint"])
+	assert.Equal(t, "1", handler.attrs["stb.machine"])
+	assert.Equal(t, handler, handlerCtx.Value(spanKey{}))
+
+	// the action of the state entered by the handler
+	assert.Equal(t, handler, action.parent)
+	assert.Equal(t, "Menu", action.attrs["stb.state"])
+	assert.Equal(t, "", action.attrs["stb.endpoint"])
+
+	assert.Equal(t, "stb.send", send.name)
+	assert.Equal(t, action, send.parent)
+	assert.Equal(t, int64(1), send.attrs["stb.chat"])
+
+	for _, span := range tracer.spans {
+		assert.True(t, span.ended, span.name)
+	}
+
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: &Chat{ID: 1}, Text: "hi"}})
+	require.Len(t, tracer.spans, 6)
+	assert.EqualError(t, tracer.spans[5].err, "failed")
+
+	// outside of handlers the context is the background
+	assert.Equal(t, context.Background(), b.machine(user).Context())
+}
+
+func TestTracerConcurrentHandlers(t *testing.T) {
+	tracer := &testTracer{}
+	b, err := NewBot(Settings{Offline: true, Workers: 2, Tracer: tracer})
+	require.NoError(t, err)
+
+	var (
+		started = make(chan struct{})
+		proceed = make(chan struct{})
+		same    = make(chan bool, 2)
+	)
+	b.Default(Default).MustHandle(OnText, func(msg *Message, m *Machine) {
+		ctx := m.Context()
+		started <- struct{}{}
+		<-proceed
+		same <- m.Context() == ctx
+	})
+
+	// the machine of the user handles both chats at the same time
+	user := &User{ID: 1}
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: &Chat{ID: 1}, Text: "a"}})
+	b.ProcessUpdate(Update{Message: &Message{Sender: user, Chat: &Chat{ID: 2}, Text: "b"}})
+	<-started
+	<-started
+	close(proceed)
+
+	assert.True(t, <-same)
+	assert.True(t, <-same)
+}
@@ -0,0 +1,197 @@
+package stb
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UserData is everything kept about a user, see Machines.ExportUser.
+type UserData struct {
+	UserID int64 `json:"user_id"`
+
+	// Machines are the snapshots of the machines of the user,
+	// with their contexts, sessions, timers and outboxes.
+	Machines map[string]*Snapshot `json:"machines"`
+
+	// Extra holds what the hooks exported, by hook name.
+	Extra map[string]interface{} `json:"extra,omitempty"`
+}
+
+// UserDataHook lets the stores of the application take part in
+// Machines.ExportUser and Machines.Erase.
+type UserDataHook interface {
+	// ExportUser returns the data kept about the user,
+	// which must be JSON encodable, or nil if there is none.
+	ExportUser(userID int64) (interface{}, error)
+
+	// EraseUser removes the data kept about the user.
+	EraseUser(userID int64) error
+}
+
+type userHook struct {
+	name string
+	hook UserDataHook
+}
+
+// HandleUserData adds a hook exporting and erasing the data
+// the application keeps about users, under the name in exports.
+func (ms *Machines) HandleUserData(name string, hook UserDataHook) {
+	ms.hooksMu.Lock()
+	ms.userHooks = append(ms.userHooks, userHook{name: name, hook: hook})
+	ms.hooksMu.Unlock()
+}
+
+// userMachine reports whether the machine id belongs to the user:
+// the id is the user id, as with ScopeUser, or "chat:user" and
+// "chat/topic:user", as with ScopeChatUser and ScopeTopicUser.
+// Machines shared by the members of a group are not the user's.
+func userMachine(id string, userID int64) bool {
+	user := strconv.FormatInt(userID, 10)
+	if id == user {
+		return true
+	}
+
+	chat := strings.TrimSuffix(id, ":"+user)
+	if chat == id {
+		return false
+	}
+	if i := strings.IndexByte(chat, '/'); i >= 0 {
+		if _, err := strconv.Atoi(chat[i+1:]); err != nil {
+			return false
+		}
+		chat = chat[:i]
+	}
+	_, err := strconv.ParseInt(chat, 10, 64)
+	return err == nil
+}
+
+// userMachineIDs returns the ids of the loaded and the stored
+// machines of the user. Without a Lister, only the machine keyed
+// by the user id alone is looked up in the store.
+func (ms *Machines) userMachineIDs(userID int64) ([]string, error) {
+	seen := make(map[string]bool)
+	ms.Range(func(m *Machine) bool {
+		if userMachine(m.id, userID) {
+			seen[m.id] = true
+		}
+		return true
+	})
+
+	if ms.store != nil {
+		stored := []string{strconv.FormatInt(userID, 10)}
+		if lister, ok := ms.store.(Lister); ok {
+			var err error
+			if stored, err = lister.IDs(); err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range stored {
+			if userMachine(id, userID) {
+				seen[id] = true
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// erase stops the machine from being saved again, once the event it
+// processes is done, and stops its timers.
+func (m *Machine) erase() {
+	m.mutex.Lock()
+	m.saveMu.Lock()
+	m.erased = true
+	m.saveMu.Unlock()
+	m.mutex.Unlock()
+
+	m.stopTimers()
+}
+
+// ExportUser returns everything kept about the user, e.g. to answer
+// a data access request: the machines of the user, see userMachine
+// for which, and the data of the hooks added with HandleUserData.
+func (ms *Machines) ExportUser(userID int64) (*UserData, error) {
+	ids, err := ms.userMachineIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &UserData{UserID: userID, Machines: make(map[string]*Snapshot)}
+	for _, id := range ids {
+		var snap *Snapshot
+		if m, ok := ms.Get(id); ok {
+			snap, err = m.Snapshot()
+		} else {
+			snap, err = ms.store.Load(id)
+		}
+		if err == ErrNotStored {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "stb: can't export machine %s", id)
+		}
+		data.Machines[id] = snap
+	}
+
+	ms.hooksMu.Lock()
+	hooks := ms.userHooks
+	ms.hooksMu.Unlock()
+	for _, h := range hooks {
+		extra, err := h.hook.ExportUser(userID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "stb: user data %s", h.name)
+		}
+		if extra == nil {
+			continue
+		}
+		if data.Extra == nil {
+			data.Extra = make(map[string]interface{})
+		}
+		data.Extra[h.name] = extra
+	}
+	return data, nil
+}
+
+// Erase removes everything kept about the user, e.g. to answer
+// a data erasure request: the machines of the user are unloaded,
+// their timers stopped and their snapshots deleted from the store,
+// with their sessions, deduplication records and outboxes, then
+// the hooks added with HandleUserData erase their data. A machine
+// comes back empty if the user talks to the bot again. Handlers
+// still running on an erased machine don't save it anymore.
+func (ms *Machines) Erase(userID int64) error {
+	ids, err := ms.userMachineIDs(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if m, ok := ms.Get(id); ok {
+			ms.Delete(id)
+			m.erase()
+		}
+		if ms.store != nil {
+			if err := ms.store.Delete(id); err != nil {
+				return errors.Wrapf(err, "stb: can't erase machine %s", id)
+			}
+		}
+	}
+
+	ms.hooksMu.Lock()
+	hooks := ms.userHooks
+	ms.hooksMu.Unlock()
+	for _, h := range hooks {
+		if err := h.hook.EraseUser(userID); err != nil {
+			return errors.Wrapf(err, "stb: user data %s", h.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package stb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testUserData map[int64]string
+
+func (d testUserData) ExportUser(userID int64) (interface{}, error) {
+	if v, ok := d[userID]; ok {
+		return v, nil
+	}
+	return nil, nil
+}
+
+func (d testUserData) EraseUser(userID int64) error {
+	delete(d, userID)
+	return nil
+}
+
+func TestMachinesUserData(t *testing.T) {
+	store := NewMemoryStore()
+	require.NoError(t, store.Save("-100:7", &Snapshot{State: Default}))
+	require.NoError(t, store.Save("-100:17", &Snapshot{State: Default}))
+	require.NoError(t, store.Save("-100", &Snapshot{State: Default}))
+	require.NoError(t, store.Save("-100/5:7", &Snapshot{State: Default}))
+	require.NoError(t, store.Save("app:7", &Snapshot{State: Default}))
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+	require.NoError(t, err)
+	b.Default(Default)
+	b.Handle(OnText, func(msg *Message, m *Machine) {
+		m.Session().Set("phone", "+49 123")
+	})
+	b.ProcessUpdate(Update{Message: &Message{Text: "hi", Sender: &User{ID: 7}, Chat: &Chat{ID: 7}}})
+
+	app := testUserData{7: "orders", 17: "invoices"}
+	b.Machines().HandleUserData("orders", app)
+
+	data, err := b.Machines().ExportUser(7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), data.UserID)
+	require.Len(t, data.Machines, 3)
+	assert.Contains(t, data.Machines, "-100:7")
+	assert.Contains(t, data.Machines, "-100/5:7")
+	assert.Contains(t, data.Machines["7"].Session, "phone")
+	assert.Equal(t, map[string]interface{}{"orders": "orders"}, data.Extra)
+
+	m, _ := b.Machines().Get("7")
+	require.NoError(t, b.Machines().Erase(7))
+	_, ok := b.Machines().Get("7")
+	assert.False(t, ok)
+
+	// a handler still running can't bring the data back
+	m.Session().Set("phone", "+49 123")
+
+	ids, err := store.IDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-100", "-100:17", "app:7"}, ids)
+	assert.Equal(t, testUserData{17: "invoices"}, app)
+
+	data, err = b.Machines().ExportUser(7)
+	require.NoError(t, err)
+	assert.Empty(t, data.Machines)
+	assert.Nil(t, data.Extra)
+}
@@ -28,12 +28,13 @@ func (b *Bot) debug(err error) {
 	}
 }
 
-func (s *State) deferDebug() {
+func (s *State) deferDebug(upd Update) {
 	if r := recover(); r != nil {
-		if err, ok := r.(error); ok {
-			s.debug(err)
-		} else if str, ok := r.(string); ok {
-			s.debug(errors.Errorf("%s", str))
+		p := newPanic(r, upd, s.Type)
+		if s.bot != nil && s.bot.recoverer != nil {
+			s.bot.recoverer.Recover(p)
+		} else {
+			s.debug(p)
 		}
 	}
 }
@@ -144,6 +145,10 @@ func extractOptions(how []interface{}) *SendOptions {
 					opts.ReplyMarkup = &ReplyMarkup{}
 				}
 				opts.ReplyMarkup.OneTimeKeyboard = true
+			case Protected:
+				opts.ProtectContent = true
+			case Split:
+				opts.Split = true
 			default:
 				panic("stb: unsupported flag-option")
 			}
@@ -166,7 +171,10 @@ func (b *Bot) embedSendOptions(params map[string]string, opt *SendOptions) {
 		return
 	}
 
-	if opt.ReplyTo != nil && opt.ReplyTo.ID != 0 {
+	if opt.ReplyParams != nil {
+		replyParams, _ := json.Marshal(opt.ReplyParams)
+		params["reply_parameters"] = string(replyParams)
+	} else if opt.ReplyTo != nil && opt.ReplyTo.ID != 0 {
 		params["reply_to_message_id"] = strconv.Itoa(opt.ReplyTo.ID)
 	}
 
@@ -190,6 +198,35 @@ func (b *Bot) embedSendOptions(params map[string]string, opt *SendOptions) {
 		params["allow_sending_without_reply"] = "true"
 	}
 
+	if opt.BusinessConnectionID != "" {
+		params["business_connection_id"] = opt.BusinessConnectionID
+	}
+
+	if opt.ThreadID != 0 {
+		params["message_thread_id"] = strconv.Itoa(opt.ThreadID)
+	}
+
+	if opt.ProtectContent {
+		params["protect_content"] = "true"
+	}
+
+	if opt.LinkPreview != nil {
+		linkPreview, _ := json.Marshal(opt.LinkPreview)
+		params["link_preview_options"] = string(linkPreview)
+	}
+
+	if opt.EffectID != "" {
+		params["message_effect_id"] = opt.EffectID
+	}
+
+	if len(opt.Entities) > 0 {
+		entities, _ := json.Marshal(opt.Entities)
+		params["entities"] = string(entities)
+		if opt.ParseMode == ModeDefault {
+			delete(params, "parse_mode")
+		}
+	}
+
 	if opt.ReplyMarkup != nil {
 		processButtons(opt.ReplyMarkup.InlineKeyboard)
 		replyMarkup, _ := json.Marshal(opt.ReplyMarkup)
@@ -245,3 +282,18 @@ func intsToStrs(ns []int) (s []string) {
 	}
 	return
 }
+
+// OnError sets the function the errors returned by handlers are
+// sent to, along with the update they were processing. Without it,
+// the errors go to Settings.Reporter.
+func (b *Bot) OnError(handler func(error, Update)) {
+	b.onError = handler
+}
+
+func (b *Bot) handleError(err error, upd Update) {
+	if b.onError != nil {
+		b.onError(err, upd)
+	} else {
+		b.debug(err)
+	}
+}
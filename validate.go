@@ -0,0 +1,157 @@
+package stb
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Problems found by ValidateStates, wrapped with the details.
+var (
+	ErrUndefinedState   = errors.New("stb: undefined state")
+	ErrUnreachableState = errors.New("stb: unreachable state")
+	ErrDeadEndState     = errors.New("stb: state has no exits")
+	ErrDuplicateHandler = errors.New("stb: handler registered twice")
+)
+
+// ValidateStates checks the state graph for mistakes that would
+// otherwise only show up at runtime: events and timeouts targeting
+// undefined states, states that can't be reached from Default,
+// states with no way out and endpoints registered twice.
+//
+// Check the problems with errors.Is:
+//
+//     for _, err := range stb.ValidateStates(states) {
+//         if errors.Is(err, stb.ErrUndefinedState) {
+//             log.Fatal(err)
+//         }
+//     }
+//
+func ValidateStates(states map[StateType]*State) []error {
+	return validateStates(states, Default, nil)
+}
+
+// Validate runs ValidateStates on the states of the bot,
+// starting from its default state and taking global events
+// and global handlers into account.
+func (b *Bot) Validate() []error {
+	problems := validateStates(b.states, b.defaultState, b.events)
+	for _, end := range sortedKeys(b.global.duplicates) {
+		problems = append(problems, errors.Wrapf(ErrDuplicateHandler, "global %q", end))
+	}
+	return problems
+}
+
+func validateStates(all map[StateType]*State, root StateType, global map[EventType]StateType) []error {
+	var problems []error
+
+	// the global state of the bot is not part of the graph
+	states := make(map[StateType]*State, len(all))
+	for t, s := range all {
+		if t != "" {
+			states[t] = s
+		}
+	}
+
+	types := make([]string, 0, len(states))
+	for t := range states {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+
+	// exits returns the states reachable from t in one step.
+	exits := func(t StateType) []StateType {
+		var next []StateType
+		for _, s := range lineage(states, t) {
+			for _, target := range s.Events {
+				next = append(next, target)
+			}
+		}
+		if s := states[t]; s.timeout > 0 {
+			next = append(next, s.timeoutTarget)
+		}
+		for _, target := range global {
+			next = append(next, target)
+		}
+		return next
+	}
+
+	for _, e := range sortedEvents(global) {
+		if _, ok := states[global[e]]; !ok {
+			problems = append(problems, errors.Wrapf(ErrUndefinedState,
+				"global event %q targets %q", e, global[e]))
+		}
+	}
+
+	for _, t := range types {
+		s := states[StateType(t)]
+
+		for _, e := range sortedEvents(s.Events) {
+			if _, ok := states[s.Events[e]]; !ok {
+				problems = append(problems, errors.Wrapf(ErrUndefinedState,
+					"event %q of %q targets %q", e, t, s.Events[e]))
+			}
+		}
+		if s.timeout > 0 {
+			if _, ok := states[s.timeoutTarget]; !ok {
+				problems = append(problems, errors.Wrapf(ErrUndefinedState,
+					"timeout of %q targets %q", t, s.timeoutTarget))
+			}
+		}
+		if s.parent != "" {
+			if _, ok := states[s.parent]; !ok {
+				problems = append(problems, errors.Wrapf(ErrUndefinedState,
+					"parent of %q is %q", t, s.parent))
+			}
+		}
+
+		if len(exits(s.Type)) == 0 {
+			problems = append(problems, errors.Wrapf(ErrDeadEndState, "%q", t))
+		}
+
+		for _, end := range sortedKeys(s.duplicates) {
+			problems = append(problems, errors.Wrapf(ErrDuplicateHandler, "%q in %q", end, t))
+		}
+	}
+
+	reached := make(map[StateType]bool)
+	if _, ok := states[root]; ok {
+		queue := []StateType{root}
+		reached[root] = true
+		for len(queue) > 0 {
+			t := queue[0]
+			queue = queue[1:]
+			for _, next := range exits(t) {
+				if _, ok := states[next]; ok && !reached[next] {
+					reached[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+	for _, t := range types {
+		if !reached[StateType(t)] {
+			problems = append(problems, errors.Wrapf(ErrUnreachableState, "%q", t))
+		}
+	}
+
+	return problems
+}
+
+func sortedEvents(events map[EventType]StateType) []EventType {
+	sorted := make([]EventType, 0, len(events))
+	for e := range events {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func sortedKeys(set map[string]bool) []string {
+	sorted := make([]string, 0, len(set))
+	for key := range set {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
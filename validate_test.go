@@ -0,0 +1,47 @@
+package stb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateStates(t *testing.T) {
+	b, err := NewBot(Settings{Offline: true})
+	require.NoError(t, err)
+
+	b.Default(Default).Event("order", "Order")
+	order := b.State("Order")
+	order.Event("pay", "Payment")
+	order.Timeout(time.Minute, Default)
+	order.Handle(OnText, func(*Message, *Machine) {})
+	order.Handle(OnText, func(*Message, *Machine) {})
+	order.Handle(OnText, func(*Message, *Machine) {})
+	b.State("Done")
+	b.State("Lost").Event("back", Default)
+
+	count := func(problems []error, target error) (n int) {
+		for _, err := range problems {
+			if errors.Is(err, target) {
+				n++
+			}
+		}
+		return n
+	}
+
+	problems := ValidateStates(b.states)
+	assert.Equal(t, 1, count(problems, ErrUndefinedState))   // Payment
+	assert.Equal(t, 2, count(problems, ErrUnreachableState)) // Done, Lost
+	assert.Equal(t, 1, count(problems, ErrDeadEndState))     // Done
+	assert.Equal(t, 1, count(problems, ErrDuplicateHandler))
+	assert.Len(t, problems, 5)
+
+	// global events lead everywhere and out of everywhere
+	b.Event("done", "Done")
+	problems = b.Validate()
+	assert.Equal(t, 1, count(problems, ErrUnreachableState)) // Lost
+	assert.Equal(t, 0, count(problems, ErrDeadEndState))
+}
@@ -0,0 +1,240 @@
+package stb
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VoteReached and VoteExpired are the events a Vote sends to the
+// machine once a reaction reached the threshold or time ran out.
+// The payload is the *VoteResult.
+const (
+	VoteReached EventType = "vote_reached"
+	VoteExpired EventType = "vote_expired"
+)
+
+// VoteResult is the outcome of a Vote.
+type VoteResult struct {
+	// Emoji is the reaction that reached the threshold,
+	// empty if the vote expired.
+	Emoji string
+
+	// Counts are the reactions counted, by emoji.
+	Counts map[string]int
+}
+
+// Vote lets a chat decide with reactions. It sends and pins a message,
+// counts the reactions to it and sends VoteReached once one of them
+// reaches the threshold. The counts are kept in the session of the
+// machine, which needs a scope keying machines by chat (ScopeChat),
+// so that the reactions of every member reach it. Telegram only
+// sends reactions to bots that are administrators of the chat
+// and ask for them in the allowed updates.
+//
+// The vote is a child state of the state it is registered under,
+// which must handle VoteReached and, with a timeout, VoteExpired.
+//
+// Example:
+//
+//     vote := stb.NewVote("ban")
+//     vote.Emojis = []string{"👍", "👎"}
+//     vote.Threshold = 5
+//
+//     if err := vote.Register(b, stb.Default); err != nil {
+//         log.Fatal(err)
+//     }
+//     group.Event(stb.VoteReached, Decided)
+//
+//     group.Handle("/voteban", func(msg *stb.Message, m *stb.Machine) error {
+//         return m.SendEvent(vote.Event(), "Ban "+msg.Payload+"?")
+//     })
+//
+type Vote struct {
+	// Text is the message put up to vote, unless the
+	// event starting the vote carries a string payload.
+	Text string // Default: "React to vote."
+
+	// Emojis are the reactions counted, all of them if empty.
+	// Custom emojis are counted by their id.
+	Emojis []string
+
+	// Threshold is the count a reaction has to reach.
+	Threshold int // Default: 3
+
+	// Timeout is how long the vote lasts, forever if zero.
+	Timeout time.Duration
+
+	// Unpin unpins the message once the vote is over.
+	Unpin bool // Default: true
+
+	name string
+}
+
+// ballot is what the machine remembers about its vote.
+type ballot struct {
+	Message StoredMessage  `json:"message"`
+	Counts  map[string]int `json:"counts"`
+}
+
+// NewVote creates a vote with the default settings. The name
+// prefixes the states, events and session key the vote uses.
+func NewVote(name string) *Vote {
+	return &Vote{
+		Text:      "React to vote.",
+		Threshold: 3,
+		Unpin:     true,
+		name:      name,
+	}
+}
+
+// Event returns the global event starting the vote.
+func (v *Vote) Event() EventType {
+	return EventType(v.name)
+}
+
+// State returns the state machines are in while they vote.
+func (v *Vote) State() StateType {
+	return StateType(v.name)
+}
+
+// Register creates the states of the vote in the bot,
+// as children of the parent state.
+func (v *Vote) Register(b *Bot, parent StateType) error {
+	if v.Threshold <= 0 {
+		return errors.Errorf("stb: vote %q needs a positive threshold", v.name)
+	}
+
+	b.Event(v.Event(), v.State())
+
+	s := b.State(v.State())
+	s.Parent(parent)
+	s.Action(v.open)
+	s.MustHandle(OnReaction, v.react)
+	s.MustHandle(OnReactionCount, v.count)
+
+	if v.Timeout > 0 {
+		s.Timeout(v.Timeout, StateType(v.name+"/expired"))
+
+		expired := b.State(StateType(v.name + "/expired"))
+		expired.Parent(parent)
+		expired.Action(v.expire)
+	}
+
+	return nil
+}
+
+// Tally returns the reactions counted so far, by emoji.
+func (v *Vote) Tally(m *Machine) map[string]int {
+	var b ballot
+	m.Session().Get(v.name, &b)
+	return b.Counts
+}
+
+// open sends and pins the message put up to vote.
+func (v *Vote) open(m *Machine) {
+	text, ok := m.Payload().(string)
+	if !ok {
+		text = v.Text
+	}
+
+	msg, err := m.Send(text)
+	if err != nil {
+		m.report(err)
+		return
+	}
+	m.report(m.bot.Pin(msg, Silent))
+
+	id, chat := msg.MessageSig()
+	m.report(m.Session().Set(v.name, ballot{
+		Message: StoredMessage{MessageID: id, ChatID: chat},
+		Counts:  make(map[string]int),
+	}))
+}
+
+// counted returns the key a reaction is counted under, if it is.
+func (v *Vote) counted(r ReactionType) (string, bool) {
+	key := r.Emoji
+	if r.Type == "custom_emoji" {
+		key = r.CustomEmojiID
+	}
+	if len(v.Emojis) == 0 {
+		return key, key != ""
+	}
+	for _, emoji := range v.Emojis {
+		if emoji == key {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// ballot returns the ballot of the machine if the message is its.
+func (v *Vote) ballot(m *Machine, chat int64, message int) (ballot, bool) {
+	var b ballot
+	ok := m.Session().Get(v.name, &b) &&
+		b.Message.ChatID == chat && b.Message.MessageID == strconv.Itoa(message)
+	return b, ok
+}
+
+func (v *Vote) react(r *MessageReaction, m *Machine) error {
+	b, ok := v.ballot(m, r.Chat.ID, r.MessageID)
+	if !ok {
+		return nil
+	}
+	for _, reaction := range r.OldReaction {
+		if key, ok := v.counted(reaction); ok && b.Counts[key] > 0 {
+			b.Counts[key]--
+		}
+	}
+	for _, reaction := range r.NewReaction {
+		if key, ok := v.counted(reaction); ok {
+			b.Counts[key]++
+		}
+	}
+	return v.tally(m, b)
+}
+
+func (v *Vote) count(r *MessageReactionCount, m *Machine) error {
+	b, ok := v.ballot(m, r.Chat.ID, r.MessageID)
+	if !ok {
+		return nil
+	}
+	b.Counts = make(map[string]int)
+	for _, reaction := range r.Reactions {
+		if key, ok := v.counted(reaction.Type); ok {
+			b.Counts[key] = reaction.Count
+		}
+	}
+	return v.tally(m, b)
+}
+
+// tally saves the counts and ends the vote once
+// a reaction reached the threshold.
+func (v *Vote) tally(m *Machine, b ballot) error {
+	for emoji, count := range b.Counts {
+		if count >= v.Threshold {
+			v.close(m, b)
+			return m.SendEvent(VoteReached, &VoteResult{Emoji: emoji, Counts: b.Counts})
+		}
+	}
+	return m.Session().Set(v.name, b)
+}
+
+// close unpins the message and forgets the vote.
+func (v *Vote) close(m *Machine, b ballot) {
+	m.Session().Delete(v.name)
+	if v.Unpin && b.Message.MessageID != "" {
+		id, _ := strconv.Atoi(b.Message.MessageID)
+		m.report(m.bot.Unpin(&Chat{ID: b.Message.ChatID}, id))
+	}
+}
+
+// expire sends VoteExpired from the action of the timeout state.
+func (v *Vote) expire(m *Machine) {
+	var b ballot
+	m.Session().Get(v.name, &b)
+	v.close(m, b)
+	m.report(m.raise(VoteExpired, &VoteResult{Counts: b.Counts}))
+}
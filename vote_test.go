@@ -0,0 +1,97 @@
+package stb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVote(t *testing.T) {
+	api := newFakeAPI(t, `{"message_id":7,"chat":{"id":-1}}`)
+	settings := api.Settings()
+	settings.Scope = ScopeChat
+	b, err := NewBot(settings)
+	require.NoError(t, err)
+	group := b.Default(Default)
+	group.Event(VoteReached, "Decided")
+	group.Event(VoteExpired, "Undecided")
+	b.State("Decided")
+	b.State("Undecided")
+
+	vote := NewVote("ban")
+	vote.Emojis = []string{"👍", "👎"}
+	vote.Threshold = 2
+	require.NoError(t, vote.Register(b, Default))
+	group.Handle("/voteban", func(msg *Message, m *Machine) error {
+		return m.SendEvent(vote.Event(), "Ban?")
+	})
+
+	chat := &Chat{ID: -1, Type: ChatSuperGroup}
+	b.ProcessUpdate(Update{Message: &Message{Sender: &User{ID: 1}, Chat: chat, Text: "/voteban"}})
+	m, ok := b.machines.Get(b.scope(Update{Message: &Message{Sender: &User{ID: 1}, Chat: chat}}))
+	require.True(t, ok)
+	assert.Equal(t, vote.State(), m.Current())
+	assert.Equal(t, []string{"sendMessage", "pinChatMessage"}, api.Methods())
+
+	react := func(user, message int, old, new string) {
+		reaction := &MessageReaction{Chat: *chat, MessageID: message, User: &User{ID: user}}
+		if old != "" {
+			reaction.OldReaction = []ReactionType{{Type: "emoji", Emoji: old}}
+		}
+		if new != "" {
+			reaction.NewReaction = []ReactionType{{Type: "emoji", Emoji: new}}
+		}
+		b.ProcessUpdate(Update{MessageReaction: reaction})
+	}
+	react(2, 7, "", "👍")
+	react(3, 7, "", "🔥")
+	react(4, 8, "", "👍")
+	react(2, 7, "👍", "👎")
+	assert.Equal(t, map[string]int{"👍": 0, "👎": 1}, vote.Tally(m))
+
+	react(3, 7, "🔥", "👎")
+	assert.Equal(t, StateType("Decided"), m.Current())
+	result := m.Payload().(*VoteResult)
+	assert.Equal(t, "👎", result.Emoji)
+	assert.Equal(t, 2, result.Counts["👎"])
+	assert.Equal(t, []string{"unpinChatMessage"}, api.Methods())
+	assert.Nil(t, vote.Tally(m))
+
+	vote.Timeout = 10 * time.Millisecond
+	require.NoError(t, vote.Register(b, Default))
+	require.NoError(t, m.SendEvent(vote.Event()))
+	assert.Eventually(t, func() bool {
+		return m.Current() == "Undecided"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, &VoteResult{Counts: map[string]int{}}, m.Payload())
+}
+
+func TestVoteExpireAsync(t *testing.T) {
+	api := newFakeAPI(t, `{"message_id":7,"chat":{"id":-1}}`)
+	b, err := NewBot(Settings{Offline: true, URL: api.URL, Scope: ScopeChat})
+	require.NoError(t, err)
+	group := b.Default(Default)
+	group.Event(VoteExpired, "Undecided")
+	b.State("Undecided")
+
+	vote := NewVote("ban")
+	vote.Timeout = 10 * time.Millisecond
+	require.NoError(t, vote.Register(b, Default))
+
+	// the expired action runs in the background
+	// while the machine keeps handling updates
+	chat := &Chat{ID: -1, Type: ChatSuperGroup}
+	m := b.machines.obtain(b.scope(Update{Message: &Message{Sender: &User{ID: 1}, Chat: chat}}), &User{ID: 1})
+	require.NoError(t, m.SendEvent(vote.Event(), "Ban?"))
+	for i := 0; i < 50 && m.Current() != "Undecided"; i++ {
+		b.ProcessUpdate(Update{Message: &Message{Sender: &User{ID: 2}, Chat: chat, Text: "hi"}})
+		time.Sleep(time.Millisecond)
+	}
+	assert.Eventually(t, func() bool {
+		return m.Current() == "Undecided"
+	}, time.Second, 5*time.Millisecond)
+	b.inflight.Wait()
+	assert.Equal(t, []StateType{Default, "ban", "ban/expired"}, m.History())
+}
@@ -0,0 +1,124 @@
+package stb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBadWebAppData is returned by ValidateWebAppData when the
+// init data is malformed, its signature does not match or it is too old.
+var ErrBadWebAppData = errors.New("stb: invalid web app init data")
+
+// WebAppInfo describes a Web App to be opened by a button.
+type WebAppInfo struct {
+	// An HTTPS URL of a Web App to be opened.
+	URL string `json:"url"`
+}
+
+// WebAppData object represents data sent from a Web App to the bot.
+type WebAppData struct {
+	// The data. Be aware that a bad client can send arbitrary data.
+	Data string `json:"data"`
+
+	// Text of the reply keyboard button the Web App was opened with.
+	Text string `json:"button_text"`
+}
+
+// WebAppMessage describes an inline message sent by a Web App
+// on behalf of a user.
+type WebAppMessage struct {
+	// Identifier of the sent inline message, if any.
+	InlineMessageID string `json:"inline_message_id"`
+}
+
+// ValidateWebAppData checks the signature of the init data a Web App
+// received from Telegram (window.Telegram.WebApp.initData) and returns
+// its decoded fields.
+//
+// If maxAge is positive, init data with an auth_date older
+// than maxAge is rejected as well.
+func ValidateWebAppData(token, initData string, maxAge time.Duration) (url.Values, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, ErrBadWebAppData
+	}
+
+	hash := values.Get("hash")
+	if hash == "" {
+		return nil, ErrBadWebAppData
+	}
+
+	pairs := make([]string, 0, len(values))
+	for k, v := range values {
+		if k == "hash" {
+			continue
+		}
+		pairs = append(pairs, k+"="+v[0])
+	}
+	sort.Strings(pairs)
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(token))
+
+	sig := hmac.New(sha256.New, secret.Sum(nil))
+	sig.Write([]byte(strings.Join(pairs, "\n")))
+
+	expected, err := hex.DecodeString(hash)
+	if err != nil || !hmac.Equal(sig.Sum(nil), expected) {
+		return nil, ErrBadWebAppData
+	}
+
+	if maxAge > 0 {
+		unixtime, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+		if err != nil || time.Since(time.Unix(unixtime, 0)) > maxAge {
+			return nil, ErrBadWebAppData
+		}
+	}
+
+	return values, nil
+}
+
+// ValidateWebAppData checks the init data of a Web App
+// against the token of the bot, see ValidateWebAppData.
+func (b *Bot) ValidateWebAppData(initData string, maxAge time.Duration) (url.Values, error) {
+	return ValidateWebAppData(b.Token, initData, maxAge)
+}
+
+// AnswerWebAppQuery sets the result of an interaction with a Web App
+// and sends a corresponding message on behalf of the user to the chat
+// from which the query originated.
+func (b *Bot) AnswerWebAppQuery(queryID string, result Result) (*WebAppMessage, error) {
+	result.Process()
+	if result.ResultID() == "" {
+		result.SetResultID(queryID)
+	}
+	if err := inferIQR(result); err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{
+		"web_app_query_id": queryID,
+		"result":           result,
+	}
+
+	data, err := b.Raw("answerWebAppQuery", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Result *WebAppMessage
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, wrapError(err)
+	}
+	return resp.Result, nil
+}
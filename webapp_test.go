@@ -0,0 +1,113 @@
+package stb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signWebAppData(token string, authDate time.Time) string {
+	values := url.Values{}
+	values.Set("query_id", "AAH")
+	values.Set("user", `{"id":1,"first_name":"Ann"}`)
+	values.Set("auth_date", strconv.FormatInt(authDate.Unix(), 10))
+
+	dcs := "auth_date=" + values.Get("auth_date") +
+		"\nquery_id=" + values.Get("query_id") +
+		"\nuser=" + values.Get("user")
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(token))
+	sig := hmac.New(sha256.New, secret.Sum(nil))
+	sig.Write([]byte(dcs))
+
+	values.Set("hash", hex.EncodeToString(sig.Sum(nil)))
+	return values.Encode()
+}
+
+func TestValidateWebAppData(t *testing.T) {
+	const token = "123:secret"
+
+	data := signWebAppData(token, time.Now())
+	values, err := ValidateWebAppData(token, data, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "AAH", values.Get("query_id"))
+
+	_, err = ValidateWebAppData("123:other", data, 0)
+	assert.Equal(t, ErrBadWebAppData, err)
+
+	_, err = ValidateWebAppData(token, data+"&extra=1", 0)
+	assert.Equal(t, ErrBadWebAppData, err)
+
+	_, err = ValidateWebAppData(token, "query_id=AAH", 0)
+	assert.Equal(t, ErrBadWebAppData, err)
+
+	old := signWebAppData(token, time.Now().Add(-2*time.Hour))
+	_, err = ValidateWebAppData(token, old, time.Hour)
+	assert.Equal(t, ErrBadWebAppData, err)
+
+	_, err = ValidateWebAppData(token, old, 0)
+	assert.NoError(t, err)
+}
+
+func TestStateWebAppData(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+
+	var got string
+	b.Default(Default).Handle(OnWebAppData, func(msg *Message, _ *Machine) {
+		got = msg.WebAppData.Data
+	})
+
+	b.ProcessUpdate(Update{Message: &Message{
+		Sender:     &User{ID: 1},
+		WebAppData: &WebAppData{Data: "order:42", Text: "Shop"},
+	}})
+
+	assert.Equal(t, "order:42", got)
+}
+
+func TestAnswerWebAppQuery(t *testing.T) {
+	var params map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&params)
+		w.Write([]byte(`{"ok":true,"result":{"inline_message_id":"abc"}}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Synchronous: true, Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+
+	msg, err := b.AnswerWebAppQuery("AAH", &ArticleResult{Title: "Order", Text: "done"})
+	require.NoError(t, err)
+	assert.Equal(t, "abc", msg.InlineMessageID)
+	assert.Equal(t, `"AAH"`, string(params["web_app_query_id"]))
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(params["result"], &result))
+	assert.Equal(t, "article", result["type"])
+	assert.Equal(t, "AAH", result["id"])
+}
+
+func TestWebAppButton(t *testing.T) {
+	r := &ReplyMarkup{}
+	btn := r.WebApp("Open", &WebAppInfo{URL: "https://example.com"})
+
+	data, err := json.Marshal(btn.Inline())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text":"Open","web_app":{"url":"https://example.com"}}`, string(data))
+
+	data, err = json.Marshal(btn.Reply())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text":"Open","web_app":{"url":"https://example.com"}}`, string(data))
+}
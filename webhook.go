@@ -2,10 +2,15 @@ package stb
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+
+	"github.com/pkg/errors"
 )
 
 // A WebhookTLS specifies the path to a key and a cert so the poller can open
@@ -52,10 +57,26 @@ type Webhook struct {
 	IP          string `json:"ip_address"`
 	DropUpdates bool   `json:"drop_pending_updates"`
 
+	// SecretToken is sent by Telegram in the X-Telegram-Bot-Api-Secret-Token
+	// header of every request. Requests with a missing or different token
+	// are rejected.
+	SecretToken string `json:"-"`
+
+	// Path limits the handler to requests for this URL path.
+	// It is also appended to the URL registered with Telegram,
+	// unless an Endpoint is set.
+	Path string `json:"-"`
+
+	// Remove deletes the webhook once the bot is stopped, so that
+	// Telegram keeps the updates until the bot starts again, with
+	// a webhook or a LongPoller. The webhook is kept otherwise.
+	Remove bool `json:"-"`
+
 	TLS      *WebhookTLS
 	Endpoint *WebhookEndpoint
 
 	dest chan<- Update
+	stop chan struct{}
 	bot  *Bot
 }
 
@@ -97,15 +118,18 @@ func (h *Webhook) getParams() map[string]string {
 	if h.DropUpdates {
 		params["drop_pending_updates"] = strconv.FormatBool(h.DropUpdates)
 	}
+	if h.SecretToken != "" {
+		params["secret_token"] = h.SecretToken
+	}
 
 	if h.TLS != nil {
-		params["url"] = "https://" + h.Listen
+		params["url"] = "https://" + h.Listen + h.Path
 	} else {
 		// this will not work with telegram, they want TLS
 		// but i allow this because telegram will send an error
 		// when you register this hook. in their docs they write
 		// that port 80/http is allowed ...
-		params["url"] = "http://" + h.Listen
+		params["url"] = "http://" + h.Listen + h.Path
 	}
 	if h.Endpoint != nil {
 		params["url"] = h.Endpoint.PublicURL
@@ -115,15 +139,21 @@ func (h *Webhook) getParams() map[string]string {
 
 func (h *Webhook) Poll(b *Bot, dest chan Update, stop chan struct{}) {
 	if err := b.SetWebhook(h); err != nil {
-		b.debug(err)
-		close(stop)
+		b.pollFailed(err)
 		return
 	}
 
 	// store the variables so the HTTP-handler can use 'em
 	h.dest = dest
+	h.stop = stop
 	h.bot = b
 
+	b.configMu.Lock()
+	b.webhook = h
+	b.configMu.Unlock()
+
+	defer h.remove(b)
+
 	if h.Listen == "" {
 		h.waitForStop(stop)
 		return
@@ -139,28 +169,105 @@ func (h *Webhook) Poll(b *Bot, dest chan Update, stop chan struct{}) {
 		s.Shutdown(context.Background())
 	}(stop)
 
+	var err error
 	if h.TLS != nil {
-		s.ListenAndServeTLS(h.TLS.Cert, h.TLS.Key)
+		err = s.ListenAndServeTLS(h.TLS.Cert, h.TLS.Key)
 	} else {
-		s.ListenAndServe()
+		err = s.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		b.pollFailed(err)
 	}
 }
 
 func (h *Webhook) waitForStop(stop chan struct{}) {
 	<-stop
-	close(stop)
+}
+
+// remove deletes the webhook if it should not outlive the bot.
+func (h *Webhook) remove(b *Bot) {
+	if !h.Remove {
+		return
+	}
+	if err := b.RemoveWebhook(); err != nil {
+		b.debug(err)
+	}
 }
 
 // The handler simply reads the update from the body of the requests
 // and writes them to the update channel.
 func (h *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Path != "" && r.URL.Path != h.Path {
+		http.NotFound(w, r)
+		return
+	}
+
+	token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if h.SecretToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.SecretToken)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	var update Update
 	err := json.NewDecoder(r.Body).Decode(&update)
 	if err != nil {
 		h.bot.debug(fmt.Errorf("cannot decode update: %v", err))
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	h.dest <- update
+	update.forwarded = r.Header.Get(forwardedHeader) != ""
+
+	// forward right away, so that Telegram retries on failure
+	if shard := h.bot.foreign(update); shard >= 0 {
+		if err := h.bot.sharding.Forward(shard, update); err != nil {
+			h.bot.debug(errors.WithMessagef(err, "stb: forwarding update %d", update.ID))
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		return
+	}
+
+	select {
+	case h.dest <- update:
+	case <-h.stop:
+		// the bot is shutting down, let Telegram redeliver it later
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// StartWebhook is a shortcut for starting the bot with a Webhook
+// listening on addr and serving updates on path. The publicURL is
+// the URL Telegram sends the updates to, path included, e.g. the
+// one of the load balancer in front of the bot. A random secret
+// token is generated to authenticate the requests from Telegram.
+// The certificate of tls is not uploaded: for a self-signed one,
+// use a Webhook with an Endpoint instead.
+//
+// Like Start, it blocks until the bot is stopped. It returns the
+// error the webhook could not be set or served with, if any.
+//
+// Example:
+//
+//     err := b.StartWebhook("https://bot.example.com/hook", ":8443", "/hook", tls)
+//
+func (b *Bot) StartWebhook(publicURL, addr, path string, tls *WebhookTLS) error {
+	if publicURL == "" {
+		return errors.New("stb: webhook needs a public URL")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	b.Poller = &Webhook{
+		Listen:      addr,
+		Path:        path,
+		TLS:         tls,
+		SecretToken: hex.EncodeToString(secret),
+		Endpoint:    &WebhookEndpoint{PublicURL: publicURL},
+	}
+	b.Start()
+	return b.pollErr
 }
 
 // GetWebhook returns current webhook status.
@@ -180,9 +287,17 @@ func (b *Bot) GetWebhook() (*Webhook, error) {
 }
 
 // SetWebhook configures a bot to receive incoming
-// updates via an outgoing webhook.
+// updates via an outgoing webhook. With NarrowUpdates,
+// Bot.AllowedUpdates are asked for unless the webhook
+// has AllowedUpdates.
 func (b *Bot) SetWebhook(w *Webhook) error {
-	_, err := b.sendFiles("setWebhook", w.getFiles(), w.getParams())
+	params := w.getParams()
+	if len(w.AllowedUpdates) == 0 && b.narrow {
+		data, _ := json.Marshal(b.AllowedUpdates())
+		params["allowed_updates"] = string(data)
+	}
+
+	_, err := b.sendFiles("setWebhook", w.getFiles(), params)
 	return err
 }
 
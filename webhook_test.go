@@ -0,0 +1,90 @@
+package stb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookServeHTTP(t *testing.T) {
+	dest := make(chan Update, 1)
+	h := &Webhook{
+		Path:        "/hook",
+		SecretToken: "secret",
+		dest:        dest,
+		stop:        make(chan struct{}),
+		bot:         &Bot{},
+	}
+
+	serve := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"update_id":1}`))
+		if token != "" {
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve("/other", "secret"))
+	assert.Equal(t, http.StatusUnauthorized, serve("/hook", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve("/hook", "wrong"))
+	assert.Empty(t, dest)
+
+	assert.Equal(t, http.StatusOK, serve("/hook", "secret"))
+	assert.Equal(t, 1, (<-dest).ID)
+
+	params := h.getParams()
+	assert.Equal(t, "secret", params["secret_token"])
+	assert.Equal(t, "http:///hook", params["url"])
+}
+
+func TestWebhookRemove(t *testing.T) {
+	api := newFakeAPI(t, "true")
+
+	b, err := NewBot(Settings{Offline: true, URL: api.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Default(Default)
+	b.Poller = &Webhook{Remove: true}
+
+	go b.Start()
+	b.Stop()
+
+	assert.Equal(t, []string{"setWebhook", "deleteWebhook"}, api.Methods())
+}
+
+func TestWebhookFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: bad webhook"}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewBot(Settings{Offline: true, URL: srv.URL})
+	require.NoError(t, err)
+	b.Default(Default)
+	b.Poller = NewMiddlewarePoller(&Webhook{}, func(*Update) bool { return true })
+
+	done := make(chan struct{})
+	go func() {
+		b.Start()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return")
+	}
+	assert.Error(t, b.pollErr)
+
+	assert.Error(t, b.StartWebhook("", ":0", "/hook", nil))
+	err = b.StartWebhook("https://bot.example.com/hook", ":0", "/hook", nil)
+	assert.Contains(t, err.Error(), "bad webhook")
+}
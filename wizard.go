@@ -0,0 +1,176 @@
+package stb
+
+import "github.com/pkg/errors"
+
+// Answers are the answers a Wizard collected, keyed by step name.
+type Answers map[string]string
+
+// WizardStep is a question of a Wizard.
+type WizardStep struct {
+	// Name is the key of the answer and the suffix of the step state.
+	Name string
+
+	// Prompt asks the question, it is the action of the step state.
+	// The answers so far are returned by Wizard.Answers.
+	Prompt func(m *Machine)
+
+	// Validate rejects bad answers. Optional.
+	Validate func(answer string) error
+
+	// Invalid tells the user why the answer was rejected.
+	// Without it, the question is asked again.
+	Invalid func(m *Machine, err error)
+}
+
+// Wizard is a linear form: it asks its steps one after another,
+// collecting the text answers, then calls the done function.
+// Sending /cancel at any step leaves the wizard. The answers are
+// kept in the session of the machine, so a wizard interrupted by
+// a restart carries on where it stopped.
+//
+// Example:
+//
+//     signup := stb.NewWizard("signup").
+//         Step(stb.WizardStep{Name: "name", Prompt: askName}).
+//         Step(stb.WizardStep{Name: "age", Prompt: askAge, Validate: isNumber}).
+//         Done(func(m *stb.Machine, a stb.Answers) {
+//             b.Send(m.User(), "Welcome, "+a["name"])
+//         })
+//
+//     if err := signup.Register(b, stb.Default); err != nil {
+//         log.Fatal(err)
+//     }
+//
+//     b.Handle("/signup", func(_ *stb.Message, m *stb.Machine) error {
+//         return m.SendEvent(signup.Event())
+//     })
+//
+type Wizard struct {
+	name  string
+	steps []WizardStep
+	done  func(m *Machine, answers Answers)
+}
+
+// NewWizard creates an empty wizard. The name prefixes the
+// states and events the wizard generates.
+func NewWizard(name string) *Wizard {
+	return &Wizard{name: name}
+}
+
+// Step appends a step to the wizard.
+func (w *Wizard) Step(step WizardStep) *Wizard {
+	w.steps = append(w.steps, step)
+	return w
+}
+
+// Done sets the function called with the answers
+// once the last step is answered.
+func (w *Wizard) Done(done func(m *Machine, answers Answers)) *Wizard {
+	w.done = done
+	return w
+}
+
+// Event returns the global event starting the wizard.
+func (w *Wizard) Event() EventType {
+	return EventType(w.name)
+}
+
+// Answers returns the answers the machine gave so far.
+func (w *Wizard) Answers(m *Machine) Answers {
+	answers := Answers{}
+	m.Session().Get(w.key(), &answers)
+	return answers
+}
+
+// key is the session key of the answers.
+func (w *Wizard) key() string {
+	return "stb.wizard/" + w.name
+}
+
+// State returns the state of the step with the given name.
+func (w *Wizard) State(step string) StateType {
+	return StateType(w.name + "/" + step)
+}
+
+// Register creates the states of the wizard in the bot.
+// Both finishing and cancelling the wizard lead to exit.
+func (w *Wizard) Register(b *Bot, exit StateType) error {
+	if len(w.steps) == 0 {
+		return errors.Errorf("stb: wizard %q has no steps", w.name)
+	}
+
+	var (
+		next   = EventType(w.name + ":next")
+		cancel = EventType(w.name + ":cancel")
+	)
+
+	seen := make(map[string]bool)
+	for _, step := range w.steps {
+		if seen[step.Name] {
+			return errors.Errorf("stb: wizard %q has two %q steps", w.name, step.Name)
+		}
+		seen[step.Name] = true
+	}
+
+	b.Event(w.Event(), w.State(w.steps[0].Name))
+
+	for i, step := range w.steps {
+		i, step := i, step
+
+		s := b.State(w.State(step.Name))
+
+		last := i == len(w.steps)-1
+		if last {
+			s.Event(next, exit)
+		} else {
+			s.Event(next, w.State(w.steps[i+1].Name))
+		}
+		s.Event(cancel, exit)
+
+		switch {
+		case i == 0:
+			s.Action(func(m *Machine) {
+				m.Session().Delete(w.key())
+				if step.Prompt != nil {
+					step.Prompt(m)
+				}
+			})
+		case step.Prompt != nil:
+			s.Action(step.Prompt)
+		}
+
+		s.MustHandle("/cancel", func(_ *Message, m *Machine) error {
+			m.Session().Delete(w.key())
+			return m.SendEvent(cancel)
+		})
+
+		s.MustHandle(OnText, func(msg *Message, m *Machine) error {
+			if step.Validate != nil {
+				if err := step.Validate(msg.Text); err != nil {
+					switch {
+					case step.Invalid != nil:
+						step.Invalid(m, err)
+					case step.Prompt != nil:
+						step.Prompt(m)
+					}
+					return nil
+				}
+			}
+
+			answers := w.Answers(m)
+			answers[step.Name] = msg.Text
+
+			if last {
+				m.Session().Delete(w.key())
+				if w.done != nil {
+					w.done(m, answers)
+				}
+			} else if err := m.Session().Set(w.key(), answers); err != nil {
+				return err
+			}
+			return m.SendEvent(next, answers)
+		})
+	}
+
+	return nil
+}
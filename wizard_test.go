@@ -0,0 +1,91 @@
+package stb
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWizard(t *testing.T) {
+	b, err := NewBot(Settings{Synchronous: true, Offline: true})
+	require.NoError(t, err)
+	b.Default(Default)
+
+	var (
+		asked []string
+		got   Answers
+	)
+	ask := func(q string) func(*Machine) {
+		return func(*Machine) { asked = append(asked, q) }
+	}
+	isNumber := func(s string) error {
+		_, err := strconv.Atoi(s)
+		return err
+	}
+
+	signup := NewWizard("signup").
+		Step(WizardStep{Name: "name", Prompt: ask("name")}).
+		Step(WizardStep{Name: "age", Prompt: ask("age"), Validate: isNumber}).
+		Done(func(_ *Machine, a Answers) { got = a })
+	require.NoError(t, signup.Register(b, Default))
+
+	user := &User{ID: 1}
+	m := b.machine(user)
+	send := func(text string) {
+		b.ProcessUpdate(Update{Message: &Message{Text: text, Sender: user}})
+	}
+
+	require.NoError(t, m.SendEvent(signup.Event()))
+	assert.Equal(t, signup.State("name"), m.Current())
+	send("Bob")
+	send("old")
+	assert.Equal(t, signup.State("age"), m.Current())
+	send("42")
+
+	assert.Equal(t, []string{"name", "age", "age"}, asked)
+	assert.Equal(t, Answers{"name": "Bob", "age": "42"}, got)
+	assert.Equal(t, Default, m.Current())
+
+	got = nil
+	require.NoError(t, m.SendEvent(signup.Event()))
+	send("/cancel")
+	assert.Equal(t, Default, m.Current())
+	assert.Nil(t, got)
+	assert.Empty(t, m.Session().Keys())
+
+	twice := NewWizard("twice").
+		Step(WizardStep{Name: "a"}).
+		Step(WizardStep{Name: "a"})
+	assert.Error(t, twice.Register(b, Default))
+	assert.Error(t, NewWizard("empty").Register(b, Default))
+}
+
+func TestWizardRestart(t *testing.T) {
+	store := NewMemoryStore()
+
+	var got Answers
+	newBot := func() *Bot {
+		b, err := NewBot(Settings{Synchronous: true, Offline: true, Store: store})
+		require.NoError(t, err)
+		b.Default(Default)
+
+		signup := NewWizard("signup").
+			Step(WizardStep{Name: "name"}).
+			Step(WizardStep{Name: "age"}).
+			Done(func(_ *Machine, a Answers) { got = a })
+		require.NoError(t, signup.Register(b, Default))
+		return b
+	}
+
+	user := &User{ID: 1}
+	b := newBot()
+	require.NoError(t, b.machine(user).SendEvent("signup"))
+	b.ProcessUpdate(Update{Message: &Message{Text: "Bob", Sender: user}})
+
+	b = newBot()
+	b.ProcessUpdate(Update{Message: &Message{Text: "42", Sender: user}})
+	assert.Equal(t, Answers{"name": "Bob", "age": "42"}, got)
+	assert.Equal(t, Default, b.machine(user).Current())
+}